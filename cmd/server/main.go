@@ -1,50 +1,149 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
 	"github.com/fsnotify/fsnotify"
-	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1"             //nolint:staticcheck // Using standard genproto package
+	credentialspb "google.golang.org/genproto/googleapis/iam/credentials/v1" //nolint:staticcheck // Using standard genproto package
+	iampb "google.golang.org/genproto/googleapis/iam/v1"                     //nolint:staticcheck // Using standard genproto package
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/blackwell-systems/gcp-iam-emulator/internal/config"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/ratelimit"
 	"github.com/blackwell-systems/gcp-iam-emulator/internal/rest"
 	"github.com/blackwell-systems/gcp-iam-emulator/internal/server"
 	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/tracebuf"
 )
 
 var (
 	port              = flag.Int("port", 8080, "Port to listen on")
 	httpPort          = flag.Int("http-port", 0, "HTTP REST port (0 = disabled)")
-	configFile        = flag.String("config", "", "Path to policy config file (YAML)")
+	enableSnapshot    = flag.Bool("enable-snapshot", false, "Enable GET /debug/snapshot and POST /debug/restore on the REST server to dump and replace all emulator state")
+	allowAdmin        = flag.Bool("allow-admin", false, "Enable the REST admin endpoints: POST /debug/reset to discard all emulator state and GET /debug/groups to list a principal's groups")
+	dbPath            = flag.String("db", "", "BoltDB file to persist policies, groups, roles, projects and service accounts across restarts (empty = in-memory only)")
+	tlsCert           = flag.String("tls-cert", "", "PEM certificate file; with --tls-key, serves gRPC and HTTP REST over TLS")
+	tlsKey            = flag.String("tls-key", "", "PEM private key file for --tls-cert")
+	rateLimitQPS      = flag.Float64("rate-limit-qps", 0, "Maximum gRPC and REST API requests per second, shared; excess requests fail with RESOURCE_EXHAUSTED / HTTP 429 (0 = unlimited)")
+	faultRate         = flag.Float64("fault-rate", 0, "Fraction (0-1) of GetIamPolicy and TestIamPermissions gRPC calls to fail with UNAVAILABLE")
+	faultSeed         = flag.Int64("fault-seed", 0, "Seed for --fault-rate so injected failures are repeatable (0 = random)")
+	requireAuth       = flag.Bool("require-auth", false, "Reject gRPC calls without an x-emulator-api-key listed under apiKeys in the config with UNAUTHENTICATED")
+	corsOrigins       = flag.String("cors-origins", "", "Comma-separated browser origins allowed to call the REST API, or * for any (empty = CORS disabled)")
+	configFile        = flag.String("config", "", "Path to policy config file (YAML), or a directory whose *.yaml/*.json files are combined")
+	configOverridesDB = flag.Bool("config-overrides-db", false, "Load --config on startup even when the --db database already holds state, replacing everything the config defines")
+	overlayFiles      = flag.String("overlay", "", "Comma-separated config files merged onto --config in order (overlay wins on conflicts)")
 	watch             = flag.Bool("watch", false, "Watch config file for changes and hot reload")
 	trace             = flag.Bool("trace", false, "Enable trace mode (log authz decisions)")
 	explain           = flag.Bool("explain", false, "Enable verbose trace output (implies --trace)")
 	traceOutput       = flag.String("trace-output", "", "Output file for JSON trace logs (implies --trace)")
+	traceBufferSize   = flag.Int("trace-buffer-size", 0, "Keep the most recent N trace events in memory for GET /v1/trace/events (0 = disabled)")
+	traceQueueSize    = flag.Int("trace-queue-size", 4096, "Buffer up to N trace events for asynchronous writing; events beyond this are dropped (0 = write synchronously)")
+	traceMaxRate      = flag.Float64("trace-max-rate", 0, "Maximum trace events written per second when queued; excess events are dropped (0 = unlimited)")
+	instanceLabel     = flag.String("instance-label", "", "Label stamped onto emitted trace events as environment.cluster (default: hostname)")
 	allowUnknownRoles = flag.Bool("allow-unknown-roles", false, "Enable wildcard role matching (compat mode, less strict)")
+	keepOrphaned      = flag.Bool("keep-orphaned-bindings", false, "Keep a deleted service account's policy bindings, as GCP does, instead of removing its member")
+	overrideInherit   = flag.Bool("override-inheritance", false, "Use only the nearest policy in the resource hierarchy instead of the union of all ancestor policies")
+	matchDeleted      = flag.Bool("match-deleted-members", false, "Let deleted: binding members match the identity they name (for migration testing)")
+	maxMembers        = flag.Int("max-policy-members", storage.DefaultMaxPolicyMembers, "Reject SetIamPolicy when a policy has more unique members than this (0 = unlimited)")
+	maxBindings       = flag.Int("max-policy-bindings", storage.DefaultMaxPolicyBindings, "Reject SetIamPolicy when a policy has more bindings than this (0 = unlimited)")
+	normalizeMembers  = flag.Bool("normalize-members", false, "Lowercase the email portion of policy members on write")
+	attachmentPoints  = flag.String("attachment-points", "", "Comma-separated collections where policies can attach during inheritance (e.g. projects,secrets,keyRings,cryptoKeys); empty = every ancestor")
+	allowBadConds     = flag.Bool("allow-unsupported-conditions", false, "Accept conditions that cannot be evaluated at SetIamPolicy and apply --unsupported-condition-policy to them instead of failing checks (less strict)")
+	publicGrants      = flag.String("public-grant-policy", "warn", "Handling for policies granting owner/editor/admin roles to allUsers or allAuthenticatedUsers: warn or reject")
+	unsupportedConds  = flag.String("unsupported-condition-policy", "deny", "Handling for unsupported condition expressions: deny or allow (with --allow-unsupported-conditions), or error (reject at SetIamPolicy)")
 	version           = "0.4.0-dev"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		return
+	}
+
 	flag.Parse()
 
 	log.Printf("GCP IAM Emulator v%s", version)
 
 	enableTrace := *trace || *explain || *traceOutput != ""
+
+	shutdownTracing, tracingEnabled, err := setupTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up OpenTelemetry tracing: %v", err)
+	}
+	if tracingEnabled {
+		log.Printf("OpenTelemetry: ENABLED (exporting spans via OTLP)")
+	}
+
+	tlsConfig, err := loadTLSConfig(*tlsCert, *tlsKey)
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
 	
 	iamServer := server.NewServer()
 	iamServer.SetTrace(enableTrace)
 	iamServer.SetAllowUnknownRoles(*allowUnknownRoles)
+
+	condPolicy, err := storage.ParseUnsupportedConditionPolicy(*unsupportedConds)
+	if err != nil {
+		log.Fatalf("Invalid --unsupported-condition-policy: %v", err)
+	}
+	if err := checkConditionFlags(condPolicy, flagSet("unsupported-condition-policy"), *allowBadConds); err != nil {
+		log.Fatalf("Invalid --unsupported-condition-policy: %v", err)
+	}
+	iamServer.SetUnsupportedConditionPolicy(condPolicy)
+	iamServer.SetStrictConditions(!*allowBadConds)
+
+	grantPolicy, err := storage.ParsePublicGrantPolicy(*publicGrants)
+	if err != nil {
+		log.Fatalf("Invalid --public-grant-policy: %v", err)
+	}
+	iamServer.SetPublicGrantPolicy(grantPolicy)
+
+	iamServer.SetPolicyLimits(*maxMembers, *maxBindings)
+	iamServer.SetNormalizeMembers(*normalizeMembers)
+	iamServer.SetPurgeDeletedMembers(!*keepOrphaned)
+	iamServer.SetAdditiveInheritance(!*overrideInherit)
+	iamServer.SetMatchDeletedMembers(*matchDeleted)
+	iamServer.SetRequireAuth(*requireAuth)
+
+	if *faultRate < 0 || *faultRate > 1 {
+		log.Fatalf("Invalid --fault-rate: %g (must be between 0 and 1)", *faultRate)
+	}
+	iamServer.SetFaultInjection(*faultRate, *faultSeed)
+
+	if *attachmentPoints != "" {
+		iamServer.SetAttachmentPoints(strings.Split(*attachmentPoints, ","))
+		log.Printf("Attachment points: %s", *attachmentPoints)
+	}
 	
 	if *explain {
 		iamServer.SetExplain(true)
 	}
+
+	if *instanceLabel != "" {
+		iamServer.SetInstanceLabel(*instanceLabel)
+	}
+
+	eventBuffer := tracebuf.New(*traceBufferSize)
+	iamServer.SetEventBuffer(eventBuffer)
 	
 	if *traceOutput != "" {
 		if err := iamServer.SetTraceOutput(*traceOutput); err != nil {
@@ -52,14 +151,24 @@ func main() {
 		}
 	}
 
-	if *configFile != "" {
-		if err := loadConfig(*configFile, iamServer); err != nil {
-			log.Fatalf("Failed to load config: %v", err)
-		}
+	if *traceQueueSize > 0 {
+		iamServer.SetTraceQueue(*traceQueueSize, *traceMaxRate)
+	}
 
-		if *watch {
-			go watchConfig(*configFile, iamServer)
-		}
+	if *configFile == "" && *overlayFiles != "" {
+		log.Fatalf("--overlay requires --config")
+	}
+	var overlays []string
+	if *overlayFiles != "" {
+		overlays = strings.Split(*overlayFiles, ",")
+	}
+
+	backend, err := setupState(iamServer, *dbPath, *configFile, overlays, *configOverridesDB)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *configFile != "" && *watch {
+		go watchConfig(*configFile, overlays, iamServer)
 	}
 
 	if enableTrace {
@@ -70,19 +179,65 @@ func main() {
 		if *traceOutput != "" {
 			log.Printf("Trace output: %s (JSON format)", *traceOutput)
 		}
+
 	}
 	
+	if *traceBufferSize > 0 {
+		log.Printf("Trace buffer: last %d events available at GET /v1/trace/events", *traceBufferSize)
+	}
+
 	if *allowUnknownRoles {
 		log.Printf("Compat mode: ENABLED (wildcard role matching allowed - less strict)")
 	} else {
 		log.Printf("Strict mode: ENABLED (unknown roles denied - use --allow-unknown-roles for compat mode)")
 	}
 
+	if *allowBadConds {
+		log.Printf("Unsupported conditions: fall back to --unsupported-condition-policy (less strict)")
+	} else {
+		log.Printf("Unsupported conditions: rejected at SetIamPolicy, checks fail with FAILED_PRECONDITION (use --allow-unsupported-conditions to fall back)")
+	}
+
+	if condPolicy != storage.UnsupportedConditionDeny {
+		log.Printf("Unsupported condition policy: %s", condPolicy)
+	}
+
+	if *requireAuth {
+		log.Printf("Require auth: ENABLED (gRPC calls without a known x-emulator-api-key are rejected)")
+	}
+
+	if *faultRate > 0 {
+		log.Printf("Fault injection: %g of GetIamPolicy/TestIamPermissions calls fail with UNAVAILABLE", *faultRate)
+	}
+
+	// gRPC and REST draw from one bucket, like a single API quota
+	limiter := ratelimit.New(*rateLimitQPS)
+	if limiter != nil {
+		log.Printf("Rate limit: %g requests/second (excess requests get RESOURCE_EXHAUSTED)", *rateLimitQPS)
+	}
+
+	var restServer *rest.Server
+	var httpServer *http.Server
 	if *httpPort > 0 {
-		go startHTTPServer(*httpPort, iamServer.GetStorage(), *trace)
+		restServer = rest.NewServer(iamServer.GetStorage(), *trace)
+		restServer.SetEventBuffer(eventBuffer)
+		restServer.SetRateLimiter(limiter)
+		if *enableSnapshot {
+			restServer.SetSnapshotEnabled(true)
+			log.Printf("Snapshot endpoints: ENABLED (GET /debug/snapshot, POST /debug/restore)")
+		}
+		if *allowAdmin {
+			restServer.SetAdminEnabled(true)
+			log.Printf("Admin endpoints: ENABLED (POST /debug/reset, GET /debug/groups)")
+		}
+		if *corsOrigins != "" {
+			restServer.SetCORSOrigins(strings.Split(*corsOrigins, ","))
+			log.Printf("CORS: allowing origins %s", *corsOrigins)
+		}
+		httpServer = startHTTPServer(*httpPort, restServer, tlsConfig)
 	} else {
 		// Start minimal HTTP server for health checks on gRPC port + 1000
-		go startHealthServer(*port + 1000)
+		httpServer = startHealthServer(*port + 1000)
 	}
 
 	log.Printf("Starting gRPC server on port %d", *port)
@@ -93,22 +248,79 @@ func main() {
 		os.Exit(1)
 	}
 
-	grpcServer := grpc.NewServer()
-	iampb.RegisterIAMPolicyServer(grpcServer, iamServer) //nolint:staticcheck // Using standard genproto package
+	grpcOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			server.RateLimitInterceptor(limiter),
+			iamServer.APIKeyInterceptor(),
+		),
+	}
+	if tlsConfig != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		log.Printf("TLS: ENABLED (cert %s)", *tlsCert)
+	}
+
+	grpcServer := grpc.NewServer(grpcOpts...)
+	iampb.RegisterIAMPolicyServer(grpcServer, iamServer)                                                        //nolint:staticcheck // Using standard genproto package
+	adminpb.RegisterIAMServer(grpcServer, server.NewAdminServer(iamServer.GetStorage()))                        //nolint:staticcheck // Using standard genproto package
+	credentialspb.RegisterIAMCredentialsServer(grpcServer, server.NewCredentialsServer(iamServer.GetStorage())) //nolint:staticcheck // Using standard genproto package
+	resourcemanagerpb.RegisterProjectsServer(grpcServer, server.NewProjectsServer(iamServer.GetStorage()))
 	reflection.Register(grpcServer)
 
 	log.Printf("Server listening at %s", lis.Addr())
+	if restServer != nil {
+		// Config loading above is synchronous, so once the gRPC listener is
+		// up the emulator is ready to serve
+		restServer.SetReady(true)
+	}
 	log.Println("Ready to accept connections")
 
-	if err := grpcServer.Serve(lis); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = serve(ctx, grpcServer, lis, []*http.Server{httpServer}, iamServer)
+	if backend != nil {
+		if closeErr := backend.Close(); closeErr != nil {
+			log.Printf("Failed to close database: %v", closeErr)
+		}
+	}
+
+	// Flush spans still queued in the batcher
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if flushErr := shutdownTracing(flushCtx); flushErr != nil {
+		log.Printf("Failed to flush OpenTelemetry spans: %v", flushErr)
+	}
+	cancel()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to serve: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func startHTTPServer(port int, store *storage.Storage, trace bool) {
-	restServer := rest.NewServer(store, trace)
-	
+// flagSet reports whether the named flag was passed on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// checkConditionFlags rejects an explicit --unsupported-condition-policy of
+// deny or allow in strict mode, where unsupported conditions are rejected at
+// SetIamPolicy and fail checks, so the fallback would never apply.
+func checkConditionFlags(policy storage.UnsupportedConditionPolicy, policySet, allowUnsupported bool) error {
+	if !policySet || allowUnsupported || policy == storage.UnsupportedConditionError {
+		return nil
+	}
+	return fmt.Errorf("%s only applies with --allow-unsupported-conditions; strict mode rejects unsupported conditions instead", policy)
+}
+
+// startHTTPServer serves the REST API on port in the background and returns
+// the server so it can be shut down.
+func startHTTPServer(port int, restServer *rest.Server, tlsConfig *tls.Config) *http.Server {
 	mux := http.NewServeMux()
 	restServer.RegisterHandlers(mux)
 	
@@ -122,16 +334,30 @@ func startHTTPServer(port int, store *storage.Storage, trace bool) {
 	log.Printf("Starting HTTP REST server on port %d", port)
 	
 	httpServer := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 	
-	if err := httpServer.ListenAndServe(); err != nil {
-		log.Printf("HTTP server error: %v", err)
-	}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// The certificate is already in TLSConfig
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	return httpServer
 }
 
-func startHealthServer(port int) {
+// startHealthServer serves /health on port in the background and returns the
+// server so it can be shut down.
+func startHealthServer(port int) *http.Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -146,44 +372,159 @@ func startHealthServer(port int) {
 		Handler: mux,
 	}
 	
-	if err := httpServer.ListenAndServe(); err != nil {
-		log.Printf("Health server error: %v", err)
-	}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Health server error: %v", err)
+		}
+	}()
+
+	return httpServer
 }
 
-func loadConfig(path string, iamServer *server.Server) error {
+func loadConfig(path string, overlays []string, iamServer *server.Server) error {
 	log.Printf("Loading policy config from %s", path)
-	cfg, err := config.LoadFromFile(path)
+	for _, overlay := range overlays {
+		log.Printf("Applying config overlay %s", overlay)
+	}
+
+	cfg, err := config.LoadWithOverlays(path, overlays)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	var isBuiltInRole func(string) bool
+	if !*allowUnknownRoles {
+		isBuiltInRole = storage.IsBuiltInRole
+	}
+	if err := cfg.Validate(isBuiltInRole); err != nil {
+		return err
+	}
+
 	policies := cfg.ToPolicies()
-	iamServer.LoadPolicies(policies)
-	log.Printf("Loaded %d policies from config", len(policies))
-	
-	if len(cfg.Groups) > 0 {
-		groups := make(map[string][]string)
-		for groupName, groupCfg := range cfg.Groups {
-			groups[groupName] = groupCfg.Members
+
+	groups := make(map[string][]string)
+	for groupName, groupCfg := range cfg.Groups {
+		groups[groupName] = groupCfg.Members
+	}
+
+	roles := make(map[string]*storage.Role)
+	for roleName, roleCfg := range cfg.ToCustomRoles() {
+		stage := roleCfg.Stage
+		if stage == "" {
+			stage = "GA"
+		}
+		roles[roleName] = &storage.Role{
+			Name:                roleName,
+			Title:               roleCfg.Title,
+			Description:         roleCfg.Description,
+			IncludedPermissions: roleCfg.Permissions,
+			Stage:               stage,
 		}
-		iamServer.LoadGroups(groups)
-		log.Printf("Loaded %d groups from config", len(groups))
 	}
-	
-	if len(cfg.Roles) > 0 {
-		roles := make(map[string][]string)
-		for roleName, roleCfg := range cfg.Roles {
-			roles[roleName] = roleCfg.Permissions
+
+	denyPolicies := make(map[string][]storage.DenyRule)
+	for resource, rules := range cfg.ToDenyPolicies() {
+		for _, rule := range rules {
+			denyPolicies[resource] = append(denyPolicies[resource], storage.DenyRule{
+				DeniedPrincipals:    rule.DeniedPrincipals,
+				DeniedPermissions:   rule.DeniedPermissions,
+				ExceptionPrincipals: rule.ExceptionPrincipals,
+				DenialCondition:     rule.DenialCondition.ToProto(),
+				DenialReason:        rule.DenialReason,
+			})
+		}
+	}
+
+	parents := cfg.ToResourceParents()
+	labels := cfg.ToResourceLabels()
+
+	// Swap everything the config defines in together, so a rejected reload
+	// leaves the previous config fully in place and a reload drops what was
+	// removed from the file
+	err = iamServer.ReplaceAll(&storage.State{
+		Policies:        policies,
+		DenyPolicies:    denyPolicies,
+		Groups:          groups,
+		CustomRoles:     roles,
+		ResourceParents: parents,
+		ResourceLabels:  labels,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d policies, %d groups and %d custom roles from config", len(policies), len(groups), len(roles))
+	if len(parents) > 0 {
+		log.Printf("Loaded %d resource hierarchy parents from config", len(parents))
+	}
+	if len(labels) > 0 {
+		log.Printf("Loaded labels for %d resources from config", len(labels))
+	}
+	if len(denyPolicies) > 0 {
+		log.Printf("Loaded deny policies for %d resources from config", len(denyPolicies))
+	}
+
+	// Always replace the keys so a reload can revoke them
+	iamServer.LoadAPIKeys(cfg.APIKeys)
+	if len(cfg.APIKeys) > 0 {
+		log.Printf("Loaded %d API keys from config", len(cfg.APIKeys))
+	}
+
+	if accountConfigs := cfg.ToServiceAccounts(); len(accountConfigs) > 0 {
+		var specs []storage.ServiceAccountSpec
+		for projectID, accounts := range accountConfigs {
+			for _, account := range accounts {
+				specs = append(specs, storage.ServiceAccountSpec{
+					ProjectID:   projectID,
+					AccountID:   account.AccountID,
+					DisplayName: account.DisplayName,
+					Description: account.Description,
+				})
+			}
 		}
-		iamServer.LoadCustomRoles(roles)
-		log.Printf("Loaded %d custom roles from config", len(roles))
+		iamServer.LoadServiceAccounts(specs)
+		log.Printf("Loaded %d service accounts from config", len(specs))
 	}
 	
 	return nil
 }
 
-func watchConfig(path string, iamServer *server.Server) {
+// setupState opens the --db database, if any, and loads the --config file.
+// A database that already holds state wins over the config: the config only
+// seeds an empty database, unless overrideDB is set, so state written through
+// the API survives restarts. Without a database the config always loads.
+func setupState(iamServer *server.Server, dbPath, configFile string, overlays []string, overrideDB bool) (*storage.BoltBackend, error) {
+	var backend *storage.BoltBackend
+	if dbPath != "" {
+		var err error
+		backend, err = storage.OpenBoltBackend(dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		if err := iamServer.GetStorage().SetBackend(backend); err != nil {
+			_ = backend.Close()
+			return nil, fmt.Errorf("failed to load database: %w", err)
+		}
+		log.Printf("Persistent storage: %s", dbPath)
+	}
+
+	if configFile == "" {
+		return backend, nil
+	}
+	if backend != nil && !overrideDB && !iamServer.GetStorage().IsEmpty() {
+		log.Printf("Database %s already holds state; not loading %s (use --config-overrides-db to replace it)", dbPath, configFile)
+		return backend, nil
+	}
+
+	if err := loadConfig(configFile, overlays, iamServer); err != nil {
+		if backend != nil {
+			_ = backend.Close()
+		}
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return backend, nil
+}
+
+func watchConfig(path string, overlays []string, iamServer *server.Server) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Printf("Failed to create file watcher: %v", err)
@@ -191,13 +532,14 @@ func watchConfig(path string, iamServer *server.Server) {
 	}
 	defer watcher.Close()
 
-	if err := watcher.Add(path); err != nil {
-		log.Printf("Failed to watch config file: %v", err)
-		return
+	for _, watched := range append([]string{path}, overlays...) {
+		if err := watcher.Add(watched); err != nil {
+			log.Printf("Failed to watch config file: %v", err)
+			return
+		}
+		log.Printf("Watching config file for changes: %s", watched)
 	}
 
-	log.Printf("Watching config file for changes: %s", path)
-
 	for {
 		select {
 		case event, ok := <-watcher.Events:
@@ -207,7 +549,7 @@ func watchConfig(path string, iamServer *server.Server) {
 
 			if event.Op&fsnotify.Write == fsnotify.Write {
 				log.Printf("Config file changed, reloading policies...")
-				if err := loadConfig(path, iamServer); err != nil {
+				if err := loadConfig(path, overlays, iamServer); err != nil {
 					log.Printf("Failed to reload config: %v", err)
 				} else {
 					log.Printf("Policies reloaded successfully")
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/server"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+const seedConfig = `projects:
+  test-project:
+    bindings:
+      - role: roles/viewer
+        members:
+          - user:alice@example.com
+`
+
+// restart starts a fresh emulator on dbPath and configPath, as the server
+// does on startup, and returns its bindings for projects/test-project.
+func restart(t *testing.T, dbPath, configPath string, overrideDB bool) []*iampb.Binding {
+	t.Helper()
+
+	iamServer := server.NewServer()
+	backend, err := setupState(iamServer, dbPath, configPath, nil, overrideDB)
+	if err != nil {
+		t.Fatalf("setupState failed: %v", err)
+	}
+	defer backend.Close()
+
+	policy, err := iamServer.GetStorage().GetIamPolicy("projects/test-project")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	return policy.Bindings
+}
+
+func TestSetupState_DatabaseWinsOverConfig(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "iam.db")
+	configPath := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(configPath, []byte(seedConfig), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// The first start seeds the empty database from the config, then a write
+	// through the API changes the persisted policy
+	iamServer := server.NewServer()
+	backend, err := setupState(iamServer, dbPath, configPath, nil, false)
+	if err != nil {
+		t.Fatalf("setupState failed: %v", err)
+	}
+	_, err = iamServer.GetStorage().SetIamPolicy("projects/test-project", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/editor", Members: []string{"user:bob@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	backend.Close()
+
+	bindings := restart(t, dbPath, configPath, false)
+	if len(bindings) != 1 || bindings[0].Role != "roles/editor" {
+		t.Errorf("Expected the persisted policy to survive a restart with --config, got %v", bindings)
+	}
+
+	bindings = restart(t, dbPath, configPath, true)
+	if len(bindings) != 1 || bindings[0].Role != "roles/viewer" {
+		t.Errorf("Expected --config-overrides-db to reload the config policy, got %v", bindings)
+	}
+}
+
+func TestSetupState_ConfigWithoutDatabase(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(configPath, []byte(seedConfig), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	iamServer := server.NewServer()
+	if _, err := setupState(iamServer, "", configPath, nil, false); err != nil {
+		t.Fatalf("setupState failed: %v", err)
+	}
+
+	policy, err := iamServer.GetStorage().GetIamPolicy("projects/test-project")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 || policy.Bindings[0].Role != "roles/viewer" {
+		t.Errorf("Expected the config policy, got %v", policy.Bindings)
+	}
+}
+
+func TestCheckConditionFlags(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           storage.UnsupportedConditionPolicy
+		policySet        bool
+		allowUnsupported bool
+		wantErr          bool
+	}{
+		{name: "defaults", policy: storage.UnsupportedConditionDeny},
+		{name: "allow in strict mode", policy: storage.UnsupportedConditionAllow, policySet: true, wantErr: true},
+		{name: "deny in strict mode", policy: storage.UnsupportedConditionDeny, policySet: true, wantErr: true},
+		{name: "error in strict mode", policy: storage.UnsupportedConditionError, policySet: true},
+		{name: "allow with fallback", policy: storage.UnsupportedConditionAllow, policySet: true, allowUnsupported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConditionFlags(tt.policy, tt.policySet, tt.allowUnsupported)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/replay"
+)
+
+// runReplay implements `gcp-iam-emulator replay [--top N] <trace.jsonl>`,
+// printing aggregate allow/deny statistics for a captured trace.
+func runReplay(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	top := fs.Int("top", 10, "Number of entries to show per table (0 = all)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gcp-iam-emulator replay [--top N] <trace.jsonl>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one trace file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open trace file: %w", err)
+	}
+	defer f.Close()
+
+	stats, err := replay.Read(f)
+	if err != nil {
+		return fmt.Errorf("failed to replay %s: %w", fs.Arg(0), err)
+	}
+
+	stats.Print(stdout, *top)
+	return nil
+}
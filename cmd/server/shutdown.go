@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/server"
+)
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to finish
+// once shutdown begins.
+const shutdownTimeout = 10 * time.Second
+
+// serve runs grpcServer on lis until ctx is cancelled (e.g. by SIGINT or
+// SIGTERM) or serving fails. On the way out it lets in-flight RPCs finish,
+// shuts down httpServers, and flushes and closes iamServer's trace output.
+// Nil entries in httpServers are skipped.
+func serve(ctx context.Context, grpcServer *grpc.Server, lis net.Listener, httpServers []*http.Server, iamServer *server.Server) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- grpcServer.Serve(lis)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down...")
+		grpcServer.GracefulStop()
+		<-serveErr
+	case err = <-serveErr:
+		if err != nil {
+			err = fmt.Errorf("gRPC server: %w", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, httpServer := range httpServers {
+		if httpServer == nil {
+			continue
+		}
+		if shutdownErr := httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+			err = errors.Join(err, fmt.Errorf("HTTP server: %w", shutdownErr))
+		}
+	}
+
+	if closeErr := iamServer.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("trace output: %w", closeErr))
+	}
+
+	if err == nil {
+		log.Println("Shutdown complete")
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	authztrace "github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/grpc"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/server"
+)
+
+func TestServe_ShutdownDrainsAndCloses(t *testing.T) {
+	t.Setenv(authztrace.EnvTraceOutput, "")
+
+	tracePath := filepath.Join(t.TempDir(), "trace.jsonl")
+	iamServer := server.NewServer()
+	if err := iamServer.SetTraceOutput(tracePath); err != nil {
+		t.Fatalf("SetTraceOutput failed: %v", err)
+	}
+	iamServer.SetTraceQueue(16, 0)
+
+	grpcServer := grpc.NewServer()
+	iampb.RegisterIAMPolicyServer(grpcServer, iamServer) //nolint:staticcheck // Using standard genproto package
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	httpServer := &http.Server{Handler: http.NewServeMux()}
+	go func() { _ = httpServer.Serve(httpLis) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, grpcServer, lis, []*http.Server{httpServer, nil}, iamServer)
+	}()
+
+	if _, err := iamServer.TestIamPermissions(context.Background(), &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test",
+		Permissions: []string{"resourcemanager.projects.get"},
+	}); err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve returned an error on shutdown: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after shutdown")
+	}
+
+	if _, err := net.DialTimeout("tcp", lis.Addr().String(), time.Second); err == nil {
+		t.Error("Expected the gRPC listener to be closed")
+	}
+	if _, err := net.DialTimeout("tcp", httpLis.Addr().String(), time.Second); err == nil {
+		t.Error("Expected the HTTP listener to be closed")
+	}
+
+	f, err := os.Open(tracePath)
+	if err != nil {
+		t.Fatalf("Failed to open trace file: %v", err)
+	}
+	defer f.Close()
+
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		found = found || len(scanner.Bytes()) > 0
+	}
+	if !found {
+		t.Error("Expected the queued trace event to be flushed on shutdown")
+	}
+}
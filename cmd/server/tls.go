@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// loadTLSConfig returns the server TLS config for --tls-cert and --tls-key,
+// shared by the gRPC and HTTP servers. It returns nil when neither is set,
+// and an error when only one is set or the key pair cannot be loaded.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be set together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair (cert %s, key %s): %w", certFile, keyFile, err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
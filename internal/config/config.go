@@ -3,16 +3,30 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
-	expr "google.golang.org/genproto/googleapis/type/expr"
 	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package
+	expr "google.golang.org/genproto/googleapis/type/expr"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Projects map[string]ProjectConfig `yaml:"projects"`
-	Groups   map[string]GroupConfig   `yaml:"groups,omitempty"`
-	Roles    map[string]RoleConfig    `yaml:"roles,omitempty"`
+	Projects      map[string]ProjectConfig `yaml:"projects"`
+	Folders       map[string]NodeConfig    `yaml:"folders,omitempty"`
+	Organizations map[string]NodeConfig    `yaml:"organizations,omitempty"`
+	Groups        map[string]GroupConfig   `yaml:"groups,omitempty"`
+	Roles         map[string]RoleConfig    `yaml:"roles,omitempty"`
+	// APIKeys maps x-emulator-api-key values to the principal each
+	// authenticates as (e.g. user:alice@example.com)
+	APIKeys map[string]string `yaml:"apiKeys,omitempty"`
+}
+
+// NodeConfig is a folder or organization in the resource hierarchy. Parent is
+// the full name of the enclosing folder or organization (e.g. folders/123 or
+// organizations/456).
+type NodeConfig struct {
+	Parent   string          `yaml:"parent,omitempty"`
+	Bindings []BindingConfig `yaml:"bindings"`
 }
 
 type GroupConfig struct {
@@ -20,34 +34,71 @@ type GroupConfig struct {
 }
 
 type RoleConfig struct {
+	Title       string   `yaml:"title,omitempty"`
+	Description string   `yaml:"description,omitempty"`
 	Permissions []string `yaml:"permissions"`
+	// Stage is the role's launch stage (ALPHA, BETA, GA, DEPRECATED,
+	// DISABLED or EAP); empty means GA. A DISABLED role grants nothing.
+	Stage string `yaml:"stage,omitempty"`
 }
 
 type ProjectConfig struct {
-	Bindings     []BindingConfig            `yaml:"bindings"`
-	AuditConfigs []AuditConfigYAML          `yaml:"auditConfigs,omitempty"`
-	Resources    map[string]ResourceConfig  `yaml:"resources,omitempty"`
+	// Parent is the full name of the folder or organization containing the
+	// project, e.g. folders/123.
+	Parent       string                    `yaml:"parent,omitempty"`
+	Bindings     []BindingConfig           `yaml:"bindings"`
+	AuditConfigs []AuditConfigYAML         `yaml:"auditConfigs,omitempty"`
+	Resources    map[string]ResourceConfig `yaml:"resources,omitempty"`
+	DenyPolicies []DenyRuleConfig          `yaml:"denyPolicies,omitempty"`
+	// ServiceAccounts are created in the project at load time.
+	ServiceAccounts []ServiceAccountConfig `yaml:"serviceAccounts,omitempty"`
+	// Roles are project-level custom roles keyed by role ID; bindings refer
+	// to them as projects/{project}/roles/{roleId}.
+	Roles map[string]RoleConfig `yaml:"roles,omitempty"`
+	// Labels are read by resource.labels["key"] conditions.
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// ServiceAccountConfig is a service account to pre-seed. Its email is
+// {accountId}@{project}.iam.gserviceaccount.com.
+type ServiceAccountConfig struct {
+	AccountID   string `yaml:"accountId"`
+	DisplayName string `yaml:"displayName,omitempty"`
+	Description string `yaml:"description,omitempty"`
 }
 
 type ResourceConfig struct {
 	Bindings     []BindingConfig   `yaml:"bindings"`
 	AuditConfigs []AuditConfigYAML `yaml:"auditConfigs,omitempty"`
+	DenyPolicies []DenyRuleConfig  `yaml:"denyPolicies,omitempty"`
+	Labels       map[string]string `yaml:"labels,omitempty"`
+}
+
+type DenyRuleConfig struct {
+	DeniedPrincipals    []string       `yaml:"deniedPrincipals"`
+	DeniedPermissions   []string       `yaml:"deniedPermissions"`
+	ExceptionPrincipals []string       `yaml:"exceptionPrincipals,omitempty"`
+	DenialCondition     *ConditionYAML `yaml:"denialCondition,omitempty"`
+	DenialReason        string         `yaml:"denialReason,omitempty"`
 }
 
 type BindingConfig struct {
-	Role      string          `yaml:"role"`
-	Members   []string        `yaml:"members"`
-	Condition *ConditionYAML  `yaml:"condition,omitempty"`
+	Role      string         `yaml:"role"`
+	Members   []string       `yaml:"members"`
+	Condition *ConditionYAML `yaml:"condition,omitempty"`
 }
 
 type ConditionYAML struct {
 	Expression  string `yaml:"expression"`
 	Title       string `yaml:"title,omitempty"`
 	Description string `yaml:"description,omitempty"`
+	// Timezone is recorded in the condition title as a "tz=<zone>" token and
+	// used by getHours/getDayOfWeek calls that omit a zone argument.
+	Timezone string `yaml:"timezone,omitempty"`
 }
 
 type AuditConfigYAML struct {
-	Service         string              `yaml:"service"`
+	Service         string               `yaml:"service"`
 	AuditLogConfigs []AuditLogConfigYAML `yaml:"auditLogConfigs"`
 }
 
@@ -56,12 +107,19 @@ type AuditLogConfigYAML struct {
 	ExemptedMembers []string `yaml:"exemptedMembers,omitempty"`
 }
 
+// LoadFromFile reads the config at path, expanding ${VAR} and
+// ${VAR:-default} environment references before parsing.
 func LoadFromFile(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	data, err = expandEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand config: %w", err)
+	}
+
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
@@ -98,9 +156,136 @@ func (c *Config) ToPolicies() map[string]*iampb.Policy { //nolint:staticcheck //
 		}
 	}
 
+	for _, node := range c.hierarchyNodes() {
+		if len(node.config.Bindings) == 0 {
+			continue
+		}
+		policy := &iampb.Policy{ //nolint:staticcheck // Using standard genproto package
+			Bindings: bindingsToProto(node.config.Bindings),
+		}
+		policy.Version = determineVersion(policy)
+		policies[node.resource] = policy
+	}
+
 	return policies
 }
 
+// ToResourceParents returns the configured hierarchy as child -> parent full
+// resource names, e.g. projects/p -> folders/123 -> organizations/456.
+func (c *Config) ToResourceParents() map[string]string {
+	parents := make(map[string]string)
+
+	for projectID, projectCfg := range c.Projects {
+		if projectCfg.Parent != "" {
+			parents[fmt.Sprintf("projects/%s", projectID)] = projectCfg.Parent
+		}
+	}
+
+	for _, node := range c.hierarchyNodes() {
+		if node.config.Parent != "" {
+			parents[node.resource] = node.config.Parent
+		}
+	}
+
+	return parents
+}
+
+// ToResourceLabels returns the configured project and resource labels keyed by
+// full resource name.
+func (c *Config) ToResourceLabels() map[string]map[string]string {
+	labels := make(map[string]map[string]string)
+
+	for projectID, projectCfg := range c.Projects {
+		projectResource := fmt.Sprintf("projects/%s", projectID)
+
+		if len(projectCfg.Labels) > 0 {
+			labels[projectResource] = projectCfg.Labels
+		}
+
+		for resourcePath, resourceCfg := range projectCfg.Resources {
+			if len(resourceCfg.Labels) > 0 {
+				labels[fmt.Sprintf("%s/%s", projectResource, resourcePath)] = resourceCfg.Labels
+			}
+		}
+	}
+
+	return labels
+}
+
+type hierarchyNode struct {
+	resource string
+	config   NodeConfig
+}
+
+func (c *Config) hierarchyNodes() []hierarchyNode {
+	var nodes []hierarchyNode
+	for folderID, folderCfg := range c.Folders {
+		nodes = append(nodes, hierarchyNode{resource: fmt.Sprintf("folders/%s", folderID), config: folderCfg})
+	}
+	for orgID, orgCfg := range c.Organizations {
+		nodes = append(nodes, hierarchyNode{resource: fmt.Sprintf("organizations/%s", orgID), config: orgCfg})
+	}
+	return nodes
+}
+
+// ToDenyPolicies returns the configured deny rules keyed by full resource name.
+func (c *Config) ToDenyPolicies() map[string][]DenyRuleConfig {
+	denyPolicies := make(map[string][]DenyRuleConfig)
+
+	for projectID, projectCfg := range c.Projects {
+		projectResource := fmt.Sprintf("projects/%s", projectID)
+
+		if len(projectCfg.DenyPolicies) > 0 {
+			denyPolicies[projectResource] = projectCfg.DenyPolicies
+		}
+
+		for resourcePath, resourceCfg := range projectCfg.Resources {
+			if len(resourceCfg.DenyPolicies) > 0 {
+				denyPolicies[fmt.Sprintf("%s/%s", projectResource, resourcePath)] = resourceCfg.DenyPolicies
+			}
+		}
+	}
+
+	return denyPolicies
+}
+
+// ToServiceAccounts returns the configured service accounts keyed by project
+// id.
+func (c *Config) ToServiceAccounts() map[string][]ServiceAccountConfig {
+	accounts := make(map[string][]ServiceAccountConfig)
+
+	for projectID, projectCfg := range c.Projects {
+		if len(projectCfg.ServiceAccounts) > 0 {
+			accounts[projectID] = projectCfg.ServiceAccounts
+		}
+	}
+
+	return accounts
+}
+
+// ToCustomRoles returns every custom role keyed by full role name: top-level
+// roles under the name they are declared with, and project roles as
+// projects/{project}/roles/{roleId}.
+func (c *Config) ToCustomRoles() map[string]RoleConfig {
+	roles := make(map[string]RoleConfig, len(c.Roles))
+
+	for roleName, roleCfg := range c.Roles {
+		roles[roleName] = roleCfg
+	}
+
+	for projectID, projectCfg := range c.Projects {
+		for roleID, roleCfg := range projectCfg.Roles {
+			roles[projectRoleName(projectID, roleID)] = roleCfg
+		}
+	}
+
+	return roles
+}
+
+func projectRoleName(projectID, roleID string) string {
+	return fmt.Sprintf("projects/%s/roles/%s", projectID, roleID)
+}
+
 func determineVersion(policy *iampb.Policy) int32 { //nolint:staticcheck // Using standard genproto package
 	for _, binding := range policy.Bindings {
 		if binding.Condition != nil {
@@ -118,19 +303,33 @@ func bindingsToProto(bindings []BindingConfig) []*iampb.Binding { //nolint:stati
 			Members: b.Members,
 		}
 		
-		if b.Condition != nil {
-			binding.Condition = &expr.Expr{
-				Expression:  b.Condition.Expression,
-				Title:       b.Condition.Title,
-				Description: b.Condition.Description,
-			}
-		}
+		binding.Condition = b.Condition.ToProto()
 		
 		result[i] = binding
 	}
 	return result
 }
 
+// ToProto converts the condition to a CEL expression, recording Timezone in
+// the title. A nil condition converts to nil.
+func (cond *ConditionYAML) ToProto() *expr.Expr {
+	if cond == nil {
+		return nil
+	}
+	return &expr.Expr{
+		Expression:  cond.Expression,
+		Title:       conditionTitle(cond),
+		Description: cond.Description,
+	}
+}
+
+func conditionTitle(cond *ConditionYAML) string {
+	if cond.Timezone == "" || strings.Contains(cond.Title, "tz=") {
+		return cond.Title
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s tz=%s", cond.Title, cond.Timezone))
+}
+
 func auditConfigsToProto(configs []AuditConfigYAML) []*iampb.AuditConfig { //nolint:staticcheck // Using standard genproto package
 	if len(configs) == 0 {
 		return nil
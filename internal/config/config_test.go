@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"testing"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
 )
 
 func TestLoadFromFile(t *testing.T) {
@@ -116,3 +118,376 @@ func TestToPolicies(t *testing.T) {
 		t.Errorf("Expected roles/secretmanager.secretAccessor, got %s", secretPolicy.Bindings[0].Role)
 	}
 }
+
+func TestToPolicies_ConditionTimezone(t *testing.T) {
+	cfg := &Config{
+		Projects: map[string]ProjectConfig{
+			"test-project": {
+				Bindings: []BindingConfig{
+					{
+						Role:    "roles/viewer",
+						Members: []string{"user:oncall@example.com"},
+						Condition: &ConditionYAML{
+							Expression: `request.time.getHours() >= 9`,
+							Title:      "Business hours",
+							Timezone:   "Europe/Berlin",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	policies := cfg.ToPolicies()
+	policy := policies["projects/test-project"]
+	if policy == nil {
+		t.Fatal("Expected policy for projects/test-project")
+	}
+
+	title := policy.Bindings[0].Condition.Title
+	if title != "Business hours tz=Europe/Berlin" {
+		t.Errorf("Expected timezone recorded in title, got %q", title)
+	}
+}
+
+func TestToDenyPolicies(t *testing.T) {
+	yamlContent := `
+projects:
+  test-project:
+    bindings:
+      - role: roles/owner
+        members:
+          - user:admin@example.com
+    denyPolicies:
+      - deniedPrincipals:
+          - user:admin@example.com
+        deniedPermissions:
+          - secretmanager.versions.destroy
+        denialReason: "Destroying secret versions requires break-glass approval"
+    resources:
+      secrets/db-password:
+        bindings: []
+        denyPolicies:
+          - deniedPrincipals:
+              - allUsers
+            deniedPermissions:
+              - secretmanager.versions.access
+`
+
+	tmpfile, err := os.CreateTemp("", "policy-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(yamlContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFromFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	denyPolicies := cfg.ToDenyPolicies()
+	if len(denyPolicies) != 2 {
+		t.Fatalf("Expected deny policies for 2 resources, got %d", len(denyPolicies))
+	}
+
+	projectRules := denyPolicies["projects/test-project"]
+	if len(projectRules) != 1 {
+		t.Fatalf("Expected 1 project deny rule, got %d", len(projectRules))
+	}
+
+	if projectRules[0].DenialReason != "Destroying secret versions requires break-glass approval" {
+		t.Errorf("Unexpected denial reason: %q", projectRules[0].DenialReason)
+	}
+
+	if len(denyPolicies["projects/test-project/secrets/db-password"]) != 1 {
+		t.Errorf("Expected 1 resource deny rule")
+	}
+}
+
+func TestToDenyPolicies_Enforced(t *testing.T) {
+	yamlContent := `
+groups:
+  contractors:
+    members:
+      - user:carol@example.com
+      - user:dave@example.com
+projects:
+  test-project:
+    bindings:
+      - role: roles/secretmanager.admin
+        members:
+          - group:contractors
+    denyPolicies:
+      - deniedPrincipals:
+          - group:contractors
+        exceptionPrincipals:
+          - user:dave@example.com
+        deniedPermissions:
+          - secretmanager.secrets.delete
+      - deniedPrincipals:
+          - group:contractors
+        deniedPermissions:
+          - secretmanager.versions.access
+        denialCondition:
+          expression: resource.name.startsWith("projects/test-project/secrets/prod-")
+`
+
+	tmpfile, err := os.CreateTemp("", "policy-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(yamlContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFromFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+	if err := cfg.Validate(nil); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	store := storage.NewStorage()
+	store.LoadPolicies(cfg.ToPolicies())
+	store.LoadGroups(map[string][]string{"contractors": cfg.Groups["contractors"].Members})
+
+	denyPolicies := make(map[string][]storage.DenyRule)
+	for resource, rules := range cfg.ToDenyPolicies() {
+		for _, rule := range rules {
+			denyPolicies[resource] = append(denyPolicies[resource], storage.DenyRule{
+				DeniedPrincipals:    rule.DeniedPrincipals,
+				DeniedPermissions:   rule.DeniedPermissions,
+				ExceptionPrincipals: rule.ExceptionPrincipals,
+				DenialCondition:     rule.DenialCondition.ToProto(),
+				DenialReason:        rule.DenialReason,
+			})
+		}
+	}
+	store.LoadDenyPolicies(denyPolicies)
+
+	tests := []struct {
+		resource   string
+		principal  string
+		permission string
+		allowed    bool
+	}{
+		{"projects/test-project/secrets/db", "user:carol@example.com", "secretmanager.secrets.delete", false},
+		{"projects/test-project/secrets/db", "user:dave@example.com", "secretmanager.secrets.delete", true},
+		{"projects/test-project/secrets/prod-db", "user:dave@example.com", "secretmanager.versions.access", false},
+		{"projects/test-project/secrets/dev-db", "user:dave@example.com", "secretmanager.versions.access", true},
+	}
+
+	for _, tt := range tests {
+		allowed, err := store.TestIamPermissions(tt.resource, tt.principal, []string{tt.permission}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		if (len(allowed) == 1) != tt.allowed {
+			t.Errorf("%s %s on %s: expected allowed=%v, got %v", tt.principal, tt.permission, tt.resource, tt.allowed, allowed)
+		}
+	}
+}
+
+func TestToResourceParents(t *testing.T) {
+	yamlContent := `
+organizations:
+  "456":
+    bindings:
+      - role: roles/viewer
+        members:
+          - group:auditors
+folders:
+  "123":
+    parent: organizations/456
+projects:
+  test-project:
+    parent: folders/123
+    bindings: []
+`
+
+	tmpfile, err := os.CreateTemp("", "policy-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(yamlContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFromFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	parents := cfg.ToResourceParents()
+	if parents["projects/test-project"] != "folders/123" || parents["folders/123"] != "organizations/456" {
+		t.Errorf("Unexpected parents: %v", parents)
+	}
+	if len(parents) != 2 {
+		t.Errorf("Expected 2 parent links, got %v", parents)
+	}
+
+	policies := cfg.ToPolicies()
+	if policy, ok := policies["organizations/456"]; !ok || len(policy.Bindings) != 1 {
+		t.Errorf("Expected organization policy, got %v", policies)
+	}
+	if _, ok := policies["folders/123"]; ok {
+		t.Error("Expected no policy for a folder without bindings")
+	}
+}
+
+func TestToResourceLabels(t *testing.T) {
+	yamlContent := `
+projects:
+  test-project:
+    labels:
+      env: prod
+    bindings: []
+    resources:
+      secrets/db-password:
+        labels:
+          team: payments
+        bindings: []
+      secrets/unlabeled:
+        bindings: []
+`
+
+	tmpfile, err := os.CreateTemp("", "policy-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(yamlContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFromFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	labels := cfg.ToResourceLabels()
+	if len(labels) != 2 {
+		t.Errorf("Expected labels for 2 resources, got %v", labels)
+	}
+	if labels["projects/test-project"]["env"] != "prod" {
+		t.Errorf("Expected project label env=prod, got %v", labels["projects/test-project"])
+	}
+	if labels["projects/test-project/secrets/db-password"]["team"] != "payments" {
+		t.Errorf("Expected resource label team=payments, got %v", labels["projects/test-project/secrets/db-password"])
+	}
+}
+
+func TestToServiceAccounts(t *testing.T) {
+	yamlContent := `
+projects:
+  test-project:
+    serviceAccounts:
+      - accountId: ci-runner
+        displayName: CI Runner
+        description: Runs CI jobs
+      - accountId: deployer
+`
+
+	tmpfile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(yamlContent)); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	cfg, err := LoadFromFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	accounts := cfg.ToServiceAccounts()["test-project"]
+	if len(accounts) != 2 {
+		t.Fatalf("Expected 2 service accounts, got %v", accounts)
+	}
+
+	want := ServiceAccountConfig{AccountID: "ci-runner", DisplayName: "CI Runner", Description: "Runs CI jobs"}
+	if accounts[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, accounts[0])
+	}
+	if accounts[1].AccountID != "deployer" {
+		t.Errorf("Expected deployer, got %+v", accounts[1])
+	}
+}
+
+func TestToCustomRoles_ProjectRoles(t *testing.T) {
+	yamlContent := `
+roles:
+  roles/custom.auditor:
+    permissions:
+      - logging.logEntries.list
+projects:
+  alpha:
+    roles:
+      deployer:
+        permissions:
+          - secretmanager.secrets.get
+  beta:
+    roles:
+      deployer:
+        permissions:
+          - secretmanager.secrets.delete
+`
+
+	tmpfile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(yamlContent)); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	cfg, err := LoadFromFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	roles := cfg.ToCustomRoles()
+	if len(roles) != 3 {
+		t.Fatalf("Expected 3 custom roles, got %v", roles)
+	}
+
+	want := map[string]string{
+		"roles/custom.auditor":          "logging.logEntries.list",
+		"projects/alpha/roles/deployer": "secretmanager.secrets.get",
+		"projects/beta/roles/deployer":  "secretmanager.secrets.delete",
+	}
+	for role, permission := range want {
+		if perms := roles[role].Permissions; len(perms) != 1 || perms[0] != permission {
+			t.Errorf("Expected %s to grant %s, got %v", role, permission, perms)
+		}
+	}
+}
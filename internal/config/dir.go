@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Load loads path as a single config file or, if path is a directory, every
+// config file in it with LoadFromDir.
+func Load(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return LoadFromDir(path)
+	}
+	return LoadFromFile(path)
+}
+
+// LoadFromDir loads every *.yaml, *.yml and *.json file directly in dir, in
+// file name order, and combines them into one config:
+//   - group members are unioned across files
+//   - a project may be split across files, but its own parent, bindings,
+//     audit configs and deny policies must come from a single file
+//   - each resource, service account, folder, organization and custom role
+//     must be defined in only one file
+//
+// Defining the same thing in two files is an error naming both files.
+func LoadFromDir(dir string) (*Config, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+
+	cfg := &Config{}
+	owners := make(map[string]string)
+	loaded := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !isConfigFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		part, err := LoadFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := cfg.combine(part, entry.Name(), owners); err != nil {
+			return nil, err
+		}
+		loaded++
+	}
+
+	if loaded == 0 {
+		return nil, fmt.Errorf("no *.yaml or *.json config files in %s", dir)
+	}
+	return cfg, nil
+}
+
+func isConfigFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// combine adds part, loaded from source, to c. owners records which source
+// defined each project, resource, folder, organization, role and API key so
+// far.
+func (c *Config) combine(part *Config, source string, owners map[string]string) error {
+	claim := func(key string) error {
+		if previous, exists := owners[key]; exists {
+			return fmt.Errorf("%s is defined in both %s and %s", key, previous, source)
+		}
+		owners[key] = source
+		return nil
+	}
+
+	if c.Projects == nil && len(part.Projects) > 0 {
+		c.Projects = make(map[string]ProjectConfig)
+	}
+	for projectID, partProject := range part.Projects {
+		projectResource := "projects/" + projectID
+		project := c.Projects[projectID]
+
+		if partProject.Parent != "" || len(partProject.Bindings) > 0 || len(partProject.AuditConfigs) > 0 || len(partProject.DenyPolicies) > 0 || len(partProject.Labels) > 0 {
+			if err := claim(projectResource); err != nil {
+				return err
+			}
+			project.Parent = partProject.Parent
+			project.Bindings = partProject.Bindings
+			project.AuditConfigs = partProject.AuditConfigs
+			project.DenyPolicies = partProject.DenyPolicies
+			project.Labels = partProject.Labels
+		}
+
+		for _, account := range partProject.ServiceAccounts {
+			if err := claim(projectResource + "/serviceAccounts/" + account.AccountID); err != nil {
+				return err
+			}
+			project.ServiceAccounts = append(project.ServiceAccounts, account)
+		}
+
+		for roleID, role := range partProject.Roles {
+			if err := claim(projectRoleName(projectID, roleID)); err != nil {
+				return err
+			}
+			if project.Roles == nil {
+				project.Roles = make(map[string]RoleConfig)
+			}
+			project.Roles[roleID] = role
+		}
+
+		for resourcePath, resource := range partProject.Resources {
+			if err := claim(projectResource + "/" + resourcePath); err != nil {
+				return err
+			}
+			if project.Resources == nil {
+				project.Resources = make(map[string]ResourceConfig)
+			}
+			project.Resources[resourcePath] = resource
+		}
+
+		c.Projects[projectID] = project
+	}
+
+	var err error
+	if c.Folders, err = combineNodes(c.Folders, part.Folders, "folders/", claim); err != nil {
+		return err
+	}
+	if c.Organizations, err = combineNodes(c.Organizations, part.Organizations, "organizations/", claim); err != nil {
+		return err
+	}
+
+	if c.Groups == nil && len(part.Groups) > 0 {
+		c.Groups = make(map[string]GroupConfig)
+	}
+	for groupName, partGroup := range part.Groups {
+		group := c.Groups[groupName]
+		group.Members = appendMissing(group.Members, partGroup.Members)
+		c.Groups[groupName] = group
+	}
+
+	if c.Roles == nil && len(part.Roles) > 0 {
+		c.Roles = make(map[string]RoleConfig)
+	}
+	for roleName, role := range part.Roles {
+		if err := claim(roleName); err != nil {
+			return err
+		}
+		c.Roles[roleName] = role
+	}
+
+	if c.APIKeys == nil && len(part.APIKeys) > 0 {
+		c.APIKeys = make(map[string]string)
+	}
+	for key, principal := range part.APIKeys {
+		if err := claim(fmt.Sprintf("api key %q", key)); err != nil {
+			return err
+		}
+		c.APIKeys[key] = principal
+	}
+
+	return nil
+}
+
+func combineNodes(base, part map[string]NodeConfig, prefix string, claim func(string) error) (map[string]NodeConfig, error) {
+	if base == nil && len(part) > 0 {
+		base = make(map[string]NodeConfig)
+	}
+
+	for nodeID, node := range part {
+		if err := claim(prefix + nodeID); err != nil {
+			return nil, err
+		}
+		base[nodeID] = node
+	}
+
+	return base, nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFromDir_Merges(t *testing.T) {
+	dir := t.TempDir()
+
+	writeConfigFile(t, dir, "platform.yaml", `
+projects:
+  shared:
+    bindings:
+      - role: roles/viewer
+        members:
+          - group:developers
+groups:
+  developers:
+    members:
+      - user:alice@example.com
+roles:
+  roles/custom.deployer:
+    permissions:
+      - secretmanager.secrets.get
+`)
+	writeConfigFile(t, dir, "payments.json", `{
+  "projects": {
+    "shared": {
+      "resources": {
+        "secrets/stripe-key": {
+          "bindings": [{"role": "roles/secretmanager.secretAccessor", "members": ["user:bob@example.com"]}]
+        }
+      }
+    },
+    "payments": {
+      "bindings": [{"role": "roles/owner", "members": ["user:bob@example.com"]}],
+      "labels": {"env": "prod"}
+    }
+  },
+  "groups": {
+    "developers": {"members": ["user:bob@example.com"]}
+  }
+}`)
+	writeConfigFile(t, dir, "README.md", "not a config file")
+
+	cfg, err := LoadFromDir(dir)
+	if err != nil {
+		t.Fatalf("LoadFromDir failed: %v", err)
+	}
+
+	if len(cfg.Projects) != 2 {
+		t.Fatalf("Expected 2 projects, got %d", len(cfg.Projects))
+	}
+
+	shared := cfg.Projects["shared"]
+	if len(shared.Bindings) != 1 || len(shared.Resources) != 1 {
+		t.Errorf("Expected shared project bindings and resource from separate files, got %+v", shared)
+	}
+
+	if labels := cfg.Projects["payments"].Labels; labels["env"] != "prod" {
+		t.Errorf("Expected payments project labels to be loaded, got %v", labels)
+	}
+
+	developers := cfg.Groups["developers"].Members
+	if !reflect.DeepEqual(developers, []string{"user:bob@example.com", "user:alice@example.com"}) {
+		t.Errorf("Expected developers to be unioned in file name order, got %v", developers)
+	}
+
+	if _, exists := cfg.Roles["roles/custom.deployer"]; !exists {
+		t.Error("Expected custom role to be loaded")
+	}
+}
+
+func TestLoadFromDir_Conflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		first  string
+		second string
+		want   string
+	}{
+		{
+			name:   "project bindings",
+			first:  "projects:\n  shared:\n    bindings:\n      - role: roles/viewer\n        members: [user:alice@example.com]\n",
+			second: "projects:\n  shared:\n    bindings:\n      - role: roles/owner\n        members: [user:bob@example.com]\n",
+			want:   "projects/shared is defined in both a.yaml and b.yaml",
+		},
+		{
+			name:   "resource",
+			first:  "projects:\n  shared:\n    resources:\n      secrets/db:\n        bindings: []\n",
+			second: "projects:\n  shared:\n    resources:\n      secrets/db:\n        bindings: []\n",
+			want:   "projects/shared/secrets/db is defined in both a.yaml and b.yaml",
+		},
+		{
+			name:   "role",
+			first:  "roles:\n  roles/custom.x:\n    permissions: [a.b.c]\n",
+			second: "roles:\n  roles/custom.x:\n    permissions: [a.b.c]\n",
+			want:   "roles/custom.x is defined in both a.yaml and b.yaml",
+		},
+		{
+			name:   "folder",
+			first:  "folders:\n  \"123\":\n    bindings: []\n",
+			second: "folders:\n  \"123\":\n    parent: organizations/1\n",
+			want:   "folders/123 is defined in both a.yaml and b.yaml",
+		},
+		{
+			name:   "api key",
+			first:  "apiKeys:\n  ci-key: user:alice@example.com\n",
+			second: "apiKeys:\n  ci-key: user:bob@example.com\n",
+			want:   `api key "ci-key" is defined in both a.yaml and b.yaml`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFile(t, dir, "a.yaml", tt.first)
+			writeConfigFile(t, dir, "b.yaml", tt.second)
+
+			_, err := LoadFromDir(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadFromDir_Empty(t *testing.T) {
+	if _, err := LoadFromDir(t.TempDir()); err == nil {
+		t.Error("Expected a directory without config files to fail")
+	}
+}
+
+func TestLoad_DirectoryOrFile(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "base.yaml", "groups:\n  ops:\n    members: [user:ops@example.com]\n")
+
+	fromDir, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load(dir) failed: %v", err)
+	}
+	fromFile, err := Load(filepath.Join(dir, "base.yaml"))
+	if err != nil {
+		t.Fatalf("Load(file) failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(fromDir.Groups, fromFile.Groups) {
+		t.Errorf("Expected directory and file loads to agree, got %v and %v", fromDir.Groups, fromFile.Groups)
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envReference matches ${VAR} and ${VAR:-default}.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} with the value of VAR from the process
+// environment and ${VAR:-default} with VAR's value, or default when VAR is
+// unset or empty. A ${VAR} without a default whose variable is unset is an
+// error. Bare $VAR references are left alone.
+func expandEnv(data []byte) ([]byte, error) {
+	var missing []string
+
+	expanded := envReference.ReplaceAllFunc(data, func(reference []byte) []byte {
+		groups := envReference.FindSubmatch(reference)
+		name := string(groups[1])
+		value, set := os.LookupEnv(name)
+
+		if groups[2] != nil {
+			if value == "" {
+				return groups[3]
+			}
+			return []byte(value)
+		}
+
+		if !set {
+			missing = append(missing, name)
+		}
+		return []byte(value)
+	})
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined environment variables: %s (use ${VAR:-default} for optional values)", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
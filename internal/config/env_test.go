@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("CI_SA_EMAIL", "ci@test-project.iam.gserviceaccount.com")
+	t.Setenv("EMPTY_VAR", "")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"set variable", "serviceAccount:${CI_SA_EMAIL}", "serviceAccount:ci@test-project.iam.gserviceaccount.com"},
+		{"default unused", "${CI_SA_EMAIL:-fallback}", "ci@test-project.iam.gserviceaccount.com"},
+		{"default for unset", "projects/${IAM_EMULATOR_UNSET_PROJECT:-test-project}", "projects/test-project"},
+		{"default for empty", "${EMPTY_VAR:-fallback}", "fallback"},
+		{"empty default", "user${IAM_EMULATOR_UNSET_SUFFIX:-}", "user"},
+		{"set but empty", "[${EMPTY_VAR}]", "[]"},
+		{"bare dollar untouched", "$CI_SA_EMAIL costs $5", "$CI_SA_EMAIL costs $5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEnv([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("expandEnv failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expandEnv(%q) = %q, expected %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnv_MissingRequired(t *testing.T) {
+	_, err := expandEnv([]byte("members: [serviceAccount:${IAM_EMULATOR_MISSING_SA}]"))
+	if err == nil || !strings.Contains(err.Error(), "IAM_EMULATOR_MISSING_SA") {
+		t.Errorf("Expected error naming the missing variable, got %v", err)
+	}
+}
+
+func TestLoadFromFile_ExpandsEnv(t *testing.T) {
+	t.Setenv("CI_SA_EMAIL", "ci@test-project.iam.gserviceaccount.com")
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(`
+projects:
+  ${CI_PROJECT:-test-project}:
+    bindings:
+      - role: roles/editor
+        members: ["serviceAccount:${CI_SA_EMAIL}"]
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	project, exists := cfg.Projects["test-project"]
+	if !exists {
+		t.Fatalf("Expected default project id, got %v", cfg.Projects)
+	}
+	if member := project.Bindings[0].Members[0]; member != "serviceAccount:ci@test-project.iam.gserviceaccount.com" {
+		t.Errorf("Expected expanded member, got %s", member)
+	}
+}
@@ -0,0 +1,267 @@
+package config
+
+import "fmt"
+
+// LoadWithOverlays loads the base config at path and merges each overlay onto
+// it in order, so later overlays win over earlier ones. The base and each
+// overlay may be a file or a directory of files (see Load).
+func LoadWithOverlays(path string, overlays []string) (*Config, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, overlayPath := range overlays {
+		overlay, err := Load(overlayPath)
+		if err != nil {
+			return nil, fmt.Errorf("overlay %s: %w", overlayPath, err)
+		}
+		cfg.Merge(overlay)
+	}
+
+	return cfg, nil
+}
+
+// Merge applies overlay onto c. The overlay wins on conflicts:
+//   - projects and resources missing from c are added
+//   - bindings replace every base binding with the same role; new roles are appended
+//   - audit configs replace the base audit config for the same service
+//   - deny policies, when set, replace the base deny policies of that resource
+//   - service accounts replace the base account with the same account id
+//   - group members are added to the base group's members
+//   - custom roles replace the base role with the same name
+//   - folders and organizations merge like projects; a set parent replaces the base parent
+//   - API keys replace the base key's principal
+func (c *Config) Merge(overlay *Config) {
+	if overlay == nil {
+		return
+	}
+
+	if c.Projects == nil && len(overlay.Projects) > 0 {
+		c.Projects = make(map[string]ProjectConfig)
+	}
+	for projectID, overlayProject := range overlay.Projects {
+		project, exists := c.Projects[projectID]
+		if !exists {
+			c.Projects[projectID] = overlayProject
+			continue
+		}
+
+		if overlayProject.Parent != "" {
+			project.Parent = overlayProject.Parent
+		}
+		project.Bindings = mergeBindings(project.Bindings, overlayProject.Bindings)
+		project.AuditConfigs = mergeAuditConfigs(project.AuditConfigs, overlayProject.AuditConfigs)
+		if len(overlayProject.DenyPolicies) > 0 {
+			project.DenyPolicies = overlayProject.DenyPolicies
+		}
+		project.Resources = mergeResources(project.Resources, overlayProject.Resources)
+		project.ServiceAccounts = mergeServiceAccounts(project.ServiceAccounts, overlayProject.ServiceAccounts)
+		project.Roles = mergeRoles(project.Roles, overlayProject.Roles)
+		project.Labels = mergeStringMap(project.Labels, overlayProject.Labels)
+
+		c.Projects[projectID] = project
+	}
+
+	c.Folders = mergeNodes(c.Folders, overlay.Folders)
+	c.Organizations = mergeNodes(c.Organizations, overlay.Organizations)
+
+	if c.Groups == nil && len(overlay.Groups) > 0 {
+		c.Groups = make(map[string]GroupConfig)
+	}
+	for groupName, overlayGroup := range overlay.Groups {
+		group := c.Groups[groupName]
+		group.Members = appendMissing(group.Members, overlayGroup.Members)
+		c.Groups[groupName] = group
+	}
+
+	c.Roles = mergeRoles(c.Roles, overlay.Roles)
+	c.APIKeys = mergeStringMap(c.APIKeys, overlay.APIKeys)
+}
+
+// mergeRoles adds overlay roles to base, replacing roles of the same name.
+func mergeRoles(base, overlay map[string]RoleConfig) map[string]RoleConfig {
+	if base == nil && len(overlay) > 0 {
+		base = make(map[string]RoleConfig)
+	}
+	for roleName, overlayRole := range overlay {
+		base[roleName] = overlayRole
+	}
+	return base
+}
+
+// mergeStringMap sets each overlay entry on base, replacing the value of a key
+// both define.
+func mergeStringMap(base, overlay map[string]string) map[string]string {
+	if base == nil && len(overlay) > 0 {
+		base = make(map[string]string)
+	}
+	for key, value := range overlay {
+		base[key] = value
+	}
+	return base
+}
+
+func mergeNodes(base, overlay map[string]NodeConfig) map[string]NodeConfig {
+	if base == nil && len(overlay) > 0 {
+		base = make(map[string]NodeConfig)
+	}
+
+	for nodeID, overlayNode := range overlay {
+		node, exists := base[nodeID]
+		if !exists {
+			base[nodeID] = overlayNode
+			continue
+		}
+
+		if overlayNode.Parent != "" {
+			node.Parent = overlayNode.Parent
+		}
+		node.Bindings = mergeBindings(node.Bindings, overlayNode.Bindings)
+		base[nodeID] = node
+	}
+
+	return base
+}
+
+func mergeResources(base, overlay map[string]ResourceConfig) map[string]ResourceConfig {
+	if base == nil && len(overlay) > 0 {
+		base = make(map[string]ResourceConfig)
+	}
+
+	for resourcePath, overlayResource := range overlay {
+		resource, exists := base[resourcePath]
+		if !exists {
+			base[resourcePath] = overlayResource
+			continue
+		}
+
+		resource.Bindings = mergeBindings(resource.Bindings, overlayResource.Bindings)
+		resource.AuditConfigs = mergeAuditConfigs(resource.AuditConfigs, overlayResource.AuditConfigs)
+		if len(overlayResource.DenyPolicies) > 0 {
+			resource.DenyPolicies = overlayResource.DenyPolicies
+		}
+		resource.Labels = mergeStringMap(resource.Labels, overlayResource.Labels)
+
+		base[resourcePath] = resource
+	}
+
+	return base
+}
+
+// mergeBindings replaces base bindings whose role appears in overlay with the
+// overlay's bindings for that role, keeping the position of the first
+// replaced binding, and appends bindings for roles the base doesn't have.
+func mergeBindings(base, overlay []BindingConfig) []BindingConfig {
+	if len(overlay) == 0 {
+		return base
+	}
+
+	byRole := make(map[string][]BindingConfig)
+	var roles []string
+	for _, binding := range overlay {
+		if _, seen := byRole[binding.Role]; !seen {
+			roles = append(roles, binding.Role)
+		}
+		byRole[binding.Role] = append(byRole[binding.Role], binding)
+	}
+
+	merged := make([]BindingConfig, 0, len(base)+len(overlay))
+	placed := make(map[string]bool)
+	for _, binding := range base {
+		replacements, overridden := byRole[binding.Role]
+		if !overridden {
+			merged = append(merged, binding)
+			continue
+		}
+		if !placed[binding.Role] {
+			merged = append(merged, replacements...)
+			placed[binding.Role] = true
+		}
+	}
+
+	for _, role := range roles {
+		if !placed[role] {
+			merged = append(merged, byRole[role]...)
+		}
+	}
+
+	return merged
+}
+
+func mergeServiceAccounts(base, overlay []ServiceAccountConfig) []ServiceAccountConfig {
+	if len(overlay) == 0 {
+		return base
+	}
+
+	merged := make([]ServiceAccountConfig, 0, len(base)+len(overlay))
+	replaced := make(map[string]bool)
+	for _, account := range base {
+		for _, replacement := range overlay {
+			if replacement.AccountID == account.AccountID {
+				account = replacement
+				replaced[account.AccountID] = true
+				break
+			}
+		}
+		merged = append(merged, account)
+	}
+
+	for _, account := range overlay {
+		if !replaced[account.AccountID] {
+			merged = append(merged, account)
+		}
+	}
+
+	return merged
+}
+
+func mergeAuditConfigs(base, overlay []AuditConfigYAML) []AuditConfigYAML {
+	if len(overlay) == 0 {
+		return base
+	}
+
+	merged := make([]AuditConfigYAML, 0, len(base)+len(overlay))
+	replaced := make(map[string]bool)
+	for _, auditConfig := range base {
+		replacement, overridden := findAuditConfig(overlay, auditConfig.Service)
+		if overridden {
+			merged = append(merged, replacement)
+			replaced[auditConfig.Service] = true
+			continue
+		}
+		merged = append(merged, auditConfig)
+	}
+
+	for _, auditConfig := range overlay {
+		if !replaced[auditConfig.Service] {
+			merged = append(merged, auditConfig)
+		}
+	}
+
+	return merged
+}
+
+func findAuditConfig(configs []AuditConfigYAML, service string) (AuditConfigYAML, bool) {
+	for _, auditConfig := range configs {
+		if auditConfig.Service == service {
+			return auditConfig, true
+		}
+	}
+	return AuditConfigYAML{}, false
+}
+
+func appendMissing(members, extra []string) []string {
+	seen := make(map[string]bool, len(members))
+	for _, member := range members {
+		seen[member] = true
+	}
+
+	for _, member := range extra {
+		if !seen[member] {
+			members = append(members, member)
+			seen[member] = true
+		}
+	}
+	return members
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func baseConfig() *Config {
+	return &Config{
+		Projects: map[string]ProjectConfig{
+			"test-project": {
+				Bindings: []BindingConfig{
+					{Role: "roles/owner", Members: []string{"user:admin@example.com"}},
+					{Role: "roles/viewer", Members: []string{"user:viewer@example.com"}},
+				},
+				Resources: map[string]ResourceConfig{
+					"secrets/db-password": {
+						Bindings: []BindingConfig{
+							{Role: "roles/secretmanager.secretAccessor", Members: []string{"group:developers"}},
+						},
+					},
+				},
+			},
+		},
+		Groups: map[string]GroupConfig{
+			"developers": {Members: []string{"user:alice@example.com"}},
+		},
+		Roles: map[string]RoleConfig{
+			"roles/custom.deployer": {Permissions: []string{"secretmanager.secrets.get"}},
+		},
+	}
+}
+
+func TestMerge_AddsProject(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Merge(&Config{
+		Projects: map[string]ProjectConfig{
+			"ci-project": {
+				Bindings: []BindingConfig{
+					{Role: "roles/editor", Members: []string{"serviceAccount:ci@ci-project.iam.gserviceaccount.com"}},
+				},
+			},
+		},
+	})
+
+	if len(cfg.Projects) != 2 {
+		t.Fatalf("Expected 2 projects, got %d", len(cfg.Projects))
+	}
+
+	if _, exists := cfg.Projects["ci-project"]; !exists {
+		t.Error("Expected overlay project to be added")
+	}
+
+	if len(cfg.Projects["test-project"].Bindings) != 2 {
+		t.Errorf("Expected base project to be untouched, got %v", cfg.Projects["test-project"].Bindings)
+	}
+}
+
+func TestMerge_OverridesBindingByRole(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Merge(&Config{
+		Projects: map[string]ProjectConfig{
+			"test-project": {
+				Bindings: []BindingConfig{
+					{Role: "roles/owner", Members: []string{"serviceAccount:ci@test-project.iam.gserviceaccount.com"}},
+					{Role: "roles/secretmanager.admin", Members: []string{"user:ops@example.com"}},
+				},
+				Resources: map[string]ResourceConfig{
+					"secrets/api-key": {
+						Bindings: []BindingConfig{
+							{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:bob@example.com"}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	project := cfg.Projects["test-project"]
+	want := []BindingConfig{
+		{Role: "roles/owner", Members: []string{"serviceAccount:ci@test-project.iam.gserviceaccount.com"}},
+		{Role: "roles/viewer", Members: []string{"user:viewer@example.com"}},
+		{Role: "roles/secretmanager.admin", Members: []string{"user:ops@example.com"}},
+	}
+	if !reflect.DeepEqual(project.Bindings, want) {
+		t.Errorf("Expected bindings %v, got %v", want, project.Bindings)
+	}
+
+	if len(project.Resources) != 2 {
+		t.Errorf("Expected base and overlay resources, got %d", len(project.Resources))
+	}
+}
+
+func TestMerge_ExtendsGroupAndReplacesRole(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Merge(&Config{
+		Groups: map[string]GroupConfig{
+			"developers": {Members: []string{"user:alice@example.com", "user:carol@example.com"}},
+			"ci":         {Members: []string{"serviceAccount:ci@test-project.iam.gserviceaccount.com"}},
+		},
+		Roles: map[string]RoleConfig{
+			"roles/custom.deployer": {Permissions: []string{"secretmanager.secrets.create"}},
+		},
+	})
+
+	developers := cfg.Groups["developers"].Members
+	if !reflect.DeepEqual(developers, []string{"user:alice@example.com", "user:carol@example.com"}) {
+		t.Errorf("Expected developers to be extended without duplicates, got %v", developers)
+	}
+
+	if _, exists := cfg.Groups["ci"]; !exists {
+		t.Error("Expected overlay group to be added")
+	}
+
+	perms := cfg.Roles["roles/custom.deployer"].Permissions
+	if !reflect.DeepEqual(perms, []string{"secretmanager.secrets.create"}) {
+		t.Errorf("Expected overlay role to replace base role, got %v", perms)
+	}
+}
+
+func TestMerge_ServiceAccounts(t *testing.T) {
+	cfg := baseConfig()
+	project := cfg.Projects["test-project"]
+	project.ServiceAccounts = []ServiceAccountConfig{
+		{AccountID: "ci-runner", DisplayName: "CI"},
+		{AccountID: "deployer"},
+	}
+	cfg.Projects["test-project"] = project
+
+	cfg.Merge(&Config{
+		Projects: map[string]ProjectConfig{
+			"test-project": {
+				ServiceAccounts: []ServiceAccountConfig{
+					{AccountID: "ci-runner", DisplayName: "CI Runner"},
+					{AccountID: "backup"},
+				},
+			},
+		},
+	})
+
+	want := []ServiceAccountConfig{
+		{AccountID: "ci-runner", DisplayName: "CI Runner"},
+		{AccountID: "deployer"},
+		{AccountID: "backup"},
+	}
+	if got := cfg.Projects["test-project"].ServiceAccounts; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected service accounts %v, got %v", want, got)
+	}
+}
+
+func TestLoadWithOverlays(t *testing.T) {
+	dir := t.TempDir()
+
+	base := filepath.Join(dir, "base.yaml")
+	if err := os.WriteFile(base, []byte(`
+projects:
+  test-project:
+    bindings:
+      - role: roles/viewer
+        members:
+          - user:viewer@example.com
+groups:
+  developers:
+    members:
+      - user:alice@example.com
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay := filepath.Join(dir, "ci.yaml")
+	if err := os.WriteFile(overlay, []byte(`
+projects:
+  test-project:
+    bindings:
+      - role: roles/viewer
+        members:
+          - serviceAccount:ci@test-project.iam.gserviceaccount.com
+groups:
+  developers:
+    members:
+      - user:bob@example.com
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadWithOverlays(base, []string{overlay})
+	if err != nil {
+		t.Fatalf("LoadWithOverlays failed: %v", err)
+	}
+
+	bindings := cfg.Projects["test-project"].Bindings
+	if len(bindings) != 1 || bindings[0].Members[0] != "serviceAccount:ci@test-project.iam.gserviceaccount.com" {
+		t.Errorf("Expected overlay to replace roles/viewer binding, got %v", bindings)
+	}
+
+	if len(cfg.Groups["developers"].Members) != 2 {
+		t.Errorf("Expected developers to have 2 members, got %v", cfg.Groups["developers"].Members)
+	}
+
+	if _, err := LoadWithOverlays(base, []string{filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("Expected missing overlay to fail")
+	}
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every semantic problem Validate found in a config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config (%d problems):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// accountIDPattern matches the service account ids GCP accepts: 6-30
+// lowercase letters, digits, or hyphens, starting with a letter.
+var accountIDPattern = regexp.MustCompile(`^[a-z][-a-z0-9]{4,28}[a-z0-9]$`)
+
+var validLogTypes = map[string]bool{
+	"ADMIN_READ": true,
+	"DATA_WRITE": true,
+	"DATA_READ":  true,
+}
+
+var validRoleStages = map[string]bool{
+	"":           true,
+	"ALPHA":      true,
+	"BETA":       true,
+	"GA":         true,
+	"DEPRECATED": true,
+	"DISABLED":   true,
+	"EAP":        true,
+}
+
+// Validate reports problems that parse cleanly but would silently never
+// match at runtime: group: members naming undefined groups, bindings with no
+// members, audit log configs with an unknown logType, deny rules without a
+// denied permission, service accounts with an invalid accountId, project
+// role IDs containing a slash, roles with an unknown stage, conditions with an
+// unknown timezone, and API keys mapped to a malformed principal. When isBuiltInRole is non-nil (strict mode),
+// binding roles that are neither built in nor defined under roles (top-level
+// or the project's) are reported too. All problems are returned together
+// as a *ValidationError.
+func (c *Config) Validate(isBuiltInRole func(role string) bool) error {
+	var problems []string
+
+	checkMembers := func(where string, members []string) {
+		for _, member := range members {
+			if groupName, ok := strings.CutPrefix(member, "group:"); ok {
+				if _, defined := c.Groups[groupName]; !defined {
+					problems = append(problems, fmt.Sprintf("%s: member %s references undefined group %q", where, member, groupName))
+				}
+			}
+		}
+	}
+
+	checkCondition := func(where string, condition *ConditionYAML) {
+		if condition == nil || condition.Timezone == "" {
+			return
+		}
+		if _, err := time.LoadLocation(condition.Timezone); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: unknown timezone %q", where, condition.Timezone))
+		}
+	}
+
+	checkBindings := func(resource string, bindings []BindingConfig) {
+		for _, binding := range bindings {
+			where := fmt.Sprintf("%s binding %s", resource, binding.Role)
+			if len(binding.Members) == 0 {
+				problems = append(problems, fmt.Sprintf("%s: no members", where))
+			}
+			checkMembers(where, binding.Members)
+			checkCondition(where, binding.Condition)
+
+			if isBuiltInRole != nil && !isBuiltInRole(binding.Role) {
+				if !c.definesRole(binding.Role) {
+					problems = append(problems, fmt.Sprintf("%s: role is neither built in nor defined under roles", where))
+				}
+			}
+		}
+	}
+
+	checkAuditConfigs := func(resource string, auditConfigs []AuditConfigYAML) {
+		for _, auditConfig := range auditConfigs {
+			for _, logConfig := range auditConfig.AuditLogConfigs {
+				if !validLogTypes[logConfig.LogType] {
+					problems = append(problems, fmt.Sprintf("%s audit config %s: invalid logType %q (must be ADMIN_READ, DATA_WRITE or DATA_READ)", resource, auditConfig.Service, logConfig.LogType))
+				}
+			}
+		}
+	}
+
+	checkDenyRules := func(resource string, rules []DenyRuleConfig) {
+		for i, rule := range rules {
+			if len(rule.DeniedPermissions) == 0 {
+				problems = append(problems, fmt.Sprintf("%s deny rule %d: no denied permissions", resource, i+1))
+			}
+			checkCondition(fmt.Sprintf("%s deny rule %d", resource, i+1), rule.DenialCondition)
+		}
+	}
+
+	for projectID, projectCfg := range c.Projects {
+		projectResource := fmt.Sprintf("projects/%s", projectID)
+		checkBindings(projectResource, projectCfg.Bindings)
+		checkAuditConfigs(projectResource, projectCfg.AuditConfigs)
+		checkDenyRules(projectResource, projectCfg.DenyPolicies)
+
+		for _, account := range projectCfg.ServiceAccounts {
+			if !accountIDPattern.MatchString(account.AccountID) {
+				problems = append(problems, fmt.Sprintf("%s service account %q: accountId must be 6-30 lowercase letters, digits, or hyphens, starting with a letter", projectResource, account.AccountID))
+			}
+		}
+
+		for roleID := range projectCfg.Roles {
+			if roleID == "" || strings.Contains(roleID, "/") {
+				problems = append(problems, fmt.Sprintf("%s role %q: role ID must be non-empty and must not contain /", projectResource, roleID))
+			}
+		}
+
+		for resourcePath, resourceCfg := range projectCfg.Resources {
+			fullResource := fmt.Sprintf("%s/%s", projectResource, resourcePath)
+			checkBindings(fullResource, resourceCfg.Bindings)
+			checkAuditConfigs(fullResource, resourceCfg.AuditConfigs)
+			checkDenyRules(fullResource, resourceCfg.DenyPolicies)
+		}
+	}
+
+	for _, node := range c.hierarchyNodes() {
+		checkBindings(node.resource, node.config.Bindings)
+	}
+
+	for groupName, group := range c.Groups {
+		checkMembers(fmt.Sprintf("group %s", groupName), group.Members)
+	}
+
+	for roleName, role := range c.ToCustomRoles() {
+		if !validRoleStages[role.Stage] {
+			problems = append(problems, fmt.Sprintf("role %s: invalid stage %q (must be ALPHA, BETA, GA, DEPRECATED, DISABLED or EAP)", roleName, role.Stage))
+		}
+	}
+
+	for key, principal := range c.APIKeys {
+		if key == "" {
+			problems = append(problems, "apiKeys: key must be non-empty")
+		}
+		if kind, email, ok := strings.Cut(principal, ":"); !ok || kind == "" || email == "" {
+			problems = append(problems, fmt.Sprintf("api key %q: principal %q must be of the form type:identity (e.g. user:alice@example.com)", key, principal))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return &ValidationError{Problems: problems}
+}
+
+// definesRole reports whether role is a top-level custom role or a
+// projects/{project}/roles/{roleId} role declared under that project.
+func (c *Config) definesRole(role string) bool {
+	if _, defined := c.Roles[role]; defined {
+		return true
+	}
+
+	parts := strings.Split(role, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "roles" {
+		return false
+	}
+	_, defined := c.Projects[parts[1]].Roles[parts[3]]
+	return defined
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func isTestBuiltInRole(role string) bool {
+	switch role {
+	case "roles/owner", "roles/viewer", "roles/secretmanager.secretAccessor":
+		return true
+	}
+	return false
+}
+
+func validationProblems(t *testing.T, err error) []string {
+	t.Helper()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected *ValidationError, got %v", err)
+	}
+	return validationErr.Problems
+}
+
+func TestValidate_Valid(t *testing.T) {
+	if err := baseConfig().Validate(isTestBuiltInRole); err != nil {
+		t.Errorf("Expected base config to be valid, got %v", err)
+	}
+}
+
+func TestValidate_UndefinedGroup(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Projects["test-project"].Bindings[1].Members = []string{"group:devs"}
+	cfg.Groups["developers"] = GroupConfig{Members: []string{"group:contractors"}}
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", problems)
+	}
+	if !strings.Contains(problems[0], `undefined group "contractors"`) || !strings.Contains(problems[1], `undefined group "devs"`) {
+		t.Errorf("Expected undefined group problems, got %v", problems)
+	}
+}
+
+func TestValidate_UndefinedRoleInStrictMode(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Projects["test-project"].Resources["secrets/db-password"].Bindings[0].Role = "roles/custom.missing"
+
+	if err := cfg.Validate(nil); err != nil {
+		t.Errorf("Expected unknown roles to be accepted without a built-in role check, got %v", err)
+	}
+
+	problems := validationProblems(t, cfg.Validate(isTestBuiltInRole))
+	if len(problems) != 1 || !strings.Contains(problems[0], "projects/test-project/secrets/db-password binding roles/custom.missing") {
+		t.Errorf("Expected undefined role problem, got %v", problems)
+	}
+}
+
+func TestValidate_EmptyMembers(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Folders = map[string]NodeConfig{
+		"123": {Bindings: []BindingConfig{{Role: "roles/viewer"}}},
+	}
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 1 || problems[0] != "folders/123 binding roles/viewer: no members" {
+		t.Errorf("Expected empty members problem, got %v", problems)
+	}
+}
+
+func TestValidate_InvalidLogType(t *testing.T) {
+	cfg := baseConfig()
+	project := cfg.Projects["test-project"]
+	project.AuditConfigs = []AuditConfigYAML{
+		{Service: "allServices", AuditLogConfigs: []AuditLogConfigYAML{{LogType: "DATA_READ"}, {LogType: "DATA_DELETE"}}},
+	}
+	cfg.Projects["test-project"] = project
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 1 || !strings.Contains(problems[0], `invalid logType "DATA_DELETE"`) {
+		t.Errorf("Expected invalid logType problem, got %v", problems)
+	}
+}
+
+func TestValidate_AggregatesProblems(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Projects["test-project"].Bindings[0].Members = nil
+	cfg.Groups["developers"] = GroupConfig{Members: []string{"group:ghosts"}}
+
+	err := cfg.Validate(nil)
+	problems := validationProblems(t, err)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", problems)
+	}
+	if !strings.Contains(err.Error(), "2 problems") {
+		t.Errorf("Expected error to count problems, got %q", err.Error())
+	}
+}
+
+func TestValidate_InvalidServiceAccountID(t *testing.T) {
+	cfg := baseConfig()
+	project := cfg.Projects["test-project"]
+	project.ServiceAccounts = []ServiceAccountConfig{{AccountID: "ci-runner"}, {AccountID: "CI"}}
+	cfg.Projects["test-project"] = project
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 1 || !strings.Contains(problems[0], `service account "CI"`) {
+		t.Errorf("Expected invalid accountId problem, got %v", problems)
+	}
+}
+
+func TestValidate_DenyRuleWithoutPermissions(t *testing.T) {
+	cfg := baseConfig()
+	resource := cfg.Projects["test-project"].Resources["secrets/db-password"]
+	resource.DenyPolicies = []DenyRuleConfig{
+		{DeniedPrincipals: []string{"allUsers"}, DeniedPermissions: []string{"secretmanager.versions.access"}},
+		{DeniedPrincipals: []string{"allUsers"}},
+	}
+	cfg.Projects["test-project"].Resources["secrets/db-password"] = resource
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 1 || problems[0] != "projects/test-project/secrets/db-password deny rule 2: no denied permissions" {
+		t.Errorf("Expected deny rule problem, got %v", problems)
+	}
+}
+
+func TestValidate_ProjectRoles(t *testing.T) {
+	cfg := baseConfig()
+	project := cfg.Projects["test-project"]
+	project.Roles = map[string]RoleConfig{
+		"deployer": {Permissions: []string{"secretmanager.secrets.get"}},
+		"bad/id":   {Permissions: []string{"secretmanager.secrets.get"}},
+	}
+	project.Bindings = append(project.Bindings,
+		BindingConfig{Role: "projects/test-project/roles/deployer", Members: []string{"user:alice@example.com"}},
+		BindingConfig{Role: "projects/other-project/roles/deployer", Members: []string{"user:alice@example.com"}},
+	)
+	cfg.Projects["test-project"] = project
+
+	problems := validationProblems(t, cfg.Validate(isTestBuiltInRole))
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", problems)
+	}
+	if !strings.Contains(problems[0], "projects/other-project/roles/deployer") || !strings.Contains(problems[1], `role "bad/id"`) {
+		t.Errorf("Expected undefined project role and invalid role ID problems, got %v", problems)
+	}
+}
+
+func TestValidate_InvalidRoleStage(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Roles["roles/custom.deployer"] = RoleConfig{Permissions: []string{"secretmanager.secrets.get"}, Stage: "DISABLED"}
+	cfg.Roles["roles/custom.retired"] = RoleConfig{Permissions: []string{"secretmanager.secrets.get"}, Stage: "RETIRED"}
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 1 || !strings.Contains(problems[0], `role roles/custom.retired: invalid stage "RETIRED"`) {
+		t.Errorf("Expected invalid stage problem, got %v", problems)
+	}
+}
+
+func TestValidate_APIKeys(t *testing.T) {
+	cfg := baseConfig()
+	cfg.APIKeys = map[string]string{
+		"ci-key":  "serviceAccount:ci@test.iam.gserviceaccount.com",
+		"bad-key": "alice@example.com",
+	}
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 1 || !strings.Contains(problems[0], `api key "bad-key": principal "alice@example.com"`) {
+		t.Errorf("Expected malformed principal problem, got %v", problems)
+	}
+}
+
+func TestValidate_UnknownTimezone(t *testing.T) {
+	cfg := baseConfig()
+	project := cfg.Projects["test-project"]
+	project.Bindings = append(project.Bindings, BindingConfig{
+		Role:    "roles/viewer",
+		Members: []string{"user:alice@example.com"},
+		Condition: &ConditionYAML{
+			Expression: `request.time.getHours() < 17`,
+			Timezone:   "Not/AZone",
+		},
+	})
+	cfg.Projects["test-project"] = project
+
+	problems := validationProblems(t, cfg.Validate(nil))
+	if len(problems) != 1 || !strings.Contains(problems[0], `unknown timezone "Not/AZone"`) {
+		t.Errorf("Expected unknown timezone problem, got %v", problems)
+	}
+}
@@ -0,0 +1,63 @@
+// Package metrics defines the Prometheus metrics served at GET /metrics. The
+// gRPC and REST servers record into the same counters, so a check is counted
+// whichever API answered it.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	outcomeAllow = "allow"
+	outcomeDeny  = "deny"
+)
+
+// authzDecisions counts per-permission TestIamPermissions outcomes.
+var authzDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "iam_emulator_authz_decisions_total",
+	Help: "Permission checks answered by TestIamPermissions (gRPC or REST), by outcome (allow or deny) and permission.",
+}, []string{"outcome", "permission"})
+
+// setIamPolicyRequests counts SetIamPolicy calls by gRPC status code. Dry runs
+// store nothing and are not counted.
+var setIamPolicyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "iam_emulator_setiampolicy_total",
+	Help: "SetIamPolicy requests (gRPC or REST, excluding dry runs), by gRPC status code.",
+}, []string{"code"})
+
+// testIamPermissionsDuration measures policy evaluation time per
+// TestIamPermissions request.
+var testIamPermissionsDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "iam_emulator_testiampermissions_duration_seconds",
+	Help:    "Time spent evaluating policies for a TestIamPermissions request.",
+	Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+})
+
+// RecordDecisions counts each requested permission as allowed or denied and
+// observes the time spent evaluating them.
+func RecordDecisions(permissions, allowed []string, duration time.Duration) {
+	granted := make(map[string]bool, len(allowed))
+	for _, permission := range allowed {
+		granted[permission] = true
+	}
+
+	for _, permission := range permissions {
+		outcome := outcomeDeny
+		if granted[permission] {
+			outcome = outcomeAllow
+		}
+		authzDecisions.WithLabelValues(outcome, permission).Inc()
+	}
+
+	testIamPermissionsDuration.Observe(duration.Seconds())
+}
+
+// RecordSetIamPolicy counts a SetIamPolicy call by the status of err, which
+// should be a gRPC status error or nil.
+func RecordSetIamPolicy(err error) {
+	setIamPolicyRequests.WithLabelValues(status.Code(err).String()).Inc()
+}
@@ -0,0 +1,75 @@
+// Package ratelimit provides the token bucket the gRPC and REST servers use to
+// simulate RESOURCE_EXHAUSTED quota errors.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Limiter is a token bucket refilled at a fixed rate and holding at most one
+// second's worth of requests (and never less than one). A nil Limiter allows
+// every request.
+type Limiter struct {
+	mu       sync.Mutex
+	rate     float64
+	tokens   float64
+	lastFill time.Time
+	now      func() time.Time
+}
+
+// New returns a limiter allowing qps requests per second, or nil (unlimited)
+// when qps is not positive.
+func New(qps float64) *Limiter {
+	if qps <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		rate:     qps,
+		tokens:   math.Max(qps, 1),
+		lastFill: time.Now(),
+		now:      time.Now,
+	}
+}
+
+// Allow takes a token if one is available. Otherwise it reports how long
+// until the next token is due.
+func (l *Limiter) Allow() (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens += now.Sub(l.lastFill).Seconds() * l.rate
+	if burst := math.Max(l.rate, 1); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.lastFill = now
+
+	if l.tokens < 1 {
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	l.tokens--
+	return true, 0
+}
+
+// Status is the RESOURCE_EXHAUSTED status returned for a rejected request,
+// carrying a RetryInfo detail with the delay until the next token.
+func Status(wait time.Duration) *status.Status {
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	if withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)}); err == nil {
+		return withInfo
+	}
+	return st
+}
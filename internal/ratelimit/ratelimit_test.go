@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLimiter(qps float64) (*Limiter, *time.Time) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(qps)
+	l.lastFill = clock
+	l.now = func() time.Time { return clock }
+	return l, &clock
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	l, _ := newTestLimiter(5)
+
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.Allow(); !ok {
+			t.Fatalf("Expected request %d within the burst to be allowed", i+1)
+		}
+	}
+
+	ok, wait := l.Allow()
+	if ok {
+		t.Fatal("Expected request past the burst to be rejected")
+	}
+	if wait != 200*time.Millisecond {
+		t.Errorf("Expected retry after 200ms, got %v", wait)
+	}
+}
+
+func TestLimiter_Refill(t *testing.T) {
+	l, clock := newTestLimiter(2)
+
+	l.Allow()
+	l.Allow()
+	if ok, _ := l.Allow(); ok {
+		t.Fatal("Expected empty bucket to reject")
+	}
+
+	*clock = clock.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow(); !ok {
+		t.Error("Expected one token after 500ms at 2 qps")
+	}
+	if ok, _ := l.Allow(); ok {
+		t.Error("Expected only one token to have refilled")
+	}
+
+	// The bucket never holds more than one second's worth
+	*clock = clock.Add(time.Minute)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.Allow(); ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Expected a full bucket to allow 2 requests, got %d", allowed)
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	l := New(0)
+	if l != nil {
+		t.Fatalf("Expected nil limiter for qps 0, got %+v", l)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow(); !ok {
+			t.Fatal("Expected nil limiter to allow every request")
+		}
+	}
+}
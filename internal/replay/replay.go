@@ -0,0 +1,170 @@
+// Package replay aggregates authorization outcomes from JSONL trace files
+// produced by the emulator.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+)
+
+// Counts holds allow/deny totals for one key.
+type Counts struct {
+	Allow int
+	Deny  int
+}
+
+// Entry is a key with its counts, used for ranked output.
+type Entry struct {
+	Key string
+	Counts
+}
+
+// Stats summarizes the authz_check events in a trace.
+type Stats struct {
+	Total   int
+	Allowed int
+	Denied  int
+	// Skipped counts lines that are not authz_check events, such as
+	// authz_error events or legacy slog lines sharing the trace file.
+	Skipped      int
+	ByPrincipal  map[string]*Counts
+	ByPermission map[string]*Counts
+}
+
+// Read decodes a JSONL trace and aggregates its authz_check events.
+func Read(r io.Reader) (*Stats, error) {
+	stats := &Stats{
+		ByPrincipal:  make(map[string]*Counts),
+		ByPermission: make(map[string]*Counts),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var event trace.AuthzEvent
+		if err := json.Unmarshal([]byte(text), &event); err != nil {
+			return nil, fmt.Errorf("line %d: invalid JSON: %w", line, err)
+		}
+
+		if event.EventType != trace.EventTypeAuthzCheck || event.Decision == nil {
+			stats.Skipped++
+			continue
+		}
+
+		stats.add(&event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (s *Stats) add(event *trace.AuthzEvent) {
+	principal := ""
+	if event.Actor != nil {
+		principal = event.Actor.Principal
+	}
+	if principal == "" {
+		principal = "(anonymous)"
+	}
+
+	permission := ""
+	if event.Action != nil {
+		permission = event.Action.Permission
+	}
+
+	s.Total++
+	allowed := event.Decision.Outcome == trace.OutcomeAllow
+	if allowed {
+		s.Allowed++
+	} else {
+		s.Denied++
+	}
+
+	increment(s.ByPrincipal, principal, allowed)
+	increment(s.ByPermission, permission, allowed)
+}
+
+func increment(counts map[string]*Counts, key string, allowed bool) {
+	c, ok := counts[key]
+	if !ok {
+		c = &Counts{}
+		counts[key] = c
+	}
+	if allowed {
+		c.Allow++
+	} else {
+		c.Deny++
+	}
+}
+
+// TopDeniedPermissions returns up to n permissions ordered by deny count.
+func (s *Stats) TopDeniedPermissions(n int) []Entry {
+	return topDenied(s.ByPermission, n)
+}
+
+// TopDeniedPrincipals returns up to n principals ordered by deny count.
+func (s *Stats) TopDeniedPrincipals(n int) []Entry {
+	return topDenied(s.ByPrincipal, n)
+}
+
+func topDenied(counts map[string]*Counts, n int) []Entry {
+	var entries []Entry
+	for key, c := range counts {
+		if c.Deny > 0 {
+			entries = append(entries, Entry{Key: key, Counts: *c})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Deny != entries[j].Deny {
+			return entries[i].Deny > entries[j].Deny
+		}
+		return entries[i].Key < entries[j].Key
+	})
+
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Print writes a human-readable summary, listing up to top entries per table.
+func (s *Stats) Print(w io.Writer, top int) {
+	fmt.Fprintf(w, "Events: %d (allowed: %d, denied: %d", s.Total, s.Allowed, s.Denied)
+	if s.Skipped > 0 {
+		fmt.Fprintf(w, ", skipped: %d", s.Skipped)
+	}
+	fmt.Fprintln(w, ")")
+	fmt.Fprintf(w, "Principals: %d, permissions: %d\n", len(s.ByPrincipal), len(s.ByPermission))
+
+	printTable(w, "Top denied permissions", s.TopDeniedPermissions(top))
+	printTable(w, "Principals with most denies", s.TopDeniedPrincipals(top))
+}
+
+func printTable(w io.Writer, title string, entries []Entry) {
+	fmt.Fprintf(w, "\n%s:\n", title)
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "  (none)")
+		return
+	}
+	for _, e := range entries {
+		fmt.Fprintf(w, "  %6d denied  %6d allowed  %s\n", e.Deny, e.Allow, e.Key)
+	}
+}
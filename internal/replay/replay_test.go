@@ -0,0 +1,84 @@
+package replay
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRead_Fixture(t *testing.T) {
+	f, err := os.Open("testdata/trace.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	stats, err := Read(f)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if stats.Total != 6 || stats.Allowed != 2 || stats.Denied != 4 {
+		t.Errorf("Expected 6 events (2 allowed, 4 denied), got %d (%d allowed, %d denied)", stats.Total, stats.Allowed, stats.Denied)
+	}
+
+	if stats.Skipped != 1 {
+		t.Errorf("Expected 1 skipped line, got %d", stats.Skipped)
+	}
+
+	perms := stats.TopDeniedPermissions(0)
+	if len(perms) != 2 {
+		t.Fatalf("Expected 2 denied permissions, got %v", perms)
+	}
+	if perms[0].Key != "secretmanager.secrets.delete" || perms[0].Deny != 3 {
+		t.Errorf("Expected secretmanager.secrets.delete with 3 denies first, got %+v", perms[0])
+	}
+	if perms[1].Key != "secretmanager.versions.access" || perms[1].Deny != 1 || perms[1].Allow != 1 {
+		t.Errorf("Expected secretmanager.versions.access with 1 deny and 1 allow, got %+v", perms[1])
+	}
+
+	principals := stats.TopDeniedPrincipals(1)
+	if len(principals) != 1 {
+		t.Fatalf("Expected top-1 principal, got %v", principals)
+	}
+	if principals[0].Key != "user:bob@example.com" || principals[0].Deny != 3 {
+		t.Errorf("Expected bob with 3 denies, got %+v", principals[0])
+	}
+
+	if c := stats.ByPrincipal["serviceAccount:ci@test.iam.gserviceaccount.com"]; c == nil || c.Allow != 1 || c.Deny != 0 {
+		t.Errorf("Expected ci service account with 1 allow, got %+v", c)
+	}
+}
+
+func TestRead_InvalidJSON(t *testing.T) {
+	_, err := Read(strings.NewReader("{\"event_type\":\"authz_check\"}\nnot json\n"))
+	if err == nil {
+		t.Fatal("Expected error for invalid JSON")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error to reference line 2, got %v", err)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	f, err := os.Open("testdata/trace.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	stats, err := Read(f)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	stats.Print(&out, 10)
+
+	for _, want := range []string{"Events: 6 (allowed: 2, denied: 4, skipped: 1)", "Top denied permissions", "user:bob@example.com"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
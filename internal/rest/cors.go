@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods = "GET, POST, OPTIONS"
+	corsAllowHeaders = "Authorization, Content-Type, X-Emulator-Principal, X-Emulator-Require-All"
+)
+
+// SetCORSOrigins allows browsers on the given origins (e.g.
+// http://localhost:3000, or "*" for any) to call the REST API. CORS is
+// disabled when origins is empty, the default.
+func (s *Server) SetCORSOrigins(origins []string) {
+	s.corsOrigins = nil
+	for _, origin := range origins {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			s.corsOrigins = append(s.corsOrigins, origin)
+		}
+	}
+}
+
+func (s *Server) corsAllowed(origin string) bool {
+	for _, allowed := range s.corsOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// cors adds CORS headers for allowed origins and answers preflight requests
+// itself, so handlers only see the actual request.
+func (s *Server) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !s.corsAllowed(origin) {
+			next(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Methods", corsAllowMethods)
+		header.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		header.Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+func newCORSTestServer(t *testing.T, origins ...string) *httptest.Server {
+	t.Helper()
+
+	restServer := NewServer(storage.NewStorage(), false)
+	restServer.SetCORSOrigins(origins)
+	mux := http.NewServeMux()
+	restServer.RegisterHandlers(mux)
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	ts := newCORSTestServer(t, "http://localhost:3000")
+
+	req, err := http.NewRequest(http.MethodOptions, ts.URL+"/v1/projects/test:testIamPermissions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-Emulator-Principal")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("OPTIONS failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("Expected origin to be echoed, got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Methods"); !strings.Contains(got, "POST") {
+		t.Errorf("Expected POST to be allowed, got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "X-Emulator-Principal") {
+		t.Errorf("Expected X-Emulator-Principal to be allowed, got %q", got)
+	}
+}
+
+func TestCORS_ActualRequest(t *testing.T) {
+	ts := newCORSTestServer(t, "*")
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "http://admin.example.com")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "http://admin.example.com" {
+		t.Errorf("Expected origin to be echoed, got %q", got)
+	}
+}
+
+func TestCORS_DisabledOrDisallowed(t *testing.T) {
+	for name, ts := range map[string]*httptest.Server{
+		"disabled":           newCORSTestServer(t),
+		"origin not allowed": newCORSTestServer(t, "http://localhost:3000"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/healthz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Origin", "http://evil.example.com")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+				t.Errorf("Expected no CORS headers, got Access-Control-Allow-Origin %q", got)
+			}
+		})
+	}
+}
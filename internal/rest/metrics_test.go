@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetric returns the value of the sample whose name and labels render
+// as series in ts's GET /metrics output, or 0 if it is absent.
+func scrapeMetric(t *testing.T, ts *httptest.Server, series string) float64 {
+	t.Helper()
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), series+" ")
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("Failed to parse %s value %q: %v", series, value, err)
+		}
+		return parsed
+	}
+	return 0
+}
+
+func postAsAlice(t *testing.T, ts *httptest.Server, path, body string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("X-Emulator-Principal", "user:alice@example.com")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", path, err)
+	}
+	resp.Body.Close()
+}
+
+func TestMetrics_CountRESTRequests(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	okSeries := `iam_emulator_setiampolicy_total{code="OK"}`
+	invalidSeries := `iam_emulator_setiampolicy_total{code="InvalidArgument"}`
+	allowSeries := `iam_emulator_authz_decisions_total{outcome="allow",permission="pubsub.topics.get"}`
+	denySeries := `iam_emulator_authz_decisions_total{outcome="deny",permission="pubsub.topics.delete"}`
+	okBefore := scrapeMetric(t, ts, okSeries)
+	invalidBefore := scrapeMetric(t, ts, invalidSeries)
+	allowBefore := scrapeMetric(t, ts, allowSeries)
+	denyBefore := scrapeMetric(t, ts, denySeries)
+	checksBefore := scrapeMetric(t, ts, "iam_emulator_testiampermissions_duration_seconds_count")
+
+	policy := `{"policy": {"bindings": [{"role": "roles/viewer", "members": ["user:alice@example.com"]}]}}`
+	postAsAlice(t, ts, "/v1/projects/rest-metrics:setIamPolicy", policy)
+	postAsAlice(t, ts, "/v1/projects/rest-metrics:setIamPolicy?dryRun=true", policy)
+	postAsAlice(t, ts, "/v1/projects/rest-metrics:setIamPolicy", `{}`)
+
+	postAsAlice(t, ts, "/v1/projects/rest-metrics:testIamPermissions", `{"permissions": ["pubsub.topics.get", "pubsub.topics.delete"]}`)
+	postAsAlice(t, ts, "/v1/batchTestIamPermissions", `[{"resource": "projects/rest-metrics", "permissions": ["pubsub.topics.get"]}]`)
+
+	if got := scrapeMetric(t, ts, okSeries) - okBefore; got != 1 {
+		t.Errorf("Expected OK counter to increase by 1, excluding the dry run, got %v", got)
+	}
+	if got := scrapeMetric(t, ts, invalidSeries) - invalidBefore; got != 1 {
+		t.Errorf("Expected InvalidArgument counter to increase by 1, got %v", got)
+	}
+	if got := scrapeMetric(t, ts, allowSeries) - allowBefore; got != 2 {
+		t.Errorf("Expected allow counter to increase by 2, got %v", got)
+	}
+	if got := scrapeMetric(t, ts, denySeries) - denyBefore; got != 1 {
+		t.Errorf("Expected deny counter to increase by 1, got %v", got)
+	}
+	if got := scrapeMetric(t, ts, "iam_emulator_testiampermissions_duration_seconds_count") - checksBefore; got != 2 {
+		t.Errorf("Expected two latency observations, got %v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+// principalFromRequest identifies the caller from, in order, the email in an
+// Authorization: Bearer JWT, the X-Emulator-Principal header, or
+// storage.AnonymousPrincipal.
+func principalFromRequest(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if principal, ok := principalFromJWT(strings.TrimSpace(token)); ok {
+			return principal
+		}
+	}
+
+	if principal := r.Header.Get("X-Emulator-Principal"); principal != "" {
+		return principal
+	}
+
+	return storage.AnonymousPrincipal
+}
+
+// principalFromJWT maps the email (or email-shaped sub) claim of an
+// unverified JWT to serviceAccount:<email> for service account emails and
+// user:<email> otherwise. The signature is not checked; this is an emulator.
+func principalFromJWT(token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", false
+	}
+
+	var claims struct {
+		Email string `json:"email"`
+		Sub   string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", false
+	}
+
+	email := claims.Email
+	if email == "" && strings.Contains(claims.Sub, "@") {
+		email = claims.Sub
+	}
+	if email == "" {
+		return "", false
+	}
+
+	if strings.HasSuffix(email, ".gserviceaccount.com") {
+		return "serviceAccount:" + email, true
+	}
+	return "user:" + email, true
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+func testJWT(payload string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encode([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestPrincipalFromRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		header        string
+		want          string
+	}{
+		{"user email claim", "Bearer " + testJWT(`{"email":"alice@example.com","sub":"1234567890"}`), "", "user:alice@example.com"},
+		{"service account email claim", "Bearer " + testJWT(`{"email":"ci@test.iam.gserviceaccount.com"}`), "", "serviceAccount:ci@test.iam.gserviceaccount.com"},
+		{"sub claim", "Bearer " + testJWT(`{"sub":"bob@example.com"}`), "", "user:bob@example.com"},
+		{"token wins over header", "Bearer " + testJWT(`{"email":"alice@example.com"}`), "user:bob@example.com", "user:alice@example.com"},
+		{"numeric sub falls back to header", "Bearer " + testJWT(`{"sub":"1234567890"}`), "user:bob@example.com", "user:bob@example.com"},
+		{"opaque token falls back to header", "Bearer ya29.opaque-token", "user:bob@example.com", "user:bob@example.com"},
+		{"plain header", "", "serviceAccount:ci@test.iam.gserviceaccount.com", "serviceAccount:ci@test.iam.gserviceaccount.com"},
+		{"anonymous", "", "", "user:anonymous"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/v1/projects/test:testIamPermissions", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Emulator-Principal", tt.header)
+			}
+
+			if got := principalFromRequest(r); got != tt.want {
+				t.Errorf("principalFromRequest() = %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestIamPermissions_BearerToken(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/projects/test:testIamPermissions", strings.NewReader(`{"permissions": ["secretmanager.secrets.get"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testJWT(`{"email":"alice@example.com"}`))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(out.Permissions) != 1 {
+		t.Errorf("Expected the token's principal to be granted, got %v", out.Permissions)
+	}
+}
@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/ratelimit"
+)
+
+// SetRateLimiter makes the API routes under /v1/ answer 429 with a
+// Retry-After header once limiter runs out of tokens. A nil limiter (the
+// default) allows every request.
+func (s *Server) SetRateLimiter(limiter *ratelimit.Limiter) {
+	s.limiter = limiter
+}
+
+// rateLimit rejects requests the limiter refuses before they reach next.
+func (s *Server) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := s.limiter.Allow()
+		if ok {
+			next(w, r)
+			return
+		}
+
+		// Retry-After takes whole seconds; round up so clients that honor
+		// it find a token waiting
+		seconds := int(math.Max(1, math.Ceil(wait.Seconds())))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		s.writeError(w, ratelimit.Status(wait).Err())
+	}
+}
@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/ratelimit"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+func TestRateLimit(t *testing.T) {
+	restServer := NewServer(storage.NewStorage(), false)
+	restServer.SetRateLimiter(ratelimit.New(0.01))
+	mux := http.NewServeMux()
+	restServer.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// At 0.01 qps the bucket holds a single token and takes 100s to refill
+	if resp := get("/v1/projects/test:getIamPolicy"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the first request to succeed, got %d", resp.StatusCode)
+	}
+
+	resp := get("/v1/projects/test:getIamPolicy")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 past the burst, got %d", resp.StatusCode)
+	}
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || retryAfter < 90 {
+		t.Errorf("Expected Retry-After of about 100 seconds, got %q", resp.Header.Get("Retry-After"))
+	}
+
+	// Health probes are never rate limited
+	if resp := get("/healthz"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected /healthz to bypass the rate limit, got %d", resp.StatusCode)
+	}
+}
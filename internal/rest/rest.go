@@ -1,23 +1,47 @@
 package rest
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	rpccode "google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/metrics"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/ratelimit"
 	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/tracebuf"
 )
 
 type Server struct {
 	storage *storage.Storage
 	trace   bool
+	events  *tracebuf.Buffer
+	ready   atomic.Bool
+	// snapshotEnabled exposes GET /debug/snapshot and POST /debug/restore
+	snapshotEnabled bool
+	// adminEnabled exposes POST /debug/reset
+	adminEnabled bool
+	// corsOrigins are the browser origins allowed to call the API; empty
+	// disables CORS
+	corsOrigins []string
+	// limiter, when set, rate limits the API routes under /v1/
+	limiter *ratelimit.Limiter
 }
 
 func NewServer(store *storage.Storage, trace bool) *Server {
@@ -27,21 +51,228 @@ func NewServer(store *storage.Storage, trace bool) *Server {
 	}
 }
 
+func (s *Server) SetEventBuffer(buffer *tracebuf.Buffer) {
+	s.events = buffer
+}
+
+// SetSnapshotEnabled enables GET /debug/snapshot and POST /debug/restore,
+// which dump and replace the entire emulator state.
+func (s *Server) SetSnapshotEnabled(enabled bool) {
+	s.snapshotEnabled = enabled
+}
+
+// SetAdminEnabled enables POST /debug/reset, which discards all emulator
+// state, and GET /debug/groups, which lists a principal's groups.
+func (s *Server) SetAdminEnabled(enabled bool) {
+	s.adminEnabled = enabled
+}
+
+// SetReady reports whether initial config loading has finished, for GET
+// /readyz.
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
 func (s *Server) RegisterHandlers(mux *http.ServeMux) {
-	mux.HandleFunc("/v1/", s.handleRequest)
+	mux.HandleFunc("/healthz", s.cors(s.handleHealthz))
+	mux.HandleFunc("/readyz", s.cors(s.handleReadyz))
+	mux.HandleFunc("/v1/", s.cors(s.rateLimit(s.handleRequest)))
+	mux.HandleFunc("/v1/batchTestIamPermissions", s.cors(s.rateLimit(s.handleBatchTestIamPermissions)))
+	mux.HandleFunc("/v1/trace/events", s.cors(s.rateLimit(s.handleTraceEvents)))
+	mux.HandleFunc("/v1/roles/coverage", s.cors(s.rateLimit(s.handleRoleCoverage)))
+	mux.HandleFunc("/debug/groups", s.cors(s.handleDebugGroups))
+	mux.HandleFunc("/debug/snapshot", s.cors(s.handleDebugSnapshot))
+	mux.HandleFunc("/debug/restore", s.cors(s.handleDebugRestore))
+	mux.HandleFunc("/debug/reset", s.cors(s.handleDebugReset))
+	mux.Handle("/metrics", promhttp.Handler())
 }
 
-func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
+// handleHealthz reports that the server is up; it never fails once serving.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be GET"))
+		return
+	}
+
+	s.writeJSON(w, map[string]interface{}{"status": "ok"})
+}
+
+// handleReadyz reports 503 until SetReady(true), i.e. until the initial config
+// has loaded.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be GET"))
+		return
+	}
+
+	if !s.ready.Load() {
+		s.writeError(w, status.Error(codes.Unavailable, "not ready: initial config load has not completed"))
+		return
+	}
+
+	s.writeJSON(w, map[string]interface{}{"status": "ready"})
+}
+
+func (s *Server) handleTraceEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be GET"))
+		return
+	}
+
+	if s.events == nil {
+		s.writeError(w, status.Error(codes.FailedPrecondition, "trace event buffer is disabled (use --trace-buffer-size)"))
+		return
+	}
+
+	events := s.events.Events()
+	if r.URL.Query().Get("clear") == "true" {
+		events = s.events.Drain()
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"events": events,
+	})
+}
+
+// handleRoleCoverage reports each role's permission count and how much of a
+// reference role (?reference=, default roles/owner) it covers.
+func (s *Server) handleRoleCoverage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be GET"))
+		return
+	}
+
+	reference := r.URL.Query().Get("reference")
+	if reference == "" {
+		reference = "roles/owner"
+	}
+
+	report, err := s.storage.RoleCoverageReport(reference)
+	if err != nil {
+		s.writeError(w, status.Error(codes.NotFound, err.Error()))
+		return
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"reference": reference,
+		"roles":     report,
+	})
+}
+
+// handleDebugGroups lists the groups ?principal= belongs to, directly or
+// through nested groups. Like /debug/reset it requires --allow-admin, since it
+// discloses group membership to any caller.
+func (s *Server) handleDebugGroups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be GET"))
+		return
+	}
+
+	if !s.adminEnabled {
+		s.writeError(w, status.Error(codes.FailedPrecondition, "admin endpoints are disabled (use --allow-admin)"))
+		return
+	}
+
+	principal := r.URL.Query().Get("principal")
+	if principal == "" {
+		s.writeError(w, status.Error(codes.InvalidArgument, "principal is required"))
+		return
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"principal": principal,
+		"groups":    s.storage.ResolvePrincipalGroups(principal),
+	})
+}
+
+// handleDebugSnapshot writes the entire emulator state as JSON, in the form
+// POST /debug/restore accepts.
+func (s *Server) handleDebugSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be GET"))
+		return
+	}
+
+	if !s.snapshotEnabled {
+		s.writeError(w, status.Error(codes.FailedPrecondition, "snapshot endpoints are disabled (use --enable-snapshot)"))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := s.storage.Snapshot(&buf); err != nil {
+		s.writeError(w, status.Error(codes.Internal, err.Error()))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Failed to write snapshot response: %v", err)
+	}
+}
+
+// handleDebugRestore replaces the entire emulator state with a snapshot from
+// GET /debug/snapshot.
+func (s *Server) handleDebugRestore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST"))
+		return
+	}
+
+	if !s.snapshotEnabled {
+		s.writeError(w, status.Error(codes.FailedPrecondition, "snapshot endpoints are disabled (use --enable-snapshot)"))
+		return
+	}
+
+	if err := s.storage.Restore(r.Body); err != nil {
+		s.writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	s.writeJSON(w, map[string]interface{}{"status": "restored"})
+}
+
+// handleDebugReset discards all emulator state, as if the process had just
+// started without a config.
+func (s *Server) handleDebugReset(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), ":")
-	if len(parts) < 2 {
-		s.writeError(w, status.Error(codes.InvalidArgument, "invalid path format"))
+	if r.Method != http.MethodPost {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST"))
+		return
+	}
+
+	if !s.adminEnabled {
+		s.writeError(w, status.Error(codes.FailedPrecondition, "admin endpoints are disabled (use --allow-admin)"))
 		return
 	}
 
-	resource := parts[0]
-	method := parts[1]
+	s.storage.Clear()
+
+	s.writeJSON(w, map[string]interface{}{"status": "reset"})
+}
+
+func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	resource, method, err := parseResourcePath(strings.TrimPrefix(r.URL.EscapedPath(), "/v1/"))
+	if err != nil {
+		s.writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
 
 	switch method {
 	case "setIamPolicy":
@@ -50,17 +281,189 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 		s.handleGetIamPolicy(w, r, resource)
 	case "testIamPermissions":
 		s.handleTestIamPermissions(w, r, resource)
+	case "getEffectiveAuditConfigs":
+		s.handleGetEffectiveAuditConfigs(w, r, resource)
+	case "getDenyPolicy":
+		s.handleGetDenyPolicy(w, r, resource)
+	case "evaluateConditions":
+		s.handleEvaluateConditions(w, r, resource)
+	case "movePolicy":
+		s.handleMovePolicy(w, r, resource)
+	case "explainIamPermission":
+		s.handleExplainIamPermission(w, r, resource)
 	default:
 		s.writeError(w, status.Errorf(codes.Unimplemented, "unknown method: %s", method))
 	}
 }
 
+// parseResourcePath splits an escaped "{resource}:{method}" path on its last
+// colon, so resource names may contain colons, and URL-decodes the resource.
+func parseResourcePath(path string) (resource, method string, err error) {
+	sep := strings.LastIndex(path, ":")
+	if sep < 0 {
+		return "", "", fmt.Errorf("invalid path format: expected {resource}:{method}")
+	}
+
+	method = path[sep+1:]
+	if method == "" {
+		return "", "", fmt.Errorf("invalid path format: missing method after ':'")
+	}
+
+	resource, err = url.PathUnescape(path[:sep])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid resource name: %v", err)
+	}
+	if resource == "" {
+		return "", "", fmt.Errorf("invalid path format: missing resource before ':'")
+	}
+
+	return resource, method, nil
+}
+
 func (s *Server) handleSetIamPolicy(w http.ResponseWriter, r *http.Request, resource string) {
 	if r.Method != http.MethodPost {
 		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST"))
 		return
 	}
 
+	// ?dryRun=true runs every check and returns the resulting policy
+	// without storing it, so it is not counted as a write
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	policy, err := s.setIamPolicy(r, resource, dryRun)
+	if !dryRun {
+		metrics.RecordSetIamPolicy(err)
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.writeJSON(w, protoJSON(policy))
+}
+
+// setIamPolicy decodes the request's policy and stores it, or only validates
+// it for a dry run. Errors are gRPC status errors.
+func (s *Server) setIamPolicy(r *http.Request, resource string, dryRun bool) (*iampb.Policy, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "failed to read request body")
+	}
+
+	var req struct {
+		Policy json.RawMessage `json:"policy"`
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid JSON: %v", err))
+	}
+
+	if len(req.Policy) == 0 || string(req.Policy) == "null" {
+		return nil, status.Error(codes.InvalidArgument, "policy is required")
+	}
+
+	// The policy is decoded with protojson so GCP's field names
+	// (auditConfigs, auditLogConfigs, logType) and enum strings are accepted
+	requested := &iampb.Policy{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(req.Policy, requested); err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid policy: %v", err))
+	}
+
+	store := s.storage.SetIamPolicy
+	if dryRun {
+		store = s.storage.ValidateIamPolicy
+	}
+
+	policy, err := store(resource, requested)
+	if err != nil {
+		if errors.Is(err, storage.ErrEtagMismatch) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, storage.ErrUnsupportedCondition) || errors.Is(err, storage.ErrPublicGrant) || errors.Is(err, storage.ErrInvalidRole) || errors.Is(err, storage.ErrPolicyTooLarge) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return policy, nil
+}
+
+func (s *Server) handleGetIamPolicy(w http.ResponseWriter, r *http.Request, resource string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST or GET"))
+		return
+	}
+
+	options, err := getPolicyOptions(r)
+	if err != nil {
+		s.writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	// Requests without options ask for version 0, as in gRPC, so conditional
+	// bindings are only returned to callers that request version 3
+	policy, err := s.storage.GetIamPolicyForVersion(resource, options.GetRequestedPolicyVersion())
+	if err != nil {
+		s.writeError(w, status.Error(codes.NotFound, err.Error()))
+		return
+	}
+
+	// Non-standard debugging aid: GCP never returns inherited bindings
+	if r.URL.Query().Get("includeInherited") == "true" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(protoJSON(policy), &fields); err != nil {
+			s.writeError(w, status.Error(codes.Internal, err.Error()))
+			return
+		}
+		inherited, err := json.Marshal(s.storage.GetInheritedBindings(resource))
+		if err != nil {
+			s.writeError(w, status.Error(codes.Internal, err.Error()))
+			return
+		}
+		fields["inheritedBindings"] = inherited
+		s.writeJSON(w, fields)
+		return
+	}
+
+	s.writeJSON(w, protoJSON(policy))
+}
+
+// getPolicyOptions reads GetPolicyOptions from a POST body of the form
+// {"options":{"requestedPolicyVersion":3}} or, for GET, from the
+// options.requestedPolicyVersion query parameter. It returns nil when the
+// request carries no options.
+func getPolicyOptions(r *http.Request) (*iampb.GetPolicyOptions, error) {
+	if r.Method == http.MethodGet {
+		value := r.URL.Query().Get("options.requestedPolicyVersion")
+		if value == "" {
+			return nil, nil
+		}
+		version, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid options.requestedPolicyVersion: %q", value)
+		}
+		return &iampb.GetPolicyOptions{RequestedPolicyVersion: int32(version)}, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body")
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	req := &iampb.GetIamPolicyRequest{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, req); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return req.GetOptions(), nil
+}
+
+func (s *Server) handleTestIamPermissions(w http.ResponseWriter, r *http.Request, resource string) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST"))
+		return
+	}
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		s.writeError(w, status.Error(codes.InvalidArgument, "failed to read request body"))
@@ -68,7 +471,10 @@ func (s *Server) handleSetIamPolicy(w http.ResponseWriter, r *http.Request, reso
 	}
 
 	var req struct {
-		Policy *iampb.Policy `json:"policy"`
+		Permissions []string `json:"permissions"`
+		// RequireAll is an emulator extension that adds an allGranted
+		// verdict to the response
+		RequireAll bool `json:"requireAll"`
 	}
 
 	if err := json.Unmarshal(body, &req); err != nil {
@@ -76,36 +482,186 @@ func (s *Server) handleSetIamPolicy(w http.ResponseWriter, r *http.Request, reso
 		return
 	}
 
-	if req.Policy == nil {
-		s.writeError(w, status.Error(codes.InvalidArgument, "policy is required"))
+	principal := principalFromRequest(r)
+
+	start := time.Now()
+	allowed, err := s.storage.TestIamPermissions(resource, principal, req.Permissions, s.trace)
+	duration := time.Since(start)
+	if err != nil {
+		if errors.Is(err, storage.ErrUnsupportedCondition) {
+			s.writeError(w, status.Error(codes.FailedPrecondition, err.Error()))
+			return
+		}
+		s.writeError(w, status.Error(codes.Internal, err.Error()))
+		return
+	}
+
+	metrics.RecordDecisions(req.Permissions, allowed, duration)
+
+	response := map[string]interface{}{
+		"permissions": allowed,
+	}
+
+	if req.RequireAll || r.Header.Get("X-Emulator-Require-All") == "true" {
+		response["allGranted"] = storage.AllGranted(req.Permissions, allowed)
+	}
+
+	s.writeJSON(w, response)
+}
+
+// handleExplainIamPermission reports how a single permission check was
+// decided: the bindings considered, the roles that granted it, and why. The
+// principal defaults to the caller's (see principalFromRequest).
+func (s *Server) handleExplainIamPermission(w http.ResponseWriter, r *http.Request, resource string) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST"))
 		return
 	}
 
-	policy, err := s.storage.SetIamPolicy(resource, req.Policy)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		s.writeError(w, status.Error(codes.InvalidArgument, "failed to read request body"))
+		return
+	}
+
+	var req struct {
+		Permission string `json:"permission"`
+		Principal  string `json:"principal"`
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeError(w, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid JSON: %v", err)))
+		return
+	}
+
+	if req.Permission == "" {
+		s.writeError(w, status.Error(codes.InvalidArgument, "permission is required"))
+		return
+	}
+
+	principal := req.Principal
+	if principal == "" {
+		principal = principalFromRequest(r)
+	}
+
+	explanation, err := s.storage.ExplainPermission(resource, principal, req.Permission)
+	if err != nil {
+		if errors.Is(err, storage.ErrUnsupportedCondition) {
+			s.writeError(w, status.Error(codes.FailedPrecondition, err.Error()))
+			return
+		}
 		s.writeError(w, status.Error(codes.Internal, err.Error()))
 		return
 	}
 
-	s.writeJSON(w, policy)
+	s.writeJSON(w, explanation)
 }
 
-func (s *Server) handleGetIamPolicy(w http.ResponseWriter, r *http.Request, resource string) {
+// batchTestItem is one check in a batchTestIamPermissions request. Principal
+// defaults to the caller's (see principalFromRequest).
+type batchTestItem struct {
+	Resource    string   `json:"resource"`
+	Permissions []string `json:"permissions"`
+	Principal   string   `json:"principal,omitempty"`
+}
+
+// handleBatchTestIamPermissions runs testIamPermissions for each item in a
+// JSON array and returns the allowed permissions per item, in request order.
+func (s *Server) handleBatchTestIamPermissions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST"))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, status.Error(codes.InvalidArgument, "failed to read request body"))
+		return
+	}
+
+	var items []batchTestItem
+	if err := json.Unmarshal(body, &items); err != nil {
+		s.writeError(w, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid JSON: expected an array of {resource, permissions}: %v", err)))
+		return
+	}
+
+	defaultPrincipal := principalFromRequest(r)
+
+	results := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		if item.Resource == "" {
+			s.writeError(w, status.Errorf(codes.InvalidArgument, "item %d: resource is required", i))
+			return
+		}
+
+		principal := item.Principal
+		if principal == "" {
+			principal = defaultPrincipal
+		}
+
+		start := time.Now()
+		allowed, err := s.storage.TestIamPermissions(item.Resource, principal, item.Permissions, s.trace)
+		duration := time.Since(start)
+		if err != nil {
+			if errors.Is(err, storage.ErrUnsupportedCondition) {
+				s.writeError(w, status.Errorf(codes.FailedPrecondition, "item %d: %v", i, err))
+				return
+			}
+			s.writeError(w, status.Errorf(codes.Internal, "item %d: %v", i, err))
+			return
+		}
+
+		metrics.RecordDecisions(item.Permissions, allowed, duration)
+
+		results = append(results, map[string]interface{}{
+			"resource":    item.Resource,
+			"principal":   principal,
+			"permissions": allowed,
+		})
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"results": results,
+	})
+}
+
+func (s *Server) handleGetEffectiveAuditConfigs(w http.ResponseWriter, r *http.Request, resource string) {
 	if r.Method != http.MethodPost && r.Method != http.MethodGet {
 		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST or GET"))
 		return
 	}
 
-	policy, err := s.storage.GetIamPolicy(resource)
-	if err != nil {
-		s.writeError(w, status.Error(codes.NotFound, err.Error()))
+	auditConfigs := []json.RawMessage{}
+	for _, auditConfig := range s.storage.GetEffectiveAuditConfigs(resource) {
+		auditConfigs = append(auditConfigs, protoJSON(auditConfig))
+	}
+
+	s.writeJSON(w, map[string][]json.RawMessage{
+		"auditConfigs": auditConfigs,
+	})
+}
+
+// handleGetDenyPolicy returns the deny rules attached to a resource. Deny
+// rules live apart from the allow policy returned by getIamPolicy.
+func (s *Server) handleGetDenyPolicy(w http.ResponseWriter, r *http.Request, resource string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST or GET"))
 		return
 	}
 
-	s.writeJSON(w, policy)
+	response := map[string]interface{}{
+		"resource": resource,
+		"rules":    s.storage.GetDenyPolicy(resource),
+	}
+
+	s.writeJSON(w, response)
 }
 
-func (s *Server) handleTestIamPermissions(w http.ResponseWriter, r *http.Request, resource string) {
+// handleMovePolicy relocates a resource's allow policy to the destination
+// resource in the request body and returns the moved policy.
+func (s *Server) handleMovePolicy(w http.ResponseWriter, r *http.Request, resource string) {
 	if r.Method != http.MethodPost {
 		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST"))
 		return
@@ -118,7 +674,7 @@ func (s *Server) handleTestIamPermissions(w http.ResponseWriter, r *http.Request
 	}
 
 	var req struct {
-		Permissions []string `json:"permissions"`
+		Destination string `json:"destination"`
 	}
 
 	if err := json.Unmarshal(body, &req); err != nil {
@@ -126,22 +682,77 @@ func (s *Server) handleTestIamPermissions(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	principal := r.Header.Get("X-Emulator-Principal")
-	if principal == "" {
-		principal = "user:anonymous"
+	if req.Destination == "" {
+		s.writeError(w, status.Error(codes.InvalidArgument, "destination is required"))
+		return
 	}
 
-	allowed, err := s.storage.TestIamPermissions(resource, principal, req.Permissions, s.trace)
+	if err := s.storage.MovePolicy(resource, req.Destination); err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			s.writeError(w, status.Error(codes.NotFound, err.Error()))
+		case strings.Contains(err.Error(), "already exists"):
+			s.writeError(w, status.Error(codes.AlreadyExists, err.Error()))
+		default:
+			s.writeError(w, status.Error(codes.Internal, err.Error()))
+		}
+		return
+	}
+
+	policy, err := s.storage.GetIamPolicy(req.Destination)
 	if err != nil {
 		s.writeError(w, status.Error(codes.Internal, err.Error()))
 		return
 	}
 
-	response := map[string][]string{
-		"permissions": allowed,
+	s.writeJSON(w, protoJSON(policy))
+}
+
+// handleEvaluateConditions reports the result of every conditional binding on
+// a resource regardless of principal. The context can be overridden with
+// requestTime and resourceService, in the JSON body or as query parameters.
+func (s *Server) handleEvaluateConditions(w http.ResponseWriter, r *http.Request, resource string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		s.writeError(w, status.Error(codes.InvalidArgument, "method must be POST or GET"))
+		return
 	}
 
-	s.writeJSON(w, response)
+	var req struct {
+		RequestTime     string `json:"requestTime"`
+		ResourceService string `json:"resourceService"`
+	}
+
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.writeError(w, status.Error(codes.InvalidArgument, "failed to read request body"))
+			return
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				s.writeError(w, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid JSON: %v", err)))
+				return
+			}
+		}
+	} else {
+		req.RequestTime = r.URL.Query().Get("requestTime")
+		req.ResourceService = r.URL.Query().Get("resourceService")
+	}
+
+	override := storage.EvalContext{ResourceService: req.ResourceService}
+	if req.RequestTime != "" {
+		requestTime, err := time.Parse(time.RFC3339, req.RequestTime)
+		if err != nil {
+			s.writeError(w, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid requestTime: %v", err)))
+			return
+		}
+		override.RequestTime = requestTime
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"resource": resource,
+		"results":  s.storage.EvaluateConditions(resource, override),
+	})
 }
 
 func (s *Server) writeJSON(w http.ResponseWriter, data interface{}) {
@@ -151,6 +762,18 @@ func (s *Server) writeJSON(w http.ResponseWriter, data interface{}) {
 	}
 }
 
+// protoJSON encodes m with the JSON field names and enum strings GCP's REST
+// API uses (auditConfigs, logType: "DATA_READ"), which encoding/json would
+// spell audit_configs and log_type: 1.
+func protoJSON(m proto.Message) json.RawMessage {
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		log.Printf("Failed to encode %T: %v", m, err)
+		return json.RawMessage("{}")
+	}
+	return data
+}
+
 func (s *Server) writeError(w http.ResponseWriter, err error) {
 	st := status.Convert(err)
 	
@@ -158,11 +781,14 @@ func (s *Server) writeError(w http.ResponseWriter, err error) {
 	
 	errResponse := map[string]interface{}{
 		"error": map[string]interface{}{
-			"code":    int(st.Code()),
+			"code":    httpCode,
 			"message": st.Message(),
-			"status":  st.Code().String(),
+			"status":  rpccode.Code(st.Code()).String(),
 		},
 	}
+	if details := errorDetails(st); len(details) > 0 {
+		errResponse["error"].(map[string]interface{})["details"] = details
+	}
 
 	w.WriteHeader(httpCode)
 	if err := json.NewEncoder(w).Encode(errResponse); err != nil {
@@ -170,6 +796,22 @@ func (s *Server) writeError(w http.ResponseWriter, err error) {
 	}
 }
 
+// errorDetails renders the status details as JSON objects carrying their
+// "@type", matching the details array in Google's error format. Details whose
+// message type is not linked into the binary are skipped.
+func errorDetails(st *status.Status) []json.RawMessage {
+	var details []json.RawMessage
+	for _, detail := range st.Proto().GetDetails() {
+		data, err := protojson.Marshal(detail)
+		if err != nil {
+			log.Printf("Failed to encode error detail %s: %v", detail.GetTypeUrl(), err)
+			continue
+		}
+		details = append(details, data)
+	}
+	return details
+}
+
 func grpcCodeToHTTP(code codes.Code) int {
 	switch code {
 	case codes.OK:
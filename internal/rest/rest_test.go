@@ -0,0 +1,1284 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/tracebuf"
+)
+
+func newTestServer(t *testing.T) (*storage.Storage, *httptest.Server) {
+	t.Helper()
+
+	store := storage.NewStorage()
+	mux := http.NewServeMux()
+	NewServer(store, false).RegisterHandlers(mux)
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	return store, ts
+}
+
+func TestSetGetIamPolicy_AuditConfigs(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	body := `{"policy": {
+		"bindings": [{"role": "roles/viewer", "members": ["user:alice@example.com"]}],
+		"auditConfigs": [{
+			"service": "secretmanager.googleapis.com",
+			"auditLogConfigs": [{"logType": "DATA_READ", "exemptedMembers": ["user:bob@example.com"]}]
+		}]
+	}}`
+	resp, err := http.Post(ts.URL+"/v1/projects/test:setIamPolicy", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/projects/test:getIamPolicy")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var policy struct {
+		AuditConfigs []struct {
+			Service         string `json:"service"`
+			AuditLogConfigs []struct {
+				LogType         string   `json:"logType"`
+				ExemptedMembers []string `json:"exemptedMembers"`
+			} `json:"auditLogConfigs"`
+		} `json:"auditConfigs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		t.Fatalf("Failed to decode policy: %v", err)
+	}
+
+	if len(policy.AuditConfigs) != 1 || policy.AuditConfigs[0].Service != "secretmanager.googleapis.com" {
+		t.Fatalf("Expected the secretmanager audit config, got %+v", policy.AuditConfigs)
+	}
+	logConfigs := policy.AuditConfigs[0].AuditLogConfigs
+	if len(logConfigs) != 1 || logConfigs[0].LogType != "DATA_READ" {
+		t.Fatalf("Expected a DATA_READ log config, got %+v", logConfigs)
+	}
+	if len(logConfigs[0].ExemptedMembers) != 1 || logConfigs[0].ExemptedMembers[0] != "user:bob@example.com" {
+		t.Errorf("Expected user:bob@example.com to be exempted, got %v", logConfigs[0].ExemptedMembers)
+	}
+}
+
+func TestSetIamPolicy_DryRun(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	if _, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}},
+	}); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	body := `{"policy": {"bindings": [{"role": "roles/owner", "members": ["user:mallory@example.com"]}]}}`
+	resp, err := http.Post(ts.URL+"/v1/projects/test:setIamPolicy?dryRun=true", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var validated struct {
+		Version  int    `json:"version"`
+		Etag     string `json:"etag"`
+		Bindings []struct {
+			Role string `json:"role"`
+		} `json:"bindings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&validated); err != nil {
+		t.Fatalf("Failed to decode policy: %v", err)
+	}
+	if validated.Version != 1 || validated.Etag == "" || len(validated.Bindings) != 1 || validated.Bindings[0].Role != "roles/owner" {
+		t.Errorf("Expected the policy that would be stored, got %+v", validated)
+	}
+
+	policy, err := store.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 || policy.Bindings[0].Role != "roles/viewer" {
+		t.Errorf("Expected dry run to leave the stored policy unchanged, got %v", policy.Bindings)
+	}
+
+	invalid := `{"policy": {"bindings": [{"role": "viewer", "members": ["user:alice@example.com"]}]}}`
+	resp, err = http.Post(ts.URL+"/v1/projects/test:setIamPolicy?dryRun=true", "application/json", strings.NewReader(invalid))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid role in a dry run, got %d", resp.StatusCode)
+	}
+}
+
+func TestGetIamPolicy_IncludeInherited(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:viewer@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	_, err = store.SetIamPolicy("projects/test/secrets/db-password", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:app@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	type response struct {
+		Bindings          []*iampb.Binding            `json:"bindings"`
+		InheritedBindings []storage.InheritedBindings `json:"inheritedBindings"`
+	}
+
+	get := func(query string) response {
+		resp, err := http.Get(ts.URL + "/v1/projects/test/secrets/db-password:getIamPolicy" + query)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+
+		var body response
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return body
+	}
+
+	own := get("")
+	if len(own.Bindings) != 1 || own.Bindings[0].Role != "roles/secretmanager.secretAccessor" {
+		t.Errorf("Expected only the secret's own binding, got %v", own.Bindings)
+	}
+	if len(own.InheritedBindings) != 0 {
+		t.Errorf("Expected no inherited bindings by default, got %v", own.InheritedBindings)
+	}
+
+	withInherited := get("?includeInherited=true")
+	if len(withInherited.Bindings) != 1 {
+		t.Errorf("Expected own bindings to stay separate, got %v", withInherited.Bindings)
+	}
+	if len(withInherited.InheritedBindings) != 1 {
+		t.Fatalf("Expected 1 inherited policy, got %d", len(withInherited.InheritedBindings))
+	}
+
+	inherited := withInherited.InheritedBindings[0]
+	if inherited.Resource != "projects/test" {
+		t.Errorf("Expected inherited bindings from projects/test, got %s", inherited.Resource)
+	}
+	if len(inherited.Bindings) != 1 || inherited.Bindings[0].Role != "roles/viewer" {
+		t.Errorf("Expected inherited roles/viewer binding, got %v", inherited.Bindings)
+	}
+}
+
+func TestTraceEvents_Endpoint(t *testing.T) {
+	store := storage.NewStorage()
+	buffer := tracebuf.New(10)
+
+	restServer := NewServer(store, false)
+	restServer.SetEventBuffer(buffer)
+
+	mux := http.NewServeMux()
+	restServer.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, perm := range []string{"secretmanager.secrets.get", "secretmanager.secrets.delete"} {
+		buffer.Add(trace.AuthzEvent{
+			SchemaVersion: trace.SchemaV1_0,
+			EventType:     trace.EventTypeAuthzCheck,
+			Action:        &trace.Action{Permission: perm},
+		})
+	}
+
+	fetch := func(query string) []trace.AuthzEvent {
+		resp, err := http.Get(ts.URL + "/v1/trace/events" + query)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+
+		var body struct {
+			Events []trace.AuthzEvent `json:"events"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return body.Events
+	}
+
+	if events := fetch(""); len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	if events := fetch("?clear=true"); len(events) != 2 {
+		t.Fatalf("Expected 2 events on clear-on-read, got %d", len(events))
+	}
+
+	if events := fetch(""); len(events) != 0 {
+		t.Errorf("Expected buffer to be empty after clear, got %d", len(events))
+	}
+}
+
+func TestTraceEvents_Disabled(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/v1/trace/events")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 when buffer disabled, got %d", resp.StatusCode)
+	}
+}
+
+func TestGetDenyPolicy_DenyOnlyResource(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	store.SetDenyPolicy("projects/test/secrets/db-password", []storage.DenyRule{
+		{
+			DeniedPrincipals:  []string{"user:intern@example.com"},
+			DeniedPermissions: []string{"secretmanager.versions.access"},
+		},
+	})
+
+	resp, err := http.Get(ts.URL + "/v1/projects/test/secrets/db-password:getIamPolicy")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var policy struct {
+		Version  int32            `json:"version"`
+		Etag     string           `json:"etag"`
+		Bindings []*iampb.Binding `json:"bindings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		t.Fatalf("Failed to decode policy: %v", err)
+	}
+	if policy.Version != 1 || policy.Etag == "" || len(policy.Bindings) != 0 {
+		t.Errorf("Expected empty allow policy with etag, got %+v", policy)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/projects/test/secrets/db-password:getDenyPolicy")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var deny struct {
+		Resource string             `json:"resource"`
+		Rules    []storage.DenyRule `json:"rules"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&deny); err != nil {
+		t.Fatalf("Failed to decode deny policy: %v", err)
+	}
+	if deny.Resource != "projects/test/secrets/db-password" {
+		t.Errorf("Unexpected resource: %s", deny.Resource)
+	}
+	if len(deny.Rules) != 1 || deny.Rules[0].DeniedPrincipals[0] != "user:intern@example.com" {
+		t.Errorf("Expected the deny rule back, got %+v", deny.Rules)
+	}
+}
+
+func TestTestIamPermissions_AnonymousCaller(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	for resource, member := range map[string]string{
+		"projects/public":        "allUsers",
+		"projects/authenticated": "allAuthenticatedUsers",
+	} {
+		_, err := store.SetIamPolicy(resource, &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{member}}},
+		})
+		if err != nil {
+			t.Fatalf("SetIamPolicy failed: %v", err)
+		}
+	}
+
+	check := func(resource, principal string) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/"+resource+":testIamPermissions", strings.NewReader(`{"permissions": ["secretmanager.secrets.get"]}`))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		if principal != "" {
+			req.Header.Set("X-Emulator-Principal", principal)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var out struct {
+			Permissions []string `json:"permissions"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return len(out.Permissions)
+	}
+
+	if n := check("projects/public", ""); n != 1 {
+		t.Errorf("Expected allUsers to grant an anonymous caller, got %d permissions", n)
+	}
+	if n := check("projects/authenticated", ""); n != 0 {
+		t.Errorf("Expected allAuthenticatedUsers not to grant an anonymous caller, got %d permissions", n)
+	}
+	if n := check("projects/authenticated", "user:alice@example.com"); n != 1 {
+		t.Errorf("Expected allAuthenticatedUsers to grant a signed-in caller, got %d permissions", n)
+	}
+}
+
+func TestTestIamPermissions_RequireAll(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:viewer@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	check := func(body string, header bool) map[string]interface{} {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/projects/test:testIamPermissions", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("X-Emulator-Principal", "user:viewer@example.com")
+		if header {
+			req.Header.Set("X-Emulator-Require-All", "true")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var out map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return out
+	}
+
+	out := check(`{"permissions": ["secretmanager.secrets.get", "secretmanager.secrets.list"], "requireAll": true}`, false)
+	if out["allGranted"] != true {
+		t.Errorf("Expected allGranted=true, got %v", out)
+	}
+
+	out = check(`{"permissions": ["secretmanager.secrets.get", "secretmanager.secrets.delete"]}`, true)
+	if out["allGranted"] != false {
+		t.Errorf("Expected allGranted=false, got %v", out)
+	}
+	if perms, _ := out["permissions"].([]interface{}); len(perms) != 1 {
+		t.Errorf("Expected the allowed subset alongside the verdict, got %v", out["permissions"])
+	}
+
+	out = check(`{"permissions": ["secretmanager.secrets.get"]}`, false)
+	if _, ok := out["allGranted"]; ok {
+		t.Errorf("Expected no allGranted unless requested, got %v", out)
+	}
+}
+
+func TestRoleCoverage_Endpoint(t *testing.T) {
+	store, ts := newTestServer(t)
+	store.LoadCustomRoles(map[string][]string{
+		"roles/custom.reader": {"secretmanager.secrets.get", "secretmanager.secrets.list"},
+	})
+
+	resp, err := http.Get(ts.URL + "/v1/roles/coverage?reference=roles/viewer")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Reference string                 `json:"reference"`
+		Roles     []storage.RoleCoverage `json:"roles"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if body.Reference != "roles/viewer" {
+		t.Errorf("Expected reference roles/viewer, got %s", body.Reference)
+	}
+
+	found := false
+	for _, role := range body.Roles {
+		if role.Role == "roles/custom.reader" {
+			found = true
+			if role.CoveragePercent != 11.1 {
+				t.Errorf("Expected 11.1%% coverage of roles/viewer, got %v", role.CoveragePercent)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected custom role in coverage report")
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/roles/coverage?reference=roles/missing")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown reference, got %d", resp.StatusCode)
+	}
+}
+
+func TestDebugGroups_Endpoint(t *testing.T) {
+	store := storage.NewStorage()
+	restServer := NewServer(store, false)
+	restServer.SetAdminEnabled(true)
+	mux := http.NewServeMux()
+	restServer.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	store.LoadGroups(map[string][]string{
+		"engineering": {"group:platform"},
+		"platform":    {"user:dana@example.com"},
+	})
+
+	resp, err := http.Get(ts.URL + "/debug/groups?principal=user:dana@example.com")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Principal string   `json:"principal"`
+		Groups    []string `json:"groups"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if !reflect.DeepEqual(body.Groups, []string{"engineering", "platform"}) {
+		t.Errorf("Expected groups [engineering platform], got %v", body.Groups)
+	}
+
+	resp, err = http.Get(ts.URL + "/debug/groups")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without principal, got %d", resp.StatusCode)
+	}
+}
+
+func TestDebugGroups_Disabled(t *testing.T) {
+	store, ts := newTestServer(t)
+	store.LoadGroups(map[string][]string{"platform": {"user:dana@example.com"}})
+
+	resp, err := http.Get(ts.URL + "/debug/groups?principal=user:dana@example.com")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without --allow-admin, got %d", resp.StatusCode)
+	}
+}
+
+func TestEvaluateConditions_Endpoint(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+				Condition: &expr.Expr{
+					Expression: `request.time < timestamp("2026-07-01T00:00:00Z")`,
+				},
+			},
+			{
+				Role:    "roles/cloudkms.viewer",
+				Members: []string{"user:ops@example.com"},
+				Condition: &expr.Expr{
+					Expression: `resource.service == "cloudkms.googleapis.com"`,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	body := `{"requestTime": "2026-06-01T00:00:00Z"}`
+	resp, err := http.Post(ts.URL+"/v1/projects/test/secrets/db:evaluateConditions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var report struct {
+		Resource string                    `json:"resource"`
+		Results  []storage.ConditionResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+
+	if len(report.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", report.Results)
+	}
+	if !report.Results[0].Result {
+		t.Errorf("Expected time-bound binding to pass, got %+v", report.Results[0])
+	}
+	if report.Results[1].Result {
+		t.Errorf("Expected KMS-only binding to fail on a secret, got %+v", report.Results[1])
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/projects/test/secrets/db:evaluateConditions?requestTime=yesterday")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid requestTime, got %d", resp.StatusCode)
+	}
+}
+
+func TestMovePolicy_Endpoint(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test/secrets/old-name", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+		AuditConfigs: []*iampb.AuditConfig{
+			{Service: "secretmanager.googleapis.com", AuditLogConfigs: []*iampb.AuditLogConfig{{LogType: iampb.AuditLogConfig_DATA_READ}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	body := `{"destination": "projects/test/secrets/new-name"}`
+	resp, err := http.Post(ts.URL+"/v1/projects/test/secrets/old-name:movePolicy", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	// The moved policy is encoded like getIamPolicy responses
+	var moved struct {
+		Etag         string `json:"etag"`
+		AuditConfigs []struct {
+			AuditLogConfigs []struct {
+				LogType string `json:"logType"`
+			} `json:"auditLogConfigs"`
+		} `json:"auditConfigs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&moved); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if moved.Etag == "" || len(moved.AuditConfigs) != 1 || moved.AuditConfigs[0].AuditLogConfigs[0].LogType != "DATA_READ" {
+		t.Errorf("Expected a protojson-encoded policy, got %+v", moved)
+	}
+
+	policy, err := store.GetIamPolicy("projects/test/secrets/new-name")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 {
+		t.Errorf("Expected moved bindings, got %v", policy.Bindings)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/projects/test/secrets/old-name:movePolicy", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 moving a missing policy, got %d", resp.StatusCode)
+	}
+}
+
+func TestParseResourcePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		resource string
+		method   string
+	}{
+		{"projects/p/secrets/s:getIamPolicy", "projects/p/secrets/s", "getIamPolicy"},
+		{"projects/p/locations/global/keyRings/r/cryptoKeys/k:testIamPermissions", "projects/p/locations/global/keyRings/r/cryptoKeys/k", "testIamPermissions"},
+		{"projects/p/secrets/a:b:getIamPolicy", "projects/p/secrets/a:b", "getIamPolicy"},
+		{"projects/p/secrets/my%20secret:setIamPolicy", "projects/p/secrets/my secret", "setIamPolicy"},
+		{"projects/p/secrets/a%3Ab:getIamPolicy", "projects/p/secrets/a:b", "getIamPolicy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resource, method, err := parseResourcePath(tt.path)
+			if err != nil {
+				t.Fatalf("parseResourcePath failed: %v", err)
+			}
+			if resource != tt.resource || method != tt.method {
+				t.Errorf("Expected (%q, %q), got (%q, %q)", tt.resource, tt.method, resource, method)
+			}
+		})
+	}
+}
+
+func TestParseResourcePath_Malformed(t *testing.T) {
+	for _, path := range []string{
+		"projects/p/secrets/s",
+		"projects/p/secrets/s:",
+		":getIamPolicy",
+		"projects/p/secrets/bad%zz:getIamPolicy",
+	} {
+		if _, _, err := parseResourcePath(path); err == nil {
+			t.Errorf("Expected %q to be rejected", path)
+		}
+	}
+}
+
+func TestHandleRequest_EncodedResource(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test/secrets/a:b", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:viewer@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/projects/test/secrets/a%3Ab:getIamPolicy", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var policy iampb.Policy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(policy.Bindings) != 1 {
+		t.Errorf("Expected the encoded resource's policy, got %v", policy.Bindings)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/projects/test/secrets/a:", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a missing method, got %d", resp.StatusCode)
+	}
+}
+
+func TestHealthz_Endpoint(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadyz_Endpoint(t *testing.T) {
+	restServer := NewServer(storage.NewStorage(), false)
+	mux := http.NewServeMux()
+	restServer.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before SetReady, got %d", resp.StatusCode)
+	}
+
+	restServer.SetReady(true)
+
+	resp, err = http.Get(ts.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 after SetReady, got %d", resp.StatusCode)
+	}
+}
+
+func TestBatchTestIamPermissions_Endpoint(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:viewer@example.com"}},
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"serviceAccount:app@test.iam.gserviceaccount.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	body := `[
+		{"resource": "projects/test/secrets/db", "permissions": ["secretmanager.secrets.get", "secretmanager.versions.access"]},
+		{"resource": "projects/test/secrets/db", "permissions": ["secretmanager.secrets.get", "secretmanager.versions.access"], "principal": "serviceAccount:app@test.iam.gserviceaccount.com"},
+		{"resource": "projects/other", "permissions": ["secretmanager.secrets.get"]}
+	]`
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/batchTestIamPermissions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Emulator-Principal", "user:viewer@example.com")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Results []struct {
+			Resource    string   `json:"resource"`
+			Principal   string   `json:"principal"`
+			Permissions []string `json:"permissions"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(out.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(out.Results))
+	}
+
+	want := [][]string{
+		{"secretmanager.secrets.get"},
+		{"secretmanager.versions.access"},
+		{},
+	}
+	for i, result := range out.Results {
+		if strings.Join(result.Permissions, ",") != strings.Join(want[i], ",") {
+			t.Errorf("Item %d: expected %v, got %v", i, want[i], result.Permissions)
+		}
+	}
+
+	if out.Results[0].Principal != "user:viewer@example.com" || out.Results[1].Principal != "serviceAccount:app@test.iam.gserviceaccount.com" {
+		t.Errorf("Expected header and per-item principals, got %q and %q", out.Results[0].Principal, out.Results[1].Principal)
+	}
+}
+
+func TestBatchTestIamPermissions_InvalidRequest(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	for _, body := range []string{`{"resource": "projects/test"}`, `[{"permissions": ["secretmanager.secrets.get"]}]`} {
+		resp, err := http.Post(ts.URL+"/v1/batchTestIamPermissions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestExplainIamPermission_Endpoint(t *testing.T) {
+	store, ts := newTestServer(t)
+	store.LoadGroups(map[string][]string{
+		"engineering": {"user:dana@example.com"},
+	})
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"group:engineering"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/projects/test/secrets/db:explainIamPermission", strings.NewReader(`{"permission": "secretmanager.versions.access"}`))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("X-Emulator-Principal", "user:dana@example.com")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var explanation storage.PermissionExplanation
+	if err := json.NewDecoder(resp.Body).Decode(&explanation); err != nil {
+		t.Fatalf("Failed to decode explanation: %v", err)
+	}
+
+	if !explanation.Granted || explanation.Principal != "user:dana@example.com" {
+		t.Errorf("Expected the header principal to be granted, got %+v", explanation)
+	}
+	if len(explanation.Bindings) != 1 || !reflect.DeepEqual(explanation.Bindings[0].GroupChain, []string{"engineering"}) {
+		t.Errorf("Expected a match via group engineering, got %+v", explanation.Bindings)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/projects/test:explainIamPermission", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without permission, got %d", resp.StatusCode)
+	}
+}
+
+func TestDebugSnapshotRestore_Endpoints(t *testing.T) {
+	store := storage.NewStorage()
+	restServer := NewServer(store, false)
+	restServer.SetSnapshotEnabled(true)
+	mux := http.NewServeMux()
+	restServer.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/debug/snapshot")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	snapshot, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+
+	store.Clear()
+
+	resp, err = http.Post(ts.URL+"/debug/restore", "application/json", bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	policy, err := store.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 || policy.Bindings[0].Role != "roles/viewer" {
+		t.Errorf("Expected the policy to be restored, got %v", policy.Bindings)
+	}
+}
+
+func TestDebugSnapshot_Disabled(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/debug/snapshot")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 when snapshots are disabled, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+"/debug/restore", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 when snapshots are disabled, got %d", resp.StatusCode)
+	}
+}
+
+func TestDebugReset_Endpoint(t *testing.T) {
+	store := storage.NewStorage()
+	restServer := NewServer(store, false)
+	restServer.SetAdminEnabled(true)
+	mux := http.NewServeMux()
+	restServer.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	resp, err := http.Post(ts.URL+"/debug/reset", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Status != "reset" {
+		t.Errorf("Expected status reset, got %q", body.Status)
+	}
+
+	policy, err := store.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 0 || policy.Version != 1 {
+		t.Errorf("Expected the empty default policy after reset, got %v", policy)
+	}
+}
+
+func TestDebugReset_Disabled(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	resp, err := http.Post(ts.URL+"/debug/reset", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 when admin endpoints are disabled, got %d", resp.StatusCode)
+	}
+
+	if policy, _ := store.GetIamPolicy("projects/test"); len(policy.Bindings) != 1 {
+		t.Errorf("Expected the policy to survive, got %v", policy.Bindings)
+	}
+}
+
+func TestWriteError_GoogleFormat(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/v1/roles/coverage?reference=roles/missing")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Error struct {
+			Code    int               `json:"code"`
+			Message string            `json:"message"`
+			Status  string            `json:"status"`
+			Details []json.RawMessage `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if body.Error.Code != 404 {
+		t.Errorf("Expected error.code 404, got %d", body.Error.Code)
+	}
+	if body.Error.Status != "NOT_FOUND" {
+		t.Errorf("Expected error.status NOT_FOUND, got %q", body.Error.Status)
+	}
+	if body.Error.Message == "" {
+		t.Error("Expected error.message to be set")
+	}
+	if body.Error.Details != nil {
+		t.Errorf("Expected no error.details, got %s", body.Error.Details)
+	}
+}
+
+func TestWriteError_Details(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "bad policy").WithDetails(&errdetails.ErrorInfo{
+		Reason: "POLICY_TOO_LARGE",
+		Domain: "iam.googleapis.com",
+	})
+	if err != nil {
+		t.Fatalf("WithDetails failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewServer(storage.NewStorage(), false).writeError(rec, st.Err())
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", rec.Code)
+	}
+
+	var body struct {
+		Error struct {
+			Code    int                      `json:"code"`
+			Status  string                   `json:"status"`
+			Details []map[string]interface{} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if body.Error.Code != 400 || body.Error.Status != "INVALID_ARGUMENT" {
+		t.Errorf("Expected 400 INVALID_ARGUMENT, got %d %s", body.Error.Code, body.Error.Status)
+	}
+	if len(body.Error.Details) != 1 {
+		t.Fatalf("Expected 1 detail, got %d", len(body.Error.Details))
+	}
+	detail := body.Error.Details[0]
+	if detail["@type"] != "type.googleapis.com/google.rpc.ErrorInfo" {
+		t.Errorf("Expected ErrorInfo @type, got %v", detail["@type"])
+	}
+	if detail["reason"] != "POLICY_TOO_LARGE" {
+		t.Errorf("Expected reason POLICY_TOO_LARGE, got %v", detail["reason"])
+	}
+}
+
+// A POST without options is a version 0 request, as in gRPC, so it must not
+// return conditional bindings to a client that cannot interpret them.
+func TestGetIamPolicy_WithoutOptionsOmitsConditions(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/editor",
+				Members: []string{"user:bob@example.com"},
+				Condition: &expr.Expr{
+					Title:      "temporary",
+					Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/projects/test:getIamPolicy", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if strings.Contains(string(body), "roles/editor") || strings.Contains(string(body), "condition") {
+		t.Errorf("Expected the conditional binding to be omitted, got %s", body)
+	}
+	if !strings.Contains(string(body), `"version":1`) {
+		t.Errorf("Expected version 1, got %s", body)
+	}
+}
+
+func TestGetIamPolicy_RequestedPolicyVersion(t *testing.T) {
+	store, ts := newTestServer(t)
+
+	_, err := store.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			{
+				Role:    "roles/editor",
+				Members: []string{"user:bob@example.com"},
+				Condition: &expr.Expr{
+					Title:      "temporary",
+					Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	decode := func(resp *http.Response) (int32, []string) {
+		t.Helper()
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		var policy struct {
+			Version  int32 `json:"version"`
+			Bindings []struct {
+				Role string `json:"role"`
+			} `json:"bindings"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var roles []string
+		for _, binding := range policy.Bindings {
+			roles = append(roles, binding.Role)
+		}
+		return policy.Version, roles
+	}
+
+	post := func(body string) (int32, []string) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/v1/projects/test:getIamPolicy", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		return decode(resp)
+	}
+
+	get := func(query string) (int32, []string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/v1/projects/test:getIamPolicy" + query)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		return decode(resp)
+	}
+
+	tests := []struct {
+		name        string
+		fetch       func() (int32, []string)
+		wantVersion int32
+		wantRoles   []string
+	}{
+		{"POST version 3", func() (int32, []string) { return post(`{"options":{"requestedPolicyVersion":3}}`) }, 3, []string{"roles/viewer", "roles/editor"}},
+		{"POST version 1", func() (int32, []string) { return post(`{"options":{"requestedPolicyVersion":1}}`) }, 1, []string{"roles/viewer"}},
+		{"POST empty options", func() (int32, []string) { return post(`{"options":{}}`) }, 1, []string{"roles/viewer"}},
+		{"POST without options", func() (int32, []string) { return post(`{}`) }, 1, []string{"roles/viewer"}},
+		{"POST without body", func() (int32, []string) { return post(``) }, 1, []string{"roles/viewer"}},
+		{"plain GET", func() (int32, []string) { return get("") }, 1, []string{"roles/viewer"}},
+		{"GET version 1", func() (int32, []string) { return get("?options.requestedPolicyVersion=1") }, 1, []string{"roles/viewer"}},
+	}
+
+	for _, tt := range tests {
+		version, roles := tt.fetch()
+		if version != tt.wantVersion {
+			t.Errorf("%s: expected version %d, got %d", tt.name, tt.wantVersion, version)
+		}
+		if !reflect.DeepEqual(roles, tt.wantRoles) {
+			t.Errorf("%s: expected roles %v, got %v", tt.name, tt.wantRoles, roles)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/projects/test:getIamPolicy", "application/json", strings.NewReader(`{"options":`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for malformed options, got %d", resp.StatusCode)
+	}
+}
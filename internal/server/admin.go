@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1" //nolint:staticcheck // Using standard genproto package
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+// AdminServer implements the google.iam.admin.v1.IAM service (service
+// accounts) on top of the same storage as the policy server.
+type AdminServer struct {
+	adminpb.UnimplementedIAMServer
+	storage *storage.Storage
+}
+
+func NewAdminServer(store *storage.Storage) *AdminServer {
+	return &AdminServer{storage: store}
+}
+
+// accountIDPattern matches the account IDs GCP accepts: 6-30 lowercase
+// letters, digits, and hyphens, starting with a letter.
+var accountIDPattern = regexp.MustCompile(`^[a-z][-a-z0-9]{4,28}[a-z0-9]$`)
+
+func (s *AdminServer) CreateServiceAccount(ctx context.Context, req *adminpb.CreateServiceAccountRequest) (*adminpb.ServiceAccount, error) {
+	projectID, ok := strings.CutPrefix(req.Name, "projects/")
+	if !ok || projectID == "" || strings.Contains(projectID, "/") {
+		return nil, status.Error(codes.InvalidArgument, "name must be projects/{project}")
+	}
+
+	if !accountIDPattern.MatchString(req.AccountId) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid account_id %q: must be 6-30 lowercase letters, digits, or hyphens, starting with a letter", req.AccountId)
+	}
+
+	var displayName, description string
+	if req.ServiceAccount != nil {
+		displayName = req.ServiceAccount.DisplayName
+		description = req.ServiceAccount.Description
+	}
+
+	account, err := s.storage.CreateServiceAccount(projectID, req.AccountId, displayName, description)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return serviceAccountToProto(account), nil
+}
+
+func (s *AdminServer) DeleteServiceAccount(ctx context.Context, req *adminpb.DeleteServiceAccountRequest) (*emptypb.Empty, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if err := s.storage.DeleteServiceAccount(req.Name); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminServer) CreateServiceAccountKey(ctx context.Context, req *adminpb.CreateServiceAccountKeyRequest) (*adminpb.ServiceAccountKey, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	switch req.PrivateKeyType {
+	case adminpb.ServiceAccountPrivateKeyType_TYPE_UNSPECIFIED, adminpb.ServiceAccountPrivateKeyType_TYPE_GOOGLE_CREDENTIALS_FILE:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported private_key_type %s (only TYPE_GOOGLE_CREDENTIALS_FILE)", req.PrivateKeyType)
+	}
+
+	switch req.KeyAlgorithm {
+	case adminpb.ServiceAccountKeyAlgorithm_KEY_ALG_UNSPECIFIED, adminpb.ServiceAccountKeyAlgorithm_KEY_ALG_RSA_2048:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported key_algorithm %s (only KEY_ALG_RSA_2048)", req.KeyAlgorithm)
+	}
+
+	account, key, err := s.storage.CreateServiceAccountKey(req.Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	credentials, err := credentialsFile(account, key)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := serviceAccountKeyToProto(key)
+	resp.PrivateKeyType = adminpb.ServiceAccountPrivateKeyType_TYPE_GOOGLE_CREDENTIALS_FILE
+	resp.PrivateKeyData = credentials
+	return resp, nil
+}
+
+func (s *AdminServer) ListServiceAccountKeys(ctx context.Context, req *adminpb.ListServiceAccountKeysRequest) (*adminpb.ListServiceAccountKeysResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	var keyTypes []string
+	for _, keyType := range req.KeyTypes {
+		if keyType == adminpb.ListServiceAccountKeysRequest_KEY_TYPE_UNSPECIFIED {
+			continue
+		}
+		keyTypes = append(keyTypes, keyType.String())
+	}
+
+	keys, err := s.storage.ListServiceAccountKeys(req.Name, keyTypes)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &adminpb.ListServiceAccountKeysResponse{}
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, serviceAccountKeyToProto(key))
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) DeleteServiceAccountKey(ctx context.Context, req *adminpb.DeleteServiceAccountKeyRequest) (*emptypb.Empty, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if err := s.storage.DeleteServiceAccountKey(req.Name); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *AdminServer) SignJwt(ctx context.Context, req *adminpb.SignJwtRequest) (*adminpb.SignJwtResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	keyID, signed, err := s.storage.SignJwt(req.Name, req.Payload)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case strings.Contains(err.Error(), "invalid JWT payload"):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &adminpb.SignJwtResponse{KeyId: keyID, SignedJwt: signed}, nil
+}
+
+func (s *AdminServer) GetServiceAccount(ctx context.Context, req *adminpb.GetServiceAccountRequest) (*adminpb.ServiceAccount, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	account, err := s.storage.GetServiceAccount(req.Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return serviceAccountToProto(account), nil
+}
+
+const (
+	defaultServiceAccountPageSize = 20
+	maxServiceAccountPageSize     = 100
+)
+
+// ListServiceAccounts pages through a project's accounts in email order. The
+// page token is the opaque encoding of the last email returned, so accounts
+// created or deleted between pages don't shift the remaining results.
+func (s *AdminServer) ListServiceAccounts(ctx context.Context, req *adminpb.ListServiceAccountsRequest) (*adminpb.ListServiceAccountsResponse, error) {
+	projectID, ok := strings.CutPrefix(req.Name, "projects/")
+	if !ok || projectID == "" || strings.Contains(projectID, "/") {
+		return nil, status.Error(codes.InvalidArgument, "name must be projects/{project}")
+	}
+
+	pageSize := int(req.PageSize)
+	if pageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if pageSize == 0 {
+		pageSize = defaultServiceAccountPageSize
+	}
+	if pageSize > maxServiceAccountPageSize {
+		pageSize = maxServiceAccountPageSize
+	}
+
+	var after string
+	if req.PageToken != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = string(decoded)
+	}
+
+	resp := &adminpb.ListServiceAccountsResponse{}
+	for _, account := range s.storage.ListServiceAccounts(projectID) {
+		if account.Email <= after {
+			continue
+		}
+		if len(resp.Accounts) == pageSize {
+			last := resp.Accounts[len(resp.Accounts)-1].Email
+			resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		resp.Accounts = append(resp.Accounts, serviceAccountToProto(account))
+	}
+
+	return resp, nil
+}
+
+// credentialsFile renders the service account JSON key file GCP returns in
+// private_key_data; clients see it base64-encoded in REST responses.
+func credentialsFile(account *storage.ServiceAccount, key *storage.ServiceAccountKey) ([]byte, error) {
+	return json.MarshalIndent(map[string]string{
+		"type":                        "service_account",
+		"project_id":                  account.ProjectID,
+		"private_key_id":              path.Base(key.Name),
+		"private_key":                 string(key.PrivateKey),
+		"client_email":                account.Email,
+		"client_id":                   account.UniqueID,
+		"auth_uri":                    "https://accounts.google.com/o/oauth2/auth",
+		"token_uri":                   "https://oauth2.googleapis.com/token",
+		"auth_provider_x509_cert_url": "https://www.googleapis.com/oauth2/v1/certs",
+		"client_x509_cert_url":        "https://www.googleapis.com/robot/v1/metadata/x509/" + url.PathEscape(account.Email),
+	}, "", "  ")
+}
+
+func serviceAccountKeyToProto(key *storage.ServiceAccountKey) *adminpb.ServiceAccountKey {
+	return &adminpb.ServiceAccountKey{
+		Name:            key.Name,
+		KeyAlgorithm:    adminpb.ServiceAccountKeyAlgorithm_KEY_ALG_RSA_2048,
+		ValidAfterTime:  timestamppb.New(key.CreateTime),
+		ValidBeforeTime: timestamppb.New(key.ValidBefore),
+		KeyOrigin:       adminpb.ServiceAccountKeyOrigin_GOOGLE_PROVIDED,
+		KeyType:         adminpb.ListServiceAccountKeysRequest_KeyType(adminpb.ListServiceAccountKeysRequest_KeyType_value[key.KeyType]),
+	}
+}
+
+func serviceAccountToProto(account *storage.ServiceAccount) *adminpb.ServiceAccount {
+	return &adminpb.ServiceAccount{
+		Name:           account.Name,
+		ProjectId:      account.ProjectID,
+		UniqueId:       account.UniqueID,
+		Email:          account.Email,
+		DisplayName:    account.DisplayName,
+		Description:    account.Description,
+		Oauth2ClientId: account.UniqueID,
+		Disabled:       account.Disabled,
+	}
+}
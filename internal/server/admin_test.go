@@ -0,0 +1,551 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/config"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+func TestCreateServiceAccount(t *testing.T) {
+	store := storage.NewStorage()
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	resp, err := s.CreateServiceAccount(ctx, &adminpb.CreateServiceAccountRequest{
+		Name:      "projects/test-project",
+		AccountId: "ci-runner",
+		ServiceAccount: &adminpb.ServiceAccount{
+			DisplayName: "CI Runner",
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	if resp.Email != "ci-runner@test-project.iam.gserviceaccount.com" {
+		t.Errorf("Unexpected email: %s", resp.Email)
+	}
+	if resp.Name != "projects/test-project/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com" {
+		t.Errorf("Unexpected name: %s", resp.Name)
+	}
+	if resp.DisplayName != "CI Runner" {
+		t.Errorf("Unexpected displayName: %s", resp.DisplayName)
+	}
+
+	stored, err := store.GetServiceAccount(resp.Name)
+	if err != nil {
+		t.Fatalf("GetServiceAccount failed: %v", err)
+	}
+	if stored.CreateTime.IsZero() {
+		t.Error("Expected CreateTime to be set")
+	}
+
+	_, err = s.CreateServiceAccount(ctx, &adminpb.CreateServiceAccountRequest{
+		Name:      "projects/test-project",
+		AccountId: "ci-runner",
+	})
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.AlreadyExists {
+		t.Errorf("Expected AlreadyExists for duplicate, got %v", err)
+	}
+
+	if _, err := s.CreateServiceAccount(ctx, &adminpb.CreateServiceAccountRequest{
+		Name:      "projects/other-project",
+		AccountId: "ci-runner",
+	}); err != nil {
+		t.Errorf("Expected same account ID in another project to succeed, got %v", err)
+	}
+}
+
+func TestCreateServiceAccount_InvalidRequest(t *testing.T) {
+	s := NewAdminServer(storage.NewStorage())
+
+	requests := []*adminpb.CreateServiceAccountRequest{
+		{Name: "", AccountId: "ci-runner"},
+		{Name: "projects/test-project/serviceAccounts", AccountId: "ci-runner"},
+		{Name: "projects/test-project", AccountId: "ci"},
+		{Name: "projects/test-project", AccountId: "CI_Runner"},
+		{Name: "projects/test-project", AccountId: "1runner"},
+	}
+
+	for _, req := range requests {
+		_, err := s.CreateServiceAccount(context.Background(), req)
+		st, ok := status.FromError(err)
+		if !ok || st.Code() != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for name=%q accountId=%q, got %v", req.Name, req.AccountId, err)
+		}
+	}
+}
+
+func TestGetServiceAccount(t *testing.T) {
+	store := storage.NewStorage()
+	created, err := store.CreateServiceAccount("test-project", "ci-runner", "CI Runner", "Runs CI jobs")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	names := []string{
+		"projects/test-project/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com",
+		"projects/-/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com",
+		"projects/-/serviceAccounts/" + created.UniqueID,
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			resp, err := s.GetServiceAccount(ctx, &adminpb.GetServiceAccountRequest{Name: name})
+			if err != nil {
+				t.Fatalf("GetServiceAccount failed: %v", err)
+			}
+
+			if resp.Name != "projects/test-project/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com" {
+				t.Errorf("Unexpected name: %s", resp.Name)
+			}
+			if resp.Email != "ci-runner@test-project.iam.gserviceaccount.com" {
+				t.Errorf("Unexpected email: %s", resp.Email)
+			}
+			if resp.ProjectId != "test-project" {
+				t.Errorf("Expected projectId 'test-project', got '%s'", resp.ProjectId)
+			}
+			if len(resp.UniqueId) != 21 || resp.UniqueId != created.UniqueID {
+				t.Errorf("Expected 21-digit uniqueId %s, got '%s'", created.UniqueID, resp.UniqueId)
+			}
+			if resp.Oauth2ClientId != resp.UniqueId {
+				t.Errorf("Expected oauth2ClientId to match uniqueId, got '%s'", resp.Oauth2ClientId)
+			}
+			if resp.DisplayName != "CI Runner" || resp.Description != "Runs CI jobs" {
+				t.Errorf("Unexpected displayName/description: %q / %q", resp.DisplayName, resp.Description)
+			}
+			if resp.Disabled {
+				t.Error("Expected new account to be enabled")
+			}
+		})
+	}
+}
+
+func TestGetServiceAccount_FromConfig(t *testing.T) {
+	cfg := &config.Config{
+		Projects: map[string]config.ProjectConfig{
+			"test-project": {
+				ServiceAccounts: []config.ServiceAccountConfig{
+					{AccountID: "ci-runner", DisplayName: "CI Runner", Description: "Runs CI jobs"},
+				},
+			},
+		},
+	}
+
+	store := storage.NewStorage()
+	for projectID, accounts := range cfg.ToServiceAccounts() {
+		for _, account := range accounts {
+			store.LoadServiceAccounts([]storage.ServiceAccountSpec{{
+				ProjectID:   projectID,
+				AccountID:   account.AccountID,
+				DisplayName: account.DisplayName,
+				Description: account.Description,
+			}})
+		}
+	}
+
+	s := NewAdminServer(store)
+	resp, err := s.GetServiceAccount(context.Background(), &adminpb.GetServiceAccountRequest{
+		Name: "projects/-/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com",
+	})
+	if err != nil {
+		t.Fatalf("GetServiceAccount failed: %v", err)
+	}
+
+	if resp.Name != "projects/test-project/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com" {
+		t.Errorf("Unexpected name: %s", resp.Name)
+	}
+	if resp.DisplayName != "CI Runner" || resp.Description != "Runs CI jobs" {
+		t.Errorf("Unexpected displayName/description: %q / %q", resp.DisplayName, resp.Description)
+	}
+	if len(resp.UniqueId) != 21 {
+		t.Errorf("Expected 21-digit uniqueId, got %q", resp.UniqueId)
+	}
+}
+
+func TestGetServiceAccount_NotFound(t *testing.T) {
+	s := NewAdminServer(storage.NewStorage())
+
+	_, err := s.GetServiceAccount(context.Background(), &adminpb.GetServiceAccountRequest{
+		Name: "projects/test-project/serviceAccounts/missing@test-project.iam.gserviceaccount.com",
+	})
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
+
+func TestGetServiceAccount_MissingName(t *testing.T) {
+	s := NewAdminServer(storage.NewStorage())
+
+	_, err := s.GetServiceAccount(context.Background(), &adminpb.GetServiceAccountRequest{})
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestListServiceAccounts_Paging(t *testing.T) {
+	store := storage.NewStorage()
+	for _, id := range []string{"runner-c", "runner-a", "runner-e", "runner-b", "runner-d"} {
+		if _, err := store.CreateServiceAccount("test-project", id, "", ""); err != nil {
+			t.Fatalf("CreateServiceAccount failed: %v", err)
+		}
+	}
+	if _, err := store.CreateServiceAccount("other-project", "runner-a", "", ""); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	var emails []string
+	var pages int
+	token := ""
+	for {
+		resp, err := s.ListServiceAccounts(ctx, &adminpb.ListServiceAccountsRequest{
+			Name:      "projects/test-project",
+			PageSize:  2,
+			PageToken: token,
+		})
+		if err != nil {
+			t.Fatalf("ListServiceAccounts failed: %v", err)
+		}
+		pages++
+
+		if len(resp.Accounts) > 2 {
+			t.Fatalf("Expected at most 2 accounts per page, got %d", len(resp.Accounts))
+		}
+		for _, account := range resp.Accounts {
+			emails = append(emails, account.Email)
+		}
+
+		token = resp.NextPageToken
+		if token == "" {
+			break
+		}
+	}
+
+	if pages != 3 {
+		t.Errorf("Expected 3 pages, got %d", pages)
+	}
+
+	want := []string{
+		"runner-a@test-project.iam.gserviceaccount.com",
+		"runner-b@test-project.iam.gserviceaccount.com",
+		"runner-c@test-project.iam.gserviceaccount.com",
+		"runner-d@test-project.iam.gserviceaccount.com",
+		"runner-e@test-project.iam.gserviceaccount.com",
+	}
+	if strings.Join(emails, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, emails)
+	}
+}
+
+func TestListServiceAccounts_InvalidRequest(t *testing.T) {
+	s := NewAdminServer(storage.NewStorage())
+	ctx := context.Background()
+
+	requests := []*adminpb.ListServiceAccountsRequest{
+		{Name: "test-project"},
+		{Name: "projects/test-project", PageSize: -1},
+		{Name: "projects/test-project", PageToken: "not base64!"},
+	}
+
+	for _, req := range requests {
+		_, err := s.ListServiceAccounts(ctx, req)
+		st, ok := status.FromError(err)
+		if !ok || st.Code() != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %+v, got %v", req, err)
+		}
+	}
+
+	resp, err := s.ListServiceAccounts(ctx, &adminpb.ListServiceAccountsRequest{Name: "projects/empty-project"})
+	if err != nil {
+		t.Fatalf("ListServiceAccounts failed: %v", err)
+	}
+	if len(resp.Accounts) != 0 || resp.NextPageToken != "" {
+		t.Errorf("Expected empty page, got %+v", resp)
+	}
+}
+
+func TestDeleteServiceAccount(t *testing.T) {
+	store := storage.NewStorage()
+	created, err := store.CreateServiceAccount("test-project", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	if _, err := s.DeleteServiceAccount(ctx, &adminpb.DeleteServiceAccountRequest{Name: created.Name}); err != nil {
+		t.Fatalf("DeleteServiceAccount failed: %v", err)
+	}
+
+	_, err = s.GetServiceAccount(ctx, &adminpb.GetServiceAccountRequest{Name: created.Name})
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+		t.Errorf("Expected deleted account to be NotFound, got %v", err)
+	}
+
+	_, err = s.DeleteServiceAccount(ctx, &adminpb.DeleteServiceAccountRequest{Name: created.Name})
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+		t.Errorf("Expected second delete to be NotFound, got %v", err)
+	}
+}
+
+func TestCreateServiceAccountKey(t *testing.T) {
+	store := storage.NewStorage()
+	account, err := store.CreateServiceAccount("test-project", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+
+	resp, err := s.CreateServiceAccountKey(context.Background(), &adminpb.CreateServiceAccountKeyRequest{Name: account.Name})
+	if err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+
+	if !strings.HasPrefix(resp.Name, account.Name+"/keys/") {
+		t.Errorf("Unexpected key name: %s", resp.Name)
+	}
+	if resp.KeyAlgorithm != adminpb.ServiceAccountKeyAlgorithm_KEY_ALG_RSA_2048 {
+		t.Errorf("Expected KEY_ALG_RSA_2048, got %s", resp.KeyAlgorithm)
+	}
+	if resp.PrivateKeyType != adminpb.ServiceAccountPrivateKeyType_TYPE_GOOGLE_CREDENTIALS_FILE {
+		t.Errorf("Expected TYPE_GOOGLE_CREDENTIALS_FILE, got %s", resp.PrivateKeyType)
+	}
+
+	var credentials map[string]string
+	if err := json.Unmarshal(resp.PrivateKeyData, &credentials); err != nil {
+		t.Fatalf("Expected private key data to be a JSON key file: %v", err)
+	}
+	if credentials["type"] != "service_account" || credentials["client_email"] != account.Email {
+		t.Errorf("Unexpected key file: %v", credentials)
+	}
+	if !strings.HasSuffix(resp.Name, "/"+credentials["private_key_id"]) {
+		t.Errorf("Expected private_key_id to match key name, got %s", credentials["private_key_id"])
+	}
+
+	block, _ := pem.Decode([]byte(credentials["private_key"]))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatalf("Expected a PRIVATE KEY PEM block, got %q", credentials["private_key"])
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse private key: %v", err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok || rsaKey.N.BitLen() != 2048 {
+		t.Errorf("Expected an RSA-2048 key, got %T", parsed)
+	}
+
+	second, err := s.CreateServiceAccountKey(context.Background(), &adminpb.CreateServiceAccountKeyRequest{Name: account.Name})
+	if err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+	if second.Name == resp.Name {
+		t.Errorf("Expected distinct key names, got %s twice", resp.Name)
+	}
+}
+
+func TestCreateServiceAccountKey_Errors(t *testing.T) {
+	store := storage.NewStorage()
+	account, err := store.CreateServiceAccount("test-project", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	_, err = s.CreateServiceAccountKey(ctx, &adminpb.CreateServiceAccountKeyRequest{
+		Name: "projects/test-project/serviceAccounts/missing@test-project.iam.gserviceaccount.com",
+	})
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	_, err = s.CreateServiceAccountKey(ctx, &adminpb.CreateServiceAccountKeyRequest{
+		Name:           account.Name,
+		PrivateKeyType: adminpb.ServiceAccountPrivateKeyType_TYPE_PKCS12_FILE,
+	})
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for PKCS12, got %v", err)
+	}
+}
+
+func TestServiceAccountKeys_ListAndDelete(t *testing.T) {
+	store := storage.NewStorage()
+	account, err := store.CreateServiceAccount("test-project", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	created, err := s.CreateServiceAccountKey(ctx, &adminpb.CreateServiceAccountKeyRequest{Name: account.Name})
+	if err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+
+	listed, err := s.ListServiceAccountKeys(ctx, &adminpb.ListServiceAccountKeysRequest{
+		Name:     account.Name,
+		KeyTypes: []adminpb.ListServiceAccountKeysRequest_KeyType{adminpb.ListServiceAccountKeysRequest_USER_MANAGED},
+	})
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(listed.Keys) != 1 || listed.Keys[0].Name != created.Name {
+		t.Fatalf("Expected the created key, got %v", listed.Keys)
+	}
+	if listed.Keys[0].KeyType != adminpb.ListServiceAccountKeysRequest_USER_MANAGED {
+		t.Errorf("Expected USER_MANAGED, got %s", listed.Keys[0].KeyType)
+	}
+	if len(listed.Keys[0].PrivateKeyData) != 0 {
+		t.Error("Expected listed key to carry no private key data")
+	}
+
+	system, err := s.ListServiceAccountKeys(ctx, &adminpb.ListServiceAccountKeysRequest{
+		Name:     account.Name,
+		KeyTypes: []adminpb.ListServiceAccountKeysRequest_KeyType{adminpb.ListServiceAccountKeysRequest_SYSTEM_MANAGED},
+	})
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(system.Keys) != 0 {
+		t.Errorf("Expected no system-managed keys, got %v", system.Keys)
+	}
+
+	if _, err := s.DeleteServiceAccountKey(ctx, &adminpb.DeleteServiceAccountKeyRequest{Name: created.Name}); err != nil {
+		t.Fatalf("DeleteServiceAccountKey failed: %v", err)
+	}
+
+	_, err = s.DeleteServiceAccountKey(ctx, &adminpb.DeleteServiceAccountKeyRequest{Name: created.Name})
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+		t.Errorf("Expected NotFound deleting a missing key, got %v", err)
+	}
+
+	listed, err = s.ListServiceAccountKeys(ctx, &adminpb.ListServiceAccountKeysRequest{Name: account.Name})
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(listed.Keys) != 0 {
+		t.Errorf("Expected no keys after delete, got %v", listed.Keys)
+	}
+}
+
+func TestSignJwt(t *testing.T) {
+	store := storage.NewStorage()
+	account, err := store.CreateServiceAccount("test-project", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	payload := `{"iss":"ci-runner@test-project.iam.gserviceaccount.com","aud":"https://example.com","exp":1893456000}`
+	resp, err := s.SignJwt(ctx, &adminpb.SignJwtRequest{Name: account.Name, Payload: payload})
+	if err != nil {
+		t.Fatalf("SignJwt failed: %v", err)
+	}
+
+	parts := strings.Split(resp.SignedJwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected compact JWS, got %q", resp.SignedJwt)
+	}
+
+	var header map[string]string
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		t.Fatalf("Failed to decode header: %v", err)
+	}
+	if header["alg"] != "RS256" || header["kid"] != resp.KeyId {
+		t.Errorf("Unexpected header: %v (key ID %s)", header, resp.KeyId)
+	}
+
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if string(claims) != payload {
+		t.Errorf("Expected payload to be signed verbatim, got %s", claims)
+	}
+
+	keys, err := store.ListServiceAccountKeys(account.Name, nil)
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].KeyType != storage.KeyTypeSystemManaged || !strings.HasSuffix(keys[0].Name, "/"+resp.KeyId) {
+		t.Fatalf("Expected a system-managed signing key to be generated, got %v", keys)
+	}
+
+	block, _ := pem.Decode(keys[0].PublicKey)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Signature did not verify against the account's public key: %v", err)
+	}
+
+	created, err := s.CreateServiceAccountKey(ctx, &adminpb.CreateServiceAccountKeyRequest{Name: account.Name})
+	if err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+	second, err := s.SignJwt(ctx, &adminpb.SignJwtRequest{Name: account.Name, Payload: payload})
+	if err != nil {
+		t.Fatalf("SignJwt failed: %v", err)
+	}
+	if !strings.HasSuffix(created.Name, "/"+second.KeyId) {
+		t.Errorf("Expected the newest key %s to sign, got key ID %s", created.Name, second.KeyId)
+	}
+}
+
+func TestSignJwt_Errors(t *testing.T) {
+	store := storage.NewStorage()
+	account, err := store.CreateServiceAccount("test-project", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	s := NewAdminServer(store)
+	ctx := context.Background()
+
+	_, err = s.SignJwt(ctx, &adminpb.SignJwtRequest{
+		Name:    "projects/-/serviceAccounts/missing@test-project.iam.gserviceaccount.com",
+		Payload: `{}`,
+	})
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	_, err = s.SignJwt(ctx, &adminpb.SignJwtRequest{Name: account.Name, Payload: "not json"})
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
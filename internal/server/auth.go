@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyAuth maps API keys to the principals they authenticate as.
+type apiKeyAuth struct {
+	mu          sync.RWMutex
+	keys        map[string]string
+	requireAuth bool
+}
+
+// LoadAPIKeys replaces the API key to principal mapping used by
+// APIKeyInterceptor.
+func (s *Server) LoadAPIKeys(keys map[string]string) {
+	loaded := make(map[string]string, len(keys))
+	for key, principal := range keys {
+		loaded[key] = principal
+	}
+
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	s.auth.keys = loaded
+}
+
+// SetRequireAuth makes APIKeyInterceptor reject calls without a known API
+// key with UNAUTHENTICATED. By default such calls proceed with whatever
+// x-emulator-principal they carry.
+func (s *Server) SetRequireAuth(require bool) {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	s.auth.requireAuth = require
+}
+
+// APIKeyInterceptor returns a unary interceptor that resolves the
+// x-emulator-api-key metadata to its configured principal and passes it on
+// as x-emulator-principal, replacing any principal the caller sent.
+func (s *Server) APIKeyInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := apiKeyFromContext(ctx)
+
+		s.auth.mu.RLock()
+		principal, known := s.auth.keys[key]
+		requireAuth := s.auth.requireAuth
+		s.auth.mu.RUnlock()
+
+		if !known || key == "" {
+			if !requireAuth {
+				return handler(ctx, req)
+			}
+			if key == "" {
+				return nil, status.Error(codes.Unauthenticated, "missing x-emulator-api-key")
+			}
+			return nil, status.Error(codes.Unauthenticated, "unknown x-emulator-api-key")
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		md = md.Copy()
+		md.Set("x-emulator-principal", principal)
+		return handler(metadata.NewIncomingContext(ctx, md), req)
+	}
+}
+
+// apiKeyFromContext returns the x-emulator-api-key metadata, or "" if there
+// is none.
+func apiKeyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	keys := md.Get("x-emulator-api-key")
+	if len(keys) == 0 {
+		return ""
+	}
+
+	return keys[0]
+}
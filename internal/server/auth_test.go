@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestAPIKeyInterceptor(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test/secrets/secret1",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	s.LoadAPIKeys(map[string]string{"alice-key": "user:alice@example.com"})
+
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(s.APIKeyInterceptor()))
+	iampb.RegisterIAMPolicyServer(grpcServer, s) //nolint:staticcheck // Using standard genproto package for tests
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := iampb.NewIAMPolicyClient(conn) //nolint:staticcheck // Using standard genproto package for tests
+
+	tests := []struct {
+		name        string
+		requireAuth bool
+		md          []string
+		wantCode    codes.Code
+		wantAllowed []string
+	}{
+		{
+			name:        "known key",
+			requireAuth: true,
+			md:          []string{"x-emulator-api-key", "alice-key"},
+			wantCode:    codes.OK,
+			wantAllowed: []string{"secretmanager.versions.access"},
+		},
+		{
+			name:        "known key overrides principal",
+			requireAuth: true,
+			md:          []string{"x-emulator-api-key", "alice-key", "x-emulator-principal", "user:bob@example.com"},
+			wantCode:    codes.OK,
+			wantAllowed: []string{"secretmanager.versions.access"},
+		},
+		{
+			name:        "unknown key",
+			requireAuth: true,
+			md:          []string{"x-emulator-api-key", "stolen-key", "x-emulator-principal", "user:alice@example.com"},
+			wantCode:    codes.Unauthenticated,
+		},
+		{
+			name:        "missing key",
+			requireAuth: true,
+			md:          []string{"x-emulator-principal", "user:alice@example.com"},
+			wantCode:    codes.Unauthenticated,
+		},
+		{
+			name:        "no auth required falls back to principal",
+			requireAuth: false,
+			md:          []string{"x-emulator-api-key", "stolen-key", "x-emulator-principal", "user:alice@example.com"},
+			wantCode:    codes.OK,
+			wantAllowed: []string{"secretmanager.versions.access"},
+		},
+		{
+			// Without a principal, checks skip the principal match as before
+			name:        "no auth required without credentials",
+			requireAuth: false,
+			wantCode:    codes.OK,
+			wantAllowed: []string{"secretmanager.versions.access"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.SetRequireAuth(tt.requireAuth)
+
+			resp, err := client.TestIamPermissions(metadata.AppendToOutgoingContext(ctx, tt.md...), &iampb.TestIamPermissionsRequest{
+				Resource:    "projects/test/secrets/secret1",
+				Permissions: []string{"secretmanager.versions.access"},
+			})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Expected %v, got %v", tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(resp.Permissions, tt.wantAllowed) {
+				t.Errorf("Expected permissions %v, got %v", tt.wantAllowed, resp.Permissions)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	credentialspb "google.golang.org/genproto/googleapis/iam/credentials/v1" //nolint:staticcheck // Using standard genproto package for tests
+	iampb "google.golang.org/genproto/googleapis/iam/v1"                     //nolint:staticcheck // Using standard genproto package for tests
+	expr "google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+func setupImpersonation(t *testing.T) (*CredentialsServer, *storage.ServiceAccount) {
+	t.Helper()
+
+	store := storage.NewStorage()
+	store.LoadCustomRoles(map[string][]string{
+		"roles/custom.tokenCreator": {"iam.serviceAccounts.getAccessToken"},
+	})
+
+	account, err := store.CreateServiceAccount("test-project", "deployer", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	_, err = store.SetIamPolicy(account.Name, &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/custom.tokenCreator", Members: []string{"user:ci@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	return NewCredentialsServer(store), account
+}
+
+func asPrincipal(principal string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-emulator-principal", principal))
+}
+
+func TestGenerateAccessToken_Authorized(t *testing.T) {
+	s, account := setupImpersonation(t)
+
+	req := &credentialspb.GenerateAccessTokenRequest{
+		Name:     account.Name,
+		Scope:    []string{"https://www.googleapis.com/auth/cloud-platform"},
+		Lifetime: durationpb.New(30 * time.Minute),
+	}
+
+	before := time.Now()
+	resp, err := s.GenerateAccessToken(asPrincipal("user:ci@example.com"), req)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+
+	if !strings.HasPrefix(resp.AccessToken, "ya29.") {
+		t.Errorf("Expected ya29-style token, got %s", resp.AccessToken)
+	}
+
+	expire := resp.ExpireTime.AsTime()
+	if expire.Before(before.Add(30*time.Minute)) || expire.After(time.Now().Add(30*time.Minute)) {
+		t.Errorf("Expected expiry 30m from now, got %v", expire)
+	}
+
+	again, err := s.GenerateAccessToken(asPrincipal("user:ci@example.com"), req)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+	if again.AccessToken != resp.AccessToken {
+		t.Error("Expected the same request to return the same token")
+	}
+}
+
+func TestGenerateAccessToken_Denied(t *testing.T) {
+	s, account := setupImpersonation(t)
+
+	req := &credentialspb.GenerateAccessTokenRequest{
+		Name:  account.Name,
+		Scope: []string{"https://www.googleapis.com/auth/cloud-platform"},
+	}
+
+	_, err := s.GenerateAccessToken(asPrincipal("user:mallory@example.com"), req)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied, got %v", err)
+	}
+
+	_, err = s.GenerateAccessToken(context.Background(), req)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a principal, got %v", err)
+	}
+}
+
+func TestGenerateAccessToken_UnsupportedCondition(t *testing.T) {
+	store := storage.NewStorage()
+	account, err := store.CreateServiceAccount("test-project", "deployer", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	// Strict mode rejects the condition at SetIamPolicy, so load it as
+	// config does
+	store.LoadPolicies(map[string]*iampb.Policy{
+		account.Name: {
+			Version: 3,
+			Bindings: []*iampb.Binding{
+				{
+					Role:    "roles/iam.serviceAccountTokenCreator",
+					Members: []string{"user:ci@example.com"},
+					Condition: &expr.Expr{
+						Expression: `request.auth.claims.level == "high"`,
+					},
+				},
+			},
+		},
+	})
+
+	_, err = NewCredentialsServer(store).GenerateAccessToken(asPrincipal("user:ci@example.com"), &credentialspb.GenerateAccessTokenRequest{
+		Name:  account.Name,
+		Scope: []string{"https://www.googleapis.com/auth/cloud-platform"},
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition, got %v", err)
+	}
+}
+
+func TestGenerateAccessToken_InvalidRequest(t *testing.T) {
+	s, account := setupImpersonation(t)
+	ctx := asPrincipal("user:ci@example.com")
+	scope := []string{"https://www.googleapis.com/auth/cloud-platform"}
+
+	tests := []struct {
+		name string
+		req  *credentialspb.GenerateAccessTokenRequest
+		code codes.Code
+	}{
+		{"missing scope", &credentialspb.GenerateAccessTokenRequest{Name: account.Name}, codes.InvalidArgument},
+		{"lifetime too long", &credentialspb.GenerateAccessTokenRequest{Name: account.Name, Scope: scope, Lifetime: durationpb.New(13 * time.Hour)}, codes.InvalidArgument},
+		{"unknown account", &credentialspb.GenerateAccessTokenRequest{Name: "projects/test-project/serviceAccounts/ghost@test-project.iam.gserviceaccount.com", Scope: scope}, codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.GenerateAccessToken(ctx, tt.req)
+			if status.Code(err) != tt.code {
+				t.Errorf("Expected %v, got %v", tt.code, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestSetIamPolicy_DryRun(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	stored, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	dryRunCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("x-emulator-dry-run", "true"))
+	validated, err := s.SetIamPolicy(dryRunCtx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/owner", Members: []string{"user:mallory@example.com"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Dry-run SetIamPolicy failed: %v", err)
+	}
+	if validated.Version != 1 || len(validated.Etag) == 0 || bytes.Equal(validated.Etag, stored.Etag) {
+		t.Errorf("Expected the computed version and a new etag, got version %d etag %q", validated.Version, validated.Etag)
+	}
+
+	current, err := s.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: "projects/test"})
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if !bytes.Equal(current.Etag, stored.Etag) || len(current.Bindings) != 1 || current.Bindings[0].Role != "roles/viewer" {
+		t.Errorf("Expected dry run to leave the stored policy unchanged, got %v", current)
+	}
+
+	// Validation errors are still reported
+	_, err = s.SetIamPolicy(dryRunCtx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "viewer", Members: []string{"user:alice@example.com"}}},
+		},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an invalid role in a dry run, got %v", err)
+	}
+
+	_, err = s.SetIamPolicy(dryRunCtx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy:   &iampb.Policy{Etag: []byte("stale")},
+	})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("Expected Aborted for a stale etag in a dry run, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// faultInjector fails a fraction of GetIamPolicy and TestIamPermissions calls
+// with UNAVAILABLE so clients can exercise their retry handling.
+type faultInjector struct {
+	mu   sync.Mutex
+	rate float64
+	rng  *rand.Rand
+}
+
+// SetFaultInjection makes rate (0 to 1) of GetIamPolicy and
+// TestIamPermissions calls fail with UNAVAILABLE before reaching storage. A
+// non-zero seed makes the sequence of failures repeatable; 0 seeds from the
+// clock. A rate of 0 (the default) injects no faults.
+func (s *Server) SetFaultInjection(rate float64, seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	s.faults.mu.Lock()
+	defer s.faults.mu.Unlock()
+	s.faults.rate = rate
+	s.faults.rng = rand.New(rand.NewSource(seed))
+}
+
+// injectFault returns an UNAVAILABLE error when the caller forced a fault via
+// x-emulator-fault metadata or the configured fault rate selects this call.
+func (s *Server) injectFault(ctx context.Context) error {
+	if forcedFault(ctx) {
+		return status.Error(codes.Unavailable, "injected fault (x-emulator-fault)")
+	}
+
+	s.faults.mu.Lock()
+	defer s.faults.mu.Unlock()
+
+	if s.faults.rate <= 0 || s.faults.rng == nil {
+		return nil
+	}
+	if s.faults.rng.Float64() < s.faults.rate {
+		return status.Error(codes.Unavailable, "injected fault (--fault-rate)")
+	}
+	return nil
+}
+
+// forcedFault reports whether the caller asked, via x-emulator-fault
+// metadata, for this call to fail with UNAVAILABLE.
+func forcedFault(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	values := md.Get("x-emulator-fault")
+	return len(values) > 0 && values[0] == "true"
+}
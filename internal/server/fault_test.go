@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// faultPattern makes n TestIamPermissions calls and records which failed.
+func faultPattern(t *testing.T, s *Server, n int) []bool {
+	t.Helper()
+
+	failed := make([]bool, n)
+	for i := range failed {
+		_, err := s.TestIamPermissions(context.Background(), &iampb.TestIamPermissionsRequest{
+			Resource:    "projects/test",
+			Permissions: []string{"resourcemanager.projects.get"},
+		})
+		if err != nil {
+			if status.Code(err) != codes.Unavailable {
+				t.Fatalf("Expected injected faults to be UNAVAILABLE, got %v", err)
+			}
+			failed[i] = true
+		}
+	}
+	return failed
+}
+
+func TestFaultInjection_Rate(t *testing.T) {
+	s := NewServer()
+	s.SetFaultInjection(0.3, 42)
+
+	failures := 0
+	for _, failed := range faultPattern(t, s, 1000) {
+		if failed {
+			failures++
+		}
+	}
+	if failures < 250 || failures > 350 {
+		t.Errorf("Expected about 300 of 1000 calls to fail at rate 0.3, got %d", failures)
+	}
+
+	_, err := s.GetIamPolicy(context.Background(), &iampb.GetIamPolicyRequest{Resource: "projects/test"})
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = s.GetIamPolicy(context.Background(), &iampb.GetIamPolicyRequest{Resource: "projects/test"})
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected GetIamPolicy to see injected faults too, got %v", err)
+	}
+}
+
+func TestFaultInjection_SeedIsRepeatable(t *testing.T) {
+	first := NewServer()
+	first.SetFaultInjection(0.5, 7)
+	second := NewServer()
+	second.SetFaultInjection(0.5, 7)
+
+	if a, b := faultPattern(t, first, 200), faultPattern(t, second, 200); !reflect.DeepEqual(a, b) {
+		t.Error("Expected the same seed to fail the same calls")
+	}
+}
+
+func TestFaultInjection_Disabled(t *testing.T) {
+	s := NewServer()
+
+	for i, failed := range faultPattern(t, s, 100) {
+		if failed {
+			t.Fatalf("Expected no faults by default, call %d failed", i+1)
+		}
+	}
+}
+
+func TestFaultInjection_Metadata(t *testing.T) {
+	s := NewServer()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-emulator-fault", "true"))
+
+	_, err := s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test",
+		Permissions: []string{"resourcemanager.projects.get"},
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected x-emulator-fault to force UNAVAILABLE, got %v", err)
+	}
+}
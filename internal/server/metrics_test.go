@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc/metadata"
+)
+
+// scrapeMetric returns the value of the sample whose name and labels render
+// as series in the Prometheus text format, or 0 if it is absent.
+func scrapeMetric(t *testing.T, series string) float64 {
+	t.Helper()
+
+	ts := httptest.NewServer(promhttp.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), series+" ")
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("Failed to parse %s value %q: %v", series, value, err)
+		}
+		return parsed
+	}
+	return 0
+}
+
+func TestMetrics_CountDecisions(t *testing.T) {
+	s := NewServer()
+
+	_, err := s.SetIamPolicy(context.Background(), &iampb.SetIamPolicyRequest{
+		Resource: "projects/metrics-test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowSeries := `iam_emulator_authz_decisions_total{outcome="allow",permission="secretmanager.secrets.get"}`
+	denySeries := `iam_emulator_authz_decisions_total{outcome="deny",permission="secretmanager.secrets.delete"}`
+	allowBefore := scrapeMetric(t, allowSeries)
+	denyBefore := scrapeMetric(t, denySeries)
+	checksBefore := scrapeMetric(t, "iam_emulator_testiampermissions_duration_seconds_count")
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-emulator-principal", "user:alice@example.com"))
+	_, err = s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/metrics-test",
+		Permissions: []string{"secretmanager.secrets.get", "secretmanager.secrets.delete"},
+	})
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	if got := scrapeMetric(t, allowSeries) - allowBefore; got != 1 {
+		t.Errorf("Expected allow counter to increase by 1, got %v", got)
+	}
+	if got := scrapeMetric(t, denySeries) - denyBefore; got != 1 {
+		t.Errorf("Expected deny counter to increase by 1, got %v", got)
+	}
+	if got := scrapeMetric(t, "iam_emulator_testiampermissions_duration_seconds_count") - checksBefore; got != 1 {
+		t.Errorf("Expected one latency observation, got %v", got)
+	}
+}
+
+func TestMetrics_CountSetIamPolicy(t *testing.T) {
+	s := NewServer()
+
+	okBefore := scrapeMetric(t, `iam_emulator_setiampolicy_total{code="OK"}`)
+	invalidBefore := scrapeMetric(t, `iam_emulator_setiampolicy_total{code="InvalidArgument"}`)
+
+	_, _ = s.SetIamPolicy(context.Background(), &iampb.SetIamPolicyRequest{
+		Resource: "projects/metrics-test",
+		Policy:   &iampb.Policy{},
+	})
+	_, _ = s.SetIamPolicy(context.Background(), &iampb.SetIamPolicyRequest{Resource: "projects/metrics-test"})
+
+	// Dry runs store nothing and are not counted
+	dryRunCtx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-emulator-dry-run", "true"))
+	_, _ = s.SetIamPolicy(dryRunCtx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/metrics-test",
+		Policy:   &iampb.Policy{},
+	})
+
+	if got := scrapeMetric(t, `iam_emulator_setiampolicy_total{code="OK"}`) - okBefore; got != 1 {
+		t.Errorf("Expected OK counter to increase by 1, got %v", got)
+	}
+	if got := scrapeMetric(t, `iam_emulator_setiampolicy_total{code="InvalidArgument"}`) - invalidBefore; got != 1 {
+		t.Errorf("Expected InvalidArgument counter to increase by 1, got %v", got)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/blackwell-systems/gcp-iam-emulator/internal/server"
+
+// OpenTelemetry span attribute keys.
+const (
+	attrResource             = attribute.Key("iam.resource")
+	attrPrincipal            = attribute.Key("iam.principal")
+	attrPermissionsRequested = attribute.Key("iam.permissions.requested")
+	attrPermissionsAllowed   = attribute.Key("iam.permissions.allowed")
+	attrPermissionsDenied    = attribute.Key("iam.permissions.denied")
+	attrDryRun               = attribute.Key("iam.dry_run")
+)
+
+// SetTracerProvider sets where the SetIamPolicy, GetIamPolicy and
+// TestIamPermissions spans go. By default they use the global provider,
+// which is a no-op until one is installed with otel.SetTracerProvider.
+func (s *Server) SetTracerProvider(provider oteltrace.TracerProvider) {
+	s.tracer = provider.Tracer(tracerName)
+}
+
+// startSpan starts the span for an IAMPolicy method on resource, as a child
+// of any span otelgrpc started for the RPC.
+func (s *Server) startSpan(ctx context.Context, method, resource string) (context.Context, oteltrace.Span) {
+	return s.tracer.Start(ctx, "iam."+method,
+		oteltrace.WithSpanKind(oteltrace.SpanKindInternal),
+		oteltrace.WithAttributes(
+			attrResource.String(resource),
+			attrPrincipal.String(s.extractPrincipal(ctx)),
+		),
+	)
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc/metadata"
+)
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestOpenTelemetrySpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	s := NewServer()
+	s.SetTracerProvider(provider)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-emulator-principal", "user:alice@example.com"))
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	_, err = s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test/secrets/db",
+		Permissions: []string{"secretmanager.versions.access", "secretmanager.secrets.delete", "secretmanager.secrets.create"},
+	})
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	_, err = s.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{})
+	if err == nil {
+		t.Fatal("Expected GetIamPolicy without a resource to fail")
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	check, ok := spans["iam.TestIamPermissions"]
+	if !ok {
+		t.Fatalf("Expected an iam.TestIamPermissions span, got %v", exporter.GetSpans().Snapshots())
+	}
+	attrs := spanAttributes(check)
+	if got := attrs[attrResource].AsString(); got != "projects/test/secrets/db" {
+		t.Errorf("Expected resource attribute projects/test/secrets/db, got %q", got)
+	}
+	if got := attrs[attrPrincipal].AsString(); got != "user:alice@example.com" {
+		t.Errorf("Expected principal attribute user:alice@example.com, got %q", got)
+	}
+	if requested, allowed, denied := attrs[attrPermissionsRequested].AsInt64(), attrs[attrPermissionsAllowed].AsInt64(), attrs[attrPermissionsDenied].AsInt64(); requested != 3 || allowed != 1 || denied != 2 {
+		t.Errorf("Expected 3 requested, 1 allowed and 2 denied, got %d, %d and %d", requested, allowed, denied)
+	}
+
+	set, ok := spans["iam.SetIamPolicy"]
+	if !ok {
+		t.Fatal("Expected an iam.SetIamPolicy span")
+	}
+	if got := spanAttributes(set)[attrResource].AsString(); got != "projects/test" {
+		t.Errorf("Expected SetIamPolicy resource attribute projects/test, got %q", got)
+	}
+
+	get, ok := spans["iam.GetIamPolicy"]
+	if !ok {
+		t.Fatal("Expected an iam.GetIamPolicy span")
+	}
+	if get.Status.Code != otelcodes.Error {
+		t.Errorf("Expected the failed GetIamPolicy span to have error status, got %v", get.Status)
+	}
+}
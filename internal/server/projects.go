@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+// ProjectsServer implements the project methods of the
+// google.cloud.resourcemanager.v3.Projects service on top of the same storage
+// as the policy server.
+type ProjectsServer struct {
+	resourcemanagerpb.UnimplementedProjectsServer
+	storage *storage.Storage
+}
+
+func NewProjectsServer(store *storage.Storage) *ProjectsServer {
+	return &ProjectsServer{storage: store}
+}
+
+// projectIDPattern matches the project IDs GCP accepts: 6-30 lowercase
+// letters, digits, and hyphens, starting with a letter.
+var projectIDPattern = regexp.MustCompile(`^[a-z][-a-z0-9]{4,28}[a-z0-9]$`)
+
+// CreateProject creates the project and returns an already completed
+// operation whose response is the new project.
+func (s *ProjectsServer) CreateProject(ctx context.Context, req *resourcemanagerpb.CreateProjectRequest) (*longrunningpb.Operation, error) {
+	if req.Project == nil {
+		return nil, status.Error(codes.InvalidArgument, "project is required")
+	}
+	projectID := req.Project.ProjectId
+	if !projectIDPattern.MatchString(projectID) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid project_id %q: must be 6-30 lowercase letters, digits, or hyphens, starting with a letter", projectID)
+	}
+
+	project, err := s.storage.CreateProject(projectID, req.Project.DisplayName)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	metadata, err := anypb.New(&resourcemanagerpb.CreateProjectMetadata{
+		CreateTime: timestamppb.New(project.CreateTime),
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response, err := anypb.New(projectToProto(project))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &longrunningpb.Operation{
+		Name:     "operations/cp." + projectID,
+		Metadata: metadata,
+		Done:     true,
+		Result:   &longrunningpb.Operation_Response{Response: response},
+	}, nil
+}
+
+// GetProject looks a project up by name (projects/{project_id}).
+func (s *ProjectsServer) GetProject(ctx context.Context, req *resourcemanagerpb.GetProjectRequest) (*resourcemanagerpb.Project, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	project, err := s.storage.GetProject(req.Name)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return projectToProto(project), nil
+}
+
+// ListProjects returns every project, sorted by name. The emulator does not
+// track project parents, so the parent field is ignored.
+func (s *ProjectsServer) ListProjects(ctx context.Context, req *resourcemanagerpb.ListProjectsRequest) (*resourcemanagerpb.ListProjectsResponse, error) {
+	return &resourcemanagerpb.ListProjectsResponse{Projects: projectsToProto(s.storage.ListProjects(""))}, nil
+}
+
+// SearchProjects filters projects by ID. The query is empty (every project),
+// id:{project_id} or projectId:{project_id}; a trailing * matches the ID as a
+// prefix, e.g. id:ci-*.
+func (s *ProjectsServer) SearchProjects(ctx context.Context, req *resourcemanagerpb.SearchProjectsRequest) (*resourcemanagerpb.SearchProjectsResponse, error) {
+	if req.Query == "" {
+		return &resourcemanagerpb.SearchProjectsResponse{Projects: projectsToProto(s.storage.ListProjects(""))}, nil
+	}
+
+	field, value, ok := strings.Cut(req.Query, ":")
+	if !ok || (field != "id" && field != "projectId") || value == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported query %q: use id:{project_id} or id:{prefix}*", req.Query)
+	}
+
+	prefix, isPrefix := strings.CutSuffix(value, "*")
+	projects := []*storage.Project{}
+	for _, project := range s.storage.ListProjects(prefix) {
+		if isPrefix || project.Name == "projects/"+value {
+			projects = append(projects, project)
+		}
+	}
+
+	return &resourcemanagerpb.SearchProjectsResponse{Projects: projectsToProto(projects)}, nil
+}
+
+func projectToProto(project *storage.Project) *resourcemanagerpb.Project {
+	return &resourcemanagerpb.Project{
+		Name:        project.Name,
+		ProjectId:   strings.TrimPrefix(project.Name, "projects/"),
+		DisplayName: project.DisplayName,
+		State:       resourcemanagerpb.Project_ACTIVE,
+		CreateTime:  timestamppb.New(project.CreateTime),
+		UpdateTime:  timestamppb.New(project.CreateTime),
+	}
+}
+
+func projectsToProto(projects []*storage.Project) []*resourcemanagerpb.Project {
+	result := make([]*resourcemanagerpb.Project, 0, len(projects))
+	for _, project := range projects {
+		result = append(result, projectToProto(project))
+	}
+	return result
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+// newProjectsClient serves a ProjectsServer over an in-memory listener so the
+// tests go through gRPC registration and marshaling.
+func newProjectsClient(t *testing.T) resourcemanagerpb.ProjectsClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	resourcemanagerpb.RegisterProjectsServer(grpcServer, NewProjectsServer(storage.NewStorage()))
+	go func() { _ = grpcServer.Serve(lis) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial projects server: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		grpcServer.Stop()
+	})
+
+	return resourcemanagerpb.NewProjectsClient(conn)
+}
+
+func TestProjects_CreateGetList(t *testing.T) {
+	client := newProjectsClient(t)
+	ctx := context.Background()
+
+	for _, projectID := range []string{"ci-project-b", "ci-project-a", "prod-project"} {
+		op, err := client.CreateProject(ctx, &resourcemanagerpb.CreateProjectRequest{
+			Project: &resourcemanagerpb.Project{ProjectId: projectID, DisplayName: "Project " + projectID},
+		})
+		if err != nil {
+			t.Fatalf("CreateProject(%s) failed: %v", projectID, err)
+		}
+		if !op.Done {
+			t.Fatalf("Expected CreateProject(%s) to return a done operation", projectID)
+		}
+
+		created := &resourcemanagerpb.Project{}
+		if err := op.GetResponse().UnmarshalTo(created); err != nil {
+			t.Fatalf("Expected the operation response to be a Project: %v", err)
+		}
+		if created.Name != "projects/"+projectID || created.State != resourcemanagerpb.Project_ACTIVE {
+			t.Errorf("Unexpected created project: %v", created)
+		}
+	}
+
+	_, err := client.CreateProject(ctx, &resourcemanagerpb.CreateProjectRequest{
+		Project: &resourcemanagerpb.Project{ProjectId: "ci-project-a"},
+	})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Expected AlreadyExists, got %v", err)
+	}
+
+	project, err := client.GetProject(ctx, &resourcemanagerpb.GetProjectRequest{Name: "projects/ci-project-a"})
+	if err != nil {
+		t.Fatalf("GetProject failed: %v", err)
+	}
+	if project.ProjectId != "ci-project-a" || project.DisplayName != "Project ci-project-a" || project.CreateTime == nil {
+		t.Errorf("Unexpected project: %v", project)
+	}
+
+	_, err = client.GetProject(ctx, &resourcemanagerpb.GetProjectRequest{Name: "projects/missing-project"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	all, err := client.ListProjects(ctx, &resourcemanagerpb.ListProjectsRequest{})
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	if len(all.Projects) != 3 {
+		t.Errorf("Expected 3 projects, got %d", len(all.Projects))
+	}
+
+	filtered, err := client.SearchProjects(ctx, &resourcemanagerpb.SearchProjectsRequest{Query: "id:ci-*"})
+	if err != nil {
+		t.Fatalf("SearchProjects failed: %v", err)
+	}
+	if len(filtered.Projects) != 2 || filtered.Projects[0].Name != "projects/ci-project-a" || filtered.Projects[1].Name != "projects/ci-project-b" {
+		t.Errorf("Expected ci- projects sorted by name, got %v", filtered.Projects)
+	}
+
+	exact, err := client.SearchProjects(ctx, &resourcemanagerpb.SearchProjectsRequest{Query: "projectId:ci-project"})
+	if err != nil {
+		t.Fatalf("SearchProjects failed: %v", err)
+	}
+	if len(exact.Projects) != 0 {
+		t.Errorf("Expected an exact ID query without * to match nothing, got %v", exact.Projects)
+	}
+
+	_, err = client.SearchProjects(ctx, &resourcemanagerpb.SearchProjectsRequest{Query: "labels.env:prod"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unsupported query, got %v", err)
+	}
+}
+
+func TestProjects_InvalidProjectID(t *testing.T) {
+	client := newProjectsClient(t)
+
+	for _, projectID := range []string{"", "short", "Upper-Case-1", "ends-with-"} {
+		_, err := client.CreateProject(context.Background(), &resourcemanagerpb.CreateProjectRequest{
+			Project: &resourcemanagerpb.Project{ProjectId: projectID},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %q, got %v", projectID, err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/ratelimit"
+)
+
+// RateLimitInterceptor returns a unary interceptor that fails calls limiter
+// rejects with RESOURCE_EXHAUSTED. A nil limiter allows every call.
+func RateLimitInterceptor(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if ok, wait := limiter.Allow(); !ok {
+			return nil, ratelimit.Status(wait).Err()
+		}
+		return handler(ctx, req)
+	}
+}
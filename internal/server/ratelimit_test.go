@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/ratelimit"
+)
+
+func TestRateLimitInterceptor(t *testing.T) {
+	s := NewServer()
+
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(RateLimitInterceptor(ratelimit.New(0.01))))
+	iampb.RegisterIAMPolicyServer(grpcServer, s) //nolint:staticcheck // Using standard genproto package for tests
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := iampb.NewIAMPolicyClient(conn) //nolint:staticcheck // Using standard genproto package for tests
+
+	get := func() error {
+		_, err := client.GetIamPolicy(context.Background(), &iampb.GetIamPolicyRequest{Resource: "projects/test"})
+		return err
+	}
+
+	// At 0.01 qps the bucket holds a single token and takes 100s to refill
+	if err := get(); err != nil {
+		t.Fatalf("Expected the first call to succeed, got %v", err)
+	}
+
+	err = get()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted past the burst, got %v", err)
+	}
+
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = info
+		}
+	}
+	if retryInfo == nil || retryInfo.RetryDelay.AsDuration() <= 0 {
+		t.Errorf("Expected a RetryInfo detail with a positive delay, got %v", status.Convert(err).Details())
+	}
+}
+
+func TestRateLimitInterceptor_Unlimited(t *testing.T) {
+	interceptor := RateLimitInterceptor(ratelimit.New(0))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	for i := 0; i < 100; i++ {
+		if _, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+			t.Fatalf("Expected unlimited interceptor to allow call %d, got %v", i+1, err)
+		}
+	}
+}
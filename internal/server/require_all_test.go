@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestTestIamPermissions_RequireAll(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test/secrets/secret1",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	iampb.RegisterIAMPolicyServer(grpcServer, s) //nolint:staticcheck // Using standard genproto package for tests
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := iampb.NewIAMPolicyClient(conn) //nolint:staticcheck // Using standard genproto package for tests
+
+	tests := []struct {
+		name        string
+		permissions []string
+		expected    string
+	}{
+		{"all granted", []string{"secretmanager.versions.access"}, "true"},
+		{"one missing", []string{"secretmanager.versions.access", "secretmanager.secrets.delete"}, "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCtx := metadata.AppendToOutgoingContext(ctx,
+				"x-emulator-principal", "user:alice@example.com",
+				"x-emulator-require-all", "true",
+			)
+
+			var header metadata.MD
+			_, err := client.TestIamPermissions(callCtx, &iampb.TestIamPermissionsRequest{
+				Resource:    "projects/test/secrets/secret1",
+				Permissions: tt.permissions,
+			}, grpc.Header(&header))
+			if err != nil {
+				t.Fatalf("TestIamPermissions failed: %v", err)
+			}
+
+			if got := header.Get("x-emulator-all-granted"); len(got) != 1 || got[0] != tt.expected {
+				t.Errorf("Expected x-emulator-all-granted=%s, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	var header metadata.MD
+	_, err = client.TestIamPermissions(metadata.AppendToOutgoingContext(ctx, "x-emulator-principal", "user:alice@example.com"),
+		&iampb.TestIamPermissionsRequest{
+			Resource:    "projects/test/secrets/secret1",
+			Permissions: []string{"secretmanager.versions.access"},
+		}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if got := header.Get("x-emulator-all-granted"); len(got) != 0 {
+		t.Errorf("Expected no verdict header unless requested, got %v", got)
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1" //nolint:staticcheck // Using standard genproto package
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+// roleIDPattern matches the custom role IDs GCP accepts: 3-64 letters,
+// digits, underscores, and periods.
+var roleIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.]{3,64}$`)
+
+const (
+	defaultRolePageSize = 300
+	maxRolePageSize     = 1000
+)
+
+// roleUpdateFields maps UpdateRole mask paths, in either proto or JSON
+// spelling, to the storage fields they update.
+var roleUpdateFields = map[string]string{
+	"title":                storage.RoleFieldTitle,
+	"description":          storage.RoleFieldDescription,
+	"included_permissions": storage.RoleFieldIncludedPermissions,
+	"includedPermissions":  storage.RoleFieldIncludedPermissions,
+	"stage":                storage.RoleFieldStage,
+}
+
+// CreateRole creates the custom role {parent}/roles/{roleId}, where parent is
+// projects/{project} or organizations/{org}. The stage defaults to ALPHA, as
+// in GCP.
+func (s *AdminServer) CreateRole(ctx context.Context, req *adminpb.CreateRoleRequest) (*adminpb.Role, error) {
+	if !isRoleParent(req.Parent) {
+		return nil, status.Error(codes.InvalidArgument, "parent must be projects/{project} or organizations/{org}")
+	}
+
+	if !roleIDPattern.MatchString(req.RoleId) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid role_id %q: must be 3-64 letters, digits, underscores, or periods", req.RoleId)
+	}
+
+	role := roleFromProto(req.Role)
+	role.Name = req.Parent + "/roles/" + req.RoleId
+
+	created, err := s.storage.CreateRole(role)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return roleToProto(created, adminpb.RoleView_FULL), nil
+}
+
+// GetRole returns a custom role, or a predefined role such as roles/viewer.
+func (s *AdminServer) GetRole(ctx context.Context, req *adminpb.GetRoleRequest) (*adminpb.Role, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	role, err := s.storage.GetRole(req.Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return roleToProto(role, adminpb.RoleView_FULL), nil
+}
+
+// ListRoles pages through the custom roles of a project or organization, or
+// the predefined roles when parent is empty, in name order. As in GCP, the
+// BASIC view (the default) omits included permissions. The page token is the
+// opaque encoding of the last name returned.
+func (s *AdminServer) ListRoles(ctx context.Context, req *adminpb.ListRolesRequest) (*adminpb.ListRolesResponse, error) {
+	if req.Parent != "" && !isRoleParent(req.Parent) {
+		return nil, status.Error(codes.InvalidArgument, "parent must be empty, projects/{project} or organizations/{org}")
+	}
+
+	pageSize := int(req.PageSize)
+	if pageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if pageSize == 0 {
+		pageSize = defaultRolePageSize
+	}
+	if pageSize > maxRolePageSize {
+		pageSize = maxRolePageSize
+	}
+
+	var after string
+	if req.PageToken != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = string(decoded)
+	}
+
+	resp := &adminpb.ListRolesResponse{}
+	for _, role := range s.storage.ListRoles(req.Parent, req.ShowDeleted) {
+		if role.Name <= after {
+			continue
+		}
+		if len(resp.Roles) == pageSize {
+			last := resp.Roles[len(resp.Roles)-1].Name
+			resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		resp.Roles = append(resp.Roles, roleToProto(role, req.View))
+	}
+
+	return resp, nil
+}
+
+// UpdateRole updates the fields of a custom role named in update_mask (title,
+// description, included_permissions, stage), or all of them when the mask
+// is empty.
+func (s *AdminServer) UpdateRole(ctx context.Context, req *adminpb.UpdateRoleRequest) (*adminpb.Role, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	if req.Role == nil {
+		return nil, status.Error(codes.InvalidArgument, "role is required")
+	}
+
+	fields := []string{storage.RoleFieldTitle, storage.RoleFieldDescription, storage.RoleFieldIncludedPermissions, storage.RoleFieldStage}
+	if paths := req.GetUpdateMask().GetPaths(); len(paths) > 0 {
+		fields = fields[:0]
+		for _, path := range paths {
+			field, ok := roleUpdateFields[path]
+			if !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid update_mask path %q", path)
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	updated, err := s.storage.UpdateRole(req.Name, roleFromProto(req.Role), fields)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case strings.Contains(err.Error(), "is deleted"):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return roleToProto(updated, adminpb.RoleView_FULL), nil
+}
+
+// DeleteRole marks a custom role deleted and returns it. Bindings to the role
+// remain but stop granting its permissions.
+func (s *AdminServer) DeleteRole(ctx context.Context, req *adminpb.DeleteRoleRequest) (*adminpb.Role, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	deleted, err := s.storage.DeleteRole(req.Name)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case strings.Contains(err.Error(), "is deleted"):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return roleToProto(deleted, adminpb.RoleView_FULL), nil
+}
+
+// isRoleParent reports whether parent is projects/{project} or
+// organizations/{org}, the resources custom roles are created under.
+func isRoleParent(parent string) bool {
+	collection, id, ok := strings.Cut(parent, "/")
+	return ok && (collection == "projects" || collection == "organizations") && id != "" && !strings.Contains(id, "/")
+}
+
+func roleFromProto(role *adminpb.Role) *storage.Role {
+	if role == nil {
+		return &storage.Role{Stage: adminpb.Role_ALPHA.String()}
+	}
+	return &storage.Role{
+		Title:               role.Title,
+		Description:         role.Description,
+		IncludedPermissions: role.IncludedPermissions,
+		Stage:               role.Stage.String(),
+	}
+}
+
+func roleToProto(role *storage.Role, view adminpb.RoleView) *adminpb.Role {
+	resp := &adminpb.Role{
+		Name:        role.Name,
+		Title:       role.Title,
+		Description: role.Description,
+		Stage:       adminpb.Role_RoleLaunchStage(adminpb.Role_RoleLaunchStage_value[role.Stage]),
+		Deleted:     role.Deleted,
+	}
+	if view == adminpb.RoleView_FULL {
+		resp.IncludedPermissions = role.IncludedPermissions
+	}
+	return resp
+}
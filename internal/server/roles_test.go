@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1" //nolint:staticcheck // Using standard genproto package for tests
+	iampb "google.golang.org/genproto/googleapis/iam/v1"         //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+)
+
+func TestRoles_CreateUpdateDelete(t *testing.T) {
+	s := NewAdminServer(storage.NewStorage())
+	ctx := context.Background()
+
+	created, err := s.CreateRole(ctx, &adminpb.CreateRoleRequest{
+		Parent: "projects/test",
+		RoleId: "secretReader",
+		Role: &adminpb.Role{
+			Title:               "Secret Reader",
+			IncludedPermissions: []string{"secretmanager.secrets.get"},
+			Stage:               adminpb.Role_BETA,
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+	if created.Name != "projects/test/roles/secretReader" || created.Stage != adminpb.Role_BETA {
+		t.Errorf("Unexpected role: %v", created)
+	}
+
+	_, err = s.CreateRole(ctx, &adminpb.CreateRoleRequest{Parent: "projects/test", RoleId: "secretReader"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Expected AlreadyExists for a duplicate role, got %v", err)
+	}
+
+	updated, err := s.UpdateRole(ctx, &adminpb.UpdateRoleRequest{
+		Name: created.Name,
+		Role: &adminpb.Role{
+			Title:               "ignored",
+			IncludedPermissions: []string{"secretmanager.secrets.get", "secretmanager.versions.access"},
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"included_permissions"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateRole failed: %v", err)
+	}
+	if updated.Title != "Secret Reader" || len(updated.IncludedPermissions) != 2 {
+		t.Errorf("Expected only the permissions to change, got %v", updated)
+	}
+
+	list, err := s.ListRoles(ctx, &adminpb.ListRolesRequest{Parent: "projects/test"})
+	if err != nil {
+		t.Fatalf("ListRoles failed: %v", err)
+	}
+	if len(list.Roles) != 1 || len(list.Roles[0].IncludedPermissions) != 0 {
+		t.Errorf("Expected 1 role without permissions in the BASIC view, got %v", list.Roles)
+	}
+
+	deleted, err := s.DeleteRole(ctx, &adminpb.DeleteRoleRequest{Name: created.Name})
+	if err != nil {
+		t.Fatalf("DeleteRole failed: %v", err)
+	}
+	if !deleted.Deleted {
+		t.Error("Expected the deleted role to be marked deleted")
+	}
+
+	list, err = s.ListRoles(ctx, &adminpb.ListRolesRequest{Parent: "projects/test"})
+	if err != nil {
+		t.Fatalf("ListRoles failed: %v", err)
+	}
+	if len(list.Roles) != 0 {
+		t.Errorf("Expected deleted roles to be hidden, got %v", list.Roles)
+	}
+
+	_, err = s.UpdateRole(ctx, &adminpb.UpdateRoleRequest{Name: created.Name, Role: &adminpb.Role{}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition updating a deleted role, got %v", err)
+	}
+}
+
+func TestRoles_DeleteRevokesAccess(t *testing.T) {
+	policyServer := NewServer()
+	s := NewAdminServer(policyServer.GetStorage())
+	ctx := context.Background()
+
+	role, err := s.CreateRole(ctx, &adminpb.CreateRoleRequest{
+		Parent: "projects/test",
+		RoleId: "secretReader",
+		Role:   &adminpb.Role{IncludedPermissions: []string{"secretmanager.secrets.get"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+
+	_, err = policyServer.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: role.Name, Members: []string{"user:alice@example.com"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	check := func() []string {
+		allowed, err := policyServer.GetStorage().TestIamPermissions("projects/test", "user:alice@example.com", []string{"secretmanager.secrets.get"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		return allowed
+	}
+
+	if allowed := check(); len(allowed) != 1 {
+		t.Fatalf("Expected the custom role to grant access, got %v", allowed)
+	}
+
+	if _, err := s.DeleteRole(ctx, &adminpb.DeleteRoleRequest{Name: role.Name}); err != nil {
+		t.Fatalf("DeleteRole failed: %v", err)
+	}
+
+	if allowed := check(); len(allowed) != 0 {
+		t.Errorf("Expected a deleted role to grant nothing, got %v", allowed)
+	}
+}
+
+func TestRoles_GetPredefined(t *testing.T) {
+	s := NewAdminServer(storage.NewStorage())
+
+	role, err := s.GetRole(context.Background(), &adminpb.GetRoleRequest{Name: "roles/secretmanager.secretAccessor"})
+	if err != nil {
+		t.Fatalf("GetRole failed: %v", err)
+	}
+	if role.Title == "" || len(role.IncludedPermissions) == 0 {
+		t.Errorf("Expected the predefined role's title and permissions, got %v", role)
+	}
+
+	_, err = s.GetRole(context.Background(), &adminpb.GetRoleRequest{Name: "projects/test/roles/missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
@@ -2,40 +2,62 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/metrics"
 	"github.com/blackwell-systems/gcp-iam-emulator/internal/storage"
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/tracebuf"
 )
 
 type Server struct {
 	iampb.UnimplementedIAMPolicyServer
-	storage     *storage.Storage
-	trace       bool
-	explain     bool
-	traceFile   *os.File
-	traceLogger *slog.Logger
-	traceWriter *trace.Writer
+	storage       *storage.Storage
+	trace         bool
+	explain       bool
+	traceFile     *os.File
+	traceLogger   *slog.Logger
+	traceWriter   eventWriter
+	tracePipeline *tracePipeline
+	instanceLabel string
+	eventBuffer   *tracebuf.Buffer
+	auth          apiKeyAuth
+	faults        faultInjector
+	tracer        oteltrace.Tracer
 }
 
 func NewServer() *Server {
 	// Initialize trace writer from environment
-	traceWriter, _ := trace.NewWriterFromEnv()
+	var traceWriter eventWriter
+	if w, _ := trace.NewWriterFromEnv(); w != nil {
+		traceWriter = w
+	}
+
+	// Default the instance label to the hostname so shared trace pipelines
+	// can tell emulator instances apart
+	hostname, _ := os.Hostname()
 	
 	return &Server{
-		storage:     storage.NewStorage(),
-		trace:       false,
-		explain:     false,
-		traceWriter: traceWriter,
+		storage:       storage.NewStorage(),
+		trace:         false,
+		explain:       false,
+		traceWriter:   traceWriter,
+		instanceLabel: hostname,
+		tracer:        otel.Tracer(tracerName),
 	}
 }
 
@@ -47,13 +69,74 @@ func (s *Server) SetExplain(explain bool) {
 	s.explain = explain
 }
 
+func (s *Server) SetInstanceLabel(label string) {
+	s.instanceLabel = label
+}
+
+// SetEventBuffer keeps emitted trace events in memory in addition to (or
+// instead of) the trace writer.
+func (s *Server) SetEventBuffer(buffer *tracebuf.Buffer) {
+	s.eventBuffer = buffer
+}
+
+// SetTraceQueue moves trace writing off the RPC path onto a bounded queue of
+// queueSize events, optionally capped at maxRate events per second (0 means
+// unlimited). Events that don't fit are dropped and counted in
+// iam_emulator_trace_events_dropped_total. Call after SetTraceOutput.
+func (s *Server) SetTraceQueue(queueSize int, maxRate float64) {
+	if s.traceWriter == nil {
+		return
+	}
+	s.tracePipeline = newTracePipeline(s.traceWriter, queueSize, maxRate)
+}
+
 func (s *Server) SetAllowUnknownRoles(allow bool) {
 	s.storage.SetAllowUnknownRoles(allow)
 }
 
+func (s *Server) SetNormalizeMembers(normalize bool) {
+	s.storage.SetNormalizeMembers(normalize)
+}
+
+func (s *Server) SetAttachmentPoints(collections []string) {
+	s.storage.SetAttachmentPoints(collections)
+}
+
+func (s *Server) SetClock(now func() time.Time) {
+	s.storage.SetClock(now)
+}
+
+func (s *Server) SetPurgeDeletedMembers(purge bool) {
+	s.storage.SetPurgeDeletedMembers(purge)
+}
+
+func (s *Server) SetMatchDeletedMembers(match bool) {
+	s.storage.SetMatchDeletedMembers(match)
+}
+
+func (s *Server) SetAdditiveInheritance(additive bool) {
+	s.storage.SetAdditiveInheritance(additive)
+}
+
+func (s *Server) SetPublicGrantPolicy(policy storage.PublicGrantPolicy) {
+	s.storage.SetPublicGrantPolicy(policy)
+}
+
+func (s *Server) SetPolicyLimits(maxMembers, maxBindings int) {
+	s.storage.SetPolicyLimits(maxMembers, maxBindings)
+}
+
+func (s *Server) SetStrictConditions(strict bool) {
+	s.storage.SetStrictConditions(strict)
+}
+
+func (s *Server) SetUnsupportedConditionPolicy(policy storage.UnsupportedConditionPolicy) {
+	s.storage.SetUnsupportedConditionPolicy(policy)
+}
+
 func (s *Server) SetTraceOutput(path string) error {
 	// Create legacy slog trace file
-	f, err := os.Create(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create trace output file: %w", err)
 	}
@@ -63,22 +146,48 @@ func (s *Server) SetTraceOutput(path string) error {
 		Level: slog.LevelDebug,
 	}))
 	
-	// Also create structured trace writer if not already set from env
+	// Structured trace events go to the same file handle, unless a writer
+	// was already set from env
 	if s.traceWriter == nil {
-		w, err := trace.NewWriter(path)
-		if err != nil {
-			return fmt.Errorf("failed to create trace writer: %w", err)
-		}
-		s.traceWriter = w
+		s.traceWriter = newFileEventWriter(f)
 	}
 	
 	return nil
 }
 
+// Close drains the trace queue and flushes and closes the trace writer and
+// trace file, so no buffered trace events are lost on exit. It is safe to
+// call more than once.
+func (s *Server) Close() error {
+	if s.tracePipeline != nil {
+		s.tracePipeline.Close()
+		s.tracePipeline = nil
+	}
+
+	var errs []error
+	if s.traceWriter != nil {
+		if err := s.traceWriter.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close trace writer: %w", err))
+		}
+	}
+	if s.traceFile != nil {
+		if err := s.traceFile.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close trace file: %w", err))
+		}
+		s.traceFile = nil
+		s.traceLogger = nil
+	}
+	return errors.Join(errs...)
+}
+
 func (s *Server) LoadPolicies(policies map[string]*iampb.Policy) { //nolint:staticcheck // Using standard genproto package
 	s.storage.LoadPolicies(policies)
 }
 
+func (s *Server) ReplaceAll(state *storage.State) error {
+	return s.storage.ReplaceAll(state)
+}
+
 func (s *Server) LoadGroups(groups map[string][]string) {
 	s.storage.LoadGroups(groups)
 }
@@ -87,6 +196,22 @@ func (s *Server) LoadCustomRoles(roles map[string][]string) {
 	s.storage.LoadCustomRoles(roles)
 }
 
+func (s *Server) LoadResourceParents(parents map[string]string) {
+	s.storage.LoadResourceParents(parents)
+}
+
+func (s *Server) LoadResourceLabels(labels map[string]map[string]string) {
+	s.storage.LoadResourceLabels(labels)
+}
+
+func (s *Server) LoadServiceAccounts(specs []storage.ServiceAccountSpec) {
+	s.storage.LoadServiceAccounts(specs)
+}
+
+func (s *Server) LoadDenyPolicies(policies map[string][]storage.DenyRule) {
+	s.storage.LoadDenyPolicies(policies)
+}
+
 func (s *Server) GetStorage() *storage.Storage {
 	return s.storage
 }
@@ -104,8 +229,15 @@ func (s *Server) logTrace(resource, principal string, allowed []string, duration
 	}
 }
 
-func (s *Server) emitTraceEvents(resource, principal string, permissions []string, allowed []string, duration time.Duration) {
-	if s.traceWriter == nil {
+// emitsTraceEvents reports whether authz_check events have anywhere to go.
+func (s *Server) emitsTraceEvents() bool {
+	return s.traceWriter != nil || s.tracePipeline != nil || s.eventBuffer != nil
+}
+
+// emitTraceEvents emits an authz_check event per permission. reasons[i],
+// when present, is the storage decision reason for permissions[i].
+func (s *Server) emitTraceEvents(resource, principal string, permissions []string, allowed []string, reasons []string, duration time.Duration) {
+	if !s.emitsTraceEvents() {
 		return
 	}
 	
@@ -116,7 +248,7 @@ func (s *Server) emitTraceEvents(resource, principal string, permissions []strin
 	}
 	
 	// Emit one event per permission check
-	for _, perm := range permissions {
+	for i, perm := range permissions {
 		outcome := trace.OutcomeDeny
 		reason := "no_matching_binding"
 		
@@ -124,6 +256,9 @@ func (s *Server) emitTraceEvents(resource, principal string, permissions []strin
 			outcome = trace.OutcomeAllow
 			reason = "binding_match"
 		}
+		if i < len(reasons) && reasons[i] != "" {
+			reason = reasons[i]
+		}
 		
 		event := trace.AuthzEvent{
 			SchemaVersion: trace.SchemaV1_0,
@@ -147,18 +282,65 @@ func (s *Server) emitTraceEvents(resource, principal string, permissions []strin
 			},
 			Environment: &trace.Environment{
 				Component: "gcp-iam-emulator",
+				Cluster:   s.instanceLabel,
 			},
 		}
 		
-		// Emit event (gracefully ignores if writer is nil)
-		_ = s.traceWriter.Emit(event)
+		s.emitTraceEvent(event)
+
+		if auditLog, audited := s.storage.AuditLogFor(resource, principal, perm); audited {
+			s.emitTraceEvent(auditEvent(event, auditLog))
+		}
 	}
 	
 	// Flush after emitting all events
-	_ = s.traceWriter.Flush()
+	if s.tracePipeline == nil && s.traceWriter != nil {
+		_ = s.traceWriter.Flush()
+	}
+}
+
+// emitTraceEvent records event in the event buffer and hands it to the trace
+// pipeline, or writes it directly when there is none.
+func (s *Server) emitTraceEvent(event trace.AuthzEvent) {
+	s.eventBuffer.Add(event)
+
+	if s.tracePipeline != nil {
+		s.tracePipeline.Enqueue(event)
+		return
+	}
+
+	if s.traceWriter != nil {
+		_ = s.traceWriter.Emit(event)
+	}
+}
+
+// eventTypeAuditLog marks the trace event emitted alongside an authz_check
+// when the resource's audit configs log the check.
+const eventTypeAuditLog = "audit_log"
+
+// auditEvent returns the audit_log event for check, an authz_check event,
+// with the log type as the decision reason and the audited service as the
+// target service.
+func auditEvent(check trace.AuthzEvent, auditLog storage.AuditLog) trace.AuthzEvent {
+	target := *check.Target
+	target.Service = auditLog.Service
+	decision := *check.Decision
+	decision.Reason = auditLog.LogType.String()
+
+	event := check
+	event.EventType = eventTypeAuditLog
+	event.Target = &target
+	event.Decision = &decision
+	return event
 }
 
 func (s *Server) extractPrincipal(ctx context.Context) string {
+	return principalFromContext(ctx)
+}
+
+// principalFromContext returns the caller principal sent as
+// x-emulator-principal metadata, or "" if there is none.
+func principalFromContext(ctx context.Context) string {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		return ""
@@ -172,7 +354,43 @@ func (s *Server) extractPrincipal(ctx context.Context) string {
 	return principals[0]
 }
 
-func (s *Server) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) { //nolint:staticcheck // Using standard genproto package
+// requireAll reports whether the caller asked, via x-emulator-require-all
+// metadata, for an all-or-nothing verdict in the x-emulator-all-granted
+// response header.
+func requireAll(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	values := md.Get("x-emulator-require-all")
+	return len(values) > 0 && values[0] == "true"
+}
+
+// dryRun reports whether the caller asked, via x-emulator-dry-run metadata,
+// for SetIamPolicy to validate the policy and return what would be stored
+// without storing it.
+func dryRun(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	values := md.Get("x-emulator-dry-run")
+	return len(values) > 0 && values[0] == "true"
+}
+
+func (s *Server) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (policy *iampb.Policy, err error) { //nolint:staticcheck // Using standard genproto package
+	defer func() {
+		if !dryRun(ctx) {
+			metrics.RecordSetIamPolicy(err)
+		}
+	}()
+
+	ctx, span := s.startSpan(ctx, "SetIamPolicy", req.Resource)
+	defer func() { endSpan(span, err) }()
+	span.SetAttributes(attrDryRun.Bool(dryRun(ctx)))
+
 	if req.Resource == "" {
 		return nil, status.Error(codes.InvalidArgument, "resource is required")
 	}
@@ -181,8 +399,18 @@ func (s *Server) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyReques
 		return nil, status.Error(codes.InvalidArgument, "policy is required")
 	}
 
-	policy, err := s.storage.SetIamPolicy(req.Resource, req.Policy)
+	if dryRun(ctx) {
+		policy, err = s.storage.ValidateIamPolicy(req.Resource, req.Policy)
+	} else {
+		policy, err = s.storage.SetIamPolicy(req.Resource, req.Policy)
+	}
 	if err != nil {
+		if errors.Is(err, storage.ErrEtagMismatch) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, storage.ErrUnsupportedCondition) || errors.Is(err, storage.ErrPublicGrant) || errors.Is(err, storage.ErrInvalidRole) || errors.Is(err, storage.ErrPolicyTooLarge) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		if strings.Contains(err.Error(), "not found") {
 			return nil, status.Error(codes.NotFound, err.Error())
 		}
@@ -192,12 +420,19 @@ func (s *Server) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyReques
 	return policy, nil
 }
 
-func (s *Server) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) { //nolint:staticcheck // Using standard genproto package
+func (s *Server) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (policy *iampb.Policy, err error) { //nolint:staticcheck // Using standard genproto package
+	ctx, span := s.startSpan(ctx, "GetIamPolicy", req.Resource)
+	defer func() { endSpan(span, err) }()
+
 	if req.Resource == "" {
 		return nil, status.Error(codes.InvalidArgument, "resource is required")
 	}
 
-	policy, err := s.storage.GetIamPolicy(req.Resource)
+	if err := s.injectFault(ctx); err != nil {
+		return nil, err
+	}
+
+	policy, err = s.storage.GetIamPolicyForVersion(req.Resource, req.GetOptions().GetRequestedPolicyVersion())
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -205,7 +440,10 @@ func (s *Server) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyReques
 	return policy, nil
 }
 
-func (s *Server) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) { //nolint:staticcheck // Using standard genproto package
+func (s *Server) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (resp *iampb.TestIamPermissionsResponse, err error) { //nolint:staticcheck // Using standard genproto package
+	ctx, span := s.startSpan(ctx, "TestIamPermissions", req.Resource)
+	defer func() { endSpan(span, err) }()
+
 	if req.Resource == "" {
 		return nil, status.Error(codes.InvalidArgument, "resource is required")
 	}
@@ -214,36 +452,64 @@ func (s *Server) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermi
 		return nil, status.Error(codes.InvalidArgument, "permissions is required")
 	}
 
+	if err := s.injectFault(ctx); err != nil {
+		return nil, err
+	}
+
 	principal := s.extractPrincipal(ctx)
 
+	// Trace events carry each decision's reason, which costs full evaluation,
+	// so only ask storage for reasons when events are emitted
 	start := time.Now()
-	allowed, err := s.storage.TestIamPermissions(req.Resource, principal, req.Permissions, s.trace || s.explain)
+	var allowed, reasons []string
+	if s.emitsTraceEvents() {
+		var results []storage.PermissionResult
+		results, err = s.storage.TestIamPermissionsDetailed(req.Resource, principal, req.Permissions, s.trace || s.explain)
+		allowed = []string{}
+		for _, result := range results {
+			if result.Allowed {
+				allowed = append(allowed, result.Permission)
+			}
+			reasons = append(reasons, result.Reason)
+		}
+	} else {
+		allowed, err = s.storage.TestIamPermissions(req.Resource, principal, req.Permissions, s.trace || s.explain)
+	}
 	duration := time.Since(start)
 	
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, permissionCheckStatus(err)
 	}
 
+	metrics.RecordDecisions(req.Permissions, allowed, duration)
+	span.SetAttributes(
+		attrPermissionsRequested.Int(len(req.Permissions)),
+		attrPermissionsAllowed.Int(len(allowed)),
+		attrPermissionsDenied.Int(len(req.Permissions)-len(allowed)),
+	)
+
 	// Legacy slog trace
 	s.logTrace(req.Resource, principal, allowed, duration)
 	
 	// Structured trace events (JSONL)
-	s.emitTraceEvents(req.Resource, principal, req.Permissions, allowed, duration)
+	s.emitTraceEvents(req.Resource, principal, req.Permissions, allowed, reasons, duration)
+
+	if requireAll(ctx) {
+		allGranted := strconv.FormatBool(storage.AllGranted(req.Permissions, allowed))
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-emulator-all-granted", allGranted))
+	}
 
 	return &iampb.TestIamPermissionsResponse{ //nolint:staticcheck // Using standard genproto package
 		Permissions: allowed,
 	}, nil
 }
 
-type ProjectsServer struct {
-	storage *storage.Storage
-}
-
-func NewProjectsServer(storage *storage.Storage) *ProjectsServer {
-	return &ProjectsServer{storage: storage}
-}
-
-func (s *ProjectsServer) CreateProject(projectID string) error {
-	_, err := s.storage.CreateProject(projectID)
-	return err
+// permissionCheckStatus maps a storage permission check error to its gRPC
+// status: a condition the emulator cannot evaluate is FAILED_PRECONDITION,
+// anything else INTERNAL.
+func permissionCheckStatus(err error) error {
+	if errors.Is(err, storage.ErrUnsupportedCondition) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
 }
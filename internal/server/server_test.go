@@ -2,11 +2,16 @@ package server
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	expr "google.golang.org/genproto/googleapis/type/expr"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestSetIamPolicy(t *testing.T) {
@@ -82,6 +87,91 @@ func TestSetIamPolicy_MissingPolicy(t *testing.T) {
 	}
 }
 
+func TestSetIamPolicy_StaleEtag(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	resp, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	_, err = s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Etag:     []byte("stale"),
+			Bindings: resp.Bindings,
+		},
+	})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("Expected Aborted, got %v", err)
+	}
+}
+
+func TestGetIamPolicy_RequestedPolicyVersion(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Version: 3,
+			Bindings: []*iampb.Binding{
+				{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+				{
+					Role:      "roles/editor",
+					Members:   []string{"user:bob@example.com"},
+					Condition: &expr.Expr{Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		options  *iampb.GetPolicyOptions
+		bindings int
+	}{
+		{"no options", nil, 1},
+		{"version 1", &iampb.GetPolicyOptions{RequestedPolicyVersion: 1}, 1},
+		{"version 3", &iampb.GetPolicyOptions{RequestedPolicyVersion: 3}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: "projects/test", Options: tt.options})
+			if err != nil {
+				t.Fatalf("GetIamPolicy failed: %v", err)
+			}
+			if len(resp.Bindings) != tt.bindings {
+				t.Errorf("Expected %d bindings, got %v", tt.bindings, resp.Bindings)
+			}
+		})
+	}
+}
+
+func TestSetIamPolicy_InvalidRole(t *testing.T) {
+	s := NewServer()
+
+	_, err := s.SetIamPolicy(context.Background(), &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{{Role: "owner", Members: []string{"user:alice@example.com"}}},
+		},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
 func TestGetIamPolicy(t *testing.T) {
 	s := NewServer()
 	ctx := context.Background()
@@ -123,6 +213,58 @@ func TestGetIamPolicy(t *testing.T) {
 	}
 }
 
+func TestGetIamPolicy_AuditConfigs(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	auditConfigs := []*iampb.AuditConfig{
+		{
+			Service: "secretmanager.googleapis.com",
+			AuditLogConfigs: []*iampb.AuditLogConfig{
+				{
+					LogType:         iampb.AuditLogConfig_DATA_READ,
+					ExemptedMembers: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+				},
+			},
+		},
+	}
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Version: 3,
+			Bindings: []*iampb.Binding{
+				{
+					Role:      "roles/viewer",
+					Members:   []string{"user:alice@example.com"},
+					Condition: &expr.Expr{Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`},
+				},
+			},
+			AuditConfigs: auditConfigs,
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	// Audit configs are returned whether or not conditional bindings are
+	// filtered out for the requested version
+	for _, version := range []int32{1, 3} {
+		resp, err := s.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+			Resource: "projects/test",
+			Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: version},
+		})
+		if err != nil {
+			t.Fatalf("GetIamPolicy failed: %v", err)
+		}
+
+		got := &iampb.Policy{AuditConfigs: resp.AuditConfigs}
+		if !proto.Equal(got, &iampb.Policy{AuditConfigs: auditConfigs}) {
+			t.Errorf("Expected audit configs %v at version %d, got %v", auditConfigs, version, resp.AuditConfigs)
+		}
+	}
+}
+
 func TestGetIamPolicy_MissingResource(t *testing.T) {
 	s := NewServer()
 	ctx := context.Background()
@@ -226,3 +368,154 @@ func TestTestIamPermissions_MissingPermissions(t *testing.T) {
 		t.Errorf("Expected InvalidArgument, got %v", err)
 	}
 }
+
+func TestTestIamPermissions_InjectedClock(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Version: 3,
+			Bindings: []*iampb.Binding{
+				{
+					Role:    "roles/secretmanager.secretAccessor",
+					Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+					Condition: &expr.Expr{
+						Expression: `request.time >= timestamp("2030-01-01T00:00:00Z")`,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	req := &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test/secrets/db",
+		Permissions: []string{"secretmanager.versions.access"},
+	}
+	callCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("x-emulator-principal", "serviceAccount:ci@test.iam.gserviceaccount.com"))
+
+	resp, err := s.TestIamPermissions(callCtx, req)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(resp.Permissions) != 0 {
+		t.Errorf("Expected future-dated binding to deny now, got %v", resp.Permissions)
+	}
+
+	s.SetClock(func() time.Time { return time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC) })
+
+	resp, err = s.TestIamPermissions(callCtx, req)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(resp.Permissions) != 1 {
+		t.Errorf("Expected binding to allow at the injected time, got %v", resp.Permissions)
+	}
+}
+
+func TestSetIamPolicy_PolicyLimits(t *testing.T) {
+	s := NewServer()
+	s.SetPolicyLimits(2, 0)
+
+	_, err := s.SetIamPolicy(context.Background(), &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/viewer", Members: []string{"user:alice@example.com", "user:bob@example.com", "user:carol@example.com"}},
+			},
+		},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a policy over the member limit, got %v", err)
+	}
+}
+
+func TestSetIamPolicy_ValidatesCondition(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	setCondition := func(expression string) error {
+		_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+			Resource: "projects/test",
+			Policy: &iampb.Policy{
+				Version: 3,
+				Bindings: []*iampb.Binding{
+					{
+						Role:      "roles/secretmanager.secretAccessor",
+						Members:   []string{"user:alice@example.com"},
+						Condition: &expr.Expr{Expression: expression},
+					},
+				},
+			},
+		})
+		return err
+	}
+
+	if err := setCondition(`resource.name.startsWith("projects/test/secrets/")`); err != nil {
+		t.Fatalf("Expected a valid condition to be accepted, got %v", err)
+	}
+
+	err := setCondition(`resource.nme.startswith("projects/test/")`)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument for an invalid condition, got %v", err)
+	}
+
+	policy, err := s.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: "projects/test",
+		Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+	})
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if expression := policy.Bindings[0].Condition.Expression; !strings.HasPrefix(expression, "resource.name.") {
+		t.Errorf("Expected the rejected write to leave the valid policy in place, got %q", expression)
+	}
+}
+
+func TestTestIamPermissions_UnsupportedCondition(t *testing.T) {
+	s := NewServer()
+	ctx := context.Background()
+
+	// Strict mode rejects the condition at SetIamPolicy, so load it as
+	// config does
+	s.LoadPolicies(map[string]*iampb.Policy{
+		"projects/test": {
+			Version: 3,
+			Bindings: []*iampb.Binding{
+				{
+					Role:    "roles/secretmanager.secretAccessor",
+					Members: []string{"user:alice@example.com"},
+					Condition: &expr.Expr{
+						Expression: `request.auth.claims.level == "high"`,
+					},
+				},
+			},
+		},
+	})
+
+	req := &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test/secrets/db",
+		Permissions: []string{"secretmanager.versions.access"},
+	}
+	callCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("x-emulator-principal", "user:alice@example.com"))
+
+	_, err := s.TestIamPermissions(callCtx, req)
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition, got %v", err)
+	}
+
+	s.SetStrictConditions(false)
+
+	resp, err := s.TestIamPermissions(callCtx, req)
+	if err != nil {
+		t.Fatalf("Expected lenient mode to fall back to deny, got %v", err)
+	}
+	if len(resp.Permissions) != 0 {
+		t.Errorf("Expected no permissions, got %v", resp.Permissions)
+	}
+}
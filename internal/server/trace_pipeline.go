@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	dropReasonQueueFull   = "queue_full"
+	dropReasonRateLimited = "rate_limited"
+)
+
+// traceEventsDropped counts trace events discarded instead of being written,
+// labelled by why they were dropped.
+var traceEventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "iam_emulator_trace_events_dropped_total",
+	Help: "Trace events dropped because the trace queue was full or the event rate limit was exceeded.",
+}, []string{"reason"})
+
+// eventWriter writes structured trace events: a *trace.Writer configured from
+// the environment, or a fileEventWriter for --trace-output.
+type eventWriter interface {
+	Emit(event trace.AuthzEvent) error
+	Flush() error
+	Close() error
+}
+
+// fileEventWriter writes trace events as JSON lines to the --trace-output file
+// the server already holds for the legacy slog trace, so both share one file
+// handle. Each event is a single unbuffered write, so its line is never split
+// by a slog record.
+type fileEventWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	closed bool
+}
+
+func newFileEventWriter(out io.Writer) *fileEventWriter {
+	return &fileEventWriter{out: out}
+}
+
+func (w *fileEventWriter) Emit(event trace.AuthzEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace event: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.New("writer is closed")
+	}
+	if _, err := w.out.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write trace event: %w", err)
+	}
+	return nil
+}
+
+// Flush is a no-op: every event is written as it is emitted.
+func (w *fileEventWriter) Flush() error {
+	return nil
+}
+
+// Close stops further writes. The file belongs to the server, which closes it.
+func (w *fileEventWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	return nil
+}
+
+// tracePipeline decouples trace writing from the RPC path. Events go through a
+// bounded queue drained by a single goroutine; when the queue is full or the
+// rate limit is exceeded the event is dropped and counted, never blocking the
+// caller.
+type tracePipeline struct {
+	writer eventWriter
+	events chan trace.AuthzEvent
+	done   chan struct{}
+
+	mu       sync.Mutex
+	rate     float64
+	tokens   float64
+	lastFill time.Time
+	now      func() time.Time
+}
+
+// newTracePipeline starts a pipeline writing to writer. A rate of 0 disables
+// rate limiting.
+func newTracePipeline(writer eventWriter, queueSize int, rate float64) *tracePipeline {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	p := &tracePipeline{
+		writer:   writer,
+		events:   make(chan trace.AuthzEvent, queueSize),
+		done:     make(chan struct{}),
+		rate:     rate,
+		tokens:   math.Max(rate, 1),
+		lastFill: time.Now(),
+		now:      time.Now,
+	}
+	go p.run()
+	return p
+}
+
+// Enqueue queues an event for writing without blocking.
+func (p *tracePipeline) Enqueue(event trace.AuthzEvent) {
+	if !p.allow() {
+		traceEventsDropped.WithLabelValues(dropReasonRateLimited).Inc()
+		return
+	}
+
+	select {
+	case p.events <- event:
+	default:
+		traceEventsDropped.WithLabelValues(dropReasonQueueFull).Inc()
+	}
+}
+
+// Close stops accepting events and waits for queued events to be written.
+func (p *tracePipeline) Close() {
+	close(p.events)
+	<-p.done
+}
+
+func (p *tracePipeline) run() {
+	defer close(p.done)
+
+	for event := range p.events {
+		_ = p.writer.Emit(event)
+		if len(p.events) == 0 {
+			_ = p.writer.Flush()
+		}
+	}
+	_ = p.writer.Flush()
+}
+
+// allow applies a token bucket holding at most one second's worth of events
+// (and never less than one).
+func (p *tracePipeline) allow() bool {
+	if p.rate <= 0 {
+		return true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.tokens += now.Sub(p.lastFill).Seconds() * p.rate
+	if burst := math.Max(p.rate, 1); p.tokens > burst {
+		p.tokens = burst
+	}
+	p.lastFill = now
+
+	if p.tokens < 1 {
+		return false
+	}
+	p.tokens--
+	return true
+}
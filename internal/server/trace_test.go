@@ -0,0 +1,454 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	expr "google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/tracebuf"
+)
+
+func readTraceEvents(t *testing.T, path string) []trace.AuthzEvent {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open trace file: %v", err)
+	}
+	defer f.Close()
+
+	var events []trace.AuthzEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event trace.AuthzEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid trace line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestTraceEvents_InstanceLabel(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	writer, err := trace.NewWriter(path)
+	if err != nil {
+		t.Fatalf("Failed to create trace writer: %v", err)
+	}
+
+	s := NewServer()
+	s.traceWriter = writer
+	s.SetInstanceLabel("ci")
+	ctx := context.Background()
+
+	_, err = s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test/secrets/secret1",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	_, err = s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test/secrets/secret1",
+		Permissions: []string{"secretmanager.versions.access", "secretmanager.secrets.delete"},
+	})
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	events := readTraceEvents(t, path)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 trace events, got %d", len(events))
+	}
+
+	for _, event := range events {
+		if event.Environment == nil || event.Environment.Cluster != "ci" {
+			t.Errorf("Expected instance label 'ci' on event, got %+v", event.Environment)
+		}
+	}
+}
+
+func TestTraceEvents_InstanceLabelDefaultsToHostname(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("Hostname unavailable: %v", err)
+	}
+
+	s := NewServer()
+	if s.instanceLabel != hostname {
+		t.Errorf("Expected default instance label %q, got %q", hostname, s.instanceLabel)
+	}
+}
+
+func TestTraceEvents_EventBuffer(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	s := NewServer()
+	buffer := tracebuf.New(10)
+	s.SetEventBuffer(buffer)
+	ctx := context.Background()
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	checks := []string{"secretmanager.secrets.get", "secretmanager.secrets.delete", "cloudkms.keyRings.list"}
+	for _, perm := range checks {
+		_, err := s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+			Resource:    "projects/test",
+			Permissions: []string{perm},
+		})
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+	}
+
+	events := buffer.Events()
+	if len(events) != len(checks) {
+		t.Fatalf("Expected %d buffered events, got %d", len(checks), len(events))
+	}
+
+	for i, perm := range checks {
+		if events[i].Action.Permission != perm {
+			t.Errorf("Expected event %d for %s, got %s", i, perm, events[i].Action.Permission)
+		}
+	}
+
+	if events[1].Decision.Outcome != trace.OutcomeDeny {
+		t.Errorf("Expected secretmanager.secrets.delete to be denied, got %s", events[1].Decision.Outcome)
+	}
+}
+
+func TestTracePipeline_DropsWhenQueueFull(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	s := NewServer()
+	// No consumer goroutine, so the single queue slot fills on the first event
+	// and every later event must be dropped rather than block the RPC.
+	s.tracePipeline = &tracePipeline{
+		events: make(chan trace.AuthzEvent, 1),
+		done:   make(chan struct{}),
+	}
+	ctx := context.Background()
+
+	dropped := traceEventsDropped.WithLabelValues(dropReasonQueueFull)
+	before := testutil.ToFloat64(dropped)
+
+	permissions := []string{"secretmanager.secrets.get", "secretmanager.secrets.list", "secretmanager.secrets.delete", "secretmanager.versions.access"}
+	for i := 0; i < 3; i++ {
+		_, err := s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+			Resource:    "projects/test",
+			Permissions: permissions,
+		})
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed with a full trace queue: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(dropped) - before; got != float64(3*len(permissions)-1) {
+		t.Errorf("Expected %d dropped events, got %v", 3*len(permissions)-1, got)
+	}
+}
+
+func TestTracePipeline_RateLimit(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &tracePipeline{
+		events:   make(chan trace.AuthzEvent, 100),
+		done:     make(chan struct{}),
+		rate:     2,
+		tokens:   2,
+		lastFill: now,
+		now:      func() time.Time { return now },
+	}
+
+	dropped := traceEventsDropped.WithLabelValues(dropReasonRateLimited)
+	before := testutil.ToFloat64(dropped)
+
+	for i := 0; i < 5; i++ {
+		p.Enqueue(trace.AuthzEvent{})
+	}
+	if len(p.events) != 2 {
+		t.Errorf("Expected 2 events within the rate limit, got %d", len(p.events))
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	p.Enqueue(trace.AuthzEvent{})
+	if len(p.events) != 3 {
+		t.Errorf("Expected a token to refill after 500ms, got %d queued events", len(p.events))
+	}
+
+	if got := testutil.ToFloat64(dropped) - before; got != 3 {
+		t.Errorf("Expected 3 rate-limited events, got %v", got)
+	}
+}
+
+func TestTracePipeline_WritesQueuedEvents(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	writer, err := trace.NewWriter(path)
+	if err != nil {
+		t.Fatalf("Failed to create trace writer: %v", err)
+	}
+
+	s := NewServer()
+	s.traceWriter = writer
+	s.SetTraceQueue(16, 0)
+
+	_, err = s.TestIamPermissions(context.Background(), &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test",
+		Permissions: []string{"secretmanager.secrets.get", "secretmanager.secrets.list"},
+	})
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	s.tracePipeline.Close()
+
+	if events := readTraceEvents(t, path); len(events) != 2 {
+		t.Errorf("Expected 2 trace events after draining the queue, got %d", len(events))
+	}
+}
+
+func TestClose_FlushesTraceOutput(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	s := NewServer()
+	if err := s.SetTraceOutput(path); err != nil {
+		t.Fatalf("SetTraceOutput failed: %v", err)
+	}
+	ctx := context.Background()
+
+	checks := []string{"secretmanager.secrets.get", "secretmanager.secrets.delete"}
+	for _, perm := range checks {
+		_, err := s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+			Resource:    "projects/test",
+			Permissions: []string{perm},
+		})
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Expected a second Close to be a no-op, got %v", err)
+	}
+
+	// readTraceEvents fails on any line that is not valid JSON; the legacy
+	// slog lines share the file, so only count authz events
+	var permissions []string
+	for _, event := range readTraceEvents(t, path) {
+		if event.EventType == trace.EventTypeAuthzCheck {
+			permissions = append(permissions, event.Action.Permission)
+		}
+	}
+	if len(permissions) != len(checks) || permissions[0] != checks[0] || permissions[1] != checks[1] {
+		t.Errorf("Expected trace events for %v, got %v", checks, permissions)
+	}
+}
+
+func TestSetTraceOutput_TruncatesSharedFile(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	if err := os.WriteFile(path, []byte("stale output from a previous run\n"), 0644); err != nil {
+		t.Fatalf("Failed to write trace file: %v", err)
+	}
+
+	s := NewServer()
+	s.SetTrace(true)
+	if err := s.SetTraceOutput(path); err != nil {
+		t.Fatalf("SetTraceOutput failed: %v", err)
+	}
+	_, err := s.TestIamPermissions(context.Background(), &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test",
+		Permissions: []string{"secretmanager.secrets.get"},
+	})
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// readTraceEvents fails on the stale line if the file was not truncated
+	var authz, legacy int
+	for _, event := range readTraceEvents(t, path) {
+		if event.EventType == trace.EventTypeAuthzCheck {
+			authz++
+		} else {
+			legacy++
+		}
+	}
+	if authz != 1 || legacy != 1 {
+		t.Errorf("Expected one authz event and one slog line, got %d and %d", authz, legacy)
+	}
+}
+
+func TestTraceEvents_AuditLog(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	s := NewServer()
+	buffer := tracebuf.New(10)
+	s.SetEventBuffer(buffer)
+	ctx := context.Background()
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com", "user:bob@example.com"}},
+			},
+			AuditConfigs: []*iampb.AuditConfig{
+				{
+					Service: "secretmanager.googleapis.com",
+					AuditLogConfigs: []*iampb.AuditLogConfig{
+						{LogType: iampb.AuditLogConfig_DATA_READ, ExemptedMembers: []string{"user:bob@example.com"}},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		principal  string
+		permission string
+		audited    bool
+	}{
+		{"non-exempt read", "user:alice@example.com", "secretmanager.versions.access", true},
+		{"exempt read", "user:bob@example.com", "secretmanager.versions.access", false},
+		{"write without DATA_WRITE config", "user:alice@example.com", "secretmanager.secrets.delete", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer.Drain()
+
+			ctx := metadata.NewIncomingContext(ctx, metadata.Pairs("x-emulator-principal", tt.principal))
+			_, err := s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+				Resource:    "projects/test/secrets/db-password",
+				Permissions: []string{tt.permission},
+			})
+			if err != nil {
+				t.Fatalf("TestIamPermissions failed: %v", err)
+			}
+
+			var audits []trace.AuthzEvent
+			for _, event := range buffer.Events() {
+				if event.EventType == eventTypeAuditLog {
+					audits = append(audits, event)
+				}
+			}
+
+			if !tt.audited {
+				if len(audits) != 0 {
+					t.Errorf("Expected no audit event, got %+v", audits)
+				}
+				return
+			}
+			if len(audits) != 1 {
+				t.Fatalf("Expected 1 audit event, got %d", len(audits))
+			}
+			if audits[0].Decision.Reason != "DATA_READ" || audits[0].Target.Service != "secretmanager.googleapis.com" {
+				t.Errorf("Expected a secretmanager DATA_READ audit event, got %+v %+v", audits[0].Decision, audits[0].Target)
+			}
+			if audits[0].Actor.Principal != tt.principal {
+				t.Errorf("Expected audit event for %s, got %s", tt.principal, audits[0].Actor.Principal)
+			}
+		})
+	}
+}
+
+func TestTraceEvents_ConditionReason(t *testing.T) {
+	t.Setenv(trace.EnvTraceOutput, "")
+
+	s := NewServer()
+	buffer := tracebuf.New(10)
+	s.SetEventBuffer(buffer)
+	ctx := context.Background()
+
+	_, err := s.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test/secrets/db-password",
+		Policy: &iampb.Policy{
+			Version: 3,
+			Bindings: []*iampb.Binding{
+				{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+				{
+					Role:    "roles/secretmanager.admin",
+					Members: []string{"user:alice@example.com"},
+					Condition: &expr.Expr{
+						Title:      "expired",
+						Expression: `request.time < timestamp("2020-01-01T00:00:00Z")`,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-emulator-principal", "user:alice@example.com"))
+	_, err = s.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test/secrets/db-password",
+		Permissions: []string{"secretmanager.versions.access", "secretmanager.secrets.delete"},
+	})
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	reasons := make(map[string]*trace.Decision)
+	for _, event := range buffer.Events() {
+		if event.EventType == trace.EventTypeAuthzCheck {
+			reasons[event.Action.Permission] = event.Decision
+		}
+	}
+
+	allowed := reasons["secretmanager.versions.access"]
+	if allowed == nil || allowed.Outcome != trace.OutcomeAllow || !strings.Contains(allowed.Reason, "role=roles/secretmanager.secretAccessor") {
+		t.Errorf("Expected an ALLOW naming the matched role, got %+v", allowed)
+	}
+
+	denied := reasons["secretmanager.secrets.delete"]
+	if denied == nil || denied.Outcome != trace.OutcomeDeny {
+		t.Fatalf("Expected a DENY for the conditional permission, got %+v", denied)
+	}
+	if !strings.Contains(denied.Reason, "condition failed") || !strings.Contains(denied.Reason, "request.time") || !strings.Contains(denied.Reason, ">= 2020-01-01T00:00:00Z") {
+		t.Errorf("Expected the reason to name the failed condition, got %q", denied.Reason)
+	}
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"sort"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+// GetEffectiveAuditConfigs returns the audit configs that apply to a resource,
+// merging its own policy with every ancestor policy. Configs are merged by
+// service: log types are unioned, and a member stays exempt from a log type
+// only if every level enabling that log type exempts it.
+func (s *Storage) GetEffectiveAuditConfigs(resource string) []*iampb.AuditConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.effectiveAuditConfigs(normalizeResource(resource))
+}
+
+// effectiveAuditConfigs implements GetEffectiveAuditConfigs. Requires s.mu to
+// be held.
+func (s *Storage) effectiveAuditConfigs(resource string) []*iampb.AuditConfig {
+	merged := make(map[string]map[iampb.AuditLogConfig_LogType]map[string]bool)
+
+	for _, candidate := range s.resourceHierarchy(resource) {
+		policy, exists := s.policies[candidate]
+		if !exists {
+			continue
+		}
+
+		for _, auditConfig := range policy.AuditConfigs {
+			logTypes, ok := merged[auditConfig.Service]
+			if !ok {
+				logTypes = make(map[iampb.AuditLogConfig_LogType]map[string]bool)
+				merged[auditConfig.Service] = logTypes
+			}
+
+			for _, logConfig := range auditConfig.AuditLogConfigs {
+				exempted := make(map[string]bool, len(logConfig.ExemptedMembers))
+				for _, member := range logConfig.ExemptedMembers {
+					exempted[member] = true
+				}
+
+				existing, seen := logTypes[logConfig.LogType]
+				if !seen {
+					logTypes[logConfig.LogType] = exempted
+					continue
+				}
+
+				for member := range existing {
+					if !exempted[member] {
+						delete(existing, member)
+					}
+				}
+			}
+		}
+	}
+
+	services := make([]string, 0, len(merged))
+	for service := range merged {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	result := make([]*iampb.AuditConfig, 0, len(services))
+	for _, service := range services {
+		logTypes := make([]iampb.AuditLogConfig_LogType, 0, len(merged[service]))
+		for logType := range merged[service] {
+			logTypes = append(logTypes, logType)
+		}
+		sort.Slice(logTypes, func(i, j int) bool { return logTypes[i] < logTypes[j] })
+
+		auditConfig := &iampb.AuditConfig{Service: service}
+		for _, logType := range logTypes {
+			var exempted []string
+			for member := range merged[service][logType] {
+				exempted = append(exempted, member)
+			}
+			sort.Strings(exempted)
+
+			auditConfig.AuditLogConfigs = append(auditConfig.AuditLogConfigs, &iampb.AuditLogConfig{
+				LogType:         logType,
+				ExemptedMembers: exempted,
+			})
+		}
+
+		result = append(result, auditConfig)
+	}
+
+	return result
+}
+
+// allServices is the audit config service that applies to every service.
+const allServices = "allServices"
+
+// AuditLog identifies the data access audit log a permission check is
+// recorded in.
+type AuditLog struct {
+	// Service is the service the permission belongs to, e.g.
+	// secretmanager.googleapis.com
+	Service string
+	LogType iampb.AuditLogConfig_LogType
+}
+
+// AuditLogFor reports whether a check of permission by principal on resource
+// is audit logged. It is when an effective audit config for the permission's
+// service, or for allServices, enables the permission's log type (see
+// auditLogType) and principal is not exempted from it. As in GCP, the two
+// configs combine: the log type is enabled if either enables it, and the
+// exemptions of both apply. Exempted members match principal the way binding
+// members do, so a group: exemption covers its members.
+func (s *Storage) AuditLogFor(resource, principal, permission string) (AuditLog, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resource = normalizeResource(resource)
+	auditLog := AuditLog{
+		Service: extractResourceService(resource, permission),
+		LogType: auditLogType(permission),
+	}
+
+	enabled := false
+	var exempted []string
+	for _, auditConfig := range s.effectiveAuditConfigs(resource) {
+		if auditConfig.Service != auditLog.Service && auditConfig.Service != allServices {
+			continue
+		}
+		for _, logConfig := range auditConfig.AuditLogConfigs {
+			if logConfig.LogType == auditLog.LogType {
+				enabled = true
+				exempted = append(exempted, logConfig.ExemptedMembers...)
+			}
+		}
+	}
+	if !enabled || s.auditExempt(principal, exempted) {
+		return AuditLog{}, false
+	}
+	return auditLog, true
+}
+
+// auditLogType returns DATA_READ for read-only permissions (see
+// isReadPermission) and DATA_WRITE for every other permission.
+func auditLogType(permission string) iampb.AuditLogConfig_LogType {
+	if isReadPermission(permission) {
+		return iampb.AuditLogConfig_DATA_READ
+	}
+	return iampb.AuditLogConfig_DATA_WRITE
+}
+
+// auditExempt reports whether principal matches one of exemptedMembers.
+// Requires s.mu to be held.
+func (s *Storage) auditExempt(principal string, exemptedMembers []string) bool {
+	for _, member := range exemptedMembers {
+		if s.principalMatches(principal, member) {
+			return true
+		}
+	}
+	return false
+}
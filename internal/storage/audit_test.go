@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+func TestEffectiveAuditConfigs_InheritedFromProject(t *testing.T) {
+	s := NewStorage()
+
+	projectPolicy := &iampb.Policy{
+		Version: 1,
+		AuditConfigs: []*iampb.AuditConfig{
+			{
+				Service: "secretmanager.googleapis.com",
+				AuditLogConfigs: []*iampb.AuditLogConfig{
+					{LogType: iampb.AuditLogConfig_DATA_READ},
+				},
+			},
+		},
+	}
+
+	secretPolicy := &iampb.Policy{
+		Version: 1,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"user:alice@example.com"},
+			},
+		},
+	}
+
+	if _, err := s.SetIamPolicy("projects/test", projectPolicy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	if _, err := s.SetIamPolicy("projects/test/secrets/db-password", secretPolicy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	configs := s.GetEffectiveAuditConfigs("projects/test/secrets/db-password")
+	if len(configs) != 1 {
+		t.Fatalf("Expected 1 effective audit config, got %d", len(configs))
+	}
+
+	if configs[0].Service != "secretmanager.googleapis.com" {
+		t.Errorf("Expected service secretmanager.googleapis.com, got %s", configs[0].Service)
+	}
+
+	if len(configs[0].AuditLogConfigs) != 1 || configs[0].AuditLogConfigs[0].LogType != iampb.AuditLogConfig_DATA_READ {
+		t.Errorf("Expected inherited DATA_READ log config, got %v", configs[0].AuditLogConfigs)
+	}
+}
+
+func TestEffectiveAuditConfigs_MergeByService(t *testing.T) {
+	s := NewStorage()
+
+	projectPolicy := &iampb.Policy{
+		Version: 1,
+		AuditConfigs: []*iampb.AuditConfig{
+			{
+				Service: "secretmanager.googleapis.com",
+				AuditLogConfigs: []*iampb.AuditLogConfig{
+					{
+						LogType:         iampb.AuditLogConfig_DATA_READ,
+						ExemptedMembers: []string{"user:alice@example.com", "user:bob@example.com"},
+					},
+				},
+			},
+		},
+	}
+
+	secretPolicy := &iampb.Policy{
+		Version: 1,
+		AuditConfigs: []*iampb.AuditConfig{
+			{
+				Service: "secretmanager.googleapis.com",
+				AuditLogConfigs: []*iampb.AuditLogConfig{
+					{
+						LogType:         iampb.AuditLogConfig_DATA_READ,
+						ExemptedMembers: []string{"user:alice@example.com"},
+					},
+					{LogType: iampb.AuditLogConfig_DATA_WRITE},
+				},
+			},
+		},
+	}
+
+	if _, err := s.SetIamPolicy("projects/test", projectPolicy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	if _, err := s.SetIamPolicy("projects/test/secrets/db-password", secretPolicy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	configs := s.GetEffectiveAuditConfigs("projects/test/secrets/db-password")
+	if len(configs) != 1 {
+		t.Fatalf("Expected 1 effective audit config, got %d", len(configs))
+	}
+
+	logConfigs := configs[0].AuditLogConfigs
+	if len(logConfigs) != 2 {
+		t.Fatalf("Expected DATA_READ and DATA_WRITE, got %v", logConfigs)
+	}
+
+	var dataRead *iampb.AuditLogConfig
+	for _, logConfig := range logConfigs {
+		if logConfig.LogType == iampb.AuditLogConfig_DATA_READ {
+			dataRead = logConfig
+		}
+	}
+	if dataRead == nil {
+		t.Fatalf("Expected DATA_READ log config, got %v", logConfigs)
+	}
+
+	if len(dataRead.ExemptedMembers) != 1 || dataRead.ExemptedMembers[0] != "user:alice@example.com" {
+		t.Errorf("Expected exemptions to be intersected to alice only, got %v", dataRead.ExemptedMembers)
+	}
+}
+
+func TestAuditLogFor(t *testing.T) {
+	s := NewStorage()
+
+	if _, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		AuditConfigs: []*iampb.AuditConfig{
+			{
+				Service: "allServices",
+				AuditLogConfigs: []*iampb.AuditLogConfig{
+					{LogType: iampb.AuditLogConfig_DATA_WRITE, ExemptedMembers: []string{"group:ci"}},
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	s.LoadGroups(map[string][]string{"ci": {"serviceAccount:ci@test.iam.gserviceaccount.com"}})
+
+	tests := []struct {
+		principal  string
+		permission string
+		audited    bool
+	}{
+		{"user:alice@example.com", "secretmanager.secrets.delete", true},
+		{"user:alice@example.com", "secretmanager.secrets.list", false},
+		{"serviceAccount:ci@test.iam.gserviceaccount.com", "secretmanager.secrets.delete", false},
+	}
+
+	for _, tt := range tests {
+		auditLog, audited := s.AuditLogFor("projects/test/secrets/db-password", tt.principal, tt.permission)
+		if audited != tt.audited {
+			t.Errorf("AuditLogFor(%s, %s) = %v, expected %v", tt.principal, tt.permission, audited, tt.audited)
+			continue
+		}
+		if audited && (auditLog.LogType != iampb.AuditLogConfig_DATA_WRITE || auditLog.Service != "secretmanager.googleapis.com") {
+			t.Errorf("Expected a secretmanager DATA_WRITE audit log, got %+v", auditLog)
+		}
+	}
+}
+
+func TestAuditLogFor_CombinesAllServicesExemptions(t *testing.T) {
+	s := NewStorage()
+
+	// allServices exempts alice, the service config exempts bob; both enable
+	// DATA_READ, so neither is logged and carol is
+	if _, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		AuditConfigs: []*iampb.AuditConfig{
+			{
+				Service: "allServices",
+				AuditLogConfigs: []*iampb.AuditLogConfig{
+					{LogType: iampb.AuditLogConfig_DATA_READ, ExemptedMembers: []string{"user:alice@example.com"}},
+				},
+			},
+			{
+				Service: "secretmanager.googleapis.com",
+				AuditLogConfigs: []*iampb.AuditLogConfig{
+					{LogType: iampb.AuditLogConfig_DATA_READ, ExemptedMembers: []string{"user:bob@example.com"}},
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		principal string
+		audited   bool
+	}{
+		{"user:alice@example.com", false},
+		{"user:bob@example.com", false},
+		{"user:carol@example.com", true},
+	}
+
+	for _, tt := range tests {
+		if _, audited := s.AuditLogFor("projects/test/secrets/db-password", tt.principal, "secretmanager.secrets.get"); audited != tt.audited {
+			t.Errorf("AuditLogFor(%s) = %v, expected %v", tt.principal, audited, tt.audited)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Backend persists Storage state so it survives restarts. Storage always
+// evaluates against its in-memory copy and hands the backend the full state
+// after every write. Without a backend (the default) state lives only in
+// memory.
+type Backend interface {
+	// Load returns the persisted state; an empty backend returns an empty
+	// State.
+	Load() (*State, error)
+	// Save replaces the persisted state with state.
+	Save(state *State) error
+	Close() error
+}
+
+// SetBackend loads the state persisted in backend, replacing the current
+// state, and persists every later write to it.
+func (s *Storage) SetBackend(backend Backend) error {
+	state, err := backend.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load persisted state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applyState(state)
+	s.backend = backend
+	return nil
+}
+
+// IsEmpty reports whether the emulator holds no state at all, e.g. after
+// SetBackend loads a new database, so callers can tell whether to seed it.
+func (s *Storage) IsEmpty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.policies) == 0 && len(s.denyPolicies) == 0 && len(s.groups) == 0 &&
+		len(s.customRoles) == 0 && len(s.resourceParents) == 0 && len(s.resourceLabels) == 0 &&
+		len(s.projects) == 0 && len(s.serviceAccounts) == 0
+}
+
+// persist saves the current state to the backend, if any. A failed save is
+// logged rather than failing the write, which has already taken effect in
+// memory. Requires s.mu to be held for writing.
+func (s *Storage) persist() {
+	if s.backend == nil {
+		return
+	}
+	if err := s.backend.Save(s.state()); err != nil {
+		slog.Error("failed to persist state", "error", err)
+	}
+}
+
+var (
+	boltPoliciesBucket        = []byte("policies")
+	boltDenyPoliciesBucket    = []byte("denyPolicies")
+	boltGroupsBucket          = []byte("groups")
+	boltCustomRolesBucket     = []byte("customRoles")
+	boltResourceParentsBucket = []byte("resourceParents")
+	boltResourceLabelsBucket  = []byte("resourceLabels")
+	boltProjectsBucket        = []byte("projects")
+	boltServiceAccountsBucket = []byte("serviceAccounts")
+)
+
+// BoltBackend persists state to a BoltDB file, one bucket per kind of state
+// with a JSON value per key.
+type BoltBackend struct {
+	db *bolt.DB
+}
+
+// OpenBoltBackend opens (creating if needed) the BoltDB file at path. It fails
+// after a second if another process holds the file.
+func OpenBoltBackend(path string) (*BoltBackend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	return &BoltBackend{db: db}, nil
+}
+
+func (b *BoltBackend) Load() (*State, error) {
+	state := &State{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var policies map[string]policyJSON
+		if err := loadBucket(tx, boltPoliciesBucket, &policies); err != nil {
+			return err
+		}
+		state.Policies = fromPolicyJSON(policies)
+		if err := loadBucket(tx, boltDenyPoliciesBucket, &state.DenyPolicies); err != nil {
+			return err
+		}
+		if err := loadBucket(tx, boltGroupsBucket, &state.Groups); err != nil {
+			return err
+		}
+		if err := loadBucket(tx, boltCustomRolesBucket, &state.CustomRoles); err != nil {
+			return err
+		}
+		if err := loadBucket(tx, boltResourceParentsBucket, &state.ResourceParents); err != nil {
+			return err
+		}
+		if err := loadBucket(tx, boltResourceLabelsBucket, &state.ResourceLabels); err != nil {
+			return err
+		}
+		if err := loadBucket(tx, boltProjectsBucket, &state.Projects); err != nil {
+			return err
+		}
+		return loadBucket(tx, boltServiceAccountsBucket, &state.ServiceAccounts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save rewrites every bucket in a single transaction, so a crash leaves
+// either the previous or the new state on disk.
+func (b *BoltBackend) Save(state *State) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := saveBucket(tx, boltPoliciesBucket, toPolicyJSON(state.Policies)); err != nil {
+			return err
+		}
+		if err := saveBucket(tx, boltDenyPoliciesBucket, state.DenyPolicies); err != nil {
+			return err
+		}
+		if err := saveBucket(tx, boltGroupsBucket, state.Groups); err != nil {
+			return err
+		}
+		if err := saveBucket(tx, boltCustomRolesBucket, state.CustomRoles); err != nil {
+			return err
+		}
+		if err := saveBucket(tx, boltResourceParentsBucket, state.ResourceParents); err != nil {
+			return err
+		}
+		if err := saveBucket(tx, boltResourceLabelsBucket, state.ResourceLabels); err != nil {
+			return err
+		}
+		if err := saveBucket(tx, boltProjectsBucket, state.Projects); err != nil {
+			return err
+		}
+		return saveBucket(tx, boltServiceAccountsBucket, state.ServiceAccounts)
+	})
+}
+
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
+
+// loadBucket decodes every value in bucket into entries, keyed as stored. A
+// missing bucket leaves entries nil.
+func loadBucket[V any](tx *bolt.Tx, bucket []byte, entries *map[string]V) error {
+	stored := tx.Bucket(bucket)
+	if stored == nil {
+		return nil
+	}
+
+	*entries = make(map[string]V, stored.Stats().KeyN)
+	return stored.ForEach(func(key, value []byte) error {
+		var entry V
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return fmt.Errorf("%s/%s: %w", bucket, key, err)
+		}
+		(*entries)[string(key)] = entry
+		return nil
+	})
+}
+
+// saveBucket replaces the contents of bucket with entries.
+func saveBucket[V any](tx *bolt.Tx, bucket []byte, entries map[string]V) error {
+	if tx.Bucket(bucket) != nil {
+		if err := tx.DeleteBucket(bucket); err != nil {
+			return err
+		}
+	}
+
+	stored, err := tx.CreateBucket(bucket)
+	if err != nil {
+		return err
+	}
+	for key, entry := range entries {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", bucket, key, err)
+		}
+		if err := stored.Put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
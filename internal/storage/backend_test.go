@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+func openTestBoltBackend(t *testing.T, path string) *BoltBackend {
+	t.Helper()
+
+	backend, err := OpenBoltBackend(path)
+	if err != nil {
+		t.Fatalf("OpenBoltBackend failed: %v", err)
+	}
+	return backend
+}
+
+func TestBoltBackend_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "iam.db")
+
+	backend := openTestBoltBackend(t, path)
+	s := NewStorage()
+	if err := s.SetBackend(backend); err != nil {
+		t.Fatalf("SetBackend failed: %v", err)
+	}
+
+	s.LoadGroups(map[string][]string{"engineering": {"user:dana@example.com"}})
+	s.LoadCustomRoles(map[string][]string{"roles/custom.reader": {"secretmanager.versions.access"}})
+	s.SetDenyPolicy("projects/test", []DenyRule{{
+		DeniedPrincipals:  []string{"user:mallory@example.com"},
+		DeniedPermissions: []string{"secretmanager.versions.access"},
+	}})
+	if _, err := s.CreateProject("test", ""); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if _, err := s.CreateServiceAccount("test", "ci", "CI", ""); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/custom.reader", Members: []string{"group:engineering", "user:mallory@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	if err := backend.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Simulate a restart: a fresh storage on the same file
+	restarted := NewStorage()
+	reopened := openTestBoltBackend(t, path)
+	defer reopened.Close()
+	if err := restarted.SetBackend(reopened); err != nil {
+		t.Fatalf("SetBackend failed: %v", err)
+	}
+
+	policy, err := restarted.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 || policy.Bindings[0].Role != "roles/custom.reader" {
+		t.Fatalf("Expected the policy to survive the restart, got %v", policy.Bindings)
+	}
+
+	for principal, want := range map[string]int{"user:dana@example.com": 1, "user:mallory@example.com": 0} {
+		allowed, err := restarted.TestIamPermissions("projects/test/secrets/db", principal, []string{"secretmanager.versions.access"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		if len(allowed) != want {
+			t.Errorf("Expected %d permissions for %s after restart, got %v", want, principal, allowed)
+		}
+	}
+
+	if _, err := restarted.GetProject("projects/test"); err != nil {
+		t.Errorf("Expected the project to survive the restart: %v", err)
+	}
+	if accounts := restarted.ListServiceAccounts("test"); len(accounts) != 1 {
+		t.Errorf("Expected 1 service account after restart, got %d", len(accounts))
+	}
+}
+
+func TestBoltBackend_ClearPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "iam.db")
+
+	backend := openTestBoltBackend(t, path)
+	s := NewStorage()
+	if err := s.SetBackend(backend); err != nil {
+		t.Fatalf("SetBackend failed: %v", err)
+	}
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	s.Clear()
+	backend.Close()
+
+	reopened := openTestBoltBackend(t, path)
+	defer reopened.Close()
+	state, err := reopened.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(state.Policies) != 0 {
+		t.Errorf("Expected Clear to be persisted, got %v", state.Policies)
+	}
+}
+
+func TestBoltBackend_EmptyDatabase(t *testing.T) {
+	backend := openTestBoltBackend(t, filepath.Join(t.TempDir(), "iam.db"))
+	defer backend.Close()
+
+	s := NewStorage()
+	if err := s.SetBackend(backend); err != nil {
+		t.Fatalf("SetBackend failed: %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 0 {
+		t.Errorf("Expected an empty policy from an empty database, got %v", policy.Bindings)
+	}
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// builtInRolesJSON holds the predefined roles the emulator knows about, one
+// entry per role in the format printed by
+// `gcloud iam roles describe <role> --format=json`, so entries can be
+// refreshed from upstream by pasting that output.
+//
+//go:embed builtin_roles.json
+var builtInRolesJSON []byte
+
+// builtInRole is one predefined role from the embedded dataset.
+type builtInRole struct {
+	Name                string   `json:"name"`
+	Title               string   `json:"title"`
+	Description         string   `json:"description"`
+	IncludedPermissions []string `json:"includedPermissions"`
+	Stage               string   `json:"stage"`
+	Etag                string   `json:"etag"`
+}
+
+var (
+	builtInRolesOnce   sync.Once
+	builtInRolesByName map[string][]string
+	builtInRolesIndex  map[string]map[string]bool
+	// builtInRoleDefs holds each role's title, description and stage for
+	// GetRole; its permissions are those of builtInRolesByName
+	builtInRoleDefs map[string]builtInRole
+)
+
+// builtInRolePermissions returns the permissions of each predefined role,
+// keyed by role name, with basic roles expanded by expandBasicRoles. The
+// embedded dataset is parsed once per process.
+func builtInRolePermissions() map[string][]string {
+	builtInRolesOnce.Do(func() {
+		roles, err := parseBuiltInRoles(builtInRolesJSON)
+		if err != nil {
+			panic(fmt.Sprintf("embedded built-in roles: %v", err))
+		}
+		builtInRolesByName = expandBasicRoles(roles)
+		builtInRolesIndex = indexRolePermissions(builtInRolesByName)
+
+		var defs []builtInRole
+		if err := json.Unmarshal(builtInRolesJSON, &defs); err != nil {
+			panic(fmt.Sprintf("embedded built-in roles: %v", err))
+		}
+		builtInRoleDefs = make(map[string]builtInRole, len(defs))
+		for _, def := range defs {
+			def.IncludedPermissions = builtInRolesByName[def.Name]
+			builtInRoleDefs[def.Name] = def
+		}
+	})
+	return builtInRolesByName
+}
+
+// builtInRoleDefinitions returns every predefined role keyed by name, with
+// basic roles expanded as in builtInRolePermissions.
+func builtInRoleDefinitions() map[string]builtInRole {
+	builtInRolePermissions()
+	return builtInRoleDefs
+}
+
+// builtInRolePermissionIndex is builtInRolePermissions as a permission set per
+// role, for constant-time grant checks.
+func builtInRolePermissionIndex() map[string]map[string]bool {
+	builtInRolePermissions()
+	return builtInRolesIndex
+}
+
+// indexRolePermissions turns each role's permission list into a set.
+func indexRolePermissions(roles map[string][]string) map[string]map[string]bool {
+	index := make(map[string]map[string]bool, len(roles))
+	for role, perms := range roles {
+		set := make(map[string]bool, len(perms))
+		for _, perm := range perms {
+			set[perm] = true
+		}
+		index[role] = set
+	}
+	return index
+}
+
+func parseBuiltInRoles(data []byte) (map[string][]string, error) {
+	var roles []builtInRole
+	if err := json.Unmarshal(data, &roles); err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		if role.Name == "" {
+			return nil, fmt.Errorf("role without a name")
+		}
+		if _, exists := byName[role.Name]; exists {
+			return nil, fmt.Errorf("duplicate role %s", role.Name)
+		}
+		byName[role.Name] = role.IncludedPermissions
+	}
+	return byName, nil
+}
+
+// ownerIAMPermissions are the policy management permissions that only
+// roles/owner among the basic roles grants.
+var ownerIAMPermissions = []string{
+	"cloudkms.cryptoKeys.getIamPolicy",
+	"cloudkms.cryptoKeys.setIamPolicy",
+	"cloudkms.keyRings.getIamPolicy",
+	"cloudkms.keyRings.setIamPolicy",
+	"pubsub.subscriptions.getIamPolicy",
+	"pubsub.subscriptions.setIamPolicy",
+	"pubsub.topics.getIamPolicy",
+	"pubsub.topics.setIamPolicy",
+	"resourcemanager.projects.getIamPolicy",
+	"resourcemanager.projects.setIamPolicy",
+	"secretmanager.secrets.getIamPolicy",
+	"secretmanager.secrets.setIamPolicy",
+}
+
+// expandBasicRoles makes the basic roles nest as in GCP: roles/editor grants
+// everything roles/viewer does, and roles/owner everything roles/editor does
+// plus ownerIAMPermissions. A permission added to a lower basic role is thus
+// granted by the higher ones without being listed again.
+func expandBasicRoles(roles map[string][]string) map[string][]string {
+	expanded := make(map[string][]string, len(roles))
+	for role, perms := range roles {
+		expanded[role] = perms
+	}
+
+	expanded["roles/editor"] = unionPermissions(roles["roles/editor"], expanded["roles/viewer"])
+	expanded["roles/owner"] = unionPermissions(roles["roles/owner"], expanded["roles/editor"], ownerIAMPermissions)
+
+	return expanded
+}
+
+func unionPermissions(sets ...[]string) []string {
+	seen := make(map[string]bool)
+	var union []string
+	for _, perms := range sets {
+		for _, perm := range perms {
+			if !seen[perm] {
+				seen[perm] = true
+				union = append(union, perm)
+			}
+		}
+	}
+	sort.Strings(union)
+	return union
+}
+
+// IsBuiltInRole reports whether role is one of the predefined roles.
+func IsBuiltInRole(role string) bool {
+	_, ok := builtInRolePermissions()[role]
+	return ok
+}
@@ -0,0 +1,95 @@
+package storage
+
+import "testing"
+
+func TestBuiltInRoles_EmbeddedDatasetParses(t *testing.T) {
+	roles, err := parseBuiltInRoles(builtInRolesJSON)
+	if err != nil {
+		t.Fatalf("Embedded dataset failed to parse: %v", err)
+	}
+
+	expected := []string{
+		"roles/owner",
+		"roles/editor",
+		"roles/viewer",
+		"roles/secretmanager.admin",
+		"roles/secretmanager.secretAccessor",
+		"roles/secretmanager.secretVersionManager",
+		"roles/cloudkms.admin",
+		"roles/cloudkms.cryptoKeyEncrypterDecrypter",
+		"roles/cloudkms.viewer",
+		"roles/pubsub.admin",
+		"roles/pubsub.publisher",
+		"roles/pubsub.subscriber",
+		"roles/pubsub.viewer",
+	}
+	for _, role := range expected {
+		if len(roles[role]) == 0 {
+			t.Errorf("Expected %s with permissions in the embedded dataset", role)
+		}
+	}
+
+	if perms := roles["roles/secretmanager.secretAccessor"]; len(perms) != 1 || perms[0] != "secretmanager.versions.access" {
+		t.Errorf("Unexpected secretAccessor permissions: %v", perms)
+	}
+}
+
+func TestBuiltInRoles_RejectsMalformedDataset(t *testing.T) {
+	tests := map[string]string{
+		"invalid JSON":   `{`,
+		"missing name":   `[{"includedPermissions": ["a.b.c"]}]`,
+		"duplicate role": `[{"name": "roles/viewer"}, {"name": "roles/viewer"}]`,
+	}
+
+	for name, data := range tests {
+		if _, err := parseBuiltInRoles([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestBasicRoles_Nest(t *testing.T) {
+	s := NewStorage()
+
+	viewer, _ := s.getRolePermissions("roles/viewer", "")
+	editor, _ := s.getRolePermissions("roles/editor", "")
+	owner, _ := s.getRolePermissions("roles/owner", "")
+
+	for _, perm := range viewer {
+		if !containsString(editor, perm) {
+			t.Errorf("roles/viewer grants %s but roles/editor does not", perm)
+		}
+		if !containsString(owner, perm) {
+			t.Errorf("roles/viewer grants %s but roles/owner does not", perm)
+		}
+	}
+	for _, perm := range editor {
+		if !containsString(owner, perm) {
+			t.Errorf("roles/editor grants %s but roles/owner does not", perm)
+		}
+	}
+
+	if !containsString(owner, "resourcemanager.projects.setIamPolicy") {
+		t.Error("Expected roles/owner to grant resourcemanager.projects.setIamPolicy")
+	}
+	if containsString(editor, "resourcemanager.projects.setIamPolicy") {
+		t.Error("Expected roles/editor not to grant resourcemanager.projects.setIamPolicy")
+	}
+}
+
+func TestExpandBasicRoles_PropagatesViewerPermissions(t *testing.T) {
+	roles := expandBasicRoles(map[string][]string{
+		"roles/viewer": {"storage.objects.get"},
+		"roles/editor": {"storage.objects.create"},
+		"roles/owner":  {},
+	})
+
+	for _, perm := range []string{"storage.objects.get", "storage.objects.create", "secretmanager.secrets.setIamPolicy"} {
+		if !containsString(roles["roles/owner"], perm) {
+			t.Errorf("Expected roles/owner to grant %s, got %v", perm, roles["roles/owner"])
+		}
+	}
+	if !containsString(roles["roles/editor"], "storage.objects.get") {
+		t.Errorf("Expected roles/editor to grant viewer permission, got %v", roles["roles/editor"])
+	}
+}
@@ -1,114 +1,651 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
+	_ "time/tzdata" // Timezone database for getHours/getDayOfWeek in minimal images
 
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/overloads"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/parser"
 	expr "google.golang.org/genproto/googleapis/type/expr"
 )
 
+// ErrUnsupportedCondition is returned when a condition expression uses CEL
+// syntax the evaluator does not understand.
+var ErrUnsupportedCondition = errors.New("unsupported CEL expression")
+
+// ConditionError reports a binding condition that could not be evaluated
+// during a permission check. It matches ErrUnsupportedCondition.
+type ConditionError struct {
+	Resource   string
+	Expression string
+	Reason     string
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("cannot evaluate condition %q on %s: %s", e.Expression, e.Resource, e.Reason)
+}
+
+func (e *ConditionError) Unwrap() error {
+	return ErrUnsupportedCondition
+}
+
+// UnsupportedConditionPolicy controls how bindings with unsupported condition
+// expressions are treated. Deny and allow only apply once strict conditions
+// are disabled; error rejects such bindings at SetIamPolicy either way.
+type UnsupportedConditionPolicy string
+
+const (
+	UnsupportedConditionDeny  UnsupportedConditionPolicy = "deny"
+	UnsupportedConditionAllow UnsupportedConditionPolicy = "allow"
+	UnsupportedConditionError UnsupportedConditionPolicy = "error"
+)
+
+func ParseUnsupportedConditionPolicy(value string) (UnsupportedConditionPolicy, error) {
+	switch policy := UnsupportedConditionPolicy(value); policy {
+	case UnsupportedConditionDeny, UnsupportedConditionAllow, UnsupportedConditionError:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid unsupported condition policy %q (must be deny, allow, or error)", value)
+}
+
 type EvalContext struct {
 	ResourceName string
 	ResourceType string
-	RequestTime  time.Time
+	// ResourceService is the API that owns the resource, such as
+	// "secretmanager.googleapis.com".
+	ResourceService string
+	RequestTime     time.Time
+	// Labels are the resource's labels, read by resource.labels["key"]
+	Labels map[string]string
+	// Timezone is the binding-level zone used by getHours/getDayOfWeek calls
+	// that do not pass a zone argument. Nil means UTC.
+	Timezone *time.Location
 }
 
 func evaluateCondition(condition *expr.Expr, ctx EvalContext) (bool, string) {
+	result, reason, _ := evalCondition(condition, ctx)
+	return result, reason
+}
+
+// evalCondition evaluates a condition with cel-go and reports
+// ErrUnsupportedCondition when the expression does not compile against the
+// emulator's CEL environment.
+func evalCondition(condition *expr.Expr, ctx EvalContext) (bool, string, error) {
 	if condition == nil {
-		return true, "no condition"
+		return true, "no condition", nil
 	}
 
-	expr := strings.TrimSpace(condition.Expression)
-	if expr == "" {
-		return true, "empty condition"
+	expression := strings.TrimSpace(condition.Expression)
+	if expression == "" {
+		return true, "empty condition", nil
 	}
 
-	if strings.Contains(expr, "resource.name.startsWith") {
-		return evalStartsWith(expr, ctx.ResourceName)
+	loc, err := bindingTimezone(condition)
+	if err != nil {
+		return false, err.Error(), err
+	}
+	if loc != nil {
+		ctx.Timezone = loc
 	}
 
-	if strings.Contains(expr, "resource.type") {
-		return evalResourceType(expr, ctx.ResourceType)
+	if ctx.Timezone != nil {
+		expression = applyTimezone(expression, ctx.Timezone)
 	}
 
-	if strings.Contains(expr, "request.time") {
-		return evalRequestTime(expr, ctx.RequestTime)
+	compiled, err := compileCondition(expression)
+	if err != nil {
+		return false, err.Error(), err
 	}
 
-	return false, fmt.Sprintf("unsupported CEL expression: %s", expr)
-}
+	activation := map[string]any{
+		"resource.name":    ctx.ResourceName,
+		"resource.type":    ctx.ResourceType,
+		"resource.service": ctx.ResourceService,
+		"resource.labels":  compiled.labels(ctx.Labels),
+		"request.time":     ctx.RequestTime,
+	}
 
-func evalStartsWith(expr, resourceName string) (bool, string) {
-	start := strings.Index(expr, `"`)
-	end := strings.LastIndex(expr, `"`)
-	if start == -1 || end == -1 || start >= end {
-		return false, "invalid startsWith syntax"
+	out, details, err := compiled.program.Eval(activation)
+	if err != nil {
+		return false, fmt.Sprintf("CEL evaluation error: %v", err), nil
 	}
 
-	prefix := expr[start+1 : end]
-	result := strings.HasPrefix(resourceName, prefix)
-	
-	if result {
-		return true, fmt.Sprintf("resource.name '%s' starts with '%s'", resourceName, prefix)
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Sprintf("CEL expression returned %s, not bool", out.Type()), nil
 	}
-	return false, fmt.Sprintf("resource.name '%s' does not start with '%s'", resourceName, prefix)
+
+	r := &reasoner{state: details.State(), info: compiled.info}
+	if r.isNot(compiled.root) {
+		// A top-level ! applies to everything after the leading "!", kept as
+		// written
+		operand := strings.TrimSpace(strings.TrimPrefix(expression, "!"))
+		return result, fmt.Sprintf("negated: %s evaluated to %t", operand, !result), nil
+	}
+	return result, r.reason(compiled.root, result), nil
 }
 
-func evalResourceType(expr, resourceType string) (bool, string) {
-	start := strings.Index(expr, `"`)
-	end := strings.LastIndex(expr, `"`)
-	if start == -1 || end == -1 || start >= end {
-		return false, "invalid resource.type syntax"
+// validateCondition reports ErrUnsupportedCondition if the expression does not
+// compile against the emulator's CEL environment.
+func validateCondition(condition *expr.Expr) error {
+	if _, err := bindingTimezone(condition); err != nil {
+		return err
 	}
+	_, err := compileCondition(strings.TrimSpace(condition.Expression))
+	return err
+}
 
-	expectedType := expr[start+1 : end]
-	result := resourceType == expectedType
+var (
+	celEnv = mustNewCELEnv()
 
-	if result {
-		return true, fmt.Sprintf("resource.type '%s' matches '%s'", resourceType, expectedType)
+	// programCache maps an expression string to its *compiledCondition so
+	// repeated permission checks don't recompile.
+	programCache sync.Map
+)
+
+// invalidCELError describes why an expression failed to compile. It matches
+// ErrUnsupportedCondition so the unsupported condition policy applies.
+type invalidCELError struct {
+	cause error
+	// call is the member function called with the wrong arguments, if that
+	// is why the expression failed to compile.
+	call string
+}
+
+func (e *invalidCELError) Error() string {
+	if e.call != "" {
+		return fmt.Sprintf("invalid CEL: invalid %s syntax: %v", e.call, e.cause)
+	}
+	return fmt.Sprintf("invalid CEL: %v", e.cause)
+}
+
+func (e *invalidCELError) Unwrap() error {
+	return ErrUnsupportedCondition
+}
+
+type compiledCondition struct {
+	program cel.Program
+	err     error
+	// root and info are the checked expression, which reasons are derived
+	// from.
+	root celast.Expr
+	info *celast.SourceInfo
+	// labelKeys are the label keys the expression reads from
+	// resource.labels, which evaluate to "" when the resource lacks them.
+	labelKeys []string
+}
+
+// membershipCheck describes `<attribute> in ["a", "b", ...]`.
+type membershipCheck struct {
+	attribute string
+	values    []string
+}
+
+// mustNewCELEnv declares the request attributes the emulator supplies,
+// mirroring EvalContext.
+func mustNewCELEnv() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("resource.name", cel.StringType),
+		cel.Variable("resource.type", cel.StringType),
+		cel.Variable("resource.service", cel.StringType),
+		cel.Variable("resource.labels", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("request.time", cel.TimestampType),
+	)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create CEL environment: %v", err))
 	}
-	return false, fmt.Sprintf("resource.type '%s' does not match '%s'", resourceType, expectedType)
+	return env
+}
+
+// compileCondition returns the cached program for expression, compiling it on
+// first use. Compile errors are cached too.
+func compileCondition(expression string) (*compiledCondition, error) {
+	if cached, ok := programCache.Load(expression); ok {
+		c := cached.(*compiledCondition)
+		return c, c.err
+	}
+
+	c := compileProgram(expression)
+	programCache.Store(expression, c)
+	return c, c.err
 }
 
-func evalRequestTime(exprStr string, requestTime time.Time) (bool, string) {
-	start := strings.Index(exprStr, `timestamp("`)
-	if start == -1 {
-		return false, "invalid request.time syntax"
+func compileProgram(expression string) *compiledCondition {
+	checked, issues := celEnv.Compile(normalizeTimestampLiterals(expression))
+	if issues != nil && issues.Err() != nil {
+		return &compiledCondition{err: &invalidCELError{cause: issues.Err(), call: invalidCall(expression)}}
 	}
 
-	start += len(`timestamp("`)
-	end := strings.Index(exprStr[start:], `"`)
-	if end == -1 {
-		return false, "invalid timestamp format"
+	if !checked.OutputType().IsExactType(cel.BoolType) {
+		return &compiledCondition{err: &invalidCELError{cause: fmt.Errorf("expression must evaluate to bool, got %s", checked.OutputType())}}
 	}
 
-	timestampStr := exprStr[start : start+end]
-	targetTime, err := time.Parse(time.RFC3339, timestampStr)
+	// State tracking records every sub-expression's value for the reason
+	program, err := celEnv.Program(checked, cel.EvalOptions(cel.OptTrackState))
 	if err != nil {
-		return false, fmt.Sprintf("invalid timestamp: %s", timestampStr)
+		return &compiledCondition{err: &invalidCELError{cause: err}}
 	}
 
-	isLessThan := strings.Contains(exprStr, "<")
-	isGreaterThan := strings.Contains(exprStr, ">")
+	root := checked.NativeRep().Expr()
+	return &compiledCondition{
+		program:   program,
+		root:      root,
+		info:      checked.NativeRep().SourceInfo(),
+		labelKeys: labelKeys(root),
+	}
+}
 
-	if isLessThan {
-		result := requestTime.Before(targetTime)
-		if result {
-			return true, fmt.Sprintf("request.time %s < %s", requestTime.Format(time.RFC3339), timestampStr)
+// invalidCall returns the function of a top-level member call the emulator
+// declares, such as endsWith in resource.name.endsWith(), so a call with the
+// wrong arguments is reported as that function's syntax error. It returns ""
+// for anything else.
+func invalidCall(expression string) string {
+	parsed, issues := celEnv.Parse(expression)
+	if issues != nil && issues.Err() != nil {
+		return ""
+	}
+
+	root := parsed.NativeRep().Expr()
+	if root.Kind() != celast.CallKind || !root.AsCall().IsMemberFunction() {
+		return ""
+	}
+	if function := root.AsCall().FunctionName(); celEnv.HasFunction(function) {
+		return function
+	}
+	return ""
+}
+
+// labelKeys returns the keys read from resource.labels, either indexed with a
+// string literal (resource.labels["env"]) or selected (resource.labels.env).
+func labelKeys(root celast.Expr) []string {
+	var keys []string
+	celast.PreOrderVisit(root, celast.NewExprVisitor(func(e celast.Expr) {
+		switch e.Kind() {
+		case celast.CallKind:
+			call := e.AsCall()
+			if call.FunctionName() != operators.Index || attributeName(call.Args()[0]) != "resource.labels" {
+				return
+			}
+			if key := call.Args()[1]; key.Kind() == celast.LiteralKind {
+				if value, ok := key.AsLiteral().Value().(string); ok {
+					keys = append(keys, value)
+				}
+			}
+		case celast.SelectKind:
+			if attributeName(e.AsSelect().Operand()) == "resource.labels" && !e.AsSelect().IsTestOnly() {
+				keys = append(keys, e.AsSelect().FieldName())
+			}
+		}
+	}))
+	return keys
+}
+
+// labels returns the resource labels to evaluate against: the resource's
+// own, plus "" for every key the expression reads that the resource lacks.
+func (c *compiledCondition) labels(resourceLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(resourceLabels)+len(c.labelKeys))
+	for _, key := range c.labelKeys {
+		labels[key] = ""
+	}
+	for key, value := range resourceLabels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// parseMembership recognizes a top-level `<attribute> in [<string literals>]`.
+func parseMembership(e celast.Expr) *membershipCheck {
+	if e.Kind() != celast.CallKind || e.AsCall().FunctionName() != operators.In {
+		return nil
+	}
+
+	args := e.AsCall().Args()
+	attribute := attributeName(args[0])
+	if attribute == "" || args[1].Kind() != celast.ListKind {
+		return nil
+	}
+
+	check := &membershipCheck{attribute: attribute}
+	for _, element := range args[1].AsList().Elements() {
+		if element.Kind() != celast.LiteralKind {
+			return nil
 		}
-		return false, fmt.Sprintf("request.time %s >= %s", requestTime.Format(time.RFC3339), timestampStr)
+		value, ok := element.AsLiteral().Value().(string)
+		if !ok {
+			return nil
+		}
+		check.values = append(check.values, value)
 	}
+	return check
+}
+
+// attributeName returns the dotted name of an identifier or field selection,
+// e.g. "resource.name", or "" for any other expression.
+func attributeName(e celast.Expr) string {
+	switch e.Kind() {
+	case celast.IdentKind:
+		return e.AsIdent()
+	case celast.SelectKind:
+		if operand := attributeName(e.AsSelect().Operand()); operand != "" {
+			return operand + "." + e.AsSelect().FieldName()
+		}
+	}
+	return ""
+}
+
+// reason explains a membership result by naming the matched element or the
+// list the value was absent from.
+func (m *membershipCheck) reason(value string, result bool) string {
+	if result {
+		return fmt.Sprintf("%s '%s' matched list element '%s'", m.attribute, value, value)
+	}
+	return fmt.Sprintf("%s '%s' not in [%s]", m.attribute, value, strings.Join(m.values, ", "))
+}
+
+// reasoner explains a condition result from the checked expression and the
+// value cel-go recorded for each sub-expression it evaluated.
+type reasoner struct {
+	state interpreter.EvalState
+	info  *celast.SourceInfo
+}
+
+// stringMatchers phrase the string member functions, as matched and not
+// matched.
+var stringMatchers = map[string][2]string{
+	overloads.StartsWith: {"starts with", "does not start with"},
+	overloads.EndsWith:   {"ends with", "does not end with"},
+	overloads.Contains:   {"contains", "does not contain"},
+}
+
+// negatedComparisons maps each ordering operator to the one that holds when
+// it does not.
+var negatedComparisons = map[string]string{
+	operators.Less:          ">=",
+	operators.LessEquals:    ">",
+	operators.Greater:       "<=",
+	operators.GreaterEquals: "<",
+}
+
+// comparisonSymbols maps the ordering operators to their CEL syntax.
+var comparisonSymbols = map[string]string{
+	operators.Less:          "<",
+	operators.LessEquals:    "<=",
+	operators.Greater:       ">",
+	operators.GreaterEquals: ">=",
+}
+
+// reason explains why e evaluated to result in terms of its top-level
+// operator, e.g. "resource.name 'projects/p/secrets/a' ends with '/a'".
+// Operators without a specific explanation fall back to
+// "<expression> evaluated to <result>".
+func (r *reasoner) reason(e celast.Expr, result bool) string {
+	if e.Kind() != celast.CallKind {
+		return r.fallback(e, result)
+	}
+
+	call := e.AsCall()
+	args := call.Args()
+	switch function := call.FunctionName(); function {
+	case operators.LogicalAnd, operators.LogicalOr:
+		return r.logicalReason(call, result)
+
+	case operators.LogicalNot:
+		if operand, ok := r.boolValue(args[0]); ok {
+			return fmt.Sprintf("negated: %s", r.reason(args[0], operand))
+		}
 
-	if isGreaterThan {
-		result := requestTime.After(targetTime)
+	case operators.Equals, operators.NotEquals:
+		attribute, value, literal, ok := r.attributeComparison(args[0], args[1])
+		if !ok {
+			break
+		}
+		if value == literal {
+			return fmt.Sprintf("%s '%s' matches '%s'", attribute, value, literal)
+		}
+		return fmt.Sprintf("%s '%s' does not match '%s'", attribute, value, literal)
+
+	case operators.Less, operators.LessEquals, operators.Greater, operators.GreaterEquals:
+		left, leftOK := r.value(args[0])
+		right, rightOK := r.value(args[1])
+		if !leftOK || !rightOK {
+			break
+		}
+		op := comparisonSymbols[function]
+		if _, isTime := left.(time.Time); isTime {
+			if !result {
+				op = negatedComparisons[function]
+			}
+			return fmt.Sprintf("%s %s %s %s", r.text(args[0]), formatValue(left), op, formatValue(right))
+		}
+		if result {
+			return fmt.Sprintf("%s is %s (%s %s)", r.text(args[0]), formatValue(left), op, formatValue(right))
+		}
+		return fmt.Sprintf("%s is %s (not %s %s)", r.text(args[0]), formatValue(left), op, formatValue(right))
+
+	case operators.In:
+		if check := parseMembership(e); check != nil {
+			if value, ok := r.value(args[0]); ok {
+				return check.reason(formatValue(value), result)
+			}
+		}
+
+	case overloads.StartsWith, overloads.EndsWith, overloads.Contains:
+		if !call.IsMemberFunction() || len(args) != 1 {
+			break
+		}
+		target, targetOK := r.value(call.Target())
+		arg, argOK := r.value(args[0])
+		if !targetOK || !argOK {
+			break
+		}
+		phrase := stringMatchers[function][1]
 		if result {
-			return true, fmt.Sprintf("request.time %s > %s", requestTime.Format(time.RFC3339), timestampStr)
+			phrase = stringMatchers[function][0]
+		}
+		return fmt.Sprintf("%s '%s' %s '%s'", r.text(call.Target()), formatValue(target), phrase, formatValue(arg))
+	}
+
+	return r.fallback(e, result)
+}
+
+// logicalReason explains && and || like their short-circuit: the term that
+// decided the result, or every term when all of them had to hold (&&) or
+// all failed (||). Terms cel-go skipped are left out.
+func (r *reasoner) logicalReason(call celast.CallExpr, result bool) string {
+	decisive := call.FunctionName() == operators.LogicalOr
+	separator := " && "
+	if decisive {
+		separator = " || "
+	}
+
+	var reasons []string
+	for _, term := range r.logicalTerms(call.FunctionName(), call) {
+		value, ok := r.boolValue(term)
+		if !ok {
+			continue
+		}
+		if value == decisive && result == decisive {
+			// || found a true term, or && found a false one
+			return r.reason(term, value)
+		}
+		reasons = append(reasons, r.reason(term, value))
+	}
+	if len(reasons) == 0 {
+		return fmt.Sprintf("%s evaluated to %t", r.text(nil), result)
+	}
+	return strings.Join(reasons, separator)
+}
+
+// logicalTerms flattens a chain of the same logical operator, so a && b && c
+// yields its three terms in order.
+func (r *reasoner) logicalTerms(function string, call celast.CallExpr) []celast.Expr {
+	var terms []celast.Expr
+	for _, arg := range call.Args() {
+		if arg.Kind() == celast.CallKind && arg.AsCall().FunctionName() == function {
+			terms = append(terms, r.logicalTerms(function, arg.AsCall())...)
+			continue
+		}
+		terms = append(terms, arg)
+	}
+	return terms
+}
+
+func (r *reasoner) isNot(e celast.Expr) bool {
+	return e.Kind() == celast.CallKind && e.AsCall().FunctionName() == operators.LogicalNot
+}
+
+// attributeComparison matches an attribute compared with a literal, on either
+// side, returning the attribute's name and value and the literal's value.
+func (r *reasoner) attributeComparison(left, right celast.Expr) (string, string, string, bool) {
+	if left.Kind() == celast.LiteralKind {
+		left, right = right, left
+	}
+	if right.Kind() != celast.LiteralKind {
+		return "", "", "", false
+	}
+
+	attribute := r.text(left)
+	value, valueOK := r.value(left)
+	literal, literalOK := r.value(right)
+	if !valueOK || !literalOK {
+		return "", "", "", false
+	}
+	return attribute, formatValue(value), formatValue(literal), true
+}
+
+// value returns the value cel-go recorded for e, if it was evaluated.
+func (r *reasoner) value(e celast.Expr) (any, bool) {
+	if e.Kind() == celast.LiteralKind {
+		return e.AsLiteral().Value(), true
+	}
+	if r.state == nil {
+		return nil, false
+	}
+	val, ok := r.state.Value(e.ID())
+	if !ok || types.IsError(val) || types.IsUnknown(val) {
+		return nil, false
+	}
+	return val.Value(), true
+}
+
+func (r *reasoner) boolValue(e celast.Expr) (bool, bool) {
+	value, ok := r.value(e)
+	if !ok {
+		return false, false
+	}
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// text returns e as CEL source, preferring the dotted attribute name.
+func (r *reasoner) text(e celast.Expr) string {
+	if e == nil {
+		return "expression"
+	}
+	if name := attributeName(e); name != "" {
+		return name
+	}
+	if text, err := parser.Unparse(e, r.info); err == nil {
+		return text
+	}
+	return "expression"
+}
+
+func (r *reasoner) fallback(e celast.Expr, result bool) string {
+	return fmt.Sprintf("%s evaluated to %t", r.text(e), result)
+}
+
+// formatValue renders a recorded value for a reason: timestamps in RFC 3339
+// and everything else as printed by fmt.
+func formatValue(value any) string {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// bareTimeAccessor matches timestamp accessors on request.time called without
+// a timezone argument.
+var bareTimeAccessor = regexp.MustCompile(`request\.time\.(getFullYear|getMonth|getDayOfYear|getDayOfMonth|getDate|getDayOfWeek|getHours|getMinutes|getSeconds|getMilliseconds)\(\s*\)`)
+
+// applyTimezone passes the binding-level timezone to bare request.time
+// accessors, so getHours() behaves like getHours("<zone>"). A zone written in
+// the expression always wins.
+func applyTimezone(expression string, loc *time.Location) string {
+	return bareTimeAccessor.ReplaceAllString(expression, fmt.Sprintf(`request.time.$1(%q)`, loc.String()))
+}
+
+// timestampLiteral matches timestamp("...") calls on a string literal.
+var timestampLiteral = regexp.MustCompile(`timestamp\(\s*("[^"]*"|'[^']*')\s*\)`)
+
+// timestampLayouts are the literal formats timestamp() accepts, in order. A
+// time without an offset is UTC, and a bare date means midnight UTC.
+var timestampLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseTimestampLiteral parses a timestamp() argument with the first layout
+// in timestampLayouts that fits.
+func parseTimestampLiteral(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
 		}
-		return false, fmt.Sprintf("request.time %s <= %s", requestTime.Format(time.RFC3339), timestampStr)
 	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
 
-	return false, "request.time expression must use < or >"
+// normalizeTimestampLiterals rewrites timestamp() literals CEL cannot parse
+// itself, such as timestamp("2026-12-31"), into RFC 3339. Literals that match
+// no layout are left for CEL to report.
+func normalizeTimestampLiterals(expression string) string {
+	return timestampLiteral.ReplaceAllStringFunc(expression, func(call string) string {
+		quoted := timestampLiteral.FindStringSubmatch(call)[1]
+		value := quoted[1 : len(quoted)-1]
+		if _, err := time.Parse(time.RFC3339, value); err == nil {
+			return call
+		}
+		t, err := parseTimestampLiteral(value)
+		if err != nil {
+			return call
+		}
+		return fmt.Sprintf("timestamp(%q)", t.UTC().Format(time.RFC3339))
+	})
+}
+
+// conditionTimezone returns the binding-level timezone declared in the
+// condition title as a "tz=<zone>" token, e.g. "Business hours tz=Europe/Berlin".
+func conditionTimezone(condition *expr.Expr) string {
+	for _, field := range strings.Fields(condition.Title) {
+		if zone, ok := strings.CutPrefix(field, "tz="); ok {
+			return zone
+		}
+	}
+	return ""
+}
+
+// bindingTimezone loads the zone named by conditionTimezone, or returns nil
+// when the title names none. A zone that does not exist is unsupported, like
+// an expression that does not compile, rather than a silent deny.
+func bindingTimezone(condition *expr.Expr) (*time.Location, error) {
+	zone := conditionTimezone(condition)
+	if zone == "" {
+		return nil, nil
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid binding timezone %q: %v", ErrUnsupportedCondition, zone, err)
+	}
+	return loc, nil
 }
 
 func extractResourceType(resourceName string) string {
@@ -121,5 +658,44 @@ func extractResourceType(resourceName string) string {
 	if strings.Contains(resourceName, "/keyRings/") {
 		return "KEY_RING"
 	}
+	if strings.Contains(resourceName, "/subscriptions/") {
+		return "SUBSCRIPTION"
+	}
+	if strings.Contains(resourceName, "/topics/") {
+		return "TOPIC"
+	}
+	if strings.Contains(resourceName, "/serviceAccounts/") {
+		return "SERVICE_ACCOUNT"
+	}
+	if collection, id, ok := strings.Cut(resourceName, "/"); ok && id != "" && !strings.Contains(id, "/") {
+		switch collection {
+		case "folders":
+			return "FOLDER"
+		case "organizations":
+			return "ORGANIZATION"
+		}
+	}
 	return "UNKNOWN"
 }
+
+// extractResourceService derives the owning API from the resource path,
+// falling back to the permission's service prefix for resources the path
+// doesn't identify (e.g. a project-level check).
+func extractResourceService(resourceName, permission string) string {
+	if strings.Contains(resourceName, "/secrets/") {
+		return "secretmanager.googleapis.com"
+	}
+	if strings.Contains(resourceName, "/keyRings/") || strings.Contains(resourceName, "/cryptoKeys/") {
+		return "cloudkms.googleapis.com"
+	}
+	if strings.Contains(resourceName, "/topics/") || strings.Contains(resourceName, "/subscriptions/") {
+		return "pubsub.googleapis.com"
+	}
+	if strings.Contains(resourceName, "/serviceAccounts/") {
+		return "iam.googleapis.com"
+	}
+	if service, _, ok := strings.Cut(permission, "."); ok && service != "" {
+		return service + ".googleapis.com"
+	}
+	return ""
+}
@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
 	expr "google.golang.org/genproto/googleapis/type/expr"
 )
 
@@ -49,6 +53,81 @@ func TestEvaluateCondition_StartsWith(t *testing.T) {
 	}
 }
 
+func TestEvaluateCondition_EndsWithContains(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		resource   string
+		expected   bool
+		reason     string
+	}{
+		{
+			name:       "matches suffix",
+			expression: `resource.name.endsWith("/prod")`,
+			resource:   "projects/test/secrets/db/prod",
+			expected:   true,
+			reason:     "ends with",
+		},
+		{
+			name:       "does not match suffix",
+			expression: `resource.name.endsWith("/prod")`,
+			resource:   "projects/test/secrets/db/staging",
+			expected:   false,
+			reason:     "does not end with",
+		},
+		{
+			name:       "matches substring",
+			expression: `resource.name.contains("-staging-")`,
+			resource:   "projects/test/secrets/api-staging-key",
+			expected:   true,
+			reason:     "contains",
+		},
+		{
+			name:       "does not match substring",
+			expression: `resource.name.contains("-staging-")`,
+			resource:   "projects/test/secrets/api-prod-key",
+			expected:   false,
+			reason:     "does not contain",
+		},
+		{
+			name:       "escaped quote in argument",
+			expression: `resource.name.contains("a\"b")`,
+			resource:   `projects/test/secrets/a"b`,
+			expected:   true,
+			reason:     "contains",
+		},
+		{
+			name:       "missing argument",
+			expression: `resource.name.endsWith()`,
+			resource:   "projects/test/secrets/db",
+			expected:   false,
+			reason:     "invalid endsWith syntax",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &expr.Expr{
+				Expression: tt.expression,
+			}
+
+			ctx := EvalContext{
+				ResourceName: tt.resource,
+				ResourceType: "SECRET",
+				RequestTime:  time.Now(),
+			}
+
+			result, reason := evaluateCondition(condition, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v for expression %s on resource %s", tt.expected, result, tt.expression, tt.resource)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("Expected reason to contain %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+}
+
 func TestEvaluateCondition_ResourceType(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -102,28 +181,28 @@ func TestEvaluateCondition_RequestTime(t *testing.T) {
 	past := "2026-01-01T00:00:00Z"
 
 	tests := []struct {
-		name       string
-		expression string
+		name        string
+		expression  string
 		requestTime time.Time
-		expected   bool
+		expected    bool
 	}{
 		{
-			name:       "time before future",
-			expression: fmt.Sprintf(`request.time < timestamp("%s")`, future),
+			name:        "time before future",
+			expression:  fmt.Sprintf(`request.time < timestamp("%s")`, future),
 			requestTime: now,
-			expected:   true,
+			expected:    true,
 		},
 		{
-			name:       "time after past",
-			expression: fmt.Sprintf(`request.time > timestamp("%s")`, past),
+			name:        "time after past",
+			expression:  fmt.Sprintf(`request.time > timestamp("%s")`, past),
 			requestTime: now,
-			expected:   true,
+			expected:    true,
 		},
 		{
-			name:       "time after future (should fail)",
-			expression: fmt.Sprintf(`request.time < timestamp("%s")`, past),
+			name:        "time after future (should fail)",
+			expression:  fmt.Sprintf(`request.time < timestamp("%s")`, past),
 			requestTime: now,
-			expected:   false,
+			expected:    false,
 		},
 	}
 
@@ -147,6 +226,104 @@ func TestEvaluateCondition_RequestTime(t *testing.T) {
 	}
 }
 
+func TestEvaluateCondition_RequestTimeBoundary(t *testing.T) {
+	boundary := "2026-06-01T12:00:00Z"
+	requestTime := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		op       string
+		expected bool
+	}{
+		{"<", false},
+		{"<=", true},
+		{">", false},
+		{">=", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			condition := &expr.Expr{
+				Expression: fmt.Sprintf(`request.time %s timestamp("%s")`, tt.op, boundary),
+			}
+
+			ctx := EvalContext{
+				ResourceName: "projects/test/secrets/api-key",
+				ResourceType: "SECRET",
+				RequestTime:  requestTime,
+			}
+
+			result, reason := evaluateCondition(condition, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v for request.time %s %s at the boundary, got %v (%s)", tt.expected, tt.op, boundary, result, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_RequestTimeWindow(t *testing.T) {
+	condition := &expr.Expr{
+		Expression: `request.time >= timestamp("2026-06-01T00:00:00Z") && request.time <= timestamp("2026-06-30T23:59:59Z")`,
+	}
+
+	tests := []struct {
+		name        string
+		requestTime time.Time
+		expected    bool
+	}{
+		{"window start", time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), true},
+		{"window end", time.Date(2026, 6, 30, 23, 59, 59, 0, time.UTC), true},
+		{"before window", time.Date(2026, 5, 31, 23, 59, 59, 0, time.UTC), false},
+		{"after window", time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := EvalContext{
+				ResourceName: "projects/test/secrets/api-key",
+				ResourceType: "SECRET",
+				RequestTime:  tt.requestTime,
+			}
+
+			if result, reason := evaluateCondition(condition, ctx); result != tt.expected {
+				t.Errorf("Expected %v at %s, got %v (%s)", tt.expected, tt.requestTime.Format(time.RFC3339), result, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_TimestampLayouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		expression  string
+		requestTime time.Time
+		expected    bool
+	}{
+		{"date-only before midnight", `request.time < timestamp("2026-12-31")`, time.Date(2026, 12, 30, 23, 59, 59, 0, time.UTC), true},
+		{"date-only is midnight UTC", `request.time < timestamp("2026-12-31")`, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), false},
+		{"date-only inclusive", `request.time >= timestamp('2026-12-31')`, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), true},
+		{"full timestamp", `request.time < timestamp("2026-12-31T12:00:00Z")`, time.Date(2026, 12, 31, 11, 59, 59, 0, time.UTC), true},
+		{"full timestamp with offset", `request.time < timestamp("2026-12-31T12:00:00+02:00")`, time.Date(2026, 12, 31, 10, 0, 0, 0, time.UTC), false},
+		{"timestamp without offset is UTC", `request.time < timestamp("2026-12-31T12:00:00")`, time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC), false},
+		{"date-only window", `request.time >= timestamp("2026-06-01") && request.time < timestamp("2026-07-01")`, time.Date(2026, 6, 30, 23, 0, 0, 0, time.UTC), true},
+		{"unparseable literal denies", `request.time < timestamp("12/31/2026")`, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := EvalContext{
+				ResourceName: "projects/test/secrets/api-key",
+				ResourceType: "SECRET",
+				RequestTime:  tt.requestTime,
+			}
+
+			result, reason := evaluateCondition(&expr.Expr{Expression: tt.expression}, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v for %s at %s, got %v (%s)", tt.expected, tt.expression, tt.requestTime.Format(time.RFC3339), result, reason)
+			}
+		})
+	}
+}
+
 func TestExtractResourceType(t *testing.T) {
 	tests := []struct {
 		resource string
@@ -156,6 +333,12 @@ func TestExtractResourceType(t *testing.T) {
 		{"projects/test/locations/global/keyRings/ring/cryptoKeys/key", "CRYPTO_KEY"},
 		{"projects/test/locations/global/keyRings/ring", "KEY_RING"},
 		{"projects/test", "UNKNOWN"},
+		{"projects/test/topics/orders", "TOPIC"},
+		{"projects/test/subscriptions/orders-worker", "SUBSCRIPTION"},
+		{"projects/test/serviceAccounts/ci@test.iam.gserviceaccount.com", "SERVICE_ACCOUNT"},
+		{"folders/123", "FOLDER"},
+		{"organizations/456", "ORGANIZATION"},
+		{"organizations/456/roles/auditor", "UNKNOWN"},
 	}
 
 	for _, tt := range tests {
@@ -167,3 +350,762 @@ func TestExtractResourceType(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractResourceService(t *testing.T) {
+	tests := []struct {
+		resource   string
+		permission string
+		expected   string
+	}{
+		{"projects/test/secrets/api-key", "secretmanager.versions.access", "secretmanager.googleapis.com"},
+		{"projects/test/locations/global/keyRings/ring/cryptoKeys/key", "cloudkms.cryptoKeys.encrypt", "cloudkms.googleapis.com"},
+		{"projects/test/locations/global/keyRings/ring", "cloudkms.keyRings.get", "cloudkms.googleapis.com"},
+		{"projects/test/topics/orders", "", "pubsub.googleapis.com"},
+		{"projects/test/serviceAccounts/ci@test.iam.gserviceaccount.com", "iam.serviceAccounts.actAs", "iam.googleapis.com"},
+		{"projects/test", "pubsub.topics.publish", "pubsub.googleapis.com"},
+		{"projects/test", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resource+"/"+tt.permission, func(t *testing.T) {
+			result := extractResourceService(tt.resource, tt.permission)
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s for resource %s", tt.expected, result, tt.resource)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_ResourceService(t *testing.T) {
+	tests := []struct {
+		expression string
+		service    string
+		expected   bool
+	}{
+		{`resource.service == "secretmanager.googleapis.com"`, "secretmanager.googleapis.com", true},
+		{`resource.service == "secretmanager.googleapis.com"`, "cloudkms.googleapis.com", false},
+		{`resource.service != "cloudkms.googleapis.com"`, "secretmanager.googleapis.com", true},
+		{`resource.service != "cloudkms.googleapis.com"`, "cloudkms.googleapis.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression+"/"+tt.service, func(t *testing.T) {
+			ctx := EvalContext{ResourceService: tt.service, RequestTime: time.Now()}
+			if result, reason := evaluateCondition(&expr.Expr{Expression: tt.expression}, ctx); result != tt.expected {
+				t.Errorf("Expected %v, got %v (%s)", tt.expected, result, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_BindingTimezone(t *testing.T) {
+	// 2026-06-01 is a Monday; 08:00 UTC is 17:00 Monday in Tokyo and
+	// 22:00 Sunday in Honolulu.
+	requestTime := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expression string
+		title      string
+		expected   bool
+	}{
+		{
+			name:       "bare getHours defaults to UTC",
+			expression: `request.time.getHours() < 12`,
+			expected:   true,
+		},
+		{
+			name:       "bare getHours uses binding timezone",
+			expression: `request.time.getHours() < 12`,
+			title:      "Morning only tz=Asia/Tokyo",
+			expected:   false,
+		},
+		{
+			name:       "expression zone overrides binding timezone",
+			expression: `request.time.getHours("UTC") < 12`,
+			title:      "Morning only tz=Asia/Tokyo",
+			expected:   true,
+		},
+		{
+			name:       "bare getDayOfWeek uses binding timezone",
+			expression: `request.time.getDayOfWeek() == 0`,
+			title:      "tz=America/Los_Angeles",
+			expected:   false,
+		},
+		{
+			name:       "getDayOfWeek crosses midnight in binding timezone",
+			expression: `request.time.getDayOfWeek() == 0`,
+			title:      "tz=Pacific/Honolulu",
+			expected:   true,
+		},
+		{
+			name:       "invalid binding timezone denies",
+			expression: `request.time.getHours() < 12`,
+			title:      "tz=Mars/Olympus_Mons",
+			expected:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &expr.Expr{
+				Expression: tt.expression,
+				Title:      tt.title,
+			}
+
+			ctx := EvalContext{
+				ResourceName: "projects/test/secrets/api-key",
+				ResourceType: "SECRET",
+				RequestTime:  requestTime,
+			}
+
+			result, reason := evaluateCondition(condition, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v for expression %s with title %q (%s)", tt.expected, result, tt.expression, tt.title, reason)
+			}
+		})
+	}
+
+	// An unknown binding timezone is unsupported, like a condition that does
+	// not compile, so strict mode fails the check rather than denying
+	_, _, err := evalCondition(&expr.Expr{Expression: `request.time.getHours() < 12`, Title: "tz=Not/AZone"}, EvalContext{RequestTime: requestTime})
+	if !errors.Is(err, ErrUnsupportedCondition) {
+		t.Errorf("Expected ErrUnsupportedCondition for an unknown binding timezone, got %v", err)
+	}
+}
+
+func TestEvaluateCondition_BooleanOperators(t *testing.T) {
+	requestTime := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expression string
+		resource   string
+		expected   bool
+	}{
+		{
+			name:       "AND of startsWith and request.time passes",
+			expression: `resource.name.startsWith("projects/p/secrets/prod-") && request.time < timestamp("2027-01-01T00:00:00Z")`,
+			resource:   "projects/p/secrets/prod-db",
+			expected:   true,
+		},
+		{
+			name:       "AND fails when time expired",
+			expression: `resource.name.startsWith("projects/p/secrets/prod-") && request.time < timestamp("2026-01-01T00:00:00Z")`,
+			resource:   "projects/p/secrets/prod-db",
+			expected:   false,
+		},
+		{
+			name:       "AND of all three attributes",
+			expression: `resource.name.startsWith("projects/p/") && resource.type == "SECRET" && request.time > timestamp("2026-01-01T00:00:00Z")`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   true,
+		},
+		{
+			name:       "OR matches second term",
+			expression: `resource.type == "CRYPTO_KEY" || resource.name.startsWith("projects/p/secrets/")`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   true,
+		},
+		{
+			name:       "OR with no matching terms",
+			expression: `resource.type == "CRYPTO_KEY" || resource.name.startsWith("projects/other/")`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   false,
+		},
+		{
+			name:       "AND binds tighter than OR",
+			expression: `resource.type == "CRYPTO_KEY" || resource.type == "SECRET" && request.time < timestamp("2026-01-01T00:00:00Z")`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   false,
+		},
+		{
+			name:       "parentheses override precedence",
+			expression: `(resource.type == "CRYPTO_KEY" || resource.type == "SECRET") && request.time > timestamp("2026-01-01T00:00:00Z")`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   true,
+		},
+		{
+			name:       "operators inside string literals are ignored",
+			expression: `resource.name.startsWith("projects/p/secrets/a&&b") || resource.type == "KEY_RING"`,
+			resource:   "projects/p/secrets/a&&b-key",
+			expected:   true,
+		},
+		{
+			name:       "whitespace around operators",
+			expression: "resource.type == \"SECRET\"&&\n\trequest.time < timestamp(\"2027-01-01T00:00:00Z\")",
+			resource:   "projects/p/secrets/api-key",
+			expected:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &expr.Expr{
+				Expression: tt.expression,
+			}
+
+			ctx := EvalContext{
+				ResourceName: tt.resource,
+				ResourceType: extractResourceType(tt.resource),
+				RequestTime:  requestTime,
+			}
+
+			result, reason := evaluateCondition(condition, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v for expression %s (%s)", tt.expected, result, tt.expression, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_Reasons(t *testing.T) {
+	ctx := EvalContext{
+		ResourceName: "projects/p/secrets/api-key",
+		ResourceType: "SECRET",
+		RequestTime:  time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		expression string
+		reason     string
+	}{
+		{
+			expression: `request.time < timestamp("2026-01-01T00:00:00Z")`,
+			reason:     "request.time 2026-06-01T12:00:00Z >= 2026-01-01T00:00:00Z",
+		},
+		{
+			expression: `request.time.getHours("UTC") >= 9`,
+			reason:     `request.time.getHours("UTC") is 12 (>= 9)`,
+		},
+		{
+			expression: `resource.type == "CRYPTO_KEY" || resource.name.startsWith("projects/p/")`,
+			reason:     "resource.name 'projects/p/secrets/api-key' starts with 'projects/p/'",
+		},
+		{
+			expression: `resource.type == "CRYPTO_KEY" || resource.name.startsWith("projects/other/")`,
+			reason:     "resource.type 'SECRET' does not match 'CRYPTO_KEY' || resource.name 'projects/p/secrets/api-key' does not start with 'projects/other/'",
+		},
+		{
+			expression: `resource.type == "SECRET" && resource.name.endsWith("-cert")`,
+			reason:     "resource.name 'projects/p/secrets/api-key' does not end with '-cert'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, reason := evaluateCondition(&expr.Expr{Expression: tt.expression}, ctx)
+			if reason != tt.reason {
+				t.Errorf("Expected reason %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_ShortCircuit(t *testing.T) {
+	ctx := EvalContext{
+		ResourceName: "projects/p/secrets/api-key",
+		ResourceType: "SECRET",
+		RequestTime:  time.Now(),
+	}
+
+	// The right side fails at runtime, but a false left side of && decides the
+	// result without surfacing the error.
+	condition := &expr.Expr{
+		Expression: `resource.type == "KEY_RING" && request.time < timestamp("not-a-time")`,
+	}
+
+	result, _, err := evalCondition(condition, ctx)
+	if err != nil {
+		t.Errorf("Expected short-circuit to absorb the runtime error, got %v", err)
+	}
+	if result {
+		t.Error("Expected false")
+	}
+}
+
+func TestEvaluateCondition_InvalidCEL(t *testing.T) {
+	tests := []string{
+		`resource.type == "KEY_RING" && request.auth.claims.email_verified == true`,
+		`resource.name.startsWith("projects/p/"`,
+		`resource.name`,
+	}
+
+	for _, expression := range tests {
+		t.Run(expression, func(t *testing.T) {
+			condition := &expr.Expr{Expression: expression}
+
+			result, reason, err := evalCondition(condition, EvalContext{ResourceName: "projects/p/secrets/a", RequestTime: time.Now()})
+			if result {
+				t.Error("Expected invalid CEL to deny")
+			}
+			if !errors.Is(err, ErrUnsupportedCondition) {
+				t.Errorf("Expected ErrUnsupportedCondition, got %v", err)
+			}
+			if !strings.HasPrefix(reason, "invalid CEL: ") {
+				t.Errorf("Expected reason to start with 'invalid CEL: ', got %q", reason)
+			}
+
+			if err := validateCondition(condition); !errors.Is(err, ErrUnsupportedCondition) {
+				t.Errorf("Expected validation to reject expression, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_Negation(t *testing.T) {
+	condition := &expr.Expr{
+		Expression: `!(resource.name.startsWith("projects/p/secrets/prod-") || resource.type != "SECRET")`,
+	}
+
+	ctx := EvalContext{
+		ResourceName: "projects/p/secrets/dev-db",
+		ResourceType: "SECRET",
+		RequestTime:  time.Now(),
+	}
+
+	if result, reason := evaluateCondition(condition, ctx); !result {
+		t.Errorf("Expected dev secret to pass negated condition (%s)", reason)
+	}
+
+	ctx.ResourceName = "projects/p/secrets/prod-db"
+	if result, reason := evaluateCondition(condition, ctx); result {
+		t.Errorf("Expected prod secret to fail negated condition (%s)", reason)
+	}
+}
+
+func TestCompileCondition_Cached(t *testing.T) {
+	expression := `resource.name.endsWith("/cache-test")`
+
+	first, err := compileCondition(expression)
+	if err != nil {
+		t.Fatalf("compileCondition failed: %v", err)
+	}
+
+	second, err := compileCondition(expression)
+	if err != nil {
+		t.Fatalf("compileCondition failed: %v", err)
+	}
+
+	if first != second {
+		t.Error("Expected repeated compiles to return the cached program")
+	}
+}
+
+func TestEvaluateCondition_In(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		resource   string
+		expected   bool
+		reason     string
+	}{
+		{
+			name:       "resource.name in list",
+			expression: `resource.name in ["projects/p/secrets/a", "projects/p/secrets/b"]`,
+			resource:   "projects/p/secrets/b",
+			expected:   true,
+			reason:     "resource.name 'projects/p/secrets/b' matched list element 'projects/p/secrets/b'",
+		},
+		{
+			name:       "resource.name absent from list",
+			expression: `resource.name in ["projects/p/secrets/a", "projects/p/secrets/b"]`,
+			resource:   "projects/p/secrets/c",
+			expected:   false,
+			reason:     "resource.name 'projects/p/secrets/c' not in [projects/p/secrets/a, projects/p/secrets/b]",
+		},
+		{
+			name:       "resource.type in list",
+			expression: `resource.type in ["SECRET", "CRYPTO_KEY"]`,
+			resource:   "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+			expected:   true,
+			reason:     "resource.type 'CRYPTO_KEY' matched list element 'CRYPTO_KEY'",
+		},
+		{
+			name:       "empty list",
+			expression: `resource.name in []`,
+			resource:   "projects/p/secrets/a",
+			expected:   false,
+			reason:     "resource.name 'projects/p/secrets/a' not in []",
+		},
+		{
+			name:       "combined with other terms",
+			expression: `resource.type == "SECRET" && resource.name in ["projects/p/secrets/a"]`,
+			resource:   "projects/p/secrets/a",
+			expected:   true,
+			reason:     "matches 'SECRET' && resource.name 'projects/p/secrets/a' matched list element",
+		},
+		{
+			name:       "unterminated list",
+			expression: `resource.name in ["projects/p/secrets/a"`,
+			resource:   "projects/p/secrets/a",
+			expected:   false,
+			reason:     "invalid CEL: ",
+		},
+		{
+			name:       "unquoted list element",
+			expression: `resource.name in [projects/p/secrets/a]`,
+			resource:   "projects/p/secrets/a",
+			expected:   false,
+			reason:     "invalid CEL: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &expr.Expr{
+				Expression: tt.expression,
+			}
+
+			ctx := EvalContext{
+				ResourceName: tt.resource,
+				ResourceType: extractResourceType(tt.resource),
+				RequestTime:  time.Now(),
+			}
+
+			result, reason := evaluateCondition(condition, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v for expression %s (%s)", tt.expected, result, tt.expression, reason)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("Expected reason to contain %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_NegationAndInequality(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		resource   string
+		expected   bool
+		reason     string
+	}{
+		{
+			name:       "negated startsWith passes",
+			expression: `!resource.name.startsWith("projects/p/secrets/internal-")`,
+			resource:   "projects/p/secrets/public-key",
+			expected:   true,
+			reason:     `negated: resource.name.startsWith("projects/p/secrets/internal-") evaluated to false`,
+		},
+		{
+			name:       "negated startsWith fails",
+			expression: `!resource.name.startsWith("projects/p/secrets/internal-")`,
+			resource:   "projects/p/secrets/internal-key",
+			expected:   false,
+			reason:     "negated: ",
+		},
+		{
+			name:       "negated parenthesized expression",
+			expression: `!(resource.type == "SECRET" && resource.name.endsWith("-key"))`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   false,
+			reason:     `negated: (resource.type == "SECRET" && resource.name.endsWith("-key")) evaluated to true`,
+		},
+		{
+			name:       "resource.type inequality",
+			expression: `resource.type != "SECRET"`,
+			resource:   "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+			expected:   true,
+		},
+		{
+			name:       "resource.type inequality fails on match",
+			expression: `resource.type != "SECRET"`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   false,
+		},
+		{
+			name:       "resource.name inequality",
+			expression: `resource.name != "projects/p/secrets/root"`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   true,
+		},
+		{
+			name:       "resource.name inequality fails on match",
+			expression: `resource.name != "projects/p/secrets/root"`,
+			resource:   "projects/p/secrets/root",
+			expected:   false,
+		},
+		{
+			name:       "resource.name equality",
+			expression: `resource.name == "projects/p/secrets/exact"`,
+			resource:   "projects/p/secrets/exact",
+			expected:   true,
+		},
+		{
+			name:       "resource.name equality is not a prefix match",
+			expression: `resource.name == "projects/p/secrets/exact"`,
+			resource:   "projects/p/secrets/exact-copy",
+			expected:   false,
+		},
+		{
+			name:       "double negation",
+			expression: `!!(resource.type == "SECRET")`,
+			resource:   "projects/p/secrets/api-key",
+			expected:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &expr.Expr{
+				Expression: tt.expression,
+			}
+
+			ctx := EvalContext{
+				ResourceName: tt.resource,
+				ResourceType: extractResourceType(tt.resource),
+				RequestTime:  time.Now(),
+			}
+
+			result, reason := evaluateCondition(condition, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v for expression %s (%s)", tt.expected, result, tt.expression, reason)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("Expected reason to contain %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_BusinessHours(t *testing.T) {
+	// Weekdays 09:00-17:00 UTC
+	businessHours := `request.time.getHours("UTC") >= 9 && request.time.getHours("UTC") < 17 && request.time.getDayOfWeek("UTC") >= 1 && request.time.getDayOfWeek("UTC") <= 5`
+
+	tests := []struct {
+		name        string
+		expression  string
+		requestTime time.Time
+		expected    bool
+	}{
+		// 2026-06-01 is a Monday
+		{"Monday opening hour", businessHours, time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC), true},
+		{"Monday before opening", businessHours, time.Date(2026, 6, 1, 8, 59, 59, 0, time.UTC), false},
+		{"Friday last hour", businessHours, time.Date(2026, 6, 5, 16, 59, 59, 0, time.UTC), true},
+		{"Friday closing hour", businessHours, time.Date(2026, 6, 5, 17, 0, 0, 0, time.UTC), false},
+		{"Saturday midday", businessHours, time.Date(2026, 6, 6, 12, 0, 0, 0, time.UTC), false},
+		{"Sunday is day 0", `request.time.getDayOfWeek("UTC") == 0`, time.Date(2026, 6, 7, 12, 0, 0, 0, time.UTC), true},
+		{"Saturday is day 6", `request.time.getDayOfWeek("UTC") == 6`, time.Date(2026, 6, 6, 12, 0, 0, 0, time.UTC), true},
+		{"timezone argument shifts hour", `request.time.getHours("America/New_York") == 8`, time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC), true},
+		{"timezone argument shifts day", `request.time.getDayOfWeek("Asia/Tokyo") == 2`, time.Date(2026, 6, 1, 20, 0, 0, 0, time.UTC), true},
+		{"no argument defaults to UTC", `request.time.getHours() == 23`, time.Date(2026, 6, 1, 23, 30, 0, 0, time.UTC), true},
+		{"invalid timezone denies", `request.time.getHours("Not/AZone") >= 0`, time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &expr.Expr{
+				Expression: tt.expression,
+			}
+
+			ctx := EvalContext{
+				ResourceName: "projects/test/secrets/api-key",
+				ResourceType: "SECRET",
+				RequestTime:  tt.requestTime,
+			}
+
+			result, reason := evaluateCondition(condition, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v at %s, got %v (%s)", tt.expected, tt.requestTime.Format(time.RFC3339), result, reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_CombinedAttributeMatrix(t *testing.T) {
+	const resource = "projects/p/secrets/api-key"
+	requestTime := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// One constraint per attribute, in a satisfied and an unsatisfied form
+	clauses := []struct {
+		attribute string
+		holds     string
+		fails     string
+	}{
+		{"name", `resource.name.startsWith("projects/p/secrets/")`, `resource.name.startsWith("projects/other/")`},
+		{"type", `resource.type == "SECRET"`, `resource.type == "CRYPTO_KEY"`},
+		{"time", `request.time < timestamp("2027-01-01T00:00:00Z")`, `request.time < timestamp("2026-01-01T00:00:00Z")`},
+	}
+
+	s := NewStorage()
+	s.SetClock(func() time.Time { return requestTime })
+
+	for i := range clauses {
+		for j := i + 1; j < len(clauses); j++ {
+			for _, first := range []bool{true, false} {
+				for _, second := range []bool{true, false} {
+					a, b := clauses[i], clauses[j]
+					left, right := a.fails, b.fails
+					if first {
+						left = a.holds
+					}
+					if second {
+						right = b.holds
+					}
+					expression := left + " && " + right
+					expected := first && second
+
+					name := fmt.Sprintf("%s=%t/%s=%t", a.attribute, first, b.attribute, second)
+					t.Run(name, func(t *testing.T) {
+						ctx := EvalContext{
+							ResourceName: resource,
+							ResourceType: extractResourceType(resource),
+							RequestTime:  requestTime,
+						}
+
+						result, reason := evaluateCondition(&expr.Expr{Expression: expression}, ctx)
+						if result != expected {
+							t.Errorf("Expected %v for %s, got %v (%s)", expected, expression, result, reason)
+						}
+
+						// The same expression bound in a policy must give the same verdict
+						_, err := s.SetIamPolicy(resource, &iampb.Policy{
+							Version: 3,
+							Bindings: []*iampb.Binding{
+								{
+									Role:      "roles/secretmanager.secretAccessor",
+									Members:   []string{"user:alice@example.com"},
+									Condition: &expr.Expr{Expression: expression},
+								},
+							},
+						})
+						if err != nil {
+							t.Fatalf("SetIamPolicy failed: %v", err)
+						}
+
+						allowed, err := s.TestIamPermissions(resource, "user:alice@example.com", []string{"secretmanager.versions.access"}, false)
+						if err != nil {
+							t.Fatalf("TestIamPermissions failed: %v", err)
+						}
+						if granted := len(allowed) == 1; granted != expected {
+							t.Errorf("Expected binding with %s to grant %v, got %v", expression, expected, granted)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestEvaluateCondition_ResourceLabels(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "payments"}
+
+	tests := []struct {
+		name       string
+		expression string
+		labels     map[string]string
+		expected   bool
+	}{
+		{"matching label", `resource.labels["env"] == "prod"`, labels, true},
+		{"different value", `resource.labels["env"] == "staging"`, labels, false},
+		{"select syntax", `resource.labels.team == "payments"`, labels, true},
+		{"missing key is empty", `resource.labels["owner"] == ""`, labels, true},
+		{"missing key does not match", `resource.labels["owner"] == "alice"`, labels, false},
+		{"no labels at all", `resource.labels["env"] == "prod"`, nil, false},
+		{"no labels reads empty", `resource.labels["env"] != "prod"`, nil, true},
+		{"combined with name", `resource.labels["env"] == "prod" && resource.name.startsWith("projects/test/")`, labels, true},
+		{"presence test sees real keys only", `has(resource.labels.owner)`, labels, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := EvalContext{
+				ResourceName: "projects/test/secrets/api-key",
+				ResourceType: "SECRET",
+				RequestTime:  time.Now(),
+				Labels:       tt.labels,
+			}
+
+			result, reason := evaluateCondition(&expr.Expr{Expression: tt.expression}, ctx)
+			if result != tt.expected {
+				t.Errorf("Expected %v for %s, got %v (%s)", tt.expected, tt.expression, result, reason)
+			}
+		})
+	}
+}
+
+func TestResourceLabels_Condition(t *testing.T) {
+	s := NewStorage()
+	s.SetResourceLabels("projects/test/secrets/prod-db", map[string]string{"env": "prod"})
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:      "roles/secretmanager.secretAccessor",
+				Members:   []string{"user:alice@example.com"},
+				Condition: &expr.Expr{Expression: `resource.labels["env"] == "prod"`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	check := func(resource string) []string {
+		allowed, err := s.TestIamPermissions(resource, "user:alice@example.com", []string{"secretmanager.versions.access"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		return allowed
+	}
+
+	if allowed := check("projects/test/secrets/prod-db"); len(allowed) != 1 {
+		t.Errorf("Expected the labeled secret to match, got %v", allowed)
+	}
+	if allowed := check("projects/test/secrets/unlabeled"); len(allowed) != 0 {
+		t.Errorf("Expected an unlabeled secret not to match, got %v", allowed)
+	}
+
+	s.SetResourceLabels("projects/test/secrets/prod-db", nil)
+	if allowed := check("projects/test/secrets/prod-db"); len(allowed) != 0 {
+		t.Errorf("Expected removing the labels to revoke access, got %v", allowed)
+	}
+}
+
+func TestResourceNameEquality_Condition(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:      "roles/secretmanager.secretAccessor",
+				Members:   []string{"user:alice@example.com"},
+				Condition: &expr.Expr{Expression: `resource.name == "projects/test/secrets/exact"`},
+			},
+			{
+				Role:      "roles/viewer",
+				Members:   []string{"user:alice@example.com"},
+				Condition: &expr.Expr{Expression: `resource.name != "projects/test/secrets/exact"`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		resource string
+		expected []string
+	}{
+		{"projects/test/secrets/exact", []string{"secretmanager.versions.access"}},
+		{"projects/test/secrets/exact-copy", []string{"secretmanager.secrets.get"}},
+		{"projects/test/secrets/other", []string{"secretmanager.secrets.get"}},
+	}
+
+	for _, tt := range tests {
+		// The indexed and the full evaluation path must agree
+		for _, trace := range []bool{false, true} {
+			allowed, err := s.TestIamPermissions(tt.resource, "user:alice@example.com", []string{"secretmanager.versions.access", "secretmanager.secrets.get"}, trace)
+			if err != nil {
+				t.Fatalf("TestIamPermissions failed: %v", err)
+			}
+			if !reflect.DeepEqual(allowed, tt.expected) {
+				t.Errorf("Expected %v on %s (trace=%t), got %v", tt.expected, tt.resource, trace, allowed)
+			}
+		}
+	}
+}
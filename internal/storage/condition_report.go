@@ -0,0 +1,76 @@
+package storage
+
+// ConditionResult is the outcome of one conditional binding's condition,
+// independent of any principal.
+type ConditionResult struct {
+	// Resource is where the binding's policy is attached: the requested
+	// resource or one of its ancestors.
+	Resource   string   `json:"resource"`
+	Role       string   `json:"role"`
+	Members    []string `json:"members"`
+	Title      string   `json:"title,omitempty"`
+	Expression string   `json:"expression"`
+	Result     bool     `json:"result"`
+	Reason     string   `json:"reason"`
+}
+
+// EvaluateConditions evaluates every conditional binding in the policies that
+// govern resource, the same policies TestIamPermissions consults. Non-zero
+// fields of override replace the context derived from the resource and the
+// clock. Conditions the evaluator cannot interpret are reported as failing,
+// with the compile error as the reason.
+func (s *Storage) EvaluateConditions(resource string, override EvalContext) []ConditionResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resource = normalizeResource(resource)
+
+	evalCtx := EvalContext{
+		ResourceName:    resource,
+		ResourceType:    extractResourceType(resource),
+		ResourceService: extractResourceService(resource, ""),
+		RequestTime:     s.now(),
+		Labels:          s.resourceLabels[resource],
+	}
+	if override.ResourceName != "" {
+		evalCtx.ResourceName = override.ResourceName
+	}
+	if override.ResourceType != "" {
+		evalCtx.ResourceType = override.ResourceType
+	}
+	if override.ResourceService != "" {
+		evalCtx.ResourceService = override.ResourceService
+	}
+	if override.Labels != nil {
+		evalCtx.Labels = override.Labels
+	}
+	if !override.RequestTime.IsZero() {
+		evalCtx.RequestTime = override.RequestTime
+	}
+	if override.Timezone != nil {
+		evalCtx.Timezone = override.Timezone
+	}
+
+	results := []ConditionResult{}
+
+	for _, attached := range s.applicablePolicies(resource) {
+		for _, binding := range attached.policy.Bindings {
+			if binding.Condition == nil {
+				continue
+			}
+
+			result, reason, _ := evalCondition(binding.Condition, evalCtx)
+			results = append(results, ConditionResult{
+				Resource:   attached.resource,
+				Role:       binding.Role,
+				Members:    binding.Members,
+				Title:      binding.Condition.Title,
+				Expression: binding.Condition.Expression,
+				Result:     result,
+				Reason:     reason,
+			})
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+)
+
+func TestEvaluateConditions(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/viewer",
+				Members: []string{"user:alice@example.com"},
+			},
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+				Condition: &expr.Expr{
+					Title:      "Before cutover",
+					Expression: `request.time < timestamp("2026-07-01T00:00:00Z")`,
+				},
+			},
+			{
+				Role:    "roles/secretmanager.admin",
+				Members: []string{"user:ops@example.com"},
+				Condition: &expr.Expr{
+					Expression: `resource.name.startsWith("projects/test/secrets/prod-")`,
+				},
+			},
+		},
+	}
+	if _, err := s.SetIamPolicy("projects/test", policy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	results := s.EvaluateConditions("projects/test/secrets/dev-db", EvalContext{
+		RequestTime: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	if len(results) != 2 {
+		t.Fatalf("Expected one result per conditional binding, got %d", len(results))
+	}
+
+	if !results[0].Result || results[0].Role != "roles/secretmanager.secretAccessor" || results[0].Title != "Before cutover" {
+		t.Errorf("Expected time-bound binding to pass, got %+v", results[0])
+	}
+
+	if results[1].Result || results[1].Role != "roles/secretmanager.admin" {
+		t.Errorf("Expected prod-only binding to fail, got %+v", results[1])
+	}
+	if !strings.Contains(results[1].Reason, "does not start with 'projects/test/secrets/prod-'") {
+		t.Errorf("Expected a reason for the failing condition, got %q", results[1].Reason)
+	}
+
+	results = s.EvaluateConditions("projects/test/secrets/dev-db", EvalContext{
+		RequestTime: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if results[0].Result {
+		t.Errorf("Expected overridden request time to fail the time-bound binding, got %+v", results[0])
+	}
+}
+
+func TestEvaluateConditions_NoPolicy(t *testing.T) {
+	s := NewStorage()
+
+	if results := s.EvaluateConditions("projects/missing", EvalContext{}); results == nil || len(results) != 0 {
+		t.Errorf("Expected empty results, got %v", results)
+	}
+}
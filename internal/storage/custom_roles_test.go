@@ -268,3 +268,133 @@ func TestCustomRoles_MultiplePermissions(t *testing.T) {
 		t.Errorf("Expected 3 permissions allowed, got %d", len(allowed))
 	}
 }
+
+func TestCustomRoles_ProjectScoped(t *testing.T) {
+	s := NewStorage()
+
+	s.LoadCustomRoles(map[string][]string{
+		"projects/alpha/roles/deployer": {"secretmanager.secrets.get"},
+		"projects/beta/roles/deployer":  {"secretmanager.secrets.delete"},
+	})
+
+	for _, project := range []string{"alpha", "beta"} {
+		_, err := s.SetIamPolicy("projects/"+project, &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "projects/" + project + "/roles/deployer", Members: []string{"user:alice@example.com"}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("SetIamPolicy failed: %v", err)
+		}
+	}
+
+	permissions := []string{"secretmanager.secrets.get", "secretmanager.secrets.delete"}
+	want := map[string]string{
+		"projects/alpha": "secretmanager.secrets.get",
+		"projects/beta":  "secretmanager.secrets.delete",
+	}
+	for resource, permission := range want {
+		allowed, err := s.TestIamPermissions(resource, "user:alice@example.com", permissions, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		if len(allowed) != 1 || allowed[0] != permission {
+			t.Errorf("Expected %s's deployer role to grant only %s, got %v", resource, permission, allowed)
+		}
+	}
+}
+
+func TestCustomRoles_DisabledStage(t *testing.T) {
+	s := NewStorage()
+
+	if _, err := s.CreateRole(&Role{
+		Name:                "projects/test/roles/deployer",
+		IncludedPermissions: []string{"secretmanager.secrets.get"},
+		Stage:               "BETA",
+	}); err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "projects/test/roles/deployer", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	check := func(stage string) []string {
+		if _, err := s.UpdateRole("projects/test/roles/deployer", &Role{Stage: stage}, []string{RoleFieldStage}); err != nil {
+			t.Fatalf("UpdateRole failed: %v", err)
+		}
+		allowed, err := s.TestIamPermissions("projects/test", "user:alice@example.com", []string{"secretmanager.secrets.get"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		return allowed
+	}
+
+	for _, stage := range []string{"ALPHA", "BETA", "GA"} {
+		if allowed := check(stage); len(allowed) != 1 {
+			t.Errorf("Expected a %s role to grant its permissions, got %v", stage, allowed)
+		}
+	}
+
+	if allowed := check(StageDisabled); len(allowed) != 0 {
+		t.Errorf("Expected a DISABLED role to grant nothing, got %v", allowed)
+	}
+
+	// The full evaluation path (used when tracing) must agree with the index
+	allowed, err := s.TestIamPermissions("projects/test", "user:alice@example.com", []string{"secretmanager.secrets.get"}, true)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected a DISABLED role to grant nothing when tracing, got %v", allowed)
+	}
+
+	role, err := s.GetRole("projects/test/roles/deployer")
+	if err != nil {
+		t.Fatalf("GetRole failed: %v", err)
+	}
+	if len(role.IncludedPermissions) != 1 {
+		t.Errorf("Expected disabling to keep the role's permissions, got %v", role.IncludedPermissions)
+	}
+
+	if allowed := check("GA"); len(allowed) != 1 {
+		t.Errorf("Expected re-enabling the role to restore access, got %v", allowed)
+	}
+}
+
+func TestWildcardRole_Granularity(t *testing.T) {
+	s := NewStorage()
+	s.SetAllowUnknownRoles(true)
+
+	tests := []struct {
+		role       string
+		permission string
+		granted    bool
+	}{
+		{"roles/secretmanager.secretViewer", "secretmanager.secrets.get", true},
+		{"roles/secretmanager.secretViewer", "secretmanager.secrets.list", true},
+		{"roles/secretmanager.secretViewer", "secretmanager.secrets.delete", false},
+		{"roles/secretmanager.anything", "secretmanager.secrets.delete", false},
+		{"roles/secretmanager.secretAdmin", "secretmanager.secrets.delete", true},
+		{"roles/secretmanager.secretEditor", "secretmanager.secrets.delete", true},
+		{"roles/secretmanager.secretEditor", "secretmanager.secrets.setIamPolicy", false},
+		{"roles/cloudkms.encryptOnly", "cloudkms.cryptoKeyVersions.useToEncrypt", false},
+		{"roles/cloudkms.encryptOnly", "cloudkms.cryptoKeys.encrypt", true},
+		{"roles/cloudkms.encryptOnly", "cloudkms.cryptoKeys.decrypt", false},
+		{"roles/secretmanagerx.admin", "secretmanager.secrets.delete", false},
+		{"roles/custom.secretmanager", "secretmanager.secrets.get", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+"/"+tt.permission, func(t *testing.T) {
+			if granted := s.roleGrants(tt.role, tt.permission); granted != tt.granted {
+				t.Errorf("Expected %s granting %s to be %v, got %v", tt.role, tt.permission, tt.granted, granted)
+			}
+		})
+	}
+}
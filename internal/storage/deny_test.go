@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+)
+
+func TestDenyRule_OverridesAllow(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 1,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	s.SetDenyPolicy("projects/test", []DenyRule{
+		{
+			DeniedPrincipals:  []string{"user:alice@example.com"},
+			DeniedPermissions: []string{"secretmanager.secrets.delete"},
+		},
+	})
+
+	allowed, err := s.TestIamPermissions(
+		"projects/test/secrets/db-password",
+		"user:alice@example.com",
+		[]string{"secretmanager.secrets.get", "secretmanager.secrets.delete"},
+		false,
+	)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	if len(allowed) != 1 || allowed[0] != "secretmanager.secrets.get" {
+		t.Errorf("Expected only secretmanager.secrets.get to be allowed, got %v", allowed)
+	}
+}
+
+func TestDenyRule_ExceptionPrincipal(t *testing.T) {
+	s := NewStorage()
+	s.LoadGroups(map[string][]string{
+		"engineering": {"user:alice@example.com", "user:bob@example.com"},
+	})
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"group:engineering"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	s.SetDenyPolicy("projects/test", []DenyRule{
+		{
+			DeniedPrincipals:    []string{"group:engineering"},
+			DeniedPermissions:   []string{"secretmanager.secrets.delete"},
+			ExceptionPrincipals: []string{"user:bob@example.com"},
+		},
+	})
+
+	tests := []struct {
+		principal string
+		allowed   bool
+	}{
+		{"user:alice@example.com", false},
+		{"user:bob@example.com", true},
+	}
+
+	for _, tt := range tests {
+		allowed, err := s.TestIamPermissions("projects/test/secrets/db", tt.principal, []string{"secretmanager.secrets.delete"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		if (len(allowed) == 1) != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tt.principal, tt.allowed, allowed)
+		}
+	}
+}
+
+func TestDenyRule_DenialCondition(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	s.SetDenyPolicy("projects/test", []DenyRule{
+		{
+			DeniedPrincipals:  []string{"user:alice@example.com"},
+			DeniedPermissions: []string{"secretmanager.versions.access"},
+			DenialCondition:   &expr.Expr{Expression: `resource.name.startsWith("projects/test/secrets/prod-")`},
+		},
+	})
+
+	tests := []struct {
+		resource string
+		allowed  bool
+	}{
+		{"projects/test/secrets/prod-db", false},
+		{"projects/test/secrets/dev-db", true},
+	}
+
+	for _, tt := range tests {
+		allowed, err := s.TestIamPermissions(tt.resource, "user:alice@example.com", []string{"secretmanager.versions.access"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		if (len(allowed) == 1) != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tt.resource, tt.allowed, allowed)
+		}
+	}
+}
+
+func TestListDenyPolicies(t *testing.T) {
+	s := NewStorage()
+	s.SetDenyPolicy("projects/a", []DenyRule{{DeniedPrincipals: []string{"allUsers"}, DeniedPermissions: []string{"iam.roles.delete"}}})
+	s.SetDenyPolicy("//secretmanager.googleapis.com/projects/a/secrets/s", []DenyRule{{DeniedPrincipals: []string{"allUsers"}, DeniedPermissions: []string{"secretmanager.secrets.delete"}}})
+	s.SetDenyPolicy("projects/b", nil)
+
+	policies := s.ListDenyPolicies()
+	if len(policies) != 2 {
+		t.Fatalf("Expected 2 resources with deny rules, got %v", policies)
+	}
+	if _, ok := policies["projects/a/secrets/s"]; !ok {
+		t.Errorf("Expected deny rules keyed by normalized resource, got %v", policies)
+	}
+}
+
+func TestDenyRule_DenialReasonInExplainOutput(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 1,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	s.SetDenyPolicy("projects/test", []DenyRule{
+		{
+			DeniedPrincipals:  []string{"user:alice@example.com"},
+			DeniedPermissions: []string{"secretmanager.versions.destroy"},
+			DenialReason:      "Secret destruction requires break-glass approval",
+		},
+	})
+
+	allowed, err := s.TestIamPermissions(
+		"projects/test/secrets/db-password",
+		"user:alice@example.com",
+		[]string{"secretmanager.versions.destroy"},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	if len(allowed) != 0 {
+		t.Errorf("Expected permission to be denied, got %v", allowed)
+	}
+
+	if !strings.Contains(buf.String(), "Secret destruction requires break-glass approval") {
+		t.Errorf("Expected explain output to include denial reason, got %s", buf.String())
+	}
+}
+
+func TestDenyOnlyResource(t *testing.T) {
+	s := NewStorage()
+	s.SetDenyPolicy("projects/test/secrets/db-password", []DenyRule{
+		{
+			DeniedPrincipals:  []string{"user:intern@example.com"},
+			DeniedPermissions: []string{"secretmanager.versions.access"},
+			DenialReason:      "interns cannot read production secrets",
+		},
+	})
+
+	policy, err := s.GetIamPolicy("projects/test/secrets/db-password")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if policy.Bindings == nil || len(policy.Bindings) != 0 {
+		t.Errorf("Expected empty (non-nil) allow bindings, got %v", policy.Bindings)
+	}
+	if policy.Version != 1 || len(policy.Etag) == 0 {
+		t.Errorf("Expected a well-formed version 1 policy with an etag, got version=%d etag=%q", policy.Version, policy.Etag)
+	}
+
+	rules := s.GetDenyPolicy("projects/test/secrets/db-password")
+	if len(rules) != 1 || rules[0].DenialReason != "interns cannot read production secrets" {
+		t.Errorf("Expected the deny rule back, got %+v", rules)
+	}
+
+	if rules := s.GetDenyPolicy("projects/test/secrets/other"); rules == nil || len(rules) != 0 {
+		t.Errorf("Expected empty deny rules for a resource without any, got %v", rules)
+	}
+}
+
+func TestExplainOutput_GrantingLevel(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions(
+		"projects/test/secrets/db-password",
+		"user:alice@example.com",
+		[]string{"secretmanager.versions.access"},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Fatalf("Expected inherited grant, got %v", allowed)
+	}
+
+	if !strings.Contains(buf.String(), "granted_by=projects/test\n") {
+		t.Errorf("Expected explain output to name the project as the granting level, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	_, err = s.SetIamPolicy("projects/test/secrets/db-password", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	if _, err := s.TestIamPermissions("projects/test/secrets/db-password", "user:alice@example.com", []string{"secretmanager.versions.access"}, true); err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "granted_by=projects/test/secrets/db-password") {
+		t.Errorf("Expected explain output to name the secret as the granting level, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"strings"
+
+	expr "google.golang.org/genproto/googleapis/type/expr"
+)
+
+// BindingExplanation describes how one binding was considered for a
+// permission check.
+type BindingExplanation struct {
+	// Resource is where the binding's policy is attached: the requested
+	// resource or one of its ancestors.
+	Resource string   `json:"resource"`
+	Role     string   `json:"role"`
+	Members  []string `json:"members"`
+	// GrantsPermission reports whether the role includes the permission.
+	GrantsPermission bool `json:"grantsPermission"`
+	// MatchedMember is the first member matching the principal, if any.
+	MatchedMember string `json:"matchedMember,omitempty"`
+	// GroupChain lists the groups traversed when MatchedMember is a group:
+	// member, outermost first, ending with the group that directly contains
+	// the principal.
+	GroupChain      []string `json:"groupChain,omitempty"`
+	Condition       string   `json:"condition,omitempty"`
+	ConditionResult *bool    `json:"conditionResult,omitempty"`
+	ConditionReason string   `json:"conditionReason,omitempty"`
+	// Granted reports whether this binding grants the permission to the
+	// principal.
+	Granted bool `json:"granted"`
+}
+
+// PermissionExplanation is the structured form of a single TestIamPermissions
+// decision.
+type PermissionExplanation struct {
+	Resource   string `json:"resource"`
+	Principal  string `json:"principal"`
+	Permission string `json:"permission"`
+	// PolicyResource is the nearest resource with an allow policy, empty when
+	// no policy governs the resource.
+	PolicyResource string               `json:"policyResource,omitempty"`
+	Bindings       []BindingExplanation `json:"bindings"`
+	// GrantingRoles are the roles of every binding that granted the
+	// permission, before deny rules apply.
+	GrantingRoles []string `json:"grantingRoles"`
+	Denied        bool     `json:"denied"`
+	DenyReason    string   `json:"denyReason,omitempty"`
+	Granted       bool     `json:"granted"`
+	Reason        string   `json:"reason"`
+}
+
+// ExplainPermission evaluates permission for principal on resource the same
+// way TestIamPermissions does, and reports every binding it considered along
+// with why each did or did not grant the permission. Errors are those
+// TestIamPermissions would return, e.g. a *ConditionError in strict mode.
+func (s *Storage) ExplainPermission(resource, principal, permission string) (*PermissionExplanation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resource = normalizeResource(resource)
+
+	explanation := &PermissionExplanation{
+		Resource:      resource,
+		Principal:     principal,
+		Permission:    permission,
+		Bindings:      []BindingExplanation{},
+		GrantingRoles: []string{},
+	}
+
+	policies := s.applicablePolicies(resource)
+	if len(policies) == 0 {
+		explanation.Reason = "no policy found"
+		return explanation, nil
+	}
+	explanation.PolicyResource = policies[0].resource
+
+	evalCtx := EvalContext{
+		ResourceName:    resource,
+		ResourceType:    extractResourceType(resource),
+		ResourceService: extractResourceService(resource, permission),
+		RequestTime:     s.now(),
+		Labels:          s.resourceLabels[resource],
+	}
+
+	for i, attached := range policies {
+		for _, binding := range attached.policy.Bindings {
+			considered, err := s.explainBinding(attached.resource, binding.Role, binding.Members, binding.Condition, principal, permission, evalCtx)
+			if err != nil {
+				return nil, err
+			}
+			explanation.Bindings = append(explanation.Bindings, considered)
+			if considered.Granted {
+				explanation.GrantingRoles = append(explanation.GrantingRoles, binding.Role)
+			}
+		}
+
+		if explanation.Granted {
+			continue
+		}
+		granted, reason, err := s.hasPermission(attached.policy, principal, permission, evalCtx, false)
+		if err != nil {
+			return nil, err
+		}
+		if granted || i == 0 {
+			explanation.Granted, explanation.Reason = granted, reason
+		}
+	}
+
+	if explanation.Granted {
+		denied, denyReason, err := s.checkDenyRules(resource, principal, permission, evalCtx)
+		if err != nil {
+			return nil, err
+		}
+		if denied {
+			explanation.Granted = false
+			explanation.Denied = true
+			explanation.DenyReason = denyReason
+			explanation.Reason = denyReason
+		}
+	}
+
+	return explanation, nil
+}
+
+// explainBinding reports how a single binding applies to the check. Like
+// hasPermission, a binding with no principal to check grants on its role
+// alone.
+func (s *Storage) explainBinding(resource, role string, members []string, condition *expr.Expr, principal, permission string, evalCtx EvalContext) (BindingExplanation, error) {
+	explained := BindingExplanation{
+		Resource: resource,
+		Role:     role,
+		Members:  members,
+	}
+	if condition != nil {
+		explained.Condition = condition.Expression
+	}
+
+	if !s.roleGrants(role, permission) {
+		return explained, nil
+	}
+	explained.GrantsPermission = true
+
+	if principal == "" {
+		explained.Granted = true
+		return explained, nil
+	}
+
+	for _, member := range members {
+		if !s.principalMatches(principal, member) {
+			continue
+		}
+		explained.MatchedMember = member
+		if groupName, ok := strings.CutPrefix(member, "group:"); ok {
+			explained.GroupChain = s.groupChain(groupName, principal, make(map[string]bool))
+		}
+		break
+	}
+	if explained.MatchedMember == "" {
+		return explained, nil
+	}
+
+	if condition == nil {
+		explained.Granted = true
+		return explained, nil
+	}
+
+	result, reason, err := s.evaluateBindingCondition(condition, evalCtx)
+	if err != nil {
+		return explained, err
+	}
+	explained.ConditionResult = &result
+	explained.ConditionReason = reason
+	explained.Granted = result
+	return explained, nil
+}
+
+// groupChain returns the path of groups from groupName down to the group that
+// directly lists principal, or nil when principal is not a member. visited
+// guards against cyclic memberships as in groupContains.
+func (s *Storage) groupChain(groupName, principal string, visited map[string]bool) []string {
+	if visited[groupName] {
+		return nil
+	}
+	visited[groupName] = true
+
+	for _, groupMember := range s.groupMembers(groupName) {
+		if sameMember(groupMember, principal) {
+			return []string{groupName}
+		}
+		if nestedGroupName, ok := strings.CutPrefix(groupMember, "group:"); ok {
+			if chain := s.groupChain(nestedGroupName, principal, visited); chain != nil {
+				return append([]string{groupName}, chain...)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+)
+
+func TestExplainPermission_GroupMatch(t *testing.T) {
+	s := NewStorage()
+	s.LoadGroups(map[string][]string{
+		"engineering": {"group:platform"},
+		"platform":    {"user:dana@example.com"},
+	})
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"group:engineering"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	explanation, err := s.ExplainPermission("projects/test/secrets/db", "user:dana@example.com", "secretmanager.versions.access")
+	if err != nil {
+		t.Fatalf("ExplainPermission failed: %v", err)
+	}
+
+	if !explanation.Granted {
+		t.Fatalf("Expected permission to be granted, got %+v", explanation)
+	}
+	if explanation.PolicyResource != "projects/test" {
+		t.Errorf("Expected policy resource projects/test, got %q", explanation.PolicyResource)
+	}
+	if len(explanation.Bindings) != 2 {
+		t.Fatalf("Expected both bindings to be considered, got %+v", explanation.Bindings)
+	}
+	if !reflect.DeepEqual(explanation.GrantingRoles, []string{"roles/secretmanager.secretAccessor"}) {
+		t.Errorf("Expected secretAccessor to grant, got %v", explanation.GrantingRoles)
+	}
+
+	viewer := explanation.Bindings[0]
+	if viewer.Granted || viewer.MatchedMember != "" {
+		t.Errorf("Expected viewer binding not to match, got %+v", viewer)
+	}
+
+	accessor := explanation.Bindings[1]
+	if accessor.MatchedMember != "group:engineering" {
+		t.Errorf("Expected match via group:engineering, got %q", accessor.MatchedMember)
+	}
+	if !reflect.DeepEqual(accessor.GroupChain, []string{"engineering", "platform"}) {
+		t.Errorf("Expected group chain [engineering platform], got %v", accessor.GroupChain)
+	}
+}
+
+func TestExplainPermission_FailingCondition(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"user:alice@example.com"},
+				Condition: &expr.Expr{
+					Expression: `resource.name.startsWith("projects/test/secrets/prod-")`,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	explanation, err := s.ExplainPermission("projects/test/secrets/dev-db", "user:alice@example.com", "secretmanager.versions.access")
+	if err != nil {
+		t.Fatalf("ExplainPermission failed: %v", err)
+	}
+
+	if explanation.Granted {
+		t.Fatalf("Expected permission to be denied, got %+v", explanation)
+	}
+	if len(explanation.GrantingRoles) != 0 {
+		t.Errorf("Expected no granting roles, got %v", explanation.GrantingRoles)
+	}
+
+	binding := explanation.Bindings[0]
+	if binding.MatchedMember != "user:alice@example.com" {
+		t.Errorf("Expected principal to match, got %+v", binding)
+	}
+	if binding.ConditionResult == nil || *binding.ConditionResult {
+		t.Errorf("Expected condition to fail, got %+v", binding)
+	}
+	if !strings.Contains(binding.ConditionReason, "does not start with 'projects/test/secrets/prod-'") {
+		t.Errorf("Expected a reason for the failing condition, got %q", binding.ConditionReason)
+	}
+	if !strings.Contains(explanation.Reason, "condition failed") {
+		t.Errorf("Expected decision reason to cite the condition, got %q", explanation.Reason)
+	}
+}
+
+func TestExplainPermission_NoPolicy(t *testing.T) {
+	s := NewStorage()
+
+	explanation, err := s.ExplainPermission("projects/missing", "user:alice@example.com", "resourcemanager.projects.get")
+	if err != nil {
+		t.Fatalf("ExplainPermission failed: %v", err)
+	}
+	if explanation.Granted || explanation.PolicyResource != "" || explanation.Reason != "no policy found" {
+		t.Errorf("Expected an ungranted explanation without a policy, got %+v", explanation)
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"reflect"
 	"testing"
 
 	iampb "google.golang.org/genproto/googleapis/iam/v1"
@@ -128,6 +129,52 @@ func TestGroups_NestedGroups(t *testing.T) {
 	}
 }
 
+func TestGroups_ThreeLevelNesting(t *testing.T) {
+	s := NewStorage()
+
+	s.LoadGroups(map[string][]string{
+		"engineering": {"group:platform"},
+		"platform":    {"group:sre"},
+		"sre":         {"user:dana@example.com"},
+	})
+
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"group:engineering"}},
+		},
+	}
+	if _, err := s.SetIamPolicy("projects/test", policy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test", "user:dana@example.com", []string{"secretmanager.secrets.get"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected permission allowed (dana in sre, in platform, in engineering), got %d", len(allowed))
+	}
+}
+
+func TestGroups_CycleTerminates(t *testing.T) {
+	s := NewStorage()
+
+	s.LoadGroups(map[string][]string{
+		"a": {"group:b", "user:alice@example.com"},
+		"b": {"group:a", "user:bob@example.com"},
+	})
+
+	if !s.principalMatches("user:bob@example.com", "group:a") {
+		t.Error("Expected bob to be a member of a through b")
+	}
+	if !s.principalMatches("user:alice@example.com", "group:b") {
+		t.Error("Expected alice to be a member of b through a")
+	}
+	if s.principalMatches("user:charlie@example.com", "group:a") {
+		t.Error("Expected charlie not to be a member of the a/b cycle")
+	}
+}
+
 func TestGroups_MultipleGroups(t *testing.T) {
 	s := NewStorage()
 
@@ -189,3 +236,28 @@ func TestGroups_MultipleGroups(t *testing.T) {
 		t.Errorf("Expected permission allowed for bob, got %d", len(allowedBob))
 	}
 }
+
+func TestResolvePrincipalGroups(t *testing.T) {
+	s := NewStorage()
+
+	s.LoadGroups(map[string][]string{
+		"engineering": {"group:platform", "user:erin@example.com"},
+		"platform":    {"group:sre"},
+		"sre":         {"user:dana@example.com", "group:engineering"},
+		"finance":     {"user:frank@example.com"},
+	})
+
+	direct := s.ResolvePrincipalGroups("user:frank@example.com")
+	if !reflect.DeepEqual(direct, []string{"finance"}) {
+		t.Errorf("Expected direct membership [finance], got %v", direct)
+	}
+
+	transitive := s.ResolvePrincipalGroups("user:dana@example.com")
+	if !reflect.DeepEqual(transitive, []string{"engineering", "platform", "sre"}) {
+		t.Errorf("Expected transitive membership [engineering platform sre], got %v", transitive)
+	}
+
+	if groups := s.ResolvePrincipalGroups("user:nobody@example.com"); len(groups) != 0 {
+		t.Errorf("Expected no groups, got %v", groups)
+	}
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	iampb "google.golang.org/genproto/googleapis/iam/v1"
@@ -106,8 +108,76 @@ func TestResourceOverridesParent(t *testing.T) {
 	}
 }
 
+func setupLayeredPolicies(t *testing.T, s *Storage) {
+	t.Helper()
+
+	_, err := s.SetIamPolicy("projects/test-project", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:dev@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	_, err = s.SetIamPolicy("projects/test-project/secrets/db-password", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"serviceAccount:app@test.iam.gserviceaccount.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+}
+
+func TestAdditiveInheritance_UnionOfAncestors(t *testing.T) {
+	s := NewStorage()
+	setupLayeredPolicies(t, s)
+
+	perms := []string{"secretmanager.secrets.get", "secretmanager.versions.access"}
+
+	allowed, err := s.TestIamPermissions("projects/test-project/secrets/db-password", "user:dev@example.com", perms, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 || allowed[0] != "secretmanager.secrets.get" {
+		t.Errorf("Expected project viewer grant despite the secret's own policy, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions("projects/test-project/secrets/db-password", "serviceAccount:app@test.iam.gserviceaccount.com", perms, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 || allowed[0] != "secretmanager.versions.access" {
+		t.Errorf("Expected only the secret-level grant, got %v", allowed)
+	}
+}
+
+func TestOverrideInheritance_NearestPolicyMasksAncestors(t *testing.T) {
+	s := NewStorage()
+	s.SetAdditiveInheritance(false)
+	setupLayeredPolicies(t, s)
+
+	allowed, err := s.TestIamPermissions("projects/test-project/secrets/db-password", "user:dev@example.com", []string{"secretmanager.secrets.get"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected secret policy to mask the project grant, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions("projects/test-project/secrets/other", "user:dev@example.com", []string{"secretmanager.secrets.get"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected project grant on a secret without its own policy, got %v", allowed)
+	}
+}
+
 func TestPrincipalMatching(t *testing.T) {
 	s := NewStorage()
+	workloadPool := "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool"
 
 	tests := []struct {
 		name      string
@@ -120,6 +190,22 @@ func TestPrincipalMatching(t *testing.T) {
 		{"allUsers", "allUsers", "user:anyone@example.com", true},
 		{"allAuthenticatedUsers", "allAuthenticatedUsers", "serviceAccount:anyone@test.iam.gserviceaccount.com", true},
 		{"no match", "user:alice@example.com", "user:bob@example.com", false},
+		{"domain user", "domain:example.com", "user:alice@example.com", true},
+		{"domain case-insensitive", "domain:Example.com", "user:alice@EXAMPLE.COM", true},
+		{"domain service account", "domain:test.iam.gserviceaccount.com", "serviceAccount:ci@test.iam.gserviceaccount.com", true},
+		{"domain other domain", "domain:example.com", "user:alice@example.org", false},
+		{"domain suffix only", "domain:example.com", "user:alice@notexample.com", false},
+		{"domain subdomain", "domain:example.com", "user:alice@mail.example.com", false},
+		{"domain local part", "domain:example.com", "user:example.com@evil.org", false},
+		{"domain group principal", "domain:example.com", "group:admins@example.com", false},
+		{"principalSet pool wildcard", "principalSet://" + workloadPool + "/*", "principal://" + workloadPool + "/subject/alice", true},
+		{"principalSet pool wildcard attribute set", "principalSet://" + workloadPool + "/*", "principalSet://" + workloadPool + "/group/admins", true},
+		{"principalSet workforce pool", "principalSet://iam.googleapis.com/locations/global/workforcePools/staff/*", "principal://iam.googleapis.com/locations/global/workforcePools/staff/subject/bob", true},
+		{"principalSet other pool", "principalSet://" + workloadPool + "/*", "principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/other/subject/alice", false},
+		{"principalSet pool prefix only", "principalSet://" + workloadPool + "/*", "principal://" + workloadPool + "-dev/subject/alice", false},
+		{"principalSet wildcard not on pool", "principalSet://iam.googleapis.com/projects/123/*", "principal://" + workloadPool + "/subject/alice", false},
+		{"principal subject match", "principal://" + workloadPool + "/subject/alice", "principal://" + workloadPool + "/subject/alice", true},
+		{"principal other subject", "principal://" + workloadPool + "/subject/alice", "principal://" + workloadPool + "/subject/bob", false},
 	}
 
 	for _, tt := range tests {
@@ -132,6 +218,54 @@ func TestPrincipalMatching(t *testing.T) {
 	}
 }
 
+func TestPrincipalSet_ReasonDescribesPoolWildcard(t *testing.T) {
+	s := NewStorage()
+
+	pool := "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool"
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"principalSet://" + pool + "/*"}},
+		},
+	}
+
+	granted, reason, err := s.hasPermission(policy, "principal://"+pool+"/subject/alice", "secretmanager.secrets.get", EvalContext{}, false)
+	if err != nil {
+		t.Fatalf("hasPermission failed: %v", err)
+	}
+	if !granted {
+		t.Fatalf("Expected pool wildcard to grant, got reason %q", reason)
+	}
+	if !strings.Contains(reason, "pool wildcard: any principal in "+pool) {
+		t.Errorf("Expected reason to describe the pool wildcard, got %q", reason)
+	}
+}
+
+func TestPrincipalMatching_DeletedMembers(t *testing.T) {
+	s := NewStorage()
+
+	member := "deleted:serviceAccount:ci@test.iam.gserviceaccount.com?uid=123456789"
+	principal := "serviceAccount:ci@test.iam.gserviceaccount.com"
+
+	if s.principalMatches(principal, member) {
+		t.Error("Expected deleted member not to match by default")
+	}
+	if s.principalMatches(member, member) {
+		t.Error("Expected deleted member not to match itself by default")
+	}
+
+	s.SetMatchDeletedMembers(true)
+
+	if !s.principalMatches(principal, member) {
+		t.Error("Expected deleted member to match its identity when enabled")
+	}
+	if s.principalMatches("serviceAccount:other@test.iam.gserviceaccount.com", member) {
+		t.Error("Expected deleted member not to match a different identity")
+	}
+	if !s.principalMatches("user:alice@example.com", "deleted:user:alice@example.com") {
+		t.Error("Expected deleted member without uid to match its identity when enabled")
+	}
+}
+
 func TestNoPrincipalBackwardCompatibility(t *testing.T) {
 	s := NewStorage()
 
@@ -161,3 +295,117 @@ func TestNoPrincipalBackwardCompatibility(t *testing.T) {
 		t.Errorf("Expected permission allowed without principal check (backward compat), got %d", len(allowed))
 	}
 }
+
+func TestAttachmentPoints_CustomHierarchy(t *testing.T) {
+	s := NewStorage()
+	s.SetAttachmentPoints([]string{"tenants", "buckets", "objects"})
+
+	// zones is not an attachment point, so its policy must be skipped
+	_, err := s.SetIamPolicy("tenants/acme/zones/eu", &iampb.Policy{
+		Version: 1,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"user:zone-admin@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	_, err = s.SetIamPolicy("tenants/acme", &iampb.Policy{
+		Version: 1,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:tenant-viewer@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	resource := "tenants/acme/zones/eu/buckets/data/objects/report"
+	perms := []string{"secretmanager.secrets.get"}
+
+	allowed, err := s.TestIamPermissions(resource, "user:tenant-viewer@example.com", perms, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected tenant-level grant to be inherited, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions(resource, "user:zone-admin@example.com", perms, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected non-attachable zones policy to be skipped, got %v", allowed)
+	}
+
+	expected := []string{resource, "tenants/acme/zones/eu/buckets/data", "tenants/acme"}
+	chain := s.resourceHierarchy(resource)
+	if len(chain) != len(expected) {
+		t.Fatalf("Expected hierarchy %v, got %v", expected, chain)
+	}
+	for i := range expected {
+		if chain[i] != expected[i] {
+			t.Errorf("Expected hierarchy %v, got %v", expected, chain)
+			break
+		}
+	}
+}
+
+func TestAttachmentPoints_DefaultWalksEveryAncestor(t *testing.T) {
+	s := NewStorage()
+
+	chain := s.resourceHierarchy("projects/p/locations/global/keyRings/ring")
+	if len(chain) != 3 {
+		t.Errorf("Expected resource plus 2 ancestors by default, got %v", chain)
+	}
+}
+
+func TestOrganizationGrantInheritedBySecret(t *testing.T) {
+	s := NewStorage()
+	s.SetResourceParent("projects/test-project", "folders/123")
+	s.SetResourceParent("folders/123", "organizations/456")
+
+	_, err := s.SetIamPolicy("organizations/456", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"group:security"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	s.LoadGroups(map[string][]string{"security": {"user:auditor@example.com"}})
+
+	want := []string{"projects/test-project/secrets/db-password", "projects/test-project", "folders/123", "organizations/456"}
+	if got := s.resourceHierarchy("projects/test-project/secrets/db-password"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected hierarchy %v, got %v", want, got)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test-project/secrets/db-password", "user:auditor@example.com", []string{"secretmanager.versions.access"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected org-level grant to be inherited by the secret, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions("projects/other-project/secrets/db-password", "user:auditor@example.com", []string{"secretmanager.versions.access"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected project outside the organization not to inherit, got %v", allowed)
+	}
+}
+
+func TestResourceParents_CycleTerminates(t *testing.T) {
+	s := NewStorage()
+	s.SetResourceParent("folders/1", "folders/2")
+	s.SetResourceParent("folders/2", "folders/1")
+
+	want := []string{"folders/1", "folders/2"}
+	if got := s.resourceHierarchy("folders/1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected hierarchy %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"path"
+)
+
+// SignJwt signs the JSON claims in payload with RS256 using the account's
+// most recently created key, and returns the key ID and the compact JWS. An
+// account without keys gets a system-managed key generated on first use, as
+// GCP signs with Google-managed keys.
+func (s *Storage) SignJwt(accountName, payload string) (string, string, error) {
+	var claims map[string]any
+	if err := json.Unmarshal([]byte(payload), &claims); err != nil {
+		return "", "", fmt.Errorf("invalid JWT payload: %w", err)
+	}
+
+	key, err := s.signingKey(accountName)
+	if err != nil {
+		return "", "", err
+	}
+	if key == nil {
+		if _, key, err = s.createServiceAccountKey(accountName, KeyTypeSystemManaged); err != nil {
+			return "", "", err
+		}
+	}
+
+	keyID := path.Base(key.Name)
+	signed, err := signRS256(key.PrivateKey, keyID, []byte(payload))
+	if err != nil {
+		return "", "", err
+	}
+	return keyID, signed, nil
+}
+
+// signingKey returns the account's newest key, or nil if it has none.
+func (s *Storage) signingKey(accountName string) (*ServiceAccountKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account := s.findServiceAccount(accountName)
+	if account == nil {
+		return nil, fmt.Errorf("service account not found: %s", accountName)
+	}
+
+	var newest *ServiceAccountKey
+	for _, key := range account.Keys {
+		// Key names embed the zero-padded key counter, so the greatest name
+		// is the most recently created key
+		if newest == nil || key.Name > newest.Name {
+			newest = key
+		}
+	}
+	return newest, nil
+}
+
+func signRS256(privateKeyPEM []byte, keyID string, payload []byte) (string, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return "", fmt.Errorf("stored private key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse private key: %w", err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("stored private key is not RSA")
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
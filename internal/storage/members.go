@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"strings"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func normalizePolicyMembers(policy *iampb.Policy) {
+	for _, binding := range policy.Bindings {
+		for i, member := range binding.Members {
+			binding.Members[i] = normalizeMember(member)
+		}
+	}
+}
+
+// dedupePolicyBindings merges bindings that share a role and condition into
+// the first of them and drops repeated members, keeping first-seen order, so
+// stored policies match what GCP returns.
+func dedupePolicyBindings(policy *iampb.Policy) {
+	merged := policy.Bindings[:0]
+	for _, binding := range policy.Bindings {
+		var target *iampb.Binding
+		for _, existing := range merged {
+			if existing.Role == binding.Role && proto.Equal(existing.Condition, binding.Condition) {
+				target = existing
+				break
+			}
+		}
+
+		if target == nil {
+			binding.Members = appendUniqueMembers(nil, binding.Members)
+			merged = append(merged, binding)
+			continue
+		}
+		target.Members = appendUniqueMembers(target.Members, binding.Members)
+	}
+	policy.Bindings = merged
+}
+
+// sameMember reports whether two members or principals name the same
+// identity. Emails compare case-insensitively, as Google treats them.
+func sameMember(a, b string) bool {
+	return a == b || normalizeMember(a) == normalizeMember(b)
+}
+
+func appendUniqueMembers(members, extra []string) []string {
+	seen := make(map[string]bool, len(members)+len(extra))
+	for _, member := range members {
+		seen[member] = true
+	}
+
+	for _, member := range extra {
+		if !seen[member] {
+			members = append(members, member)
+			seen[member] = true
+		}
+	}
+	return members
+}
+
+// memberTypes maps lowercased member type prefixes to their GCP spelling.
+var memberTypes = map[string]string{
+	"user":           "user",
+	"serviceaccount": "serviceAccount",
+	"group":          "group",
+	"domain":         "domain",
+	"deleted":        "deleted",
+}
+
+// normalizeMember lowercases the email or domain portion of a member and
+// spells the type prefix as GCP does, e.g. "User:Alice@Example.com" becomes
+// "user:alice@example.com". Special members and federated identities are
+// returned unchanged.
+func normalizeMember(member string) string {
+	memberType, value, ok := strings.Cut(member, ":")
+	if !ok {
+		return member
+	}
+	if canonical, known := memberTypes[strings.ToLower(memberType)]; known {
+		memberType = canonical
+	}
+
+	switch memberType {
+	case "user", "serviceAccount", "group", "domain":
+		return memberType + ":" + strings.ToLower(value)
+	case "deleted":
+		inner, uid, hasUID := strings.Cut(value, "?")
+		normalized := "deleted:" + normalizeMember(inner)
+		if hasUID {
+			normalized += "?" + uid
+		}
+		return normalized
+	}
+
+	return member
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+)
+
+func TestNormalizeMembers_StoredLowercased(t *testing.T) {
+	s := NewStorage()
+	s.SetNormalizeMembers(true)
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 1,
+		Bindings: []*iampb.Binding{
+			{
+				Role: "roles/viewer",
+				Members: []string{
+					"user:Alice@Example.COM",
+					"serviceAccount:CI-Bot@Test.iam.gserviceaccount.com",
+					"allAuthenticatedUsers",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+
+	expected := []string{
+		"user:alice@example.com",
+		"serviceAccount:ci-bot@test.iam.gserviceaccount.com",
+		"allAuthenticatedUsers",
+	}
+
+	members := policy.Bindings[0].Members
+	if len(members) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, members)
+	}
+	for i := range expected {
+		if members[i] != expected[i] {
+			t.Errorf("Expected member %q, got %q", expected[i], members[i])
+		}
+	}
+}
+
+func TestNormalizeMembers_DisabledByDefault(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 1,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:Alice@Example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+
+	if policy.Bindings[0].Members[0] != "user:Alice@Example.com" {
+		t.Errorf("Expected member stored as written, got %q", policy.Bindings[0].Members[0])
+	}
+}
+
+func TestNormalizeMember(t *testing.T) {
+	tests := []struct {
+		member   string
+		expected string
+	}{
+		{"user:Alice@Example.com", "user:alice@example.com"},
+		{"User:Alice@Example.com", "user:alice@example.com"},
+		{"serviceaccount:CI@Test.iam.gserviceaccount.com", "serviceAccount:ci@test.iam.gserviceaccount.com"},
+		{"group:Devs@Example.com", "group:devs@example.com"},
+		{"domain:Example.COM", "domain:example.com"},
+		{"deleted:user:Bob@Example.com?uid=123ABC", "deleted:user:bob@example.com?uid=123ABC"},
+		{"allUsers", "allUsers"},
+		{"principal://iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/Pool/subject/Alice", "principal://iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/Pool/subject/Alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.member, func(t *testing.T) {
+			if got := normalizeMember(tt.member); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetIamPolicy_DedupesMembers(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/viewer",
+				Members: []string{"user:bob@example.com", "user:alice@example.com", "user:bob@example.com"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	policy, _ := s.GetIamPolicy("projects/test")
+	want := []string{"user:bob@example.com", "user:alice@example.com"}
+	if !reflect.DeepEqual(policy.Bindings[0].Members, want) {
+		t.Errorf("Expected %v, got %v", want, policy.Bindings[0].Members)
+	}
+}
+
+func TestSetIamPolicy_MergesBindingsWithSameRole(t *testing.T) {
+	s := NewStorage()
+
+	condition := &expr.Expr{Expression: `resource.name.startsWith("projects/test/secrets/prod-")`}
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			{Role: "roles/editor", Members: []string{"user:carol@example.com"}, Condition: condition},
+			{Role: "roles/viewer", Members: []string{"user:bob@example.com", "user:alice@example.com"}},
+			{Role: "roles/editor", Members: []string{"user:dave@example.com"}},
+			{Role: "roles/editor", Members: []string{"user:erin@example.com"}, Condition: &expr.Expr{Expression: condition.Expression}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	policy, _ := s.GetIamPolicy("projects/test")
+	if len(policy.Bindings) != 3 {
+		t.Fatalf("Expected 3 bindings after merging, got %v", policy.Bindings)
+	}
+
+	if want := []string{"user:alice@example.com", "user:bob@example.com"}; !reflect.DeepEqual(policy.Bindings[0].Members, want) {
+		t.Errorf("Expected viewer members %v, got %v", want, policy.Bindings[0].Members)
+	}
+	if want := []string{"user:carol@example.com", "user:erin@example.com"}; !reflect.DeepEqual(policy.Bindings[1].Members, want) {
+		t.Errorf("Expected conditional editor members %v, got %v", want, policy.Bindings[1].Members)
+	}
+	if policy.Bindings[2].Condition != nil || policy.Bindings[2].Members[0] != "user:dave@example.com" {
+		t.Errorf("Expected unconditional editor binding to stay separate, got %v", policy.Bindings[2])
+	}
+}
+
+func TestPublicMembers_AnonymousPrincipal(t *testing.T) {
+	tests := []struct {
+		member    string
+		principal string
+		granted   bool
+	}{
+		{"allUsers", AnonymousPrincipal, true},
+		{"allUsers", "user:alice@example.com", true},
+		{"allAuthenticatedUsers", AnonymousPrincipal, false},
+		{"allAuthenticatedUsers", "user:alice@example.com", true},
+		{"allAuthenticatedUsers", "serviceAccount:ci@test.iam.gserviceaccount.com", true},
+		{"allAuthenticatedUsers", "principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/subject/ci", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.member+"/"+tt.principal, func(t *testing.T) {
+			s := NewStorage()
+			_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+				Bindings: []*iampb.Binding{
+					{Role: "roles/secretmanager.secretAccessor", Members: []string{tt.member}},
+				},
+			})
+			if err != nil {
+				t.Fatalf("SetIamPolicy failed: %v", err)
+			}
+
+			// The indexed path and full evaluation (trace) must agree
+			for _, trace := range []bool{false, true} {
+				allowed, err := s.TestIamPermissions("projects/test", tt.principal, []string{"secretmanager.versions.access"}, trace)
+				if err != nil {
+					t.Fatalf("TestIamPermissions failed: %v", err)
+				}
+				if granted := len(allowed) == 1; granted != tt.granted {
+					t.Errorf("Expected %s to grant %s %v (trace=%v), got %v", tt.member, tt.principal, tt.granted, trace, granted)
+				}
+			}
+		})
+	}
+}
+
+func TestPrincipalMatching_CaseInsensitiveEmails(t *testing.T) {
+	s := NewStorage()
+	s.LoadGroups(map[string][]string{
+		"Eng@Example.com": {"user:Dana@Example.com"},
+	})
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"User:Alice@Example.com"}},
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"group:eng@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		principal  string
+		permission string
+	}{
+		{"direct member", "user:alice@example.com", "secretmanager.secrets.get"},
+		{"direct member, mixed-case principal", "user:ALICE@example.COM", "secretmanager.secrets.get"},
+		{"group member", "user:dana@example.com", "secretmanager.versions.access"},
+		{"group member, mixed-case principal", "User:DANA@Example.com", "secretmanager.versions.access"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The indexed path and full evaluation (trace) must agree
+			for _, trace := range []bool{false, true} {
+				allowed, err := s.TestIamPermissions("projects/test", tt.principal, []string{tt.permission}, trace)
+				if err != nil {
+					t.Fatalf("TestIamPermissions failed: %v", err)
+				}
+				if len(allowed) != 1 {
+					t.Errorf("Expected %s to be granted %s (trace=%v), got %v", tt.principal, tt.permission, trace, allowed)
+				}
+			}
+		})
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test", "user:bob@example.com", []string{"secretmanager.secrets.get"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected a different email not to match, got %v", allowed)
+	}
+
+	explanation, err := s.ExplainPermission("projects/test", "user:DANA@example.com", "secretmanager.versions.access")
+	if err != nil {
+		t.Fatalf("ExplainPermission failed: %v", err)
+	}
+	if !explanation.Granted {
+		t.Errorf("Expected the explanation to agree with the check, got %+v", explanation)
+	}
+}
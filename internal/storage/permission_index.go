@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"strings"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+// policyIndex precomputes who an allow policy grants what, so permission
+// checks on the common case (unconditional bindings of known roles to plain
+// principals and groups) need only map lookups. Policies the index cannot
+// represent faithfully are marked inexact and always take the full
+// evaluation path.
+type policyIndex struct {
+	// exact is false when a binding has a condition, a member whose match
+	// depends on more than equality (domain:, principalSet wildcards,
+	// deleted:), or a role resolved by compat-mode wildcard matching
+	exact bool
+	// members maps every principal a binding names, directly or through
+	// group membership, to the permission sets of its roles. Keys are
+	// normalized (see normalizeMember) so emails match case-insensitively
+	members map[string][]map[string]bool
+	// public holds the permission sets of roles bound to allUsers, which
+	// matches any principal
+	public []map[string]bool
+	// authenticated holds the permission sets of roles bound to
+	// allAuthenticatedUsers, which matches any but the anonymous principal
+	authenticated []map[string]bool
+	// roles holds the permission sets of every bound role, for checks
+	// without a principal
+	roles []map[string]bool
+}
+
+// grants reports whether the policy grants permission to principal, with the
+// same result hasPermission would give for an exact index.
+func (idx *policyIndex) grants(principal, permission string) bool {
+	if principal == "" {
+		return anyGrants(idx.roles, permission)
+	}
+	return anyGrants(idx.members[normalizeMember(principal)], permission) ||
+		anyGrants(idx.public, permission) ||
+		(isAuthenticatedPrincipal(principal) && anyGrants(idx.authenticated, permission))
+}
+
+func anyGrants(sets []map[string]bool, permission string) bool {
+	for _, perms := range sets {
+		if perms[permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPolicyIndex indexes policy against the current roles and groups.
+// Requires s.mu to be held.
+func (s *Storage) buildPolicyIndex(policy *iampb.Policy) *policyIndex { //nolint:staticcheck // Using standard genproto package
+	idx := &policyIndex{
+		exact:   true,
+		members: make(map[string][]map[string]bool),
+	}
+
+	for _, binding := range policy.Bindings {
+		if binding.Condition != nil {
+			return &policyIndex{}
+		}
+
+		perms, ok := s.customRoleIndex[binding.Role]
+		if !ok {
+			perms, ok = s.builtInRoleIndex[binding.Role]
+		}
+		if !ok {
+			if s.allowUnknownRoles {
+				return &policyIndex{}
+			}
+			// Unknown roles grant nothing, so the binding can be skipped
+			continue
+		}
+		idx.roles = append(idx.roles, perms)
+
+		for _, member := range binding.Members {
+			switch {
+			case member == "allUsers":
+				idx.public = append(idx.public, perms)
+			case member == "allAuthenticatedUsers":
+				idx.authenticated = append(idx.authenticated, perms)
+			case strings.HasPrefix(member, "domain:") || strings.HasPrefix(member, "deleted:"):
+				return &policyIndex{}
+			default:
+				if _, ok := principalSetPool(member); ok {
+					return &policyIndex{}
+				}
+			}
+
+			member = normalizeMember(member)
+			idx.members[member] = append(idx.members[member], perms)
+			if groupName, ok := strings.CutPrefix(member, "group:"); ok {
+				for principal := range s.groupPrincipals(groupName, make(map[string]bool)) {
+					idx.members[principal] = append(idx.members[principal], perms)
+				}
+			}
+		}
+	}
+
+	return idx
+}
+
+// groupPrincipals returns every member of groupName, directly or through
+// nested groups, normalized: exactly the principals groupContains accepts.
+func (s *Storage) groupPrincipals(groupName string, visited map[string]bool) map[string]bool {
+	principals := make(map[string]bool)
+	if visited[groupName] {
+		return principals
+	}
+	visited[groupName] = true
+
+	for _, groupMember := range s.groupMembers(groupName) {
+		groupMember = normalizeMember(groupMember)
+		principals[groupMember] = true
+		if nestedGroupName, ok := strings.CutPrefix(groupMember, "group:"); ok {
+			for principal := range s.groupPrincipals(nestedGroupName, visited) {
+				principals[principal] = true
+			}
+		}
+	}
+	return principals
+}
+
+// indexPolicy rebuilds the index of the policy attached to resource, or drops
+// it when there is no longer a policy. Requires s.mu to be held for writing.
+func (s *Storage) indexPolicy(resource string) {
+	if policy, exists := s.policies[resource]; exists {
+		s.policyIndexes[resource] = s.buildPolicyIndex(policy)
+		return
+	}
+	delete(s.policyIndexes, resource)
+}
+
+// reindexPolicies rebuilds every policy index, after a change that can
+// affect any policy (groups, custom roles, role matching). Requires s.mu to
+// be held for writing.
+func (s *Storage) reindexPolicies() {
+	s.policyIndexes = make(map[string]*policyIndex, len(s.policies))
+	for resource, policy := range s.policies {
+		s.policyIndexes[resource] = s.buildPolicyIndex(policy)
+	}
+}
+
+// indexedPermissions answers TestIamPermissions from the policy indexes. It
+// reports false, leaving the caller to evaluate every binding, when any of
+// the policies is not exactly indexed. Deny rules are still checked in full.
+// Requires s.mu to be held.
+func (s *Storage) indexedPermissions(resource, principal string, permissions []string, policies []attachedPolicy, evalCtx EvalContext) ([]string, bool, error) {
+	indexes := make([]*policyIndex, 0, len(policies))
+	for _, attached := range policies {
+		idx := s.policyIndexes[attached.resource]
+		if idx == nil || !idx.exact {
+			return nil, false, nil
+		}
+		indexes = append(indexes, idx)
+	}
+
+	allowed := []string{}
+	for _, perm := range permissions {
+		granted := false
+		for _, idx := range indexes {
+			if idx.grants(principal, perm) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			continue
+		}
+
+		evalCtx.ResourceService = extractResourceService(resource, perm)
+		denied, _, err := s.checkDenyRules(resource, principal, perm, evalCtx)
+		if err != nil {
+			return nil, false, err
+		}
+		if !denied {
+			allowed = append(allowed, perm)
+		}
+	}
+	return allowed, true, nil
+}
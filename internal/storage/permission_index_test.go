@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+)
+
+// fullEvaluation runs TestIamPermissions with the policy indexes removed, so
+// every binding is evaluated.
+func fullEvaluation(t *testing.T, s *Storage, resource, principal string, permissions []string) []string {
+	t.Helper()
+
+	s.mu.Lock()
+	indexes := s.policyIndexes
+	s.policyIndexes = make(map[string]*policyIndex)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.policyIndexes = indexes
+		s.mu.Unlock()
+	}()
+
+	allowed, err := s.TestIamPermissions(resource, principal, permissions, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	return allowed
+}
+
+func TestPolicyIndex_MatchesFullEvaluation(t *testing.T) {
+	s := NewStorage()
+	s.LoadGroups(map[string][]string{
+		"engineering": {"group:platform", "user:erin@example.com"},
+		"platform":    {"user:dana@example.com"},
+	})
+	s.LoadCustomRoles(map[string][]string{
+		"roles/custom.secretReader": {"secretmanager.secrets.get"},
+	})
+	s.SetDenyPolicy("projects/test", []DenyRule{{
+		DeniedPrincipals:  []string{"user:erin@example.com"},
+		DeniedPermissions: []string{"secretmanager.versions.access"},
+	}})
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"group:engineering"}},
+			{Role: "roles/custom.secretReader", Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"}},
+			{Role: "roles/pubsub.subscriber", Members: []string{"allAuthenticatedUsers"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	_, err = s.SetIamPolicy("projects/test/secrets/db", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.admin", Members: []string{"user:bob@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	if idx := s.policyIndexes["projects/test"]; idx == nil || !idx.exact {
+		t.Fatalf("Expected an exact index for an unconditional policy, got %+v", idx)
+	}
+
+	permissions := []string{
+		"resourcemanager.projects.get",
+		"secretmanager.versions.access",
+		"secretmanager.secrets.get",
+		"secretmanager.secrets.delete",
+		"pubsub.subscriptions.consume",
+	}
+	principals := []string{
+		"",
+		"user:alice@example.com",
+		"user:bob@example.com",
+		"user:dana@example.com",
+		"user:erin@example.com",
+		"group:platform",
+		"serviceAccount:ci@test.iam.gserviceaccount.com",
+		"user:nobody@example.com",
+	}
+
+	for _, resource := range []string{"projects/test", "projects/test/secrets/db", "projects/other"} {
+		for _, principal := range principals {
+			indexed, err := s.TestIamPermissions(resource, principal, permissions, false)
+			if err != nil {
+				t.Fatalf("TestIamPermissions failed: %v", err)
+			}
+			if full := fullEvaluation(t, s, resource, principal, permissions); !reflect.DeepEqual(indexed, full) {
+				t.Errorf("%s on %s: indexed %v, full evaluation %v", principal, resource, indexed, full)
+			}
+		}
+	}
+}
+
+func TestPolicyIndex_ConditionalPolicyNotIndexed(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:      "roles/viewer",
+				Members:   []string{"user:alice@example.com"},
+				Condition: &expr.Expr{Expression: `resource.name.startsWith("projects/test/secrets/prod-")`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	if idx := s.policyIndexes["projects/test"]; idx == nil || idx.exact {
+		t.Fatalf("Expected an inexact index for a conditional policy, got %+v", idx)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test/secrets/dev-db", "user:alice@example.com", []string{"resourcemanager.projects.get"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected the failing condition to deny, got %v", allowed)
+	}
+}
+
+func TestPolicyIndex_RebuiltOnGroupAndRoleChanges(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/custom.reader", Members: []string{"group:engineering"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	check := func() []string {
+		allowed, err := s.TestIamPermissions("projects/test", "user:dana@example.com", []string{"secretmanager.secrets.get"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		return allowed
+	}
+
+	if allowed := check(); len(allowed) != 0 {
+		t.Fatalf("Expected no grant before the role and group exist, got %v", allowed)
+	}
+
+	s.LoadCustomRoles(map[string][]string{"roles/custom.reader": {"secretmanager.secrets.get"}})
+	s.LoadGroups(map[string][]string{"engineering": {"user:dana@example.com"}})
+	if allowed := check(); len(allowed) != 1 {
+		t.Errorf("Expected the new group membership to grant, got %v", allowed)
+	}
+
+	s.LoadGroups(map[string][]string{"engineering": {}})
+	if allowed := check(); len(allowed) != 0 {
+		t.Errorf("Expected removing the member to revoke, got %v", allowed)
+	}
+
+	if err := s.MovePolicy("projects/test", "projects/moved"); err != nil {
+		t.Fatalf("MovePolicy failed: %v", err)
+	}
+	if _, exists := s.policyIndexes["projects/test"]; exists {
+		t.Error("Expected the moved policy's old index to be dropped")
+	}
+}
+
+// BenchmarkTestIamPermissions_Index compares the policy index with
+// evaluating every binding, on a policy with many bindings.
+func BenchmarkTestIamPermissions_Index(b *testing.B) {
+	permissions := []string{
+		"resourcemanager.projects.get",
+		"secretmanager.versions.access",
+		"cloudkms.cryptoKeyVersions.useToEncrypt",
+		"pubsub.topics.publish",
+		"resourcemanager.projects.setIamPolicy",
+	}
+
+	b.Run("scan", func(b *testing.B) {
+		s := manyBindingsStorage(b)
+		s.policyIndexes = make(map[string]*policyIndex)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.TestIamPermissions("projects/bench/secrets/s", "user:bench@example.com", permissions, false); err != nil {
+				b.Fatalf("TestIamPermissions failed: %v", err)
+			}
+		}
+	})
+
+	b.Run("index", func(b *testing.B) {
+		s := manyBindingsStorage(b)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.TestIamPermissions("projects/bench/secrets/s", "user:bench@example.com", permissions, false); err != nil {
+				b.Fatalf("TestIamPermissions failed: %v", err)
+			}
+		}
+	})
+}
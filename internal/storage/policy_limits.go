@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+// ErrPolicyTooLarge is returned by SetIamPolicy for a policy with more unique
+// members or bindings than the configured limits allow.
+var ErrPolicyTooLarge = errors.New("policy exceeds size limit")
+
+// Default policy size limits. GCP allows up to 1,500 principals per allow
+// policy; the binding limit keeps a policy of single-member bindings within
+// the same bound.
+const (
+	DefaultMaxPolicyMembers  = 1500
+	DefaultMaxPolicyBindings = 1500
+)
+
+// SetPolicyLimits sets the most unique members (counted across all bindings)
+// and bindings a policy written by SetIamPolicy may have. Zero disables a
+// limit.
+func (s *Storage) SetPolicyLimits(maxMembers, maxBindings int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPolicyMembers = maxMembers
+	s.maxPolicyBindings = maxBindings
+}
+
+// checkPolicyLimits rejects a policy over the member or binding limit.
+// Requires s.mu to be held.
+func (s *Storage) checkPolicyLimits(resource string, policy *iampb.Policy) error {
+	if s.maxPolicyBindings > 0 && len(policy.Bindings) > s.maxPolicyBindings {
+		return fmt.Errorf("%w: %s has %d bindings (limit %d)", ErrPolicyTooLarge, resource, len(policy.Bindings), s.maxPolicyBindings)
+	}
+
+	if s.maxPolicyMembers > 0 {
+		members := make(map[string]bool)
+		for _, binding := range policy.Bindings {
+			for _, member := range binding.Members {
+				members[member] = true
+			}
+		}
+		if len(members) > s.maxPolicyMembers {
+			return fmt.Errorf("%w: %s has %d unique members (limit %d)", ErrPolicyTooLarge, resource, len(members), s.maxPolicyMembers)
+		}
+	}
+
+	return nil
+}
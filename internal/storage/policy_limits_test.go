@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+// policyWithMembers returns a policy binding n distinct users, spread over
+// two roles with every member in both.
+func policyWithMembers(n int) *iampb.Policy {
+	members := make([]string, n)
+	for i := range members {
+		members[i] = fmt.Sprintf("user:user%d@example.com", i)
+	}
+	return &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: members},
+			{Role: "roles/secretmanager.secretAccessor", Members: append([]string(nil), members...)},
+		},
+	}
+}
+
+func TestPolicyLimits_Members(t *testing.T) {
+	s := NewStorage()
+
+	// Members shared by both bindings count once
+	if _, err := s.SetIamPolicy("projects/test", policyWithMembers(DefaultMaxPolicyMembers)); err != nil {
+		t.Fatalf("Expected a policy at the member limit to be accepted, got %v", err)
+	}
+
+	_, err := s.SetIamPolicy("projects/test", policyWithMembers(DefaultMaxPolicyMembers+1))
+	if !errors.Is(err, ErrPolicyTooLarge) {
+		t.Fatalf("Expected ErrPolicyTooLarge one member over the limit, got %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings[0].Members) != DefaultMaxPolicyMembers {
+		t.Errorf("Expected the rejected write to leave the stored policy in place, got %d members", len(policy.Bindings[0].Members))
+	}
+}
+
+func TestPolicyLimits_Bindings(t *testing.T) {
+	s := NewStorage()
+	s.SetPolicyLimits(10, 3)
+
+	policyWithBindings := func(n int) *iampb.Policy {
+		policy := &iampb.Policy{}
+		for i := 0; i < n; i++ {
+			policy.Bindings = append(policy.Bindings, &iampb.Binding{
+				Role:    fmt.Sprintf("roles/custom.role%d", i),
+				Members: []string{"user:alice@example.com"},
+			})
+		}
+		return policy
+	}
+
+	if _, err := s.SetIamPolicy("projects/test", policyWithBindings(3)); err != nil {
+		t.Fatalf("Expected a policy at the binding limit to be accepted, got %v", err)
+	}
+	if _, err := s.SetIamPolicy("projects/test", policyWithBindings(4)); !errors.Is(err, ErrPolicyTooLarge) {
+		t.Errorf("Expected ErrPolicyTooLarge one binding over the limit, got %v", err)
+	}
+
+	if _, err := s.SetIamPolicy("projects/test", policyWithMembers(11)); !errors.Is(err, ErrPolicyTooLarge) {
+		t.Errorf("Expected ErrPolicyTooLarge over a custom member limit, got %v", err)
+	}
+
+	s.SetPolicyLimits(0, 0)
+	if _, err := s.SetIamPolicy("projects/test", policyWithBindings(4)); err != nil {
+		t.Errorf("Expected zero limits to disable the checks, got %v", err)
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"strings"
 	"testing"
 
-	expr "google.golang.org/genproto/googleapis/type/expr"
 	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package
+	expr "google.golang.org/genproto/googleapis/type/expr"
 )
 
 func TestPolicyEtag(t *testing.T) {
@@ -111,6 +111,59 @@ func TestPolicyVersion3_WithConditions(t *testing.T) {
 	}
 }
 
+func TestGetIamPolicyForVersion_MixedPolicy(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{ //nolint:staticcheck // Using standard genproto package
+		Version: 3,
+		Bindings: []*iampb.Binding{ //nolint:staticcheck // Using standard genproto package
+			{
+				Role:    "roles/viewer",
+				Members: []string{"user:alice@example.com"},
+			},
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+				Condition: &expr.Expr{
+					Expression: `resource.name.startsWith("projects/test/secrets/prod-")`,
+				},
+			},
+		},
+	}
+
+	stored, err := s.SetIamPolicy("projects/test", policy)
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	v1, err := s.GetIamPolicyForVersion("projects/test", 1)
+	if err != nil {
+		t.Fatalf("GetIamPolicyForVersion failed: %v", err)
+	}
+	if len(v1.Bindings) != 1 || v1.Bindings[0].Role != "roles/viewer" {
+		t.Errorf("Expected only the unconditional binding at version 1, got %v", v1.Bindings)
+	}
+	if v1.Version != 1 {
+		t.Errorf("Expected version 1, got %d", v1.Version)
+	}
+	if string(v1.Etag) != string(stored.Etag) {
+		t.Error("Expected the stored etag to be kept")
+	}
+
+	v3, err := s.GetIamPolicyForVersion("projects/test", 3)
+	if err != nil {
+		t.Fatalf("GetIamPolicyForVersion failed: %v", err)
+	}
+	if len(v3.Bindings) != 2 || v3.Version != 3 {
+		t.Errorf("Expected both bindings at version 3, got version %d with %v", v3.Version, v3.Bindings)
+	}
+
+	// Filtering must not touch the stored policy
+	if got, _ := s.GetIamPolicy("projects/test"); len(got.Bindings) != 2 {
+		t.Errorf("Expected stored policy to keep conditional binding, got %v", got.Bindings)
+	}
+}
+
 func TestPolicyVersion3_EmptyCondition(t *testing.T) {
 	s := NewStorage()
 
@@ -240,3 +293,84 @@ func TestConditionalBinding_ResourceType(t *testing.T) {
 		t.Errorf("Expected permission denied for CRYPTO_KEY type (condition requires SECRET), got %d allowed", len(denied))
 	}
 }
+
+func TestConditionalBinding_CombinedCondition(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+				Condition: &expr.Expr{
+					Expression: `resource.name.startsWith("projects/test/secrets/prod-") && resource.type == "SECRET" && request.time < timestamp("2999-01-01T00:00:00Z")`,
+				},
+			},
+		},
+	}
+
+	if _, err := s.SetIamPolicy("projects/test", policy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test/secrets/prod-db", "serviceAccount:ci@test.iam.gserviceaccount.com", []string{"secretmanager.versions.access"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected access to prod secret, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions("projects/test/secrets/dev-db", "serviceAccount:ci@test.iam.gserviceaccount.com", []string{"secretmanager.versions.access"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected no access to dev secret, got %v", allowed)
+	}
+}
+
+func TestPolicyV3_ResourceServiceCondition(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/editor",
+				Members: []string{"user:dev@example.com"},
+				Condition: &expr.Expr{
+					Expression: `resource.service == "secretmanager.googleapis.com"`,
+				},
+			},
+		},
+	}
+	if _, err := s.SetIamPolicy("projects/test", policy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test/secrets/db", "user:dev@example.com", []string{"secretmanager.versions.access"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected access to secrets, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions("projects/test/locations/global/keyRings/ring/cryptoKeys/key", "user:dev@example.com", []string{"cloudkms.cryptoKeys.encrypt"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected no access to KMS keys, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions("projects/test", "user:dev@example.com", []string{"secretmanager.secrets.list", "cloudkms.keyRings.list"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 || allowed[0] != "secretmanager.secrets.list" {
+		t.Errorf("Expected service derived from permission at project level, got %v", allowed)
+	}
+}
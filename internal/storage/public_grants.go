@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+// ErrPublicGrant is returned when a policy grants a broad role to allUsers or
+// allAuthenticatedUsers and the public grant policy is reject.
+var ErrPublicGrant = errors.New("broad role granted to public member")
+
+// PublicGrantPolicy controls what happens when a policy grants a broad role
+// (owner, editor, or an admin role) to allUsers or allAuthenticatedUsers.
+type PublicGrantPolicy string
+
+const (
+	PublicGrantWarn   PublicGrantPolicy = "warn"
+	PublicGrantReject PublicGrantPolicy = "reject"
+)
+
+// ParsePublicGrantPolicy validates a public grant policy name.
+func ParsePublicGrantPolicy(value string) (PublicGrantPolicy, error) {
+	switch policy := PublicGrantPolicy(value); policy {
+	case PublicGrantWarn, PublicGrantReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid public grant policy %q (must be warn or reject)", value)
+}
+
+// PublicGrant is a binding member that gives the public a broad role.
+type PublicGrant struct {
+	Resource string
+	Role     string
+	Member   string
+}
+
+func (g PublicGrant) String() string {
+	return fmt.Sprintf("%s grants %s to %s", g.Resource, g.Role, g.Member)
+}
+
+// FindPublicGrants lists the bindings in policy that grant a broad role to
+// allUsers or allAuthenticatedUsers.
+func FindPublicGrants(resource string, policy *iampb.Policy) []PublicGrant {
+	if policy == nil {
+		return nil
+	}
+
+	var grants []PublicGrant
+	for _, binding := range policy.Bindings {
+		if !isBroadRole(binding.Role) {
+			continue
+		}
+		for _, member := range binding.Members {
+			if member == "allUsers" || member == "allAuthenticatedUsers" {
+				grants = append(grants, PublicGrant{Resource: resource, Role: binding.Role, Member: member})
+			}
+		}
+	}
+	return grants
+}
+
+func isBroadRole(role string) bool {
+	if role == "roles/owner" || role == "roles/editor" {
+		return true
+	}
+	return strings.HasPrefix(role, "roles/") && strings.HasSuffix(strings.ToLower(role), "admin")
+}
+
+// CheckPublicGrants logs every broad public grant in policies and, under the
+// reject policy, returns an error wrapping ErrPublicGrant if there are any.
+func (s *Storage) CheckPublicGrants(policies map[string]*iampb.Policy) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resources := make([]string, 0, len(policies))
+	for resource := range policies {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	var grants []PublicGrant
+	for _, resource := range resources {
+		grants = append(grants, FindPublicGrants(normalizeResource(resource), policies[resource])...)
+	}
+
+	return s.reportPublicGrants(grants)
+}
+
+// reportPublicGrants requires s.mu to be held.
+func (s *Storage) reportPublicGrants(grants []PublicGrant) error {
+	for _, grant := range grants {
+		slog.Warn("broad role granted to public member", "resource", grant.Resource, "role", grant.Role, "member", grant.Member, "policy", string(s.publicGrantPolicy))
+	}
+
+	if len(grants) == 0 || s.publicGrantPolicy != PublicGrantReject {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPublicGrant, grants[0])
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+func publicPolicy(role string) *iampb.Policy {
+	return &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{
+				Role:    role,
+				Members: []string{"allUsers", "user:alice@example.com"},
+			},
+		},
+	}
+}
+
+func TestFindPublicGrants(t *testing.T) {
+	grants := FindPublicGrants("projects/test", publicPolicy("roles/owner"))
+	if len(grants) != 1 {
+		t.Fatalf("Expected owner-to-allUsers to be flagged, got %v", grants)
+	}
+
+	want := PublicGrant{Resource: "projects/test", Role: "roles/owner", Member: "allUsers"}
+	if grants[0] != want {
+		t.Errorf("Expected %v, got %v", want, grants[0])
+	}
+
+	if grants := FindPublicGrants("projects/test", publicPolicy("roles/secretmanager.admin")); len(grants) != 1 {
+		t.Errorf("Expected admin role to be flagged, got %v", grants)
+	}
+
+	if grants := FindPublicGrants("projects/test", publicPolicy("roles/viewer")); len(grants) != 0 {
+		t.Errorf("Expected viewer-to-allUsers not to be flagged, got %v", grants)
+	}
+}
+
+func TestPublicGrant_WarnByDefault(t *testing.T) {
+	s := NewStorage()
+
+	if _, err := s.SetIamPolicy("projects/test", publicPolicy("roles/owner")); err != nil {
+		t.Fatalf("Expected warn policy to accept the binding, got %v", err)
+	}
+}
+
+func TestPublicGrant_Reject(t *testing.T) {
+	s := NewStorage()
+	s.SetPublicGrantPolicy(PublicGrantReject)
+
+	_, err := s.SetIamPolicy("projects/test", publicPolicy("roles/owner"))
+	if !errors.Is(err, ErrPublicGrant) {
+		t.Fatalf("Expected ErrPublicGrant, got %v", err)
+	}
+
+	if _, err := s.SetIamPolicy("projects/test", publicPolicy("roles/viewer")); err != nil {
+		t.Errorf("Expected narrow public role to be accepted, got %v", err)
+	}
+
+	err = s.CheckPublicGrants(map[string]*iampb.Policy{
+		"projects/test/secrets/db": publicPolicy("roles/editor"),
+	})
+	if !errors.Is(err, ErrPublicGrant) {
+		t.Errorf("Expected CheckPublicGrants to reject loaded policies, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// RoleCoverage compares one role's permissions against a reference role.
+type RoleCoverage struct {
+	Role            string `json:"role"`
+	Custom          bool   `json:"custom"`
+	PermissionCount int    `json:"permissionCount"`
+	// OverlapCount is the number of the role's permissions that the
+	// reference role also grants.
+	OverlapCount int `json:"overlapCount"`
+	// CoveragePercent is the share of the reference role's permissions the
+	// role grants, rounded to one decimal place.
+	CoveragePercent float64 `json:"coveragePercent"`
+	// ExtraPermissions are granted by the role but not by the reference role.
+	ExtraPermissions []string `json:"extraPermissions,omitempty"`
+}
+
+// RoleCoverageReport returns a coverage entry for every built-in and custom
+// role, sorted by role name, measured against the reference role.
+func (s *Storage) RoleCoverageReport(reference string) ([]RoleCoverage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	referencePerms, ok := s.builtInRoles[reference]
+	if custom, isCustom := s.customRoles[reference]; isCustom {
+		referencePerms, ok = custom.grantedPermissions(), true
+	}
+	if !ok {
+		return nil, fmt.Errorf("reference role not found: %s", reference)
+	}
+
+	inReference := make(map[string]bool, len(referencePerms))
+	for _, perm := range referencePerms {
+		inReference[perm] = true
+	}
+
+	roles := make(map[string][]string, len(s.builtInRoles)+len(s.customRoles))
+	for role, perms := range s.builtInRoles {
+		roles[role] = perms
+	}
+	for name, role := range s.customRoles {
+		roles[name] = role.grantedPermissions()
+	}
+
+	report := make([]RoleCoverage, 0, len(roles))
+	for role, perms := range roles {
+		_, custom := s.customRoles[role]
+		entry := RoleCoverage{
+			Role:   role,
+			Custom: custom,
+		}
+
+		seen := make(map[string]bool, len(perms))
+		for _, perm := range perms {
+			if seen[perm] {
+				continue
+			}
+			seen[perm] = true
+
+			entry.PermissionCount++
+			if inReference[perm] {
+				entry.OverlapCount++
+			} else {
+				entry.ExtraPermissions = append(entry.ExtraPermissions, perm)
+			}
+		}
+		sort.Strings(entry.ExtraPermissions)
+
+		if len(inReference) > 0 {
+			entry.CoveragePercent = math.Round(float64(entry.OverlapCount)/float64(len(inReference))*1000) / 10
+		}
+
+		report = append(report, entry)
+	}
+
+	sort.Slice(report, func(i, j int) bool { return report[i].Role < report[j].Role })
+	return report, nil
+}
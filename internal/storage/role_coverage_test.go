@@ -0,0 +1,74 @@
+package storage
+
+import "testing"
+
+func TestRoleCoverageReport_CustomSubset(t *testing.T) {
+	s := NewStorage()
+	s.LoadCustomRoles(map[string][]string{
+		// 13 of the 26 permissions in roles/owner
+		"roles/custom.secretsOperator": {
+			"secretmanager.secrets.get",
+			"secretmanager.secrets.create",
+			"secretmanager.secrets.update",
+			"secretmanager.secrets.delete",
+			"secretmanager.secrets.list",
+			"secretmanager.versions.add",
+			"secretmanager.versions.get",
+			"secretmanager.versions.access",
+			"secretmanager.versions.list",
+			"secretmanager.versions.enable",
+			"secretmanager.versions.disable",
+			"secretmanager.versions.destroy",
+			"cloudkms.keyRings.get",
+		},
+		"roles/custom.overreach": {
+			"secretmanager.versions.access",
+			"storage.buckets.delete",
+		},
+	})
+
+	report, err := s.RoleCoverageReport("roles/owner")
+	if err != nil {
+		t.Fatalf("RoleCoverageReport failed: %v", err)
+	}
+
+	byRole := make(map[string]RoleCoverage, len(report))
+	for i, entry := range report {
+		byRole[entry.Role] = entry
+		if i > 0 && report[i-1].Role >= entry.Role {
+			t.Errorf("Expected report sorted by role, got %s before %s", report[i-1].Role, entry.Role)
+		}
+	}
+
+	subset, ok := byRole["roles/custom.secretsOperator"]
+	if !ok {
+		t.Fatal("Expected custom role in report")
+	}
+	if !subset.Custom || subset.PermissionCount != 13 || subset.OverlapCount != 13 {
+		t.Errorf("Unexpected subset entry: %+v", subset)
+	}
+	if subset.CoveragePercent != 21 {
+		t.Errorf("Expected 21%% coverage of roles/owner, got %v", subset.CoveragePercent)
+	}
+	if len(subset.ExtraPermissions) != 0 {
+		t.Errorf("Expected no extra permissions for a strict subset, got %v", subset.ExtraPermissions)
+	}
+
+	overreach := byRole["roles/custom.overreach"]
+	if len(overreach.ExtraPermissions) != 1 || overreach.ExtraPermissions[0] != "storage.buckets.delete" {
+		t.Errorf("Expected storage.buckets.delete flagged as extra, got %v", overreach.ExtraPermissions)
+	}
+
+	owner := byRole["roles/owner"]
+	if owner.Custom || owner.CoveragePercent != 100 {
+		t.Errorf("Expected roles/owner to fully cover itself, got %+v", owner)
+	}
+}
+
+func TestRoleCoverageReport_UnknownReference(t *testing.T) {
+	s := NewStorage()
+
+	if _, err := s.RoleCoverageReport("roles/doesNotExist"); err == nil {
+		t.Error("Expected error for unknown reference role")
+	}
+}
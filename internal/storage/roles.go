@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Role is a role definition. Custom roles loaded from config only have a
+// name and permissions; roles created through the IAM admin API also carry
+// a title, description and launch stage.
+type Role struct {
+	Name                string   `json:"name"`
+	Title               string   `json:"title,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	IncludedPermissions []string `json:"includedPermissions"`
+	// Stage is the launch stage as GCP spells it (ALPHA, BETA, GA, ...); a
+	// DISABLED role grants nothing
+	Stage string `json:"stage,omitempty"`
+	// Deleted roles are kept, as in GCP, but grant nothing and cannot be
+	// recreated or updated
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// UnmarshalJSON also accepts a bare permission list, the form custom roles
+// took in snapshots and databases written before roles had metadata. The
+// name is then filled in from the role's key by applyState.
+func (r *Role) UnmarshalJSON(data []byte) error {
+	var perms []string
+	if err := json.Unmarshal(data, &perms); err == nil {
+		*r = Role{IncludedPermissions: perms}
+		return nil
+	}
+
+	type role Role
+	return json.Unmarshal(data, (*role)(r))
+}
+
+// Role fields UpdateRole can change.
+const (
+	RoleFieldTitle               = "title"
+	RoleFieldDescription         = "description"
+	RoleFieldIncludedPermissions = "includedPermissions"
+	RoleFieldStage               = "stage"
+)
+
+// customRolesFromPermissions turns role -> permissions entries into GA custom
+// roles.
+func customRolesFromPermissions(roles map[string][]string) map[string]*Role {
+	custom := make(map[string]*Role, len(roles))
+	for name, perms := range roles {
+		custom[name] = &Role{Name: name, IncludedPermissions: perms, Stage: "GA"}
+	}
+	return custom
+}
+
+// StageDisabled is the launch stage of a role that grants no permissions.
+const StageDisabled = "DISABLED"
+
+// customRoleIndexOf builds the permission set of every custom role. Deleted
+// and disabled roles get an empty set rather than none, so bindings to them
+// grant nothing instead of falling back to a built-in role or wildcard
+// matching.
+func customRoleIndexOf(roles map[string]*Role) map[string]map[string]bool {
+	perms := make(map[string][]string, len(roles))
+	for name, role := range roles {
+		perms[name] = role.grantedPermissions()
+	}
+	return indexRolePermissions(perms)
+}
+
+// grantedPermissions returns the permissions the role grants: none once it
+// is deleted or while it is disabled. Every other stage grants its
+// permissions.
+func (r *Role) grantedPermissions() []string {
+	if r.Deleted || r.Stage == StageDisabled {
+		return nil
+	}
+	return r.IncludedPermissions
+}
+
+// CreateRole adds a custom role. The name must not already belong to a
+// custom role, including a deleted one.
+func (s *Storage) CreateRole(role *Role) (*Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.customRoles[role.Name]; exists {
+		return nil, fmt.Errorf("role already exists: %s", role.Name)
+	}
+
+	created := cloneRole(role)
+	created.Deleted = false
+	s.customRoles[created.Name] = created
+	s.customRoleIndex = customRoleIndexOf(s.customRoles)
+	s.reindexPolicies()
+	s.persist()
+	return cloneRole(created), nil
+}
+
+// GetRole returns the custom role with the given name or, failing that, the
+// predefined role.
+func (s *Storage) GetRole(name string) (*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if role, exists := s.customRoles[name]; exists {
+		return cloneRole(role), nil
+	}
+	if def, exists := builtInRoleDefinitions()[name]; exists {
+		return builtInRoleToRole(def), nil
+	}
+	return nil, fmt.Errorf("role not found: %s", name)
+}
+
+// ListRoles returns the roles defined under parent sorted by name: the
+// custom roles of a project or organization (parent projects/{p} or
+// organizations/{o}), or the predefined roles when parent is empty.
+// Deleted roles are only included when showDeleted is set.
+func (s *Storage) ListRoles(parent string, showDeleted bool) []*Role {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := []*Role{}
+	if parent == "" {
+		for _, def := range builtInRoleDefinitions() {
+			roles = append(roles, builtInRoleToRole(def))
+		}
+	} else {
+		prefix := parent + "/roles/"
+		for name, role := range s.customRoles {
+			if strings.HasPrefix(name, prefix) && (showDeleted || !role.Deleted) {
+				roles = append(roles, cloneRole(role))
+			}
+		}
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
+
+// UpdateRole copies the named fields (RoleField*) of update onto the custom
+// role name. Deleted roles cannot be updated.
+func (s *Storage) UpdateRole(name string, update *Role, fields []string) (*Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.customRoles[name]
+	if !exists {
+		return nil, fmt.Errorf("role not found: %s", name)
+	}
+	if existing.Deleted {
+		return nil, fmt.Errorf("role is deleted: %s", name)
+	}
+
+	updated := cloneRole(existing)
+	for _, field := range fields {
+		switch field {
+		case RoleFieldTitle:
+			updated.Title = update.Title
+		case RoleFieldDescription:
+			updated.Description = update.Description
+		case RoleFieldIncludedPermissions:
+			updated.IncludedPermissions = append([]string(nil), update.IncludedPermissions...)
+		case RoleFieldStage:
+			updated.Stage = update.Stage
+		default:
+			return nil, fmt.Errorf("invalid role field: %s", field)
+		}
+	}
+
+	s.customRoles[name] = updated
+	s.customRoleIndex = customRoleIndexOf(s.customRoles)
+	s.reindexPolicies()
+	s.persist()
+	return cloneRole(updated), nil
+}
+
+// DeleteRole marks the custom role name deleted. Bindings to it stay in
+// place but stop granting its permissions.
+func (s *Storage) DeleteRole(name string) (*Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.customRoles[name]
+	if !exists {
+		return nil, fmt.Errorf("role not found: %s", name)
+	}
+	if existing.Deleted {
+		return nil, fmt.Errorf("role is deleted: %s", name)
+	}
+
+	deleted := cloneRole(existing)
+	deleted.Deleted = true
+	s.customRoles[name] = deleted
+	s.customRoleIndex = customRoleIndexOf(s.customRoles)
+	s.reindexPolicies()
+	s.persist()
+	return cloneRole(deleted), nil
+}
+
+func cloneRole(role *Role) *Role {
+	clone := *role
+	clone.IncludedPermissions = append([]string(nil), role.IncludedPermissions...)
+	return &clone
+}
+
+func builtInRoleToRole(def builtInRole) *Role {
+	return &Role{
+		Name:                def.Name,
+		Title:               def.Title,
+		Description:         def.Description,
+		IncludedPermissions: append([]string(nil), def.IncludedPermissions...),
+		Stage:               def.Stage,
+	}
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Key types, matching the admin API's key type filter values.
+const (
+	KeyTypeUserManaged   = "USER_MANAGED"
+	KeyTypeSystemManaged = "SYSTEM_MANAGED"
+)
+
+// keyValidBefore matches the expiry GCP reports for user-managed keys.
+var keyValidBefore = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// CreateServiceAccountKey generates an RSA-2048 key for the account named by
+// accountName (looked up as in GetServiceAccount). The private key is stored
+// as a PKCS#8 PEM block and the public key as a self-signed X.509 certificate,
+// matching what GCP hands out for user-managed keys.
+func (s *Storage) CreateServiceAccountKey(accountName string) (*ServiceAccount, *ServiceAccountKey, error) {
+	return s.createServiceAccountKey(accountName, KeyTypeUserManaged)
+}
+
+func (s *Storage) createServiceAccountKey(accountName, keyType string) (*ServiceAccount, *ServiceAccountKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.findServiceAccount(accountName)
+	if account == nil {
+		return nil, nil, fmt.Errorf("service account not found: %s", accountName)
+	}
+
+	account.NextKeyID++
+	keyID := fmt.Sprintf("%040x", account.NextKeyID)
+	createTime := time.Now()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(account.NextKeyID),
+		Subject:      pkix.Name{CommonName: account.Email},
+		NotBefore:    createTime,
+		NotAfter:     keyValidBefore,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	key := &ServiceAccountKey{
+		Name:        fmt.Sprintf("%s/keys/%s", account.Name, keyID),
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		PublicKey:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		CreateTime:  createTime,
+		ValidBefore: keyValidBefore,
+		KeyType:     keyType,
+	}
+
+	account.Keys[keyID] = key
+	s.persist()
+	return account, key, nil
+}
+
+// ListServiceAccountKeys returns metadata for an account's keys, sorted by
+// name, without private key material. If keyTypes is non-empty only keys of
+// those types are returned.
+func (s *Storage) ListServiceAccountKeys(accountName string, keyTypes []string) ([]*ServiceAccountKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account := s.findServiceAccount(accountName)
+	if account == nil {
+		return nil, fmt.Errorf("service account not found: %s", accountName)
+	}
+
+	wanted := make(map[string]bool, len(keyTypes))
+	for _, keyType := range keyTypes {
+		wanted[keyType] = true
+	}
+
+	keys := []*ServiceAccountKey{}
+	for _, key := range account.Keys {
+		if len(wanted) > 0 && !wanted[key.KeyType] {
+			continue
+		}
+		metadata := *key
+		metadata.PrivateKey = nil
+		keys = append(keys, &metadata)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// DeleteServiceAccountKey removes the key named
+// projects/{project}/serviceAccounts/{account}/keys/{key}, where the account
+// is resolved as in GetServiceAccount.
+func (s *Storage) DeleteServiceAccountKey(keyName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accountName, keyID, ok := strings.Cut(keyName, "/keys/")
+	if !ok || keyID == "" {
+		return fmt.Errorf("service account key not found: %s", keyName)
+	}
+
+	account := s.findServiceAccount(accountName)
+	if account == nil {
+		return fmt.Errorf("service account not found: %s", accountName)
+	}
+
+	if _, exists := account.Keys[keyID]; !exists {
+		return fmt.Errorf("service account key not found: %s", keyName)
+	}
+
+	delete(account.Keys, keyID)
+	s.persist()
+	return nil
+}
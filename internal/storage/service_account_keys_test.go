@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestCreateServiceAccountKey(t *testing.T) {
+	s := NewStorage()
+
+	account, err := s.CreateServiceAccount("test", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	_, key, err := s.CreateServiceAccountKey(account.Email)
+	if err == nil {
+		t.Fatalf("Expected bare email to be rejected, got key %s", key.Name)
+	}
+
+	_, first, err := s.CreateServiceAccountKey(account.Name)
+	if err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+	_, second, err := s.CreateServiceAccountKey("projects/-/serviceAccounts/" + account.UniqueID)
+	if err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+
+	if first.Name != account.Name+"/keys/0000000000000000000000000000000000000001" {
+		t.Errorf("Unexpected first key name: %s", first.Name)
+	}
+	if !strings.HasSuffix(second.Name, "/keys/0000000000000000000000000000000000000002") {
+		t.Errorf("Unexpected second key name: %s", second.Name)
+	}
+	if len(account.Keys) != 2 || account.NextKeyID != 2 {
+		t.Errorf("Expected 2 stored keys and NextKeyID 2, got %d and %d", len(account.Keys), account.NextKeyID)
+	}
+	if first.KeyType != "USER_MANAGED" {
+		t.Errorf("Expected USER_MANAGED, got %s", first.KeyType)
+	}
+
+	privateBlock, _ := pem.Decode(first.PrivateKey)
+	if privateBlock == nil {
+		t.Fatal("Expected PEM private key")
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse private key: %v", err)
+	}
+
+	certBlock, _ := pem.Decode(first.PublicKey)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		t.Fatal("Expected PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	if !privateKey.(*rsa.PrivateKey).PublicKey.Equal(cert.PublicKey) {
+		t.Error("Expected certificate to hold the key's public half")
+	}
+	if cert.Subject.CommonName != account.Email {
+		t.Errorf("Expected certificate subject %s, got %s", account.Email, cert.Subject.CommonName)
+	}
+}
+
+func TestServiceAccountKeys_RoundTrip(t *testing.T) {
+	s := NewStorage()
+
+	account, err := s.CreateServiceAccount("test", "ci-runner", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	_, created, err := s.CreateServiceAccountKey(account.Name)
+	if err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+	account.Keys["system"] = &ServiceAccountKey{Name: account.Name + "/keys/system", KeyType: KeyTypeSystemManaged}
+
+	keys, err := s.ListServiceAccountKeys(account.Name, nil)
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(keys))
+	}
+	for _, key := range keys {
+		if key.PrivateKey != nil {
+			t.Errorf("Expected %s to be listed without private key material", key.Name)
+		}
+	}
+	if account.Keys[strings.TrimPrefix(created.Name, account.Name+"/keys/")].PrivateKey == nil {
+		t.Error("Expected listing not to strip the stored private key")
+	}
+
+	userKeys, err := s.ListServiceAccountKeys(account.Name, []string{KeyTypeUserManaged})
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(userKeys) != 1 || userKeys[0].Name != created.Name {
+		t.Errorf("Expected only the user-managed key, got %v", userKeys)
+	}
+
+	systemKeys, err := s.ListServiceAccountKeys(account.Name, []string{KeyTypeSystemManaged})
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(systemKeys) != 1 || systemKeys[0].KeyType != KeyTypeSystemManaged {
+		t.Errorf("Expected only the system-managed key, got %v", systemKeys)
+	}
+
+	if err := s.DeleteServiceAccountKey(created.Name); err != nil {
+		t.Fatalf("DeleteServiceAccountKey failed: %v", err)
+	}
+	if err := s.DeleteServiceAccountKey(created.Name); err == nil {
+		t.Error("Expected deleting a deleted key to fail")
+	}
+
+	userKeys, err = s.ListServiceAccountKeys(account.Name, []string{KeyTypeUserManaged})
+	if err != nil {
+		t.Fatalf("ListServiceAccountKeys failed: %v", err)
+	}
+	if len(userKeys) != 0 {
+		t.Errorf("Expected no user-managed keys after delete, got %v", userKeys)
+	}
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *Storage) CreateServiceAccount(projectID, accountID, displayName, description string) (*ServiceAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", accountID, projectID)
+	name := fmt.Sprintf("projects/%s/serviceAccounts/%s", projectID, email)
+	if _, exists := s.serviceAccounts[name]; exists {
+		return nil, fmt.Errorf("service account already exists: %s", name)
+	}
+
+	account := &ServiceAccount{
+		Name:        name,
+		Email:       email,
+		ProjectID:   projectID,
+		UniqueID:    serviceAccountUniqueID(email),
+		DisplayName: displayName,
+		Description: description,
+		CreateTime:  time.Now(),
+		Keys:        make(map[string]*ServiceAccountKey),
+	}
+
+	s.serviceAccounts[name] = account
+	s.persist()
+	return account, nil
+}
+
+// ServiceAccountSpec describes a service account seeded from config.
+type ServiceAccountSpec struct {
+	ProjectID   string
+	AccountID   string
+	DisplayName string
+	Description string
+}
+
+// LoadServiceAccounts creates each account in specs that doesn't exist yet and
+// refreshes the display name and description of those that do, keeping their
+// keys and creation time, so reloading the same config is idempotent.
+// Existing accounts not in specs are left alone.
+func (s *Storage) LoadServiceAccounts(specs []ServiceAccountSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, spec := range specs {
+		email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", spec.AccountID, spec.ProjectID)
+		name := fmt.Sprintf("projects/%s/serviceAccounts/%s", spec.ProjectID, email)
+
+		// Store an updated copy rather than editing the account in place,
+		// since callers may still hold the old one
+		if account, exists := s.serviceAccounts[name]; exists {
+			updated := *account
+			updated.DisplayName = spec.DisplayName
+			updated.Description = spec.Description
+			s.serviceAccounts[name] = &updated
+			continue
+		}
+
+		s.serviceAccounts[name] = &ServiceAccount{
+			Name:        name,
+			Email:       email,
+			ProjectID:   spec.ProjectID,
+			UniqueID:    serviceAccountUniqueID(email),
+			DisplayName: spec.DisplayName,
+			Description: spec.Description,
+			CreateTime:  time.Now(),
+			Keys:        make(map[string]*ServiceAccountKey),
+		}
+	}
+	s.persist()
+}
+
+// GetServiceAccount looks up an account by resource name. As in GCP, the name
+// is projects/{project}/serviceAccounts/{email or uniqueId}, and the project
+// may be the "-" wildcard. The account returned is a copy.
+func (s *Storage) GetServiceAccount(name string) (*ServiceAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account := s.findServiceAccount(name)
+	if account == nil {
+		return nil, fmt.Errorf("service account not found: %s", name)
+	}
+
+	return copyServiceAccount(account), nil
+}
+
+// ListServiceAccounts returns copies of the accounts in a project sorted by
+// email, so callers can page through them deterministically.
+func (s *Storage) ListServiceAccounts(projectID string) []*ServiceAccount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := []*ServiceAccount{}
+	for _, account := range s.serviceAccounts {
+		if account.ProjectID == projectID {
+			accounts = append(accounts, copyServiceAccount(account))
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Email < accounts[j].Email })
+	return accounts
+}
+
+// DeleteServiceAccount removes an account, looked up as in GetServiceAccount.
+// Unless purging is disabled, the account's member is also stripped from
+// every stored policy, dropping bindings left without members.
+func (s *Storage) DeleteServiceAccount(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.findServiceAccount(name)
+	if account == nil {
+		return fmt.Errorf("service account not found: %s", name)
+	}
+
+	delete(s.serviceAccounts, account.Name)
+
+	if s.purgeDeletedMembers {
+		s.removeMember("serviceAccount:" + account.Email)
+	}
+	s.persist()
+	return nil
+}
+
+// removeMember strips member from every binding. Policies it changes are
+// replaced with new values rather than edited, since GetIamPolicy callers may
+// still hold the stored ones. It requires s.mu to be held.
+func (s *Storage) removeMember(member string) {
+	for resource, policy := range s.policies {
+		if !policyHasMember(policy, member) {
+			continue
+		}
+
+		updated := proto.Clone(policy).(*iampb.Policy)
+		bindings := make([]*iampb.Binding, 0, len(updated.Bindings))
+		for _, binding := range updated.Bindings {
+			members := make([]string, 0, len(binding.Members))
+			for _, m := range binding.Members {
+				if !sameMember(m, member) {
+					members = append(members, m)
+				}
+			}
+			binding.Members = members
+
+			if len(binding.Members) > 0 {
+				bindings = append(bindings, binding)
+			}
+		}
+		updated.Bindings = bindings
+		updated.Etag = s.generateEtag(updated)
+
+		s.policies[resource] = updated
+	}
+	s.reindexPolicies()
+}
+
+func policyHasMember(policy *iampb.Policy, member string) bool {
+	for _, binding := range policy.Bindings {
+		for _, m := range binding.Members {
+			if sameMember(m, member) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Storage) findServiceAccount(name string) *ServiceAccount {
+	if account, exists := s.serviceAccounts[name]; exists {
+		return account
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "serviceAccounts" {
+		return nil
+	}
+	project, id := parts[1], parts[3]
+
+	for _, account := range s.serviceAccounts {
+		if project != "-" && project != account.ProjectID {
+			continue
+		}
+		if id == account.Email || id == account.UniqueID {
+			return account
+		}
+	}
+
+	return nil
+}
+
+// copyServiceAccount returns a copy of account, including its key map, that
+// callers can read without holding s.mu.
+func copyServiceAccount(account *ServiceAccount) *ServiceAccount {
+	copied := *account
+	copied.Keys = make(map[string]*ServiceAccountKey, len(account.Keys))
+	for keyID, key := range account.Keys {
+		copied.Keys[keyID] = key
+	}
+	return &copied
+}
+
+// serviceAccountUniqueID derives a stable 21-digit numeric ID from the email
+// so the same config always produces the same IDs.
+func serviceAccountUniqueID(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return fmt.Sprintf("1%020d", binary.BigEndian.Uint64(sum[:8]))
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// State is the emulator state written by Snapshot, read by Restore and kept
+// by a Backend. Settings such as strict mode are configuration, not state,
+// and are not included.
+type State struct {
+	Policies        map[string]*iampb.Policy     `json:"policies"`
+	DenyPolicies    map[string][]DenyRule        `json:"denyPolicies"`
+	Groups          map[string][]string          `json:"groups"`
+	CustomRoles     map[string]*Role             `json:"customRoles"`
+	ResourceParents map[string]string            `json:"resourceParents"`
+	ResourceLabels  map[string]map[string]string `json:"resourceLabels"`
+	Projects        map[string]*Project          `json:"projects"`
+	ServiceAccounts map[string]*ServiceAccount   `json:"serviceAccounts"`
+}
+
+// policyJSON encodes a policy with protojson, as the REST API does.
+// encoding/json would write proto field names and numeric enums (audit_configs,
+// "log_type": 1). protojson also accepts those, so snapshots and databases
+// written before policies used protojson still load.
+type policyJSON struct {
+	*iampb.Policy
+}
+
+func (p policyJSON) MarshalJSON() ([]byte, error) {
+	return protojson.Marshal(p.Policy)
+}
+
+func (p *policyJSON) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	p.Policy = &iampb.Policy{}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, p.Policy)
+}
+
+func toPolicyJSON(policies map[string]*iampb.Policy) map[string]policyJSON {
+	encoded := make(map[string]policyJSON, len(policies))
+	for resource, policy := range policies {
+		encoded[resource] = policyJSON{policy}
+	}
+	return encoded
+}
+
+func fromPolicyJSON(encoded map[string]policyJSON) map[string]*iampb.Policy {
+	if encoded == nil {
+		return nil
+	}
+	policies := make(map[string]*iampb.Policy, len(encoded))
+	for resource, policy := range encoded {
+		policies[resource] = policy.Policy
+	}
+	return policies
+}
+
+// snapshotJSON is State as written by Snapshot: its policies field shadows
+// State.Policies so policies go through protojson while everything else
+// stays plain encoding/json.
+type snapshotJSON struct {
+	*State
+	Policies map[string]policyJSON `json:"policies"`
+}
+
+// Snapshot writes every policy, deny policy, group, custom role, resource
+// parent, resource label set, project and service account to w as JSON, for
+// Restore to load back.
+func (s *Storage) Snapshot(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	state := s.state()
+	if err := encoder.Encode(snapshotJSON{State: state, Policies: toPolicyJSON(state.Policies)}); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces all state with a snapshot written by Snapshot. The snapshot
+// is decoded before the write lock is taken, so a malformed snapshot leaves the
+// current state untouched and readers never observe a partial restore.
+func (s *Storage) Restore(r io.Reader) error {
+	snapshot := snapshotJSON{State: &State{}}
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	state := snapshot.State
+	state.Policies = fromPolicyJSON(snapshot.Policies)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applyState(state)
+	s.persist()
+	return nil
+}
+
+// state returns the current state. The maps are shared with s, so it must
+// only be used while s.mu is held.
+func (s *Storage) state() *State {
+	return &State{
+		Policies:        s.policies,
+		DenyPolicies:    s.denyPolicies,
+		Groups:          s.groups,
+		CustomRoles:     s.customRoles,
+		ResourceParents: s.resourceParents,
+		ResourceLabels:  s.resourceLabels,
+		Projects:        s.projects,
+		ServiceAccounts: s.serviceAccounts,
+	}
+}
+
+// applyState replaces all state with state, taking ownership of its maps.
+// Requires s.mu to be held for writing.
+func (s *Storage) applyState(state *State) {
+	if state.Policies == nil {
+		state.Policies = make(map[string]*iampb.Policy)
+	}
+	if state.DenyPolicies == nil {
+		state.DenyPolicies = make(map[string][]DenyRule)
+	}
+	if state.Groups == nil {
+		state.Groups = make(map[string][]string)
+	}
+	if state.CustomRoles == nil {
+		state.CustomRoles = make(map[string]*Role)
+	}
+	for name, role := range state.CustomRoles {
+		if role == nil {
+			state.CustomRoles[name] = &Role{Name: name}
+		} else if role.Name == "" {
+			role.Name = name
+		}
+	}
+	if state.ResourceParents == nil {
+		state.ResourceParents = make(map[string]string)
+	}
+	if state.ResourceLabels == nil {
+		state.ResourceLabels = make(map[string]map[string]string)
+	}
+	if state.Projects == nil {
+		state.Projects = make(map[string]*Project)
+	}
+	if state.ServiceAccounts == nil {
+		state.ServiceAccounts = make(map[string]*ServiceAccount)
+	}
+	for _, account := range state.ServiceAccounts {
+		if account != nil && account.Keys == nil {
+			account.Keys = make(map[string]*ServiceAccountKey)
+		}
+	}
+
+	s.policies = state.Policies
+	s.denyPolicies = state.DenyPolicies
+	s.groups = state.Groups
+	s.setCustomRoles(state.CustomRoles)
+	s.resourceParents = state.ResourceParents
+	s.resourceLabels = state.ResourceLabels
+	s.projects = state.Projects
+	s.serviceAccounts = state.ServiceAccounts
+	s.reindexPolicies()
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+func TestSnapshotRestore_RoundTrip(t *testing.T) {
+	s := NewStorage()
+	s.LoadGroups(map[string][]string{
+		"engineering": {"user:dana@example.com"},
+	})
+	s.LoadCustomRoles(map[string][]string{
+		"roles/custom.reader": {"secretmanager.versions.access"},
+	})
+	s.SetResourceParent("projects/test", "folders/123")
+	s.SetResourceLabels("projects/test/secrets/db", map[string]string{"env": "prod"})
+	if _, err := s.CreateProject("test", ""); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if _, err := s.CreateServiceAccount("test", "ci", "CI", ""); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/custom.reader", Members: []string{"group:engineering"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	before, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	s.Clear()
+	if allowed, _ := s.TestIamPermissions("projects/test/secrets/db", "user:dana@example.com", []string{"secretmanager.versions.access"}, false); len(allowed) != 0 {
+		t.Fatalf("Expected Clear to remove the grant, got %v", allowed)
+	}
+
+	if err := s.Restore(&buf); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	after, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(after.Bindings) != 1 || after.Bindings[0].Role != "roles/custom.reader" {
+		t.Errorf("Expected the policy to survive the round trip, got %v", after.Bindings)
+	}
+	if !bytes.Equal(after.Etag, before.Etag) {
+		t.Errorf("Expected etag %q to be preserved, got %q", before.Etag, after.Etag)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test/secrets/db", "user:dana@example.com", []string{"secretmanager.versions.access"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected groups and custom roles to be restored, got %v", allowed)
+	}
+
+	if _, err := s.GetProject("projects/test"); err != nil {
+		t.Errorf("Expected project to be restored: %v", err)
+	}
+	if accounts := s.ListServiceAccounts("test"); len(accounts) != 1 {
+		t.Errorf("Expected 1 restored service account, got %d", len(accounts))
+	}
+	if inherited := s.resourceHierarchy("projects/test"); len(inherited) != 2 || inherited[1] != "folders/123" {
+		t.Errorf("Expected resource parent to be restored, got %v", inherited)
+	}
+	if labels := s.resourceLabels["projects/test/secrets/db"]; labels["env"] != "prod" {
+		t.Errorf("Expected resource labels to be restored, got %v", labels)
+	}
+}
+
+func TestRestore_InvalidSnapshotKeepsState(t *testing.T) {
+	s := NewStorage()
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	if err := s.Restore(strings.NewReader(`{"policies": [`)); err == nil {
+		t.Fatal("Expected an error for a malformed snapshot")
+	}
+
+	policy, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 {
+		t.Errorf("Expected state to be untouched, got %v", policy.Bindings)
+	}
+}
+
+func TestRestore_LegacyCustomRoles(t *testing.T) {
+	s := NewStorage()
+
+	// Snapshots taken before roles had metadata stored each custom role as
+	// a bare permission list
+	legacy := `{"customRoles": {"roles/custom.reader": ["secretmanager.versions.access"]}}`
+	if err := s.Restore(strings.NewReader(legacy)); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	role, err := s.GetRole("roles/custom.reader")
+	if err != nil {
+		t.Fatalf("GetRole failed: %v", err)
+	}
+	if role.Name != "roles/custom.reader" || len(role.IncludedPermissions) != 1 || role.IncludedPermissions[0] != "secretmanager.versions.access" {
+		t.Errorf("Expected the legacy role to be restored, got %+v", role)
+	}
+}
+
+func TestSnapshot_PoliciesUseProtoJSON(t *testing.T) {
+	s := NewStorage()
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+		},
+		AuditConfigs: []*iampb.AuditConfig{
+			{
+				Service:         "allServices",
+				AuditLogConfigs: []*iampb.AuditLogConfig{{LogType: iampb.AuditLogConfig_DATA_READ}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	snapshot := buf.String()
+	if !strings.Contains(snapshot, `"auditConfigs"`) || !strings.Contains(snapshot, `"DATA_READ"`) {
+		t.Errorf("Expected GCP JSON field names and enum strings, got %s", snapshot)
+	}
+
+	restored := NewStorage()
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	policy, err := restored.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.AuditConfigs) != 1 || policy.AuditConfigs[0].AuditLogConfigs[0].LogType != iampb.AuditLogConfig_DATA_READ {
+		t.Errorf("Expected audit configs to survive the round trip, got %v", policy.AuditConfigs)
+	}
+}
+
+func TestRestore_LegacyPolicies(t *testing.T) {
+	s := NewStorage()
+
+	// Snapshots taken before policies used protojson have proto field names
+	// and numeric enums
+	legacy := `{"policies": {"projects/test": {"version": 1, "bindings": [{"role": "roles/viewer", "members": ["user:alice@example.com"]}], "audit_configs": [{"service": "allServices", "audit_log_configs": [{"log_type": 2}]}]}}}`
+	if err := s.Restore(strings.NewReader(legacy)); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 || len(policy.AuditConfigs) != 1 || policy.AuditConfigs[0].AuditLogConfigs[0].LogType != iampb.AuditLogConfig_DATA_WRITE {
+		t.Errorf("Expected the legacy policy to be restored, got %v", policy)
+	}
+}
@@ -1,60 +1,120 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/protobuf/proto"
 )
 
+// ErrEtagMismatch is returned by SetIamPolicy when the caller's etag does not
+// match the stored policy, i.e. the policy changed since the caller read it.
+var ErrEtagMismatch = errors.New("etag does not match current policy")
+
+// ErrInvalidRole is returned by SetIamPolicy for a binding whose role is empty
+// or not of the form roles/..., projects/{p}/roles/... or
+// organizations/{o}/roles/... (unless unknown roles are allowed).
+var ErrInvalidRole = errors.New("invalid role")
+
 type Storage struct {
-	mu               sync.RWMutex
-	projects         map[string]*Project
-	serviceAccounts  map[string]*ServiceAccount
-	policies         map[string]*iampb.Policy
-	groups           map[string][]string
-	customRoles      map[string][]string
-	allowUnknownRoles bool
+	mu              sync.RWMutex
+	projects        map[string]*Project
+	serviceAccounts map[string]*ServiceAccount
+	policies        map[string]*iampb.Policy
+	groups          map[string][]string
+	customRoles     map[string]*Role
+	builtInRoles    map[string][]string
+	// customRoleIndex and builtInRoleIndex hold the same permissions as
+	// customRoles and builtInRoles as sets; see roleGrants
+	customRoleIndex  map[string]map[string]bool
+	builtInRoleIndex map[string]map[string]bool
+	// policyIndexes holds a policyIndex per entry of policies, rebuilt on
+	// every write that affects permission checks
+	policyIndexes map[string]*policyIndex
+	// backend, when set, receives the full state after every write
+	backend                    Backend
+	denyPolicies               map[string][]DenyRule
+	attachmentPoints           map[string]bool
+	resourceParents            map[string]string
+	normalizeMembers           bool
+	allowUnknownRoles          bool
+	unsupportedConditionPolicy UnsupportedConditionPolicy
+	strictConditions           bool
+	publicGrantPolicy          PublicGrantPolicy
+	purgeDeletedMembers        bool
+	additiveInheritance        bool
+	matchDeletedMembers        bool
+	maxPolicyMembers           int
+	maxPolicyBindings          int
+	// resourceLabels holds each resource's labels for resource.labels
+	// conditions
+	resourceLabels map[string]map[string]string
+	// now supplies request.time for condition evaluation
+	now func() time.Time
 }
 
 type Project struct {
-	Name       string
-	CreateTime time.Time
+	Name        string
+	DisplayName string
+	CreateTime  time.Time
 }
 
 type ServiceAccount struct {
 	Name        string
 	Email       string
 	ProjectID   string
+	UniqueID    string
 	DisplayName string
 	Description string
+	Disabled    bool
 	CreateTime  time.Time
 	Keys        map[string]*ServiceAccountKey
 	NextKeyID   int64
 }
 
 type ServiceAccountKey struct {
-	Name       string
-	PrivateKey []byte
-	PublicKey  []byte
-	CreateTime time.Time
-	KeyType    string
+	Name        string
+	PrivateKey  []byte
+	PublicKey   []byte
+	CreateTime  time.Time
+	ValidBefore time.Time
+	KeyType     string
 }
 
 func NewStorage() *Storage {
 	return &Storage{
-		projects:          make(map[string]*Project),
-		serviceAccounts:   make(map[string]*ServiceAccount),
-		policies:          make(map[string]*iampb.Policy),
-		groups:            make(map[string][]string),
-		customRoles:       make(map[string][]string),
-		allowUnknownRoles: false,
+		projects:                   make(map[string]*Project),
+		serviceAccounts:            make(map[string]*ServiceAccount),
+		policies:                   make(map[string]*iampb.Policy),
+		policyIndexes:              make(map[string]*policyIndex),
+		groups:                     make(map[string][]string),
+		customRoles:                make(map[string]*Role),
+		customRoleIndex:            make(map[string]map[string]bool),
+		builtInRoles:               builtInRolePermissions(),
+		builtInRoleIndex:           builtInRolePermissionIndex(),
+		denyPolicies:               make(map[string][]DenyRule),
+		resourceParents:            make(map[string]string),
+		resourceLabels:             make(map[string]map[string]string),
+		allowUnknownRoles:          false,
+		unsupportedConditionPolicy: UnsupportedConditionDeny,
+		strictConditions:           true,
+		publicGrantPolicy:          PublicGrantWarn,
+		purgeDeletedMembers:        true,
+		additiveInheritance:        true,
+		maxPolicyMembers:           DefaultMaxPolicyMembers,
+		maxPolicyBindings:          DefaultMaxPolicyBindings,
+		now:                        time.Now,
 	}
 }
 
@@ -62,9 +122,157 @@ func (s *Storage) SetAllowUnknownRoles(allow bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.allowUnknownRoles = allow
+	s.reindexPolicies()
+}
+
+// SetNormalizeMembers lowercases the email portion of members when policies
+// are written, so GetIamPolicy returns canonical members.
+func (s *Storage) SetNormalizeMembers(normalize bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.normalizeMembers = normalize
+}
+
+// SetAttachmentPoints restricts the inheritance walk to ancestors whose
+// collection segment (e.g. "projects", "keyRings") is listed. An empty list
+// restores the default of treating every ancestor as attachable.
+func (s *Storage) SetAttachmentPoints(collections []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attachmentPoints = make(map[string]bool, len(collections))
+	for _, collection := range collections {
+		s.attachmentPoints[collection] = true
+	}
+}
+
+// SetResourceParent registers parent (e.g. folders/123 or
+// organizations/456) as the hierarchy parent of child (e.g. projects/p or
+// folders/123), so policies on parent are inherited by child and everything
+// under it.
+func (s *Storage) SetResourceParent(child, parent string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resourceParents[normalizeResource(child)] = normalizeResource(parent)
+	s.persist()
+}
+
+// LoadResourceParents registers each child -> parent entry in parents, on top
+// of any parents already registered.
+func (s *Storage) LoadResourceParents(parents map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for child, parent := range parents {
+		s.resourceParents[normalizeResource(child)] = normalizeResource(parent)
+	}
+	s.persist()
+}
+
+// SetResourceLabels replaces the labels of resource that conditions read as
+// resource.labels. Empty labels remove them.
+func (s *Storage) SetResourceLabels(resource string, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setResourceLabels(normalizeResource(resource), labels)
+	s.persist()
+}
+
+// LoadResourceLabels sets the labels of each resource in labels, leaving other
+// resources' labels in place.
+func (s *Storage) LoadResourceLabels(labels map[string]map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for resource, resourceLabels := range labels {
+		s.setResourceLabels(normalizeResource(resource), resourceLabels)
+	}
+	s.persist()
+}
+
+// setResourceLabels stores a copy of labels. Requires s.mu to be held for
+// writing.
+func (s *Storage) setResourceLabels(resource string, labels map[string]string) {
+	if len(labels) == 0 {
+		delete(s.resourceLabels, resource)
+		return
+	}
+
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	s.resourceLabels[resource] = copied
+}
+
+func (s *Storage) SetUnsupportedConditionPolicy(policy UnsupportedConditionPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsupportedConditionPolicy = policy
+}
+
+// SetPurgeDeletedMembers controls whether DeleteServiceAccount also removes
+// the account from every policy binding (the default). GCP instead keeps such
+// orphaned bindings.
+func (s *Storage) SetPurgeDeletedMembers(purge bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeDeletedMembers = purge
+}
+
+// SetMatchDeletedMembers controls whether deleted: binding members still
+// match the identity they name. By default they match nobody, since the
+// identity no longer exists.
+func (s *Storage) SetMatchDeletedMembers(match bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.matchDeletedMembers = match
+}
+
+// SetAdditiveInheritance controls whether permission checks consider the
+// union of the policies on a resource and all its ancestors (the default, as
+// in GCP) or only the nearest policy, which then masks every ancestor.
+func (s *Storage) SetAdditiveInheritance(additive bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.additiveInheritance = additive
+}
+
+// SetPublicGrantPolicy controls whether SetIamPolicy rejects, or only logs,
+// policies granting broad roles to allUsers or allAuthenticatedUsers.
+func (s *Storage) SetPublicGrantPolicy(policy PublicGrantPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publicGrantPolicy = policy
+}
+
+// SetStrictConditions controls whether a binding condition that cannot be
+// evaluated is an error (the default): SetIamPolicy rejects it and
+// TestIamPermissions fails with a *ConditionError for one loaded from config.
+// Otherwise such conditions are stored and the unsupported condition policy
+// applies when they are checked.
+func (s *Storage) SetStrictConditions(strict bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strictConditions = strict
 }
 
-func (s *Storage) CreateProject(projectID string) (*Project, error) {
+// SetClock overrides the time used as request.time when evaluating
+// conditions, e.g. to test time-bound bindings deterministically. A nil
+// clock restores time.Now.
+func (s *Storage) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now == nil {
+		now = time.Now
+	}
+	s.now = now
+}
+
+func (s *Storage) CreateProject(projectID, displayName string) (*Project, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -74,11 +282,13 @@ func (s *Storage) CreateProject(projectID string) (*Project, error) {
 	}
 
 	project := &Project{
-		Name:       name,
-		CreateTime: time.Now(),
+		Name:        name,
+		DisplayName: displayName,
+		CreateTime:  time.Now(),
 	}
 
 	s.projects[name] = project
+	s.persist()
 	return project, nil
 }
 
@@ -94,10 +304,60 @@ func (s *Storage) GetProject(name string) (*Project, error) {
 	return project, nil
 }
 
+// ListProjects returns the projects whose ID starts with idPrefix (all
+// projects when it is empty), sorted by name.
+func (s *Storage) ListProjects(idPrefix string) []*Project {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	projects := []*Project{}
+	for name, project := range s.projects {
+		if strings.HasPrefix(strings.TrimPrefix(name, "projects/"), idPrefix) {
+			projects = append(projects, project)
+		}
+	}
+
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	return projects
+}
+
 func (s *Storage) SetIamPolicy(resource string, policy *iampb.Policy) (*iampb.Policy, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	resource = normalizeResource(resource)
+
+	policy, err := s.preparePolicy(resource, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	s.policies[resource] = policy
+	s.indexPolicy(resource)
+	s.persist()
+	return policy, nil
+}
+
+// ValidateIamPolicy runs every check SetIamPolicy makes and returns the policy,
+// version and etag included, that SetIamPolicy would store, without storing
+// it. The caller's policy is left unmodified.
+func (s *Storage) ValidateIamPolicy(resource string, policy *iampb.Policy) (*iampb.Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.preparePolicy(normalizeResource(resource), proto.Clone(policy).(*iampb.Policy))
+}
+
+// preparePolicy validates policy as a write to resource and canonicalizes it
+// in place: default version, normalized and deduplicated members, and a new
+// etag. Requires s.mu to be held.
+func (s *Storage) preparePolicy(resource string, policy *iampb.Policy) (*iampb.Policy, error) {
+	// An empty etag overwrites unconditionally; otherwise the write only
+	// succeeds against the policy the caller read
+	if len(policy.Etag) > 0 && !bytes.Equal(policy.Etag, s.currentEtag(resource)) {
+		return nil, fmt.Errorf("%w: %s", ErrEtagMismatch, resource)
+	}
+
 	if policy.Version == 0 {
 		policy.Version = 1
 	}
@@ -112,12 +372,71 @@ func (s *Storage) SetIamPolicy(resource string, policy *iampb.Policy) (*iampb.Po
 		}
 	}
 
-	policy.Etag = s.generateEtag(policy)
+	for _, binding := range policy.Bindings {
+		if err := s.validateRole(binding.Role); err != nil {
+			return nil, err
+		}
+	}
 
-	s.policies[resource] = policy
+	// Strict mode catches a malformed condition when it is written rather
+	// than at the first permission check that reaches it
+	if s.strictConditions || s.unsupportedConditionPolicy == UnsupportedConditionError {
+		for _, binding := range policy.Bindings {
+			if binding.Condition == nil {
+				continue
+			}
+			if err := validateCondition(binding.Condition); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := s.reportPublicGrants(FindPublicGrants(resource, policy)); err != nil {
+		return nil, err
+	}
+
+	if s.normalizeMembers {
+		normalizePolicyMembers(policy)
+	}
+	dedupePolicyBindings(policy)
+
+	if err := s.checkPolicyLimits(resource, policy); err != nil {
+		return nil, err
+	}
+
+	policy.Etag = s.generateEtag(policy)
 	return policy, nil
 }
 
+// validateRole rejects role strings that can never match a role definition.
+// Compat mode only requires the role to be non-empty.
+func (s *Storage) validateRole(role string) error {
+	if role == "" {
+		return fmt.Errorf("%w: binding role cannot be empty", ErrInvalidRole)
+	}
+	if s.allowUnknownRoles || isWellFormedRole(role) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q (must be roles/{name}, projects/{project}/roles/{name} or organizations/{org}/roles/{name})", ErrInvalidRole, role)
+}
+
+func isWellFormedRole(role string) bool {
+	parts := strings.Split(role, "/")
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+	}
+
+	switch len(parts) {
+	case 2:
+		return parts[0] == "roles"
+	case 4:
+		return (parts[0] == "projects" || parts[0] == "organizations") && parts[2] == "roles"
+	}
+	return false
+}
+
 func (s *Storage) generateEtag(policy *iampb.Policy) []byte {
 	data, _ := json.Marshal(policy)
 	hash := sha256.Sum256(data)
@@ -129,12 +448,18 @@ func (s *Storage) LoadPolicies(policies map[string]*iampb.Policy) {
 	defer s.mu.Unlock()
 
 	for resource, policy := range policies {
+		resource = normalizeResource(resource)
 		if policy.Version == 0 {
 			policy.Version = 1
 		}
+		if s.normalizeMembers {
+			normalizePolicyMembers(policy)
+		}
 		policy.Etag = s.generateEtag(policy)
 		s.policies[resource] = policy
+		s.indexPolicy(resource)
 	}
+	s.persist()
 }
 
 func (s *Storage) LoadGroups(groups map[string][]string) {
@@ -142,209 +467,461 @@ func (s *Storage) LoadGroups(groups map[string][]string) {
 	defer s.mu.Unlock()
 
 	s.groups = groups
+	s.reindexPolicies()
+	s.persist()
 }
 
 func (s *Storage) LoadCustomRoles(roles map[string][]string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.setCustomRoles(customRolesFromPermissions(roles))
+	s.reindexPolicies()
+	s.persist()
+}
+
+// setCustomRoles replaces the custom roles and their permission index.
+// Requires s.mu to be held for writing.
+func (s *Storage) setCustomRoles(roles map[string]*Role) {
 	s.customRoles = roles
+	s.customRoleIndex = customRoleIndexOf(roles)
+}
+
+// ReplaceAll atomically replaces every policy, deny policy, group, custom
+// role, resource parent and resource label set with those in state, as a
+// config reload does; projects and service accounts in state are ignored.
+// Each policy is first checked and canonicalized exactly as SetIamPolicy
+// would, in resource order; if any check fails the error is returned and
+// the previous state is left untouched. Policies set through the API since
+// the last load are discarded.
+func (s *Storage) ReplaceAll(state *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resources := make([]string, 0, len(state.Policies))
+	for resource := range state.Policies {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	replaced := make(map[string]*iampb.Policy, len(state.Policies)) //nolint:staticcheck // Using standard genproto package
+	for _, resource := range resources {
+		normalized := normalizeResource(resource)
+		policy, err := s.preparePolicy(normalized, proto.Clone(state.Policies[resource]).(*iampb.Policy))
+		if err != nil {
+			return fmt.Errorf("%s: %w", resource, err)
+		}
+		replaced[normalized] = policy
+	}
+
+	groups := state.Groups
+	if groups == nil {
+		groups = make(map[string][]string)
+	}
+	roles := state.CustomRoles
+	if roles == nil {
+		roles = make(map[string]*Role)
+	}
+
+	denyPolicies := make(map[string][]DenyRule, len(state.DenyPolicies))
+	for resource, rules := range state.DenyPolicies {
+		denyPolicies[normalizeResource(resource)] = rules
+	}
+	parents := make(map[string]string, len(state.ResourceParents))
+	for child, parent := range state.ResourceParents {
+		parents[normalizeResource(child)] = normalizeResource(parent)
+	}
+
+	s.policies = replaced
+	s.denyPolicies = denyPolicies
+	s.groups = groups
+	s.setCustomRoles(roles)
+	s.resourceParents = parents
+	s.resourceLabels = make(map[string]map[string]string, len(state.ResourceLabels))
+	for resource, labels := range state.ResourceLabels {
+		s.setResourceLabels(normalizeResource(resource), labels)
+	}
+	s.reindexPolicies()
+	s.persist()
+	return nil
 }
 
 func (s *Storage) GetIamPolicy(resource string) (*iampb.Policy, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	resource = normalizeResource(resource)
+
 	policy, exists := s.policies[resource]
 	if !exists {
-		return &iampb.Policy{
-			Bindings: []*iampb.Binding{},
-			Version:  1,
-		}, nil
+		// Resources without an allow policy (including those with only deny
+		// rules) still get a well-formed empty policy, as in GCP
+		return s.emptyPolicy(), nil
 	}
 
 	return policy, nil
 }
 
+// GetIamPolicyForVersion returns the policy for resource as seen by a caller
+// that understands policies up to requestedVersion. Below version 3,
+// conditional bindings are omitted, as in GCP, and the policy is reported as
+// version 1. The etag is unchanged.
+func (s *Storage) GetIamPolicyForVersion(resource string, requestedVersion int32) (*iampb.Policy, error) {
+	policy, err := s.GetIamPolicy(resource)
+	if err != nil || requestedVersion >= 3 || !hasConditionalBindings(policy) {
+		return policy, err
+	}
+
+	filtered := proto.Clone(policy).(*iampb.Policy)
+	filtered.Version = 1
+	unconditional := filtered.Bindings[:0]
+	for _, binding := range filtered.Bindings {
+		if binding.Condition == nil {
+			unconditional = append(unconditional, binding)
+		}
+	}
+	filtered.Bindings = unconditional
+	return filtered, nil
+}
+
+func hasConditionalBindings(policy *iampb.Policy) bool {
+	for _, binding := range policy.Bindings {
+		if binding.Condition != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Storage) emptyPolicy() *iampb.Policy {
+	empty := &iampb.Policy{
+		Bindings: []*iampb.Binding{},
+		Version:  1,
+	}
+	empty.Etag = s.generateEtag(empty)
+	return empty
+}
+
+// currentEtag returns the etag GetIamPolicy would report for resource.
+// Requires s.mu to be held.
+func (s *Storage) currentEtag(resource string) []byte {
+	if policy, exists := s.policies[resource]; exists {
+		return policy.Etag
+	}
+	return s.emptyPolicy().Etag
+}
+
+// MovePolicy relocates the allow policy attached to oldResource to
+// newResource, e.g. after a resource is renamed, and regenerates its etag.
+func (s *Storage) MovePolicy(oldResource, newResource string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldResource = normalizeResource(oldResource)
+	newResource = normalizeResource(newResource)
+
+	policy, exists := s.policies[oldResource]
+	if !exists {
+		return fmt.Errorf("policy not found: %s", oldResource)
+	}
+
+	if oldResource == newResource {
+		return nil
+	}
+
+	if _, exists := s.policies[newResource]; exists {
+		return fmt.Errorf("policy already exists: %s", newResource)
+	}
+
+	// Move a clone so callers still reading the old policy never see its
+	// etag change
+	moved := proto.Clone(policy).(*iampb.Policy)
+	moved.Etag = s.generateEtag(moved)
+	s.policies[newResource] = moved
+	delete(s.policies, oldResource)
+	s.indexPolicy(newResource)
+	s.indexPolicy(oldResource)
+	s.persist()
+	return nil
+}
+
+// InheritedBindings holds the bindings an ancestor resource contributes to a
+// descendant.
+type InheritedBindings struct {
+	Resource string           `json:"resource"`
+	Bindings []*iampb.Binding `json:"bindings"`
+}
+
+// GetInheritedBindings returns the bindings of every ancestor policy of a
+// resource, nearest ancestor first. The resource's own policy is excluded.
+func (s *Storage) GetInheritedBindings(resource string) []InheritedBindings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resource = normalizeResource(resource)
+
+	inherited := []InheritedBindings{}
+	for _, ancestor := range s.resourceHierarchy(resource)[1:] {
+		if policy, exists := s.policies[ancestor]; exists {
+			inherited = append(inherited, InheritedBindings{
+				Resource: ancestor,
+				Bindings: policy.Bindings,
+			})
+		}
+	}
+
+	return inherited
+}
+
+// PermissionResult is the decision for one permission in a
+// TestIamPermissionsDetailed call. Role and Member name the binding that
+// granted an allowed permission; Policy is the resource that binding is set
+// on. Reason explains the decision: the matched binding, the condition that
+// failed, or the deny rule that applied.
+type PermissionResult struct {
+	Permission string
+	Allowed    bool
+	Role       string
+	Member     string
+	Policy     string
+	Reason     string
+}
+
+// TestIamPermissions returns the subset of permissions principal holds on
+// resource.
 func (s *Storage) TestIamPermissions(resource string, principal string, permissions []string, trace bool) ([]string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	policy := s.resolvePolicy(resource)
-	if policy == nil {
-		if trace {
-			slog.Info("authz decision", "decision", "DENY", "resource", resource, "principal", principal, "reason", "no policy found")
+	resource = normalizeResource(resource)
+
+	// Tracing needs a reason per decision, which only full evaluation gives
+	if !trace {
+		policies := s.applicablePolicies(resource)
+		if len(policies) > 0 {
+			if allowed, indexed, err := s.indexedPermissions(resource, principal, permissions, policies, s.evalContext(resource)); indexed || err != nil {
+				return allowed, err
+			}
 		}
-		return []string{}, nil
 	}
 
-	evalCtx := EvalContext{
+	results, err := s.testIamPermissionsDetailed(resource, principal, permissions, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []string{}
+	for _, result := range results {
+		if result.Allowed {
+			allowed = append(allowed, result.Permission)
+		}
+	}
+	return allowed, nil
+}
+
+// TestIamPermissionsDetailed is TestIamPermissions that returns a result for
+// every requested permission, in order, recording why it was allowed or
+// denied. Results need full evaluation, so the permission index is never
+// used.
+func (s *Storage) TestIamPermissionsDetailed(resource string, principal string, permissions []string, trace bool) ([]PermissionResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.testIamPermissionsDetailed(normalizeResource(resource), principal, permissions, trace)
+}
+
+// evalContext returns the condition attributes of a check on resource,
+// without the per-permission ResourceService.
+// Requires s.mu to be held.
+func (s *Storage) evalContext(resource string) EvalContext {
+	return EvalContext{
 		ResourceName: resource,
 		ResourceType: extractResourceType(resource),
-		RequestTime:  time.Now(),
+		RequestTime:  s.now(),
+		Labels:       s.resourceLabels[resource],
 	}
+}
 
-	allowed := []string{}
-	for _, perm := range permissions {
-		decision, reason := s.hasPermission(policy, principal, perm, evalCtx, trace)
-		if decision {
-			allowed = append(allowed, perm)
-			if trace {
-				slog.Info("authz decision", "decision", "ALLOW", "resource", resource, "principal", principal, "permission", perm, "reason", reason)
+// testIamPermissionsDetailed evaluates every permission against the full
+// policies of a normalized resource.
+// Requires s.mu to be held.
+func (s *Storage) testIamPermissionsDetailed(resource string, principal string, permissions []string, trace bool) ([]PermissionResult, error) {
+	results := make([]PermissionResult, len(permissions))
+	for i, perm := range permissions {
+		results[i].Permission = perm
+	}
+
+	policies := s.applicablePolicies(resource)
+	if len(policies) == 0 {
+		if trace {
+			slog.Info("authz decision", "decision", "DENY", "resource", resource, "principal", principal, "reason", "no policy found")
+		}
+		for i := range results {
+			results[i].Reason = "no policy found"
+		}
+		return results, nil
+	}
+
+	evalCtx := s.evalContext(resource)
+	for i, perm := range permissions {
+		evalCtx.ResourceService = extractResourceService(resource, perm)
+		result := &results[i]
+
+		for j, attached := range policies {
+			match, err := s.matchBinding(attached.policy, principal, perm, evalCtx, trace)
+			if err != nil {
+				if trace {
+					slog.Info("authz decision", "decision", "ERROR", "resource", resource, "principal", principal, "permission", perm, "reason", match.reason)
+				}
+				return nil, err
+			}
+			if match.granted {
+				result.Allowed, result.Role, result.Member, result.Policy, result.Reason = true, match.role, match.member, attached.resource, match.reason
+				break
 			}
-		} else {
-			if trace {
-				slog.Info("authz decision", "decision", "DENY", "resource", resource, "principal", principal, "permission", perm, "reason", reason)
+			if j == 0 {
+				result.Reason = match.reason
+			}
+		}
+
+		if result.Allowed {
+			denied, denyReason, err := s.checkDenyRules(resource, principal, perm, evalCtx)
+			if err != nil {
+				if trace {
+					slog.Info("authz decision", "decision", "ERROR", "resource", resource, "principal", principal, "permission", perm, "reason", err.Error())
+				}
+				return nil, err
+			}
+			if denied {
+				*result = PermissionResult{Permission: perm, Reason: denyReason}
+			}
+		}
+		if trace {
+			if result.Allowed {
+				slog.Info("authz decision", "decision", "ALLOW", "resource", resource, "principal", principal, "permission", perm, "reason", result.Reason, "granted_by", result.Policy)
+			} else {
+				slog.Info("authz decision", "decision", "DENY", "resource", resource, "principal", principal, "permission", perm, "reason", result.Reason)
 			}
 		}
 	}
 
-	return allowed, nil
+	return results, nil
 }
 
-func (s *Storage) resolvePolicy(resource string) *iampb.Policy {
-	if policy, exists := s.policies[resource]; exists {
-		return policy
+// AllGranted reports whether every requested permission is in allowed, for
+// callers that need "has all of these" rather than the allowed subset.
+func AllGranted(requested, allowed []string) bool {
+	granted := make(map[string]bool, len(allowed))
+	for _, perm := range allowed {
+		granted[perm] = true
+	}
+
+	for _, perm := range requested {
+		if !granted[perm] {
+			return false
+		}
+	}
+	return true
+}
+
+// attachedPolicy is an allow policy together with the resource it is set on.
+type attachedPolicy struct {
+	resource string
+	policy   *iampb.Policy
+}
+
+// applicablePolicies returns the policies a permission check on resource
+// consults, nearest first: every policy on the resource and its ancestors
+// under additive inheritance, otherwise only the nearest one.
+func (s *Storage) applicablePolicies(resource string) []attachedPolicy {
+	if !s.additiveInheritance {
+		policy, policyResource := s.resolvePolicy(resource)
+		if policy == nil {
+			return nil
+		}
+		return []attachedPolicy{{resource: policyResource, policy: policy}}
+	}
+
+	var policies []attachedPolicy
+	for _, candidate := range s.resourceHierarchy(resource) {
+		if policy, exists := s.policies[candidate]; exists {
+			policies = append(policies, attachedPolicy{resource: candidate, policy: policy})
+		}
+	}
+	return policies
+}
+
+// resolvePolicy returns the policy governing resource and the resource it is
+// attached to: the resource itself or the nearest ancestor with a policy.
+func (s *Storage) resolvePolicy(resource string) (*iampb.Policy, string) {
+	for _, candidate := range s.resourceHierarchy(resource) {
+		if policy, exists := s.policies[candidate]; exists {
+			return policy, candidate
+		}
+	}
+
+	return nil, ""
+}
+
+// normalizeResource converts a full resource name such as
+// //secretmanager.googleapis.com/projects/p/secrets/s to the relative form
+// projects/p/secrets/s, so both resolve to the same stored policy.
+func normalizeResource(resource string) string {
+	if !strings.HasPrefix(resource, "//") {
+		return resource
+	}
+
+	_, relative, found := strings.Cut(strings.TrimPrefix(resource, "//"), "/")
+	if !found {
+		return resource
 	}
+	return relative
+}
+
+// resourceHierarchy returns the resource followed by each ancestor that may
+// hold a policy, nearest first: its path ancestors, then the chain of
+// registered parents of the top-level resource (e.g. project -> folder ->
+// organization). When attachment points are configured, only ancestors whose
+// collection segment is an attachment point are included.
+func (s *Storage) resourceHierarchy(resource string) []string {
+	chain := []string{resource}
 
 	parts := strings.Split(resource, "/")
 	for len(parts) > 2 {
 		parts = parts[:len(parts)-2]
-		parentResource := strings.Join(parts, "/")
-		if policy, exists := s.policies[parentResource]; exists {
-			return policy
+		if !s.isAttachmentPoint(parts[len(parts)-2]) {
+			continue
 		}
+		chain = append(chain, strings.Join(parts, "/"))
 	}
 
-	return nil
+	visited := map[string]bool{resource: true}
+	current := strings.Join(parts, "/")
+	for {
+		parent, exists := s.resourceParents[current]
+		if !exists || visited[parent] {
+			break
+		}
+		visited[parent] = true
+		if collection, _, _ := strings.Cut(parent, "/"); s.isAttachmentPoint(collection) {
+			chain = append(chain, parent)
+		}
+		current = parent
+	}
+
+	return chain
+}
+
+func (s *Storage) isAttachmentPoint(collection string) bool {
+	return len(s.attachmentPoints) == 0 || s.attachmentPoints[collection]
 }
 
 func (s *Storage) getRolePermissions(role string, permission string) ([]string, bool) {
-	if perms, ok := s.customRoles[role]; ok {
-		return perms, true
+	if custom, ok := s.customRoles[role]; ok {
+		return custom.grantedPermissions(), true
 	}
 
-	builtInRoles := map[string][]string{
-		"roles/owner": {
-			"secretmanager.secrets.get",
-			"secretmanager.secrets.create",
-			"secretmanager.secrets.update",
-			"secretmanager.secrets.delete",
-			"secretmanager.secrets.list",
-			"secretmanager.versions.add",
-			"secretmanager.versions.get",
-			"secretmanager.versions.access",
-			"secretmanager.versions.list",
-			"secretmanager.versions.enable",
-			"secretmanager.versions.disable",
-			"secretmanager.versions.destroy",
-			"cloudkms.keyRings.create",
-			"cloudkms.keyRings.get",
-			"cloudkms.keyRings.list",
-			"cloudkms.cryptoKeys.create",
-			"cloudkms.cryptoKeys.get",
-			"cloudkms.cryptoKeys.list",
-			"cloudkms.cryptoKeys.update",
-			"cloudkms.cryptoKeys.encrypt",
-			"cloudkms.cryptoKeys.decrypt",
-			"cloudkms.cryptoKeyVersions.create",
-			"cloudkms.cryptoKeyVersions.get",
-			"cloudkms.cryptoKeyVersions.list",
-			"cloudkms.cryptoKeyVersions.update",
-			"cloudkms.cryptoKeyVersions.destroy",
-		},
-		"roles/editor": {
-			"secretmanager.secrets.get",
-			"secretmanager.secrets.create",
-			"secretmanager.secrets.update",
-			"secretmanager.secrets.list",
-			"secretmanager.versions.add",
-			"secretmanager.versions.get",
-			"secretmanager.versions.access",
-			"secretmanager.versions.list",
-			"secretmanager.versions.enable",
-			"secretmanager.versions.disable",
-			"cloudkms.keyRings.get",
-			"cloudkms.keyRings.list",
-			"cloudkms.cryptoKeys.create",
-			"cloudkms.cryptoKeys.get",
-			"cloudkms.cryptoKeys.list",
-			"cloudkms.cryptoKeys.update",
-			"cloudkms.cryptoKeys.encrypt",
-			"cloudkms.cryptoKeys.decrypt",
-			"cloudkms.cryptoKeyVersions.create",
-			"cloudkms.cryptoKeyVersions.get",
-			"cloudkms.cryptoKeyVersions.list",
-			"cloudkms.cryptoKeyVersions.update",
-		},
-		"roles/viewer": {
-			"secretmanager.secrets.get",
-			"secretmanager.secrets.list",
-			"secretmanager.versions.get",
-			"secretmanager.versions.list",
-			"cloudkms.keyRings.get",
-			"cloudkms.keyRings.list",
-			"cloudkms.cryptoKeys.get",
-			"cloudkms.cryptoKeys.list",
-			"cloudkms.cryptoKeyVersions.get",
-			"cloudkms.cryptoKeyVersions.list",
-		},
-		"roles/secretmanager.admin": {
-			"secretmanager.secrets.get",
-			"secretmanager.secrets.create",
-			"secretmanager.secrets.update",
-			"secretmanager.secrets.delete",
-			"secretmanager.secrets.list",
-			"secretmanager.versions.add",
-			"secretmanager.versions.get",
-			"secretmanager.versions.access",
-			"secretmanager.versions.list",
-			"secretmanager.versions.enable",
-			"secretmanager.versions.disable",
-			"secretmanager.versions.destroy",
-		},
-		"roles/secretmanager.secretAccessor": {
-			"secretmanager.versions.access",
-		},
-		"roles/secretmanager.secretVersionManager": {
-			"secretmanager.versions.add",
-			"secretmanager.versions.get",
-			"secretmanager.versions.list",
-			"secretmanager.versions.enable",
-			"secretmanager.versions.disable",
-			"secretmanager.versions.destroy",
-		},
-		"roles/cloudkms.admin": {
-			"cloudkms.keyRings.create",
-			"cloudkms.keyRings.get",
-			"cloudkms.keyRings.list",
-			"cloudkms.cryptoKeys.create",
-			"cloudkms.cryptoKeys.get",
-			"cloudkms.cryptoKeys.list",
-			"cloudkms.cryptoKeys.update",
-			"cloudkms.cryptoKeys.encrypt",
-			"cloudkms.cryptoKeys.decrypt",
-			"cloudkms.cryptoKeyVersions.create",
-			"cloudkms.cryptoKeyVersions.get",
-			"cloudkms.cryptoKeyVersions.list",
-			"cloudkms.cryptoKeyVersions.update",
-			"cloudkms.cryptoKeyVersions.destroy",
-		},
-		"roles/cloudkms.cryptoKeyEncrypterDecrypter": {
-			"cloudkms.cryptoKeys.encrypt",
-			"cloudkms.cryptoKeys.decrypt",
-		},
-		"roles/cloudkms.viewer": {
-			"cloudkms.keyRings.get",
-			"cloudkms.keyRings.list",
-			"cloudkms.cryptoKeys.get",
-			"cloudkms.cryptoKeys.list",
-			"cloudkms.cryptoKeyVersions.get",
-			"cloudkms.cryptoKeyVersions.list",
-		},
-	}
-
-	if perms, ok := builtInRoles[role]; ok {
+	if perms, ok := s.builtInRoles[role]; ok {
 		return perms, true
 	}
 
@@ -355,103 +932,287 @@ func (s *Storage) getRolePermissions(role string, permission string) ([]string,
 	return nil, false
 }
 
+// roleGrants reports whether role includes permission, checking the custom
+// and built-in role indexes instead of scanning permission lists. Unknown
+// roles grant nothing unless unknown roles are allowed.
+func (s *Storage) roleGrants(role, permission string) bool {
+	if perms, ok := s.customRoleIndex[role]; ok {
+		return perms[permission]
+	}
+
+	if perms, ok := s.builtInRoleIndex[role]; ok {
+		return perms[permission]
+	}
+
+	if s.allowUnknownRoles {
+		_, ok := s.wildcardRolePermissions(role, permission)
+		return ok
+	}
+
+	return false
+}
+
+// wildcardRolePermissions guesses, in compat mode, whether an unknown role
+// roles/{service}.{name} grants permission. The role's service must equal
+// the permission's service; the name, compared case-insensitively, then
+// decides:
+//   - containing "admin" or "owner": every permission of the service
+//   - containing the permission's verb (e.g. encryptOnly grants
+//     cloudkms.cryptoKeys.encrypt, secretAccessor grants ...versions.access)
+//   - containing "editor", "writer" or "manager": every permission except
+//     setIamPolicy
+//   - otherwise, including "viewer" and "reader": read-only permissions (see
+//     isReadPermission)
 func (s *Storage) wildcardRolePermissions(role, permission string) ([]string, bool) {
-	if !strings.HasPrefix(role, "roles/") {
+	roleName, ok := strings.CutPrefix(role, "roles/")
+	if !ok {
+		return nil, false
+	}
+
+	roleService, name, _ := strings.Cut(roleName, ".")
+	permService, _, _ := strings.Cut(permission, ".")
+	if roleService != permService {
 		return nil, false
 	}
 
-	roleName := strings.TrimPrefix(role, "roles/")
-	permPrefix := strings.Split(permission, ".")[0]
+	name = strings.ToLower(name)
+	verb := strings.ToLower(permissionVerb(permission))
 
-	if strings.Contains(roleName, permPrefix) {
-		return []string{permission}, true
+	var granted bool
+	switch {
+	case strings.Contains(name, "admin") || strings.Contains(name, "owner"):
+		granted = true
+	case verb != "" && strings.Contains(name, verb):
+		granted = true
+	case strings.Contains(name, "editor") || strings.Contains(name, "writer") || strings.Contains(name, "manager"):
+		granted = verb != "setiampolicy"
+	default:
+		granted = isReadPermission(permission)
 	}
 
+	if granted {
+		return []string{permission}, true
+	}
 	return nil, false
 }
 
-func (s *Storage) hasPermission(policy *iampb.Policy, principal string, permission string, evalCtx EvalContext, trace bool) (bool, string) { //nolint:staticcheck // Using standard genproto package
-
-	if principal == "" {
-		for _, binding := range policy.Bindings {
-			perms, ok := s.getRolePermissions(binding.Role, permission)
-			if !ok {
-				continue
-			}
+// permissionVerb returns the last segment of a permission, e.g. "delete" for
+// secretmanager.secrets.delete.
+func permissionVerb(permission string) string {
+	return permission[strings.LastIndex(permission, ".")+1:]
+}
 
-			for _, p := range perms {
-				if p == permission {
-					return true, fmt.Sprintf("matched role=%s (no principal check)", binding.Role)
-				}
-			}
+// isReadPermission reports whether permission only reads: its verb starts
+// with get, list, access, read, search or view.
+func isReadPermission(permission string) bool {
+	verb := permissionVerb(permission)
+	for _, prefix := range []string{"get", "list", "access", "read", "search", "view"} {
+		if strings.HasPrefix(verb, prefix) {
+			return true
 		}
-		return false, "no role grants permission (no principal provided)"
 	}
+	return false
+}
 
-	for _, binding := range policy.Bindings {
-		perms, ok := s.getRolePermissions(binding.Role, permission)
-		if !ok {
-			continue
-		}
+func (s *Storage) hasPermission(policy *iampb.Policy, principal string, permission string, evalCtx EvalContext, trace bool) (bool, string, error) { //nolint:staticcheck // Using standard genproto package
+	match, err := s.matchBinding(policy, principal, permission, evalCtx, trace)
+	return match.granted, match.reason, err
+}
 
-		hasPermission := false
-		for _, p := range perms {
-			if p == permission {
-				hasPermission = true
-				break
+// bindingMatch is the outcome of checking one permission against a policy.
+type bindingMatch struct {
+	granted bool
+	role    string
+	member  string
+	reason  string
+}
+
+// matchBinding finds the binding in policy that grants permission to
+// principal, evaluating its condition.
+func (s *Storage) matchBinding(policy *iampb.Policy, principal string, permission string, evalCtx EvalContext, trace bool) (bindingMatch, error) { //nolint:staticcheck // Using standard genproto package
+
+	if principal == "" {
+		for _, binding := range policy.Bindings {
+			if s.roleGrants(binding.Role, permission) {
+				return bindingMatch{granted: true, role: binding.Role, reason: fmt.Sprintf("matched role=%s (no principal check)", binding.Role)}, nil
 			}
 		}
+		return bindingMatch{reason: "no role grants permission (no principal provided)"}, nil
+	}
 
-		if !hasPermission {
+	for _, binding := range policy.Bindings {
+		if !s.roleGrants(binding.Role, permission) {
 			continue
 		}
 
 		for _, member := range binding.Members {
 			if s.principalMatches(principal, member) {
 				if binding.Condition != nil {
-					condResult, condReason := evaluateCondition(binding.Condition, evalCtx)
+					condResult, condReason, err := s.evaluateBindingCondition(binding.Condition, evalCtx)
+					if err != nil {
+						return bindingMatch{reason: condReason}, err
+					}
 					if trace {
 						slog.Info("condition evaluation", "resource", evalCtx.ResourceName, "principal", principal, "condition", binding.Condition.Expression, "result", condResult, "reason", condReason)
 					}
 					if !condResult {
-						return false, fmt.Sprintf("condition failed: %s", condReason)
+						return bindingMatch{reason: fmt.Sprintf("condition failed: %s", condReason)}, nil
 					}
-					return true, fmt.Sprintf("matched binding: role=%s member=%s condition=%s", binding.Role, member, condReason)
+					return bindingMatch{granted: true, role: binding.Role, member: member, reason: fmt.Sprintf("matched binding: role=%s member=%s condition=%s", binding.Role, describeMember(member), condReason)}, nil
 				}
-				return true, fmt.Sprintf("matched binding: role=%s member=%s", binding.Role, member)
+				return bindingMatch{granted: true, role: binding.Role, member: member, reason: fmt.Sprintf("matched binding: role=%s member=%s", binding.Role, describeMember(member))}, nil
 			}
 		}
 	}
 
-	return false, "no matching binding found for principal"
+	return bindingMatch{reason: "no matching binding found for principal"}, nil
+}
+
+// evaluateBindingCondition returns a *ConditionError in strict mode when the
+// evaluator cannot interpret an expression, and otherwise applies the
+// unsupported condition policy.
+func (s *Storage) evaluateBindingCondition(condition *expr.Expr, evalCtx EvalContext) (bool, string, error) {
+	result, reason, err := evalCondition(condition, evalCtx)
+	if !errors.Is(err, ErrUnsupportedCondition) {
+		return result, reason, nil
+	}
+
+	if s.strictConditions {
+		return false, reason, &ConditionError{
+			Resource:   evalCtx.ResourceName,
+			Expression: condition.Expression,
+			Reason:     reason,
+		}
+	}
+
+	slog.Warn("unsupported condition fallback", "resource", evalCtx.ResourceName, "condition", condition.Expression, "policy", string(s.unsupportedConditionPolicy))
+	if s.unsupportedConditionPolicy == UnsupportedConditionAllow {
+		return true, fmt.Sprintf("%s (allowed by unsupported condition policy)", reason), nil
+	}
+	return false, reason, nil
 }
 
 func (s *Storage) principalMatches(principal, member string) bool {
-	if principal == member {
+	if identity, ok := deletedMemberIdentity(member); ok {
+		slog.Warn("deleted member in binding", "member", member, "matched", s.matchDeletedMembers)
+		return s.matchDeletedMembers && s.principalMatches(principal, identity)
+	}
+
+	if sameMember(principal, member) {
 		return true
 	}
 
-	if member == "allUsers" || member == "allAuthenticatedUsers" {
+	if member == "allUsers" {
 		return true
 	}
 
-	if strings.HasPrefix(member, "group:") {
-		groupName := strings.TrimPrefix(member, "group:")
-		if groupMembers, exists := s.groups[groupName]; exists {
-			for _, groupMember := range groupMembers {
-				if groupMember == principal {
-					return true
-				}
-				if strings.HasPrefix(groupMember, "group:") {
-					nestedGroupName := strings.TrimPrefix(groupMember, "group:")
-					if nestedMembers, nestedExists := s.groups[nestedGroupName]; nestedExists {
-						for _, nestedMember := range nestedMembers {
-							if nestedMember == principal {
-								return true
-							}
-						}
-					}
-				}
+	if member == "allAuthenticatedUsers" {
+		return isAuthenticatedPrincipal(principal)
+	}
+
+	if domain, ok := strings.CutPrefix(member, "domain:"); ok {
+		principalDomain, hasDomain := emailDomain(normalizeMember(principal))
+		return hasDomain && strings.EqualFold(principalDomain, domain)
+	}
+
+	if pool, ok := principalSetPool(member); ok {
+		return strings.HasPrefix(principal, "principal://"+pool+"/") || strings.HasPrefix(principal, "principalSet://"+pool+"/")
+	}
+
+	if groupName, ok := strings.CutPrefix(member, "group:"); ok {
+		return s.groupContains(groupName, principal, make(map[string]bool))
+	}
+
+	return false
+}
+
+// AnonymousPrincipal is the principal of a caller that presented no identity.
+// allUsers matches it; allAuthenticatedUsers does not.
+const AnonymousPrincipal = "user:anonymous"
+
+// isAuthenticatedPrincipal reports whether principal is a signed-in identity
+// that allAuthenticatedUsers covers: a user, service account or federated
+// principal other than AnonymousPrincipal.
+func isAuthenticatedPrincipal(principal string) bool {
+	principal = normalizeMember(principal)
+	if principal == AnonymousPrincipal {
+		return false
+	}
+	for _, prefix := range []string{"user:", "serviceAccount:", "principal://"} {
+		if strings.HasPrefix(principal, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePrincipalGroups returns the sorted names of every group principal
+// belongs to, directly or through nested groups.
+func (s *Storage) ResolvePrincipalGroups(principal string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := []string{}
+	for groupName := range s.groups {
+		if s.groupContains(groupName, principal, make(map[string]bool)) {
+			groups = append(groups, groupName)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// principalSetPool returns the pool of a principalSet:// member that ends in
+// the /* wildcard on a workload or workforce identity pool, e.g.
+// "iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool"
+// for ".../workloadIdentityPools/pool/*". Such a member matches every
+// principal:// or principalSet:// identity under that pool. Any other
+// principalSet:// or principal:// member matches only the identical principal.
+func principalSetPool(member string) (string, bool) {
+	set, ok := strings.CutPrefix(member, "principalSet://")
+	if !ok {
+		return "", false
+	}
+	pool, ok := strings.CutSuffix(set, "/*")
+	if !ok {
+		return "", false
+	}
+
+	segments := strings.Split(pool, "/")
+	if len(segments) < 2 {
+		return "", false
+	}
+	switch segments[len(segments)-2] {
+	case "workloadIdentityPools", "workforcePools":
+		return pool, true
+	}
+	return "", false
+}
+
+// describeMember spells out the matching rule of wildcard members in reasons.
+func describeMember(member string) string {
+	if pool, ok := principalSetPool(member); ok {
+		return fmt.Sprintf("%s (pool wildcard: any principal in %s)", member, pool)
+	}
+	return member
+}
+
+// groupContains reports whether principal is a member of groupName, directly
+// or through nested group: members at any depth. visited holds the groups
+// already on the walk so cyclic memberships terminate.
+func (s *Storage) groupContains(groupName, principal string, visited map[string]bool) bool {
+	if visited[groupName] {
+		return false
+	}
+	visited[groupName] = true
+
+	for _, groupMember := range s.groupMembers(groupName) {
+		if sameMember(groupMember, principal) {
+			return true
+		}
+		if nestedGroupName, ok := strings.CutPrefix(groupMember, "group:"); ok {
+			if s.groupContains(nestedGroupName, principal, visited) {
+				return true
 			}
 		}
 	}
@@ -459,6 +1220,52 @@ func (s *Storage) principalMatches(principal, member string) bool {
 	return false
 }
 
+// groupMembers returns the members of groupName, matching the name
+// case-insensitively when there is no exact match, as group emails are.
+// Requires s.mu to be held.
+func (s *Storage) groupMembers(groupName string) []string {
+	if members, exists := s.groups[groupName]; exists {
+		return members
+	}
+	for name, members := range s.groups {
+		if strings.EqualFold(name, groupName) {
+			return members
+		}
+	}
+	return nil
+}
+
+// deletedMemberIdentity strips the deleted: prefix and ?uid= suffix GCP adds
+// to members whose identity was deleted, e.g.
+// "deleted:serviceAccount:ci@p.iam.gserviceaccount.com?uid=123" becomes
+// "serviceAccount:ci@p.iam.gserviceaccount.com".
+func deletedMemberIdentity(member string) (string, bool) {
+	identity, ok := strings.CutPrefix(member, "deleted:")
+	if !ok {
+		return "", false
+	}
+	identity, _, _ = strings.Cut(identity, "?uid=")
+	return identity, true
+}
+
+// emailDomain returns the domain of a user: or serviceAccount: principal's
+// email, i.e. everything after the last "@".
+func emailDomain(principal string) (string, bool) {
+	memberType, email, ok := strings.Cut(principal, ":")
+	if !ok || (memberType != "user" && memberType != "serviceAccount") {
+		return "", false
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return "", false
+	}
+	return email[at+1:], true
+}
+
+// Clear discards all projects, service accounts, policies, groups, custom
+// roles, deny policies, resource parents and resource labels. Settings are
+// kept.
 func (s *Storage) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -466,5 +1273,10 @@ func (s *Storage) Clear() {
 	s.serviceAccounts = make(map[string]*ServiceAccount)
 	s.policies = make(map[string]*iampb.Policy)
 	s.groups = make(map[string][]string)
-	s.customRoles = make(map[string][]string)
+	s.setCustomRoles(make(map[string]*Role))
+	s.denyPolicies = make(map[string][]DenyRule)
+	s.resourceParents = make(map[string]string)
+	s.resourceLabels = make(map[string]map[string]string)
+	s.policyIndexes = make(map[string]*policyIndex)
+	s.persist()
 }
@@ -1,9 +1,19 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestSetIamPolicy(t *testing.T) {
@@ -191,3 +201,888 @@ func TestTestIamPermissions_KMS(t *testing.T) {
 		t.Errorf("Expected 2 allowed permissions (encrypt, decrypt), got %d: %v", len(allowed), allowed)
 	}
 }
+
+func TestFullResourceNameAliases(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+		},
+	}
+	if _, err := s.SetIamPolicy("projects/p/secrets/s", policy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	fullName := "//secretmanager.googleapis.com/projects/p/secrets/s"
+
+	got, err := s.GetIamPolicy(fullName)
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(got.Bindings) != 1 {
+		t.Errorf("Expected policy set under the relative name to be found by full name, got %v", got.Bindings)
+	}
+
+	allowed, err := s.TestIamPermissions(fullName, "user:alice@example.com", []string{"secretmanager.versions.access"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected permission via full resource name, got %v", allowed)
+	}
+
+	// And the reverse: set by full name, read by relative name. The policy
+	// carries the etag of the first write, so clear it to overwrite
+	policy.Etag = nil
+	if _, err := s.SetIamPolicy("//cloudkms.googleapis.com/projects/p/locations/global/keyRings/r", policy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	got, err = s.GetIamPolicy("projects/p/locations/global/keyRings/r")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(got.Bindings) != 1 {
+		t.Errorf("Expected policy set under the full name to be found by relative name, got %v", got.Bindings)
+	}
+}
+
+func TestNormalizeResource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"projects/p/secrets/s", "projects/p/secrets/s"},
+		{"//secretmanager.googleapis.com/projects/p/secrets/s", "projects/p/secrets/s"},
+		{"//cloudresourcemanager.googleapis.com/projects/p", "projects/p"},
+		{"//invalid", "//invalid"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeResource(tt.input); got != tt.expected {
+			t.Errorf("normalizeResource(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSetClock_TimeBoundBinding(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+				Condition: &expr.Expr{
+					Expression: `request.time < timestamp("2026-07-01T00:00:00Z")`,
+					Title:      "CI token expiry",
+				},
+			},
+		},
+	}
+	if _, err := s.SetIamPolicy("projects/test", policy); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	check := func() int {
+		allowed, err := s.TestIamPermissions("projects/test/secrets/db", "serviceAccount:ci@test.iam.gserviceaccount.com", []string{"secretmanager.versions.access"}, false)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		return len(allowed)
+	}
+
+	s.SetClock(func() time.Time { return time.Date(2026, 6, 30, 23, 59, 59, 0, time.UTC) })
+	if check() != 1 {
+		t.Error("Expected access just before expiry")
+	}
+
+	s.SetClock(func() time.Time { return time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC) })
+	if check() != 0 {
+		t.Error("Expected no access at expiry")
+	}
+
+	s.SetClock(nil)
+	if s.now == nil {
+		t.Error("Expected nil clock to restore time.Now")
+	}
+}
+
+func TestMovePolicy(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"user:alice@example.com"},
+			},
+		},
+	}
+	original, err := s.SetIamPolicy("projects/test/secrets/old-name", policy)
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	oldEtag := string(original.Etag)
+
+	if err := s.MovePolicy("projects/test/secrets/old-name", "projects/test/secrets/new-name"); err != nil {
+		t.Fatalf("MovePolicy failed: %v", err)
+	}
+
+	old, err := s.GetIamPolicy("projects/test/secrets/old-name")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(old.Bindings) != 0 {
+		t.Errorf("Expected old resource to have no bindings, got %v", old.Bindings)
+	}
+
+	moved, err := s.GetIamPolicy("projects/test/secrets/new-name")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(moved.Bindings) != 1 || moved.Bindings[0].Members[0] != "user:alice@example.com" {
+		t.Errorf("Expected bindings at new resource, got %v", moved.Bindings)
+	}
+	if string(moved.Etag) == oldEtag {
+		t.Error("Expected etag to be regenerated")
+	}
+	if string(original.Etag) != oldEtag {
+		t.Error("Expected the policy returned before the move to keep its etag")
+	}
+}
+
+func TestMovePolicy_Errors(t *testing.T) {
+	s := NewStorage()
+
+	if err := s.MovePolicy("projects/test/secrets/missing", "projects/test/secrets/other"); err == nil {
+		t.Error("Expected error moving a missing policy")
+	}
+
+	for _, resource := range []string{"projects/test/secrets/a", "projects/test/secrets/b"} {
+		if _, err := s.SetIamPolicy(resource, &iampb.Policy{}); err != nil {
+			t.Fatalf("SetIamPolicy failed: %v", err)
+		}
+	}
+
+	if err := s.MovePolicy("projects/test/secrets/a", "projects/test/secrets/b"); err == nil {
+		t.Error("Expected error moving onto an existing policy")
+	}
+}
+
+func serviceAccountPolicy() *iampb.Policy {
+	return &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com", "user:alice@example.com"},
+			},
+			{
+				Role:    "roles/secretmanager.admin",
+				Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"},
+			},
+		},
+	}
+}
+
+func TestDeleteServiceAccount_PurgesMembers(t *testing.T) {
+	s := NewStorage()
+
+	if _, err := s.CreateServiceAccount("test", "ci", "", ""); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+	original, err := s.SetIamPolicy("projects/test/secrets/db", serviceAccountPolicy())
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	oldEtag := string(original.Etag)
+
+	if err := s.DeleteServiceAccount("projects/-/serviceAccounts/ci@test.iam.gserviceaccount.com"); err != nil {
+		t.Fatalf("DeleteServiceAccount failed: %v", err)
+	}
+
+	if _, err := s.GetServiceAccount("projects/test/serviceAccounts/ci@test.iam.gserviceaccount.com"); err == nil {
+		t.Error("Expected account to be gone")
+	}
+
+	policy, err := s.GetIamPolicy("projects/test/secrets/db")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 {
+		t.Fatalf("Expected binding left without members to be dropped, got %v", policy.Bindings)
+	}
+	if members := policy.Bindings[0].Members; len(members) != 1 || members[0] != "user:alice@example.com" {
+		t.Errorf("Expected only alice to remain, got %v", members)
+	}
+	if string(policy.Etag) == oldEtag {
+		t.Error("Expected etag to change after purge")
+	}
+}
+
+func TestDeleteServiceAccount_PurgesMembersCaseInsensitive(t *testing.T) {
+	s := NewStorage()
+
+	if _, err := s.CreateServiceAccount("test", "ci", "", ""); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+	_, err := s.SetIamPolicy("projects/test/secrets/db", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"serviceAccount:CI@test.iam.gserviceaccount.com", "user:alice@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	before, err := s.GetIamPolicy("projects/test/secrets/db")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+
+	if err := s.DeleteServiceAccount("projects/test/serviceAccounts/ci@test.iam.gserviceaccount.com"); err != nil {
+		t.Fatalf("DeleteServiceAccount failed: %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test/secrets/db")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if members := policy.Bindings[0].Members; len(members) != 1 || members[0] != "user:alice@example.com" {
+		t.Errorf("Expected the differently cased member to be purged, got %v", members)
+	}
+
+	// A policy returned before the delete is left as it was
+	if members := before.Bindings[0].Members; len(members) != 2 || members[0] != "serviceAccount:CI@test.iam.gserviceaccount.com" {
+		t.Errorf("Expected the earlier policy to be unchanged, got %v", members)
+	}
+}
+
+func TestDeleteServiceAccount_KeepsOrphanedBindings(t *testing.T) {
+	s := NewStorage()
+	s.SetPurgeDeletedMembers(false)
+
+	if _, err := s.CreateServiceAccount("test", "ci", "", ""); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+	if _, err := s.SetIamPolicy("projects/test/secrets/db", serviceAccountPolicy()); err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	if err := s.DeleteServiceAccount("projects/test/serviceAccounts/ci@test.iam.gserviceaccount.com"); err != nil {
+		t.Fatalf("DeleteServiceAccount failed: %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test/secrets/db")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 2 || len(policy.Bindings[0].Members) != 2 {
+		t.Errorf("Expected bindings to be untouched, got %v", policy.Bindings)
+	}
+}
+
+func TestSetIamPolicy_EtagCAS(t *testing.T) {
+	s := NewStorage()
+
+	// First write with no etag creates the policy
+	first, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}},
+	})
+	if err != nil {
+		t.Fatalf("First write with empty etag failed: %v", err)
+	}
+	staleEtag := first.Etag
+
+	// Read-modify-write with the current etag succeeds
+	current, err := s.GetIamPolicy("projects/test")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	updated, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Etag:     current.Etag,
+		Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:bob@example.com"}}},
+	})
+	if err != nil {
+		t.Fatalf("Write with current etag failed: %v", err)
+	}
+	if string(updated.Etag) == string(staleEtag) {
+		t.Error("Expected etag to change after a write")
+	}
+
+	// A write based on the old read is rejected and leaves the policy alone
+	_, err = s.SetIamPolicy("projects/test", &iampb.Policy{
+		Etag:     staleEtag,
+		Bindings: []*iampb.Binding{{Role: "roles/owner", Members: []string{"user:mallory@example.com"}}},
+	})
+	if !errors.Is(err, ErrEtagMismatch) {
+		t.Fatalf("Expected ErrEtagMismatch for stale etag, got %v", err)
+	}
+
+	got, _ := s.GetIamPolicy("projects/test")
+	if got.Bindings[0].Members[0] != "user:bob@example.com" {
+		t.Errorf("Expected rejected write not to change the policy, got %v", got.Bindings)
+	}
+}
+
+func TestSetIamPolicy_EtagOfEmptyPolicy(t *testing.T) {
+	s := NewStorage()
+
+	empty, err := s.GetIamPolicy("projects/fresh")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+
+	_, err = s.SetIamPolicy("projects/fresh", &iampb.Policy{
+		Etag:     empty.Etag,
+		Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}},
+	})
+	if err != nil {
+		t.Errorf("Expected etag of the empty policy to allow the first write, got %v", err)
+	}
+}
+
+func TestTestIamPermissions_PubSubPublisherVsSubscriber(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/pubsub.publisher", Members: []string{"serviceAccount:orders@test.iam.gserviceaccount.com"}},
+			{Role: "roles/pubsub.subscriber", Members: []string{"serviceAccount:worker@test.iam.gserviceaccount.com"}},
+			{Role: "roles/viewer", Members: []string{"user:oncall@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	perms := []string{"pubsub.topics.publish", "pubsub.subscriptions.consume", "pubsub.topics.get"}
+	tests := []struct {
+		principal string
+		resource  string
+		expected  []string
+	}{
+		{"serviceAccount:orders@test.iam.gserviceaccount.com", "projects/test/topics/orders", []string{"pubsub.topics.publish"}},
+		{"serviceAccount:worker@test.iam.gserviceaccount.com", "projects/test/subscriptions/orders-worker", []string{"pubsub.subscriptions.consume"}},
+		{"user:oncall@example.com", "projects/test/topics/orders", []string{"pubsub.topics.get"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			allowed, err := s.TestIamPermissions(tt.resource, tt.principal, perms, false)
+			if err != nil {
+				t.Fatalf("TestIamPermissions failed: %v", err)
+			}
+			if len(allowed) != len(tt.expected) || allowed[0] != tt.expected[0] {
+				t.Errorf("Expected %v, got %v", tt.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestTestIamPermissions_PubSubConditionOnTopic(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:      "roles/pubsub.publisher",
+				Members:   []string{"serviceAccount:orders@test.iam.gserviceaccount.com"},
+				Condition: &expr.Expr{Expression: `resource.type == "TOPIC"`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test/topics/orders", "serviceAccount:orders@test.iam.gserviceaccount.com", []string{"pubsub.topics.publish"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected publish on a topic, got %v", allowed)
+	}
+
+	allowed, err = s.TestIamPermissions("projects/test/subscriptions/orders-worker", "serviceAccount:orders@test.iam.gserviceaccount.com", []string{"pubsub.topics.publish"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected condition to exclude subscriptions, got %v", allowed)
+	}
+}
+
+func TestTestIamPermissions_ServiceAccountRoles(t *testing.T) {
+	s := NewStorage()
+
+	account, err := s.CreateServiceAccount("test", "deployer", "", "")
+	if err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+
+	_, err = s.SetIamPolicy(account.Name, &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/iam.serviceAccountUser", Members: []string{"user:dev@example.com"}},
+			{Role: "roles/iam.serviceAccountTokenCreator", Members: []string{"serviceAccount:ci@test.iam.gserviceaccount.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	perms := []string{"iam.serviceAccounts.actAs", "iam.serviceAccounts.getAccessToken"}
+	tests := []struct {
+		principal string
+		expected  []string
+	}{
+		{"user:dev@example.com", []string{"iam.serviceAccounts.actAs"}},
+		// Token Creator can mint tokens for the account but does not grant actAs
+		{"serviceAccount:ci@test.iam.gserviceaccount.com", []string{"iam.serviceAccounts.getAccessToken"}},
+		{"user:other@example.com", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			allowed, err := s.TestIamPermissions(account.Name, tt.principal, perms, false)
+			if err != nil {
+				t.Fatalf("TestIamPermissions failed: %v", err)
+			}
+			if !reflect.DeepEqual(allowed, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestTestIamPermissions_ActAsInheritedFromProject(t *testing.T) {
+	s := NewStorage()
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:      "roles/iam.serviceAccountUser",
+				Members:   []string{"user:dev@example.com"},
+				Condition: &expr.Expr{Expression: `resource.type == "SERVICE_ACCOUNT"`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/test/serviceAccounts/runtime@test.iam.gserviceaccount.com", "user:dev@example.com", []string{"iam.serviceAccounts.actAs"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected project-level serviceAccountUser to grant actAs on the account, got %v", allowed)
+	}
+}
+
+func TestReplaceAll_SwapsState(t *testing.T) {
+	s := NewStorage()
+	s.LoadPolicies(map[string]*iampb.Policy{
+		"projects/old": {Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}}},
+	})
+	s.LoadGroups(map[string][]string{"old-team": {"user:alice@example.com"}})
+
+	err := s.ReplaceAll(&State{
+		Policies: map[string]*iampb.Policy{
+			"projects/new": {Bindings: []*iampb.Binding{{Role: "roles/custom.reader", Members: []string{"group:new-team"}}}},
+		},
+		Groups:      map[string][]string{"new-team": {"user:bob@example.com"}},
+		CustomRoles: customRolesFromPermissions(map[string][]string{"roles/custom.reader": {"secretmanager.secrets.get"}}),
+	})
+	if err != nil {
+		t.Fatalf("ReplaceAll failed: %v", err)
+	}
+
+	if policy, _ := s.GetIamPolicy("projects/old"); len(policy.Bindings) != 0 {
+		t.Errorf("Expected policy missing from the new set to be dropped, got %v", policy.Bindings)
+	}
+	if groups := s.ResolvePrincipalGroups("user:alice@example.com"); len(groups) != 0 {
+		t.Errorf("Expected old group to be dropped, got %v", groups)
+	}
+
+	allowed, err := s.TestIamPermissions("projects/new", "user:bob@example.com", []string{"secretmanager.secrets.get"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 1 {
+		t.Errorf("Expected new policy, group and role to grant together, got %v", allowed)
+	}
+}
+
+func TestReplaceAll_RejectedReloadKeepsState(t *testing.T) {
+	s := NewStorage()
+	s.SetPublicGrantPolicy(PublicGrantReject)
+
+	s.SetPolicyLimits(2, 0)
+
+	good := &State{
+		Policies: map[string]*iampb.Policy{
+			"projects/test": {Bindings: []*iampb.Binding{{Role: "roles/custom.reader", Members: []string{"group:team"}}}},
+		},
+		Groups:      map[string][]string{"team": {"user:alice@example.com"}},
+		CustomRoles: customRolesFromPermissions(map[string][]string{"roles/custom.reader": {"secretmanager.secrets.get"}}),
+	}
+	if err := s.ReplaceAll(good); err != nil {
+		t.Fatalf("ReplaceAll failed: %v", err)
+	}
+	before, _ := s.GetIamPolicy("projects/test")
+
+	badReloads := map[string]map[string]*iampb.Policy{
+		"malformed role": {
+			"projects/test":  {Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:bob@example.com"}}}},
+			"projects/other": {Bindings: []*iampb.Binding{{Role: "owner", Members: []string{"user:bob@example.com"}}}},
+		},
+		"public grant": {
+			"projects/test": {Bindings: []*iampb.Binding{{Role: "roles/owner", Members: []string{"allUsers"}}}},
+		},
+		"unsupported condition": {
+			"projects/test": {Version: 3, Bindings: []*iampb.Binding{{
+				Role:      "roles/viewer",
+				Members:   []string{"user:bob@example.com"},
+				Condition: &expr.Expr{Expression: `request.auth.claims.foo == "bar"`},
+			}}},
+		},
+		"too many members": {
+			"projects/test": {Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:a@example.com", "user:b@example.com", "user:c@example.com"}}}},
+		},
+	}
+
+	for name, policies := range badReloads {
+		t.Run(name, func(t *testing.T) {
+			if err := s.ReplaceAll(&State{Policies: policies}); err == nil {
+				t.Fatal("Expected bad reload to fail")
+			}
+
+			after, _ := s.GetIamPolicy("projects/test")
+			if !proto.Equal(before, after) {
+				t.Errorf("Expected policy to be unchanged, got %v", after)
+			}
+
+			allowed, err := s.TestIamPermissions("projects/test", "user:alice@example.com", []string{"secretmanager.secrets.get"}, false)
+			if err != nil {
+				t.Fatalf("TestIamPermissions failed: %v", err)
+			}
+			if len(allowed) != 1 {
+				t.Error("Expected previous group and custom role to still grant access")
+			}
+		})
+	}
+}
+
+func TestReplaceAll_DropsRemovedConfig(t *testing.T) {
+	s := NewStorage()
+	first := &State{
+		Policies: map[string]*iampb.Policy{
+			"folders/eng": {Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:alice@example.com"}}}},
+		},
+		DenyPolicies: map[string][]DenyRule{
+			"projects/test": {{DeniedPrincipals: []string{"user:alice@example.com"}, DeniedPermissions: []string{"resourcemanager.projects.get"}}},
+		},
+		ResourceParents: map[string]string{"projects/test": "folders/eng"},
+		ResourceLabels:  map[string]map[string]string{"projects/test": {"env": "prod"}},
+	}
+	if err := s.ReplaceAll(first); err != nil {
+		t.Fatalf("ReplaceAll failed: %v", err)
+	}
+	if denied := s.ListDenyPolicies(); len(denied) != 1 {
+		t.Fatalf("Expected the deny policy to load, got %v", denied)
+	}
+
+	// The reload drops the deny rule, parent and labels, and dedupes the
+	// repeated member as SetIamPolicy would
+	second := &State{
+		Policies: map[string]*iampb.Policy{
+			"projects/test": {Bindings: []*iampb.Binding{{Role: "roles/viewer", Members: []string{"user:bob@example.com", "user:bob@example.com"}}}},
+		},
+	}
+	if err := s.ReplaceAll(second); err != nil {
+		t.Fatalf("ReplaceAll failed: %v", err)
+	}
+
+	if denied := s.ListDenyPolicies(); len(denied) != 0 {
+		t.Errorf("Expected the removed deny policy to be dropped, got %v", denied)
+	}
+	allowed, err := s.TestIamPermissions("projects/test", "user:alice@example.com", []string{"resourcemanager.projects.get"}, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected the removed parent and its policy to stop granting, got %v", allowed)
+	}
+
+	s.mu.RLock()
+	parents, labels := len(s.resourceParents), len(s.resourceLabels)
+	s.mu.RUnlock()
+	if parents != 0 || labels != 0 {
+		t.Errorf("Expected removed parents and labels to be dropped, got %d parents and %d label sets", parents, labels)
+	}
+
+	policy, _ := s.GetIamPolicy("projects/test")
+	if members := policy.Bindings[0].Members; len(members) != 1 {
+		t.Errorf("Expected duplicate members to be removed, got %v", members)
+	}
+}
+
+func TestLoadServiceAccounts_Idempotent(t *testing.T) {
+	s := NewStorage()
+	specs := []ServiceAccountSpec{
+		{ProjectID: "test-project", AccountID: "ci-runner", DisplayName: "CI Runner"},
+	}
+	s.LoadServiceAccounts(specs)
+
+	name := "projects/test-project/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com"
+	if _, _, err := s.CreateServiceAccountKey(name); err != nil {
+		t.Fatalf("CreateServiceAccountKey failed: %v", err)
+	}
+
+	specs[0].DisplayName = "CI"
+	s.LoadServiceAccounts(specs)
+
+	account, err := s.GetServiceAccount(name)
+	if err != nil {
+		t.Fatalf("GetServiceAccount failed: %v", err)
+	}
+	if account.DisplayName != "CI" {
+		t.Errorf("Expected reload to refresh displayName, got %q", account.DisplayName)
+	}
+	if len(account.Keys) != 1 {
+		t.Errorf("Expected reload to keep the account's keys, got %d", len(account.Keys))
+	}
+	if accounts := s.ListServiceAccounts("test-project"); len(accounts) != 1 {
+		t.Errorf("Expected reload not to duplicate the account, got %d", len(accounts))
+	}
+}
+
+func TestLoadServiceAccounts_ReloadLeavesReturnedAccounts(t *testing.T) {
+	s := NewStorage()
+	specs := []ServiceAccountSpec{
+		{ProjectID: "test-project", AccountID: "ci-runner", DisplayName: "CI Runner"},
+	}
+	s.LoadServiceAccounts(specs)
+
+	name := "projects/test-project/serviceAccounts/ci-runner@test-project.iam.gserviceaccount.com"
+	before, err := s.GetServiceAccount(name)
+	if err != nil {
+		t.Fatalf("GetServiceAccount failed: %v", err)
+	}
+	listed := s.ListServiceAccounts("test-project")
+
+	// Readers run alongside reloads; go test -race flags any shared writes
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if account, err := s.GetServiceAccount(name); err == nil {
+				_ = account.DisplayName + account.Description
+			}
+			for _, account := range s.ListServiceAccounts("test-project") {
+				_ = account.DisplayName
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		specs[0].DisplayName = fmt.Sprintf("CI %d", i)
+		s.LoadServiceAccounts(specs)
+	}
+	wg.Wait()
+
+	if before.DisplayName != "CI Runner" || listed[0].DisplayName != "CI Runner" {
+		t.Errorf("Expected accounts returned before the reload to be unchanged, got %q and %q", before.DisplayName, listed[0].DisplayName)
+	}
+}
+
+// manyBindingsStorage returns a storage whose projects/bench policy has
+// bindings for every built-in role, none of which include the principal
+// except the last.
+func manyBindingsStorage(b *testing.B) *Storage {
+	b.Helper()
+
+	s := NewStorage()
+	roles := make([]string, 0, len(s.builtInRoles))
+	for role := range s.builtInRoles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	policy := &iampb.Policy{}
+	for i, role := range roles {
+		policy.Bindings = append(policy.Bindings, &iampb.Binding{
+			Role:    role,
+			Members: []string{fmt.Sprintf("user:member%d@example.com", i)},
+		})
+	}
+	policy.Bindings = append(policy.Bindings, &iampb.Binding{
+		Role:    "roles/owner",
+		Members: []string{"user:bench@example.com"},
+	})
+	if _, err := s.SetIamPolicy("projects/bench", policy); err != nil {
+		b.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	return s
+}
+
+func BenchmarkTestIamPermissions_ManyBindings(b *testing.B) {
+	s := manyBindingsStorage(b)
+	permissions := []string{
+		"resourcemanager.projects.get",
+		"secretmanager.versions.access",
+		"cloudkms.cryptoKeyVersions.useToEncrypt",
+		"pubsub.topics.publish",
+		"resourcemanager.projects.setIamPolicy",
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.TestIamPermissions("projects/bench/secrets/s", "user:bench@example.com", permissions, false); err != nil {
+			b.Fatalf("TestIamPermissions failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkRoleGrants compares scanning a role's permission list, as
+// hasPermission used to, with the permission set lookup of roleGrants.
+func BenchmarkRoleGrants(b *testing.B) {
+	s := NewStorage()
+	const role, permission = "roles/owner", "secretmanager.versions.access"
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			perms, _ := s.getRolePermissions(role, permission)
+			if !containsString(perms, permission) {
+				b.Fatal("Expected roles/owner to grant the permission")
+			}
+		}
+	})
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if !s.roleGrants(role, permission) {
+				b.Fatal("Expected roles/owner to grant the permission")
+			}
+		}
+	})
+}
+
+func TestValidateIamPolicy(t *testing.T) {
+	s := NewStorage()
+
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com", "user:alice@example.com"}},
+		},
+	}
+
+	validated, err := s.ValidateIamPolicy("projects/test", policy)
+	if err != nil {
+		t.Fatalf("ValidateIamPolicy failed: %v", err)
+	}
+	if policy.Version != 0 || len(policy.Etag) != 0 {
+		t.Errorf("Expected the caller's policy to be left unmodified, got %v", policy)
+	}
+	if current, _ := s.GetIamPolicy("projects/test"); len(current.Bindings) != 0 {
+		t.Errorf("Expected ValidateIamPolicy not to store the policy, got %v", current.Bindings)
+	}
+
+	stored, err := s.SetIamPolicy("projects/test", policy)
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	if !bytes.Equal(validated.Etag, stored.Etag) || validated.Version != stored.Version {
+		t.Errorf("Expected the validated policy to match the stored one, got etag %q version %d, want %q version %d", validated.Etag, validated.Version, stored.Etag, stored.Version)
+	}
+
+	if _, err := s.ValidateIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{{Role: "", Members: []string{"user:alice@example.com"}}},
+	}); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("Expected ErrInvalidRole, got %v", err)
+	}
+}
+
+func TestTestIamPermissionsDetailed(t *testing.T) {
+	s := NewStorage()
+	s.LoadGroups(map[string][]string{"engineering": {"user:alice@example.com"}})
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"group:engineering"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	_, err = s.SetIamPolicy("projects/test/secrets/db", &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+			{
+				Role:    "roles/secretmanager.admin",
+				Members: []string{"user:alice@example.com"},
+				Condition: &expr.Expr{
+					Title:      "expired",
+					Expression: `request.time < timestamp("2020-01-01T00:00:00Z")`,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+	s.SetDenyPolicy("projects/test/secrets/db", []DenyRule{
+		{DeniedPrincipals: []string{"user:alice@example.com"}, DeniedPermissions: []string{"secretmanager.secrets.list"}},
+	})
+
+	permissions := []string{
+		"secretmanager.versions.access",
+		"secretmanager.secrets.get",
+		"secretmanager.secrets.delete",
+		"secretmanager.secrets.list",
+	}
+	results, err := s.TestIamPermissionsDetailed("projects/test/secrets/db", "user:alice@example.com", permissions, false)
+	if err != nil {
+		t.Fatalf("TestIamPermissionsDetailed failed: %v", err)
+	}
+	if len(results) != len(permissions) {
+		t.Fatalf("Expected %d results, got %d", len(permissions), len(results))
+	}
+
+	direct := results[0]
+	if direct.Permission != "secretmanager.versions.access" || !direct.Allowed {
+		t.Errorf("Expected secretmanager.versions.access to be allowed, got %+v", direct)
+	}
+	if direct.Role != "roles/secretmanager.secretAccessor" || direct.Member != "user:alice@example.com" || direct.Policy != "projects/test/secrets/db" {
+		t.Errorf("Expected the secret's secretAccessor binding for alice, got %+v", direct)
+	}
+
+	inherited := results[1]
+	if !inherited.Allowed || inherited.Role != "roles/viewer" || inherited.Member != "group:engineering" || inherited.Policy != "projects/test" {
+		t.Errorf("Expected the project's viewer binding via group:engineering, got %+v", inherited)
+	}
+
+	conditional := results[2]
+	if conditional.Allowed || conditional.Role != "" || !strings.Contains(conditional.Reason, "condition failed") {
+		t.Errorf("Expected a condition failure, got %+v", conditional)
+	}
+
+	denied := results[3]
+	if denied.Allowed || denied.Role != "" || denied.Reason == "" {
+		t.Errorf("Expected a deny rule to override the viewer grant, got %+v", denied)
+	}
+
+	for _, trace := range []bool{false, true} {
+		allowed, err := s.TestIamPermissions("projects/test/secrets/db", "user:alice@example.com", permissions, trace)
+		if err != nil {
+			t.Fatalf("TestIamPermissions failed: %v", err)
+		}
+		if !reflect.DeepEqual(allowed, permissions[:2]) {
+			t.Errorf("Expected TestIamPermissions (trace=%t) to agree with the detailed results, got %v", trace, allowed)
+		}
+	}
+}
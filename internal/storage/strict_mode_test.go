@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"testing"
 
 	iampb "google.golang.org/genproto/googleapis/iam/v1"
@@ -195,3 +196,60 @@ func TestCompatMode_WildcardDoesNotMatchWrongService(t *testing.T) {
 		t.Errorf("Expected wildcard to NOT match wrong service, got %d allowed", len(denied))
 	}
 }
+
+func TestStrictMode_MalformedRoleRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		wantErr bool
+	}{
+		{"empty role", "", true},
+		{"unprefixed role", "owner", true},
+		{"missing role name", "projects/test/roles/", true},
+		{"predefined role", "roles/owner", false},
+		{"project-scoped role", "projects/test/roles/deployer", false},
+		{"org-scoped role", "organizations/123/roles/auditor", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStorage()
+
+			_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+				Bindings: []*iampb.Binding{
+					{Role: tt.role, Members: []string{"user:user@example.com"}},
+				},
+			})
+
+			if tt.wantErr && !errors.Is(err, ErrInvalidRole) {
+				t.Errorf("Expected ErrInvalidRole for %q, got %v", tt.role, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected %q to be accepted, got %v", tt.role, err)
+			}
+		})
+	}
+}
+
+func TestCompatMode_MalformedRoleAllowed(t *testing.T) {
+	s := NewStorage()
+	s.SetAllowUnknownRoles(true)
+
+	_, err := s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "owner", Members: []string{"user:user@example.com"}},
+		},
+	})
+	if err != nil {
+		t.Errorf("Expected compat mode to accept unprefixed role, got %v", err)
+	}
+
+	_, err = s.SetIamPolicy("projects/test", &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "", Members: []string{"user:user@example.com"}},
+		},
+	})
+	if !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("Expected empty role to be rejected even in compat mode, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	expr "google.golang.org/genproto/googleapis/type/expr"
+)
+
+const unsupportedExpression = `api.getAttribute("iam.googleapis.com/modifiedGrantsByRole", []).hasOnly(["roles/viewer"])`
+
+func unsupportedConditionPolicy() *iampb.Policy {
+	return &iampb.Policy{
+		Version: 3,
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"user:alice@example.com"},
+				Condition: &expr.Expr{
+					Expression: unsupportedExpression,
+				},
+			},
+		},
+	}
+}
+
+func TestUnsupportedCondition_StrictByDefault(t *testing.T) {
+	s := NewStorage()
+
+	// Strict mode rejects the condition at SetIamPolicy, so load it as
+	// config does
+	s.LoadPolicies(map[string]*iampb.Policy{"projects/test/secrets/db-password": unsupportedConditionPolicy()})
+
+	allowed, err := s.TestIamPermissions(
+		"projects/test/secrets/db-password",
+		"user:alice@example.com",
+		[]string{"secretmanager.versions.access"},
+		false,
+	)
+	if err == nil {
+		t.Fatalf("Expected unsupported condition to fail the check, got %v", allowed)
+	}
+
+	if !errors.Is(err, ErrUnsupportedCondition) {
+		t.Errorf("Expected ErrUnsupportedCondition, got %v", err)
+	}
+
+	var condErr *ConditionError
+	if !errors.As(err, &condErr) {
+		t.Fatalf("Expected *ConditionError, got %T", err)
+	}
+	if condErr.Expression != unsupportedExpression {
+		t.Errorf("Expected expression %q, got %q", unsupportedExpression, condErr.Expression)
+	}
+	if condErr.Resource != "projects/test/secrets/db-password" {
+		t.Errorf("Expected resource projects/test/secrets/db-password, got %q", condErr.Resource)
+	}
+}
+
+func TestUnsupportedCondition_StrictIgnoresOtherPrincipals(t *testing.T) {
+	s := NewStorage()
+
+	// Strict mode rejects the condition at SetIamPolicy, so load it as
+	// config does
+	s.LoadPolicies(map[string]*iampb.Policy{"projects/test/secrets/db-password": unsupportedConditionPolicy()})
+
+	allowed, err := s.TestIamPermissions(
+		"projects/test/secrets/db-password",
+		"user:bob@example.com",
+		[]string{"secretmanager.versions.access"},
+		false,
+	)
+	if err != nil {
+		t.Fatalf("Expected condition on a non-matching binding to be skipped, got %v", err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("Expected no permissions, got %v", allowed)
+	}
+}
+
+func TestUnsupportedCondition_DenyPolicy(t *testing.T) {
+	s := NewStorage()
+	s.SetStrictConditions(false)
+
+	_, err := s.SetIamPolicy("projects/test/secrets/db-password", unsupportedConditionPolicy())
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions(
+		"projects/test/secrets/db-password",
+		"user:alice@example.com",
+		[]string{"secretmanager.versions.access"},
+		false,
+	)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	if len(allowed) != 0 {
+		t.Errorf("Expected unsupported condition to deny by default, got %v", allowed)
+	}
+}
+
+func TestUnsupportedCondition_AllowPolicy(t *testing.T) {
+	s := NewStorage()
+	s.SetStrictConditions(false)
+	s.SetUnsupportedConditionPolicy(UnsupportedConditionAllow)
+
+	_, err := s.SetIamPolicy("projects/test/secrets/db-password", unsupportedConditionPolicy())
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	allowed, err := s.TestIamPermissions(
+		"projects/test/secrets/db-password",
+		"user:alice@example.com",
+		[]string{"secretmanager.versions.access"},
+		false,
+	)
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+
+	if len(allowed) != 1 {
+		t.Errorf("Expected unsupported condition to allow under allow policy, got %v", allowed)
+	}
+}
+
+func TestUnsupportedCondition_ErrorPolicy(t *testing.T) {
+	s := NewStorage()
+	s.SetUnsupportedConditionPolicy(UnsupportedConditionError)
+
+	_, err := s.SetIamPolicy("projects/test/secrets/db-password", unsupportedConditionPolicy())
+	if err == nil {
+		t.Fatal("Expected SetIamPolicy to reject unsupported condition")
+	}
+
+	if !errors.Is(err, ErrUnsupportedCondition) {
+		t.Errorf("Expected ErrUnsupportedCondition, got %v", err)
+	}
+
+	policy, err := s.GetIamPolicy("projects/test/secrets/db-password")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+
+	if len(policy.Bindings) != 0 {
+		t.Errorf("Expected rejected policy not to be stored, got %d bindings", len(policy.Bindings))
+	}
+}
+
+func TestUnsupportedCondition_ErrorPolicyAcceptsSupported(t *testing.T) {
+	s := NewStorage()
+	s.SetUnsupportedConditionPolicy(UnsupportedConditionError)
+
+	policy := unsupportedConditionPolicy()
+	policy.Bindings[0].Condition.Expression = `resource.name.startsWith("projects/test/secrets/")`
+
+	if _, err := s.SetIamPolicy("projects/test/secrets/db-password", policy); err != nil {
+		t.Fatalf("Expected supported condition to be accepted, got %v", err)
+	}
+}
+
+func TestParseUnsupportedConditionPolicy(t *testing.T) {
+	for _, value := range []string{"deny", "allow", "error"} {
+		if _, err := ParseUnsupportedConditionPolicy(value); err != nil {
+			t.Errorf("Expected %q to parse, got %v", value, err)
+		}
+	}
+
+	if _, err := ParseUnsupportedConditionPolicy("maybe"); err == nil {
+		t.Error("Expected invalid policy to be rejected")
+	}
+}
+
+func TestSetIamPolicy_ValidatesConditionInStrictMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		valid      bool
+	}{
+		{"valid", `resource.name.startsWith("projects/test/") && resource.type == "SECRET"`, true},
+		{"misspelled attribute", `resource.nme.startsWith("projects/test/")`, false},
+		{"misspelled function", `resource.name.startswith("projects/test/")`, false},
+		{"syntax error", `resource.name.startsWith("projects/test/"`, false},
+		{"not a bool", `resource.name`, false},
+		{"unsupported attribute", unsupportedExpression, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := func() *iampb.Policy {
+				policy := unsupportedConditionPolicy()
+				policy.Bindings[0].Condition.Expression = tt.expression
+				return policy
+			}
+
+			_, err := NewStorage().SetIamPolicy("projects/test", policy())
+			if tt.valid && err != nil {
+				t.Errorf("Expected %s to be accepted, got %v", tt.expression, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrUnsupportedCondition) {
+				t.Errorf("Expected ErrUnsupportedCondition for %s, got %v", tt.expression, err)
+			}
+
+			// Lenient mode stores the binding and applies the unsupported
+			// condition policy at check time instead
+			lenient := NewStorage()
+			lenient.SetStrictConditions(false)
+			if _, err := lenient.SetIamPolicy("projects/test", policy()); err != nil {
+				t.Errorf("Expected lenient mode to accept %s, got %v", tt.expression, err)
+			}
+		})
+	}
+}
+
+func TestSetIamPolicy_RejectsUnknownBindingTimezone(t *testing.T) {
+	policy := unsupportedConditionPolicy()
+	policy.Bindings[0].Condition = &expr.Expr{
+		Title:      "Business hours tz=Not/AZone",
+		Expression: `request.time.getHours() < 17`,
+	}
+
+	_, err := NewStorage().SetIamPolicy("projects/test", policy)
+	if !errors.Is(err, ErrUnsupportedCondition) {
+		t.Errorf("Expected ErrUnsupportedCondition, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Package tracebuf provides an in-memory ring buffer of authorization trace
+// events for retrieval over the API at the end of short-lived test runs.
+package tracebuf
+
+import (
+	"sync"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+)
+
+// Buffer holds the most recent trace events up to a fixed capacity, evicting
+// the oldest event when full. A nil *Buffer is valid and discards events.
+type Buffer struct {
+	mu     sync.Mutex
+	events []trace.AuthzEvent
+	start  int
+	count  int
+}
+
+func New(size int) *Buffer {
+	if size <= 0 {
+		return nil
+	}
+	return &Buffer{events: make([]trace.AuthzEvent, size)}
+}
+
+func (b *Buffer) Add(event trace.AuthzEvent) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.count < len(b.events) {
+		b.events[(b.start+b.count)%len(b.events)] = event
+		b.count++
+		return
+	}
+
+	b.events[b.start] = event
+	b.start = (b.start + 1) % len(b.events)
+}
+
+// Events returns the buffered events, oldest first.
+func (b *Buffer) Events() []trace.AuthzEvent {
+	if b == nil {
+		return []trace.AuthzEvent{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.snapshot()
+}
+
+// Drain returns the buffered events, oldest first, and clears the buffer.
+func (b *Buffer) Drain() []trace.AuthzEvent {
+	if b == nil {
+		return []trace.AuthzEvent{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := b.snapshot()
+	b.start = 0
+	b.count = 0
+	return events
+}
+
+func (b *Buffer) snapshot() []trace.AuthzEvent {
+	events := make([]trace.AuthzEvent, b.count)
+	for i := 0; i < b.count; i++ {
+		events[i] = b.events[(b.start+i)%len(b.events)]
+	}
+	return events
+}
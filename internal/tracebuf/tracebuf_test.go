@@ -0,0 +1,62 @@
+package tracebuf
+
+import (
+	"testing"
+
+	"github.com/blackwell-systems/gcp-emulator-auth/pkg/trace"
+)
+
+func event(permission string) trace.AuthzEvent {
+	return trace.AuthzEvent{
+		SchemaVersion: trace.SchemaV1_0,
+		EventType:     trace.EventTypeAuthzCheck,
+		Action:        &trace.Action{Permission: permission},
+	}
+}
+
+func TestBuffer_EvictsOldest(t *testing.T) {
+	b := New(2)
+
+	b.Add(event("a"))
+	b.Add(event("b"))
+	b.Add(event("c"))
+
+	events := b.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	if events[0].Action.Permission != "b" || events[1].Action.Permission != "c" {
+		t.Errorf("Expected [b c], got [%s %s]", events[0].Action.Permission, events[1].Action.Permission)
+	}
+}
+
+func TestBuffer_Drain(t *testing.T) {
+	b := New(4)
+
+	b.Add(event("a"))
+	b.Add(event("b"))
+
+	if events := b.Drain(); len(events) != 2 {
+		t.Fatalf("Expected 2 drained events, got %d", len(events))
+	}
+
+	if events := b.Events(); len(events) != 0 {
+		t.Errorf("Expected empty buffer after drain, got %d events", len(events))
+	}
+
+	b.Add(event("c"))
+	if events := b.Events(); len(events) != 1 || events[0].Action.Permission != "c" {
+		t.Errorf("Expected [c] after refill, got %v", events)
+	}
+}
+
+func TestBuffer_NilIsDisabled(t *testing.T) {
+	var b *Buffer = New(0)
+
+	b.Add(event("a"))
+
+	if events := b.Events(); len(events) != 0 {
+		t.Errorf("Expected nil buffer to discard events, got %d", len(events))
+	}
+}
@@ -0,0 +1,64 @@
+// Package emulatortest runs the IAM emulator in-process for Go tests.
+//
+// The emulator's gRPC services are served over an in-memory bufconn listener,
+// so tests get a ready client connection without opening a TCP port:
+//
+//	srv, conn := emulatortest.New(t)
+//	client := iampb.NewIAMPolicyClient(conn)
+//
+// srv is the emulator itself, for loading policies or changing settings
+// directly. Both are shut down when the test finishes.
+package emulatortest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1"             //nolint:staticcheck // Using standard genproto package
+	credentialspb "google.golang.org/genproto/googleapis/iam/credentials/v1" //nolint:staticcheck // Using standard genproto package
+	iampb "google.golang.org/genproto/googleapis/iam/v1"                     //nolint:staticcheck // Using standard genproto package
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/blackwell-systems/gcp-iam-emulator/internal/server"
+)
+
+const bufSize = 1024 * 1024
+
+// New starts an emulator with default settings and returns it together with
+// a client connection to its IAMPolicy, IAM admin, IAM Credentials and
+// Resource Manager Projects services. The server and connection are closed
+// by tb.Cleanup.
+func New(tb testing.TB) (*server.Server, *grpc.ClientConn) {
+	tb.Helper()
+
+	iamServer := server.NewServer()
+	lis := bufconn.Listen(bufSize)
+
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(iamServer.APIKeyInterceptor()))
+	iampb.RegisterIAMPolicyServer(grpcServer, iamServer)                                                        //nolint:staticcheck // Using standard genproto package
+	adminpb.RegisterIAMServer(grpcServer, server.NewAdminServer(iamServer.GetStorage()))                        //nolint:staticcheck // Using standard genproto package
+	credentialspb.RegisterIAMCredentialsServer(grpcServer, server.NewCredentialsServer(iamServer.GetStorage())) //nolint:staticcheck // Using standard genproto package
+	resourcemanagerpb.RegisterProjectsServer(grpcServer, server.NewProjectsServer(iamServer.GetStorage()))
+	go func() { _ = grpcServer.Serve(lis) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		grpcServer.Stop()
+		tb.Fatalf("Failed to dial in-process emulator: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		conn.Close()
+		grpcServer.Stop()
+		iamServer.Close()
+	})
+
+	return iamServer, conn
+}
@@ -0,0 +1,48 @@
+package emulatortest
+
+import (
+	"context"
+	"testing"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // Using standard genproto package for tests
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNew_SetAndTestPolicy(t *testing.T) {
+	srv, conn := New(t)
+	client := iampb.NewIAMPolicyClient(conn) //nolint:staticcheck // Using standard genproto package for tests
+	ctx := context.Background()
+
+	_, err := client.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: "projects/test/secrets/db-password",
+		Policy: &iampb.Policy{
+			Bindings: []*iampb.Binding{
+				{Role: "roles/secretmanager.secretAccessor", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetIamPolicy failed: %v", err)
+	}
+
+	callCtx := metadata.AppendToOutgoingContext(ctx, "x-emulator-principal", "user:alice@example.com")
+	resp, err := client.TestIamPermissions(callCtx, &iampb.TestIamPermissionsRequest{
+		Resource:    "projects/test/secrets/db-password",
+		Permissions: []string{"secretmanager.versions.access", "secretmanager.secrets.delete"},
+	})
+	if err != nil {
+		t.Fatalf("TestIamPermissions failed: %v", err)
+	}
+	if len(resp.Permissions) != 1 || resp.Permissions[0] != "secretmanager.versions.access" {
+		t.Errorf("Expected only secretmanager.versions.access, got %v", resp.Permissions)
+	}
+
+	// The returned server shares state with the connection
+	policy, err := srv.GetStorage().GetIamPolicy("projects/test/secrets/db-password")
+	if err != nil {
+		t.Fatalf("GetIamPolicy failed: %v", err)
+	}
+	if len(policy.Bindings) != 1 {
+		t.Errorf("Expected the policy set over the connection, got %v", policy.Bindings)
+	}
+}